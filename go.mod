@@ -1,15 +1,16 @@
 module github.com/ThreeDotsLabs/watermill-jetstream
 
-go 1.17
+go 1.23.0
 
 replace github.com/ThreeDotsLabs/watermill => github.com/AlexCuse/watermill v1.2.0-rc.9.0.20220220204212-e3ba4405bc1e
 
 require (
 	github.com/ThreeDotsLabs/watermill v1.2.0-rc.10
 	github.com/google/uuid v1.3.0
-	github.com/nats-io/nats.go v1.13.1-0.20220202232944-a0a6a71ede98
+	github.com/nats-io/nats-server/v2 v2.10.14
+	github.com/nats-io/nats.go v1.42.0
 	github.com/pkg/errors v0.9.1
-	github.com/stretchr/testify v1.7.0
+	github.com/stretchr/testify v1.8.4
 	google.golang.org/protobuf v1.28.0
 )
 
@@ -17,14 +18,18 @@ require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/hashicorp/errwrap v1.0.0 // indirect
 	github.com/hashicorp/go-multierror v1.1.1 // indirect
+	github.com/klauspost/compress v1.18.0 // indirect
 	github.com/kr/pretty v0.1.0 // indirect
 	github.com/lithammer/shortuuid/v3 v3.0.7 // indirect
-	github.com/nats-io/nats-server/v2 v2.6.6 // indirect
-	github.com/nats-io/nkeys v0.3.0 // indirect
+	github.com/minio/highwayhash v1.0.2 // indirect
+	github.com/nats-io/jwt/v2 v2.5.8 // indirect
+	github.com/nats-io/nkeys v0.4.11 // indirect
 	github.com/nats-io/nuid v1.0.1 // indirect
 	github.com/oklog/ulid v1.3.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	golang.org/x/crypto v0.0.0-20210616213533-5ff15b29337e // indirect
+	golang.org/x/crypto v0.37.0 // indirect
+	golang.org/x/sys v0.32.0 // indirect
+	golang.org/x/time v0.5.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
-	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
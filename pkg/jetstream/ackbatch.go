@@ -0,0 +1,157 @@
+package jetstream
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// AckBatchingConfig configures ack pipelining: acks are queued and sent together every Interval (or once MaxPending
+// acks are queued), followed by a single flush of the connection, instead of being written one by one.
+//
+// Ack returns before the ack was sent, so a message acked shortly before a crash may be redelivered.  Users needing
+// an ack confirmed by the server before moving on use AckSync instead, which can not be combined with batching.
+type AckBatchingConfig struct {
+	// Interval is how often queued acks are sent, acks are not batched when it is 0.
+	Interval time.Duration
+
+	// MaxPending sends the queued acks as soon as this many are queued (defaults to 256).
+	MaxPending int
+}
+
+func (c *AckBatchingConfig) setDefaults() {
+	if c.MaxPending <= 0 {
+		c.MaxPending = 256
+	}
+}
+
+// Validate ensures configuration is valid before use
+func (c AckBatchingConfig) Validate() error {
+	if c.Interval < 0 {
+		return errors.New("AckBatchingConfig.Interval can not be negative")
+	}
+
+	return nil
+}
+
+func (c AckBatchingConfig) enabled() bool {
+	return c.Interval > 0
+}
+
+// batchingAcker queues the acks sent through it and sends them in batches, see AckBatchingConfig.
+// Other acknowledgements (AckSync, Nak) are sent right away.
+type batchingAcker struct {
+	msgAcker
+
+	flush  func() error
+	config AckBatchingConfig
+	clock  Clock
+	logger watermill.LoggerAdapter
+
+	pendingLock sync.Mutex
+	pending     []*nats.Msg
+	// stopped is set once close sent the last batch, acks are sent right away afterwards
+	stopped bool
+
+	closeOnce sync.Once
+	closing   chan struct{}
+	closed    chan struct{}
+}
+
+func newBatchingAcker(
+	acker msgAcker,
+	flush func() error,
+	config AckBatchingConfig,
+	clock Clock,
+	logger watermill.LoggerAdapter,
+) *batchingAcker {
+	a := &batchingAcker{
+		msgAcker: acker,
+		flush:    flush,
+		config:   config,
+		clock:    clock,
+		logger:   logger,
+		closing:  make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+
+	go a.run()
+
+	return a
+}
+
+func (a *batchingAcker) Ack(m *nats.Msg) error {
+	a.pendingLock.Lock()
+	if a.stopped {
+		a.pendingLock.Unlock()
+		return a.msgAcker.Ack(m)
+	}
+	a.pending = append(a.pending, m)
+	full := len(a.pending) >= a.config.MaxPending
+	a.pendingLock.Unlock()
+
+	if full {
+		a.sendPending()
+	}
+
+	return nil
+}
+
+func (a *batchingAcker) run() {
+	defer close(a.closed)
+
+	for {
+		wait, stop := after(a.clock, a.config.Interval)
+		select {
+		case <-wait:
+			stop()
+			a.sendPending()
+		case <-a.closing:
+			stop()
+			return
+		}
+	}
+}
+
+// sendPending sends the queued acks and flushes them to the server.
+func (a *batchingAcker) sendPending() {
+	a.pendingLock.Lock()
+	pending := a.pending
+	a.pending = nil
+	a.pendingLock.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+
+	for _, m := range pending {
+		if err := a.msgAcker.Ack(m); err != nil {
+			a.logger.Error("Cannot send ack", err, nil)
+		}
+	}
+
+	if err := a.flush(); err != nil {
+		a.logger.Error("Cannot flush acks", err, watermill.LogFields{"acks": len(pending)})
+		return
+	}
+
+	a.logger.Trace("Acks sent", watermill.LogFields{"acks": len(pending)})
+}
+
+// close stops the batching and sends the acks still queued, acks of messages still in flight (e.g. when outputs did
+// not finish within CloseTimeout) are sent one by one afterwards.
+func (a *batchingAcker) close() {
+	a.closeOnce.Do(func() {
+		close(a.closing)
+		<-a.closed
+
+		a.pendingLock.Lock()
+		a.stopped = true
+		a.pendingLock.Unlock()
+
+		a.sendPending()
+	})
+}
@@ -0,0 +1,155 @@
+package jetstream
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingAcker records the acks and naks sent and the flushes following them.
+type recordingAcker struct {
+	nopAcker
+	lock    sync.Mutex
+	acks    int
+	naks    int
+	flushes int
+}
+
+func (a *recordingAcker) Ack(*nats.Msg) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.acks++
+	return nil
+}
+
+func (a *recordingAcker) Nak(*nats.Msg) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.naks++
+	return nil
+}
+
+func (a *recordingAcker) flush() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.flushes++
+	return nil
+}
+
+func (a *recordingAcker) counts() (acks, naks, flushes int) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.acks, a.naks, a.flushes
+}
+
+func TestBatchingAcker_MaxPending(t *testing.T) {
+	inner := &recordingAcker{}
+	a := newBatchingAcker(inner, inner.flush, AckBatchingConfig{Interval: time.Hour, MaxPending: 3}, RealClock{}, watermill.NopLogger{})
+	defer a.close()
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, a.Ack(&nats.Msg{}))
+	}
+	acks, _, flushes := inner.counts()
+	require.Equal(t, 0, acks)
+	require.Equal(t, 0, flushes)
+
+	// reaching MaxPending sends the queued acks with a single flush
+	require.NoError(t, a.Ack(&nats.Msg{}))
+	acks, _, flushes = inner.counts()
+	require.Equal(t, 3, acks)
+	require.Equal(t, 1, flushes)
+}
+
+func TestBatchingAcker_Interval(t *testing.T) {
+	inner := &recordingAcker{}
+	clock := NewManualClock(time.Now())
+	a := newBatchingAcker(inner, inner.flush, AckBatchingConfig{Interval: time.Minute, MaxPending: 100}, clock, watermill.NopLogger{})
+	defer a.close()
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, a.Ack(&nats.Msg{}))
+	}
+
+	// the interval is measured on the clock of the subscriber
+	require.Eventually(t, func() bool { return clock.Timers() == 1 }, time.Second, time.Millisecond)
+	acks, _, _ := inner.counts()
+	require.Equal(t, 0, acks)
+
+	clock.Advance(time.Minute)
+	require.Eventually(t, func() bool {
+		acks, _, flushes := inner.counts()
+		return acks == 5 && flushes == 1
+	}, time.Second, time.Millisecond)
+}
+
+func TestBatchingAcker_Close(t *testing.T) {
+	inner := &recordingAcker{}
+	a := newBatchingAcker(inner, inner.flush, AckBatchingConfig{Interval: time.Hour, MaxPending: 100}, RealClock{}, watermill.NopLogger{})
+
+	require.NoError(t, a.Ack(&nats.Msg{}))
+
+	// naks are not batched
+	require.NoError(t, a.Nak(&nats.Msg{}))
+	acks, naks, _ := inner.counts()
+	require.Equal(t, 0, acks)
+	require.Equal(t, 1, naks)
+
+	a.close()
+	a.close()
+
+	acks, _, flushes := inner.counts()
+	require.Equal(t, 1, acks)
+	require.Equal(t, 1, flushes)
+
+	// acks of messages still in flight when the subscriber closed are sent right away
+	require.NoError(t, a.Ack(&nats.Msg{}))
+	acks, _, _ = inner.counts()
+	require.Equal(t, 2, acks)
+}
+
+func TestSubscriberSubscriptionConfig_AckBatching(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  SubscriberSubscriptionConfig
+		wantErr bool
+	}{
+		{
+			name:   "batched acks",
+			config: SubscriberSubscriptionConfig{AckBatching: AckBatchingConfig{Interval: time.Millisecond}},
+		},
+		{
+			name:    "negative interval",
+			config:  SubscriberSubscriptionConfig{AckBatching: AckBatchingConfig{Interval: -time.Millisecond}},
+			wantErr: true,
+		},
+		{
+			name:    "with ack sync",
+			config:  SubscriberSubscriptionConfig{AckSync: true, AckBatching: AckBatchingConfig{Interval: time.Millisecond}},
+			wantErr: true,
+		},
+		{
+			name:    "with exactly once",
+			config:  SubscriberSubscriptionConfig{ExactlyOnce: true, AckBatching: AckBatchingConfig{Interval: time.Millisecond}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Unmarshaler = &GobMarshaler{}
+			tt.config.setDefaults()
+
+			err := tt.config.Validate()
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
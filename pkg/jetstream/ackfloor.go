@@ -0,0 +1,142 @@
+package jetstream
+
+import (
+	"context"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/pkg/errors"
+)
+
+// AckFloor is the ack floor of a consumer: every message it received up to StreamSequence was acked or
+// terminated, so the stream can be truncated up to it as far as this consumer is concerned.
+type AckFloor struct {
+	Topic string
+
+	// Partition is the partition of the consumer, nil when partitioning is disabled.
+	Partition *int
+
+	Stream   string
+	Consumer string
+
+	StreamSequence   uint64
+	ConsumerSequence uint64
+}
+
+// AckFloorConfig reports the ack floors of the consumers of Subscribe as they advance, e.g. so downstream
+// systems persist a "safe to truncate" watermark for coordinated retention.  It is disabled unless OnAdvance is set.
+//
+// Ack floors are polled from the server.  Durable consumers shared by several instances report the same ack
+// floor to every instance.
+type AckFloorConfig struct {
+	// OnAdvance is called when the ack floor of a consumer advanced since the last poll, including the first one.
+	OnAdvance func(floor AckFloor)
+
+	// Interval is how often ack floors are polled (defaults to 30 seconds).
+	Interval time.Duration
+}
+
+func (c AckFloorConfig) enabled() bool {
+	return c.OnAdvance != nil
+}
+
+func (c *AckFloorConfig) setDefaults() {
+	if c.Interval == 0 {
+		c.Interval = 30 * time.Second
+	}
+}
+
+// Validate ensures configuration is valid before use
+func (c AckFloorConfig) Validate() error {
+	if c.Interval < 0 {
+		return errors.New("AckFloorConfig.Interval can not be negative")
+	}
+
+	return nil
+}
+
+// AckFloors returns the ack floors of the consumers of the subscription, in partition order.
+// Every call queries the server.
+func (h *SubscriptionHandle) AckFloors(ctx context.Context) ([]AckFloor, error) {
+	floors := make([]AckFloor, 0, len(h.consumers))
+
+	for _, consumer := range h.consumers {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		info, err := consumer.info(ctx, h.js)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot get ack floor of topic %s", h.topic)
+		}
+
+		floors = append(floors, AckFloor{
+			Topic:            h.topic,
+			Partition:        consumer.partition,
+			Stream:           info.Stream,
+			Consumer:         info.Name,
+			StreamSequence:   info.AckFloor.Stream,
+			ConsumerSequence: info.AckFloor.Consumer,
+		})
+	}
+
+	return floors, nil
+}
+
+// AckFloor returns the lowest stream sequence acked by every consumer of the subscription: the stream can be
+// truncated up to it without losing messages the subscription did not handle.  With partitions it is
+// conservative, a partition without new messages holds it back.
+func (h *SubscriptionHandle) AckFloor(ctx context.Context) (uint64, error) {
+	floors, err := h.AckFloors(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var lowest uint64
+	for i, floor := range floors {
+		if i == 0 || floor.StreamSequence < lowest {
+			lowest = floor.StreamSequence
+		}
+	}
+
+	return lowest, nil
+}
+
+// watchAckFloors calls AckFloorConfig.OnAdvance with the ack floors of the consumers of handle which
+// advanced, every Interval until closing or ctx is done.
+func (s *Subscriber) watchAckFloors(ctx context.Context, handle *SubscriptionHandle, logFields watermill.LogFields) {
+	last := make([]uint64, len(handle.consumers))
+
+	for {
+		floors, err := handle.AckFloors(ctx)
+		if err != nil {
+			if ctx.Err() == nil && !s.isClosed() {
+				s.logger.Error("Cannot get ack floors", err, logFields)
+			}
+		}
+
+		for i, floor := range floors {
+			if floor.StreamSequence <= last[i] {
+				continue
+			}
+			last[i] = floor.StreamSequence
+
+			s.logger.Trace("Ack floor advanced", logFields.Add(watermill.LogFields{
+				"consumer":        floor.Consumer,
+				"stream_sequence": floor.StreamSequence,
+			}))
+			s.config.AckFloor.OnAdvance(floor)
+		}
+
+		wait, stop := after(s.config.Clock, s.config.AckFloor.Interval)
+		select {
+		case <-wait:
+		case <-s.closing:
+			stop()
+			return
+		case <-ctx.Done():
+			stop()
+			return
+		}
+	}
+}
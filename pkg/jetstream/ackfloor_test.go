@@ -0,0 +1,91 @@
+package jetstream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+// floorsJetStream returns consumer infos with the ack floors of their consumer.
+type floorsJetStream struct {
+	nats.JetStreamContext
+	floors map[string]uint64
+}
+
+func (js *floorsJetStream) ConsumerInfo(stream, name string, opts ...nats.JSOpt) (*nats.ConsumerInfo, error) {
+	floor, ok := js.floors[name]
+	if !ok {
+		return nil, nats.ErrConsumerNotFound
+	}
+	return &nats.ConsumerInfo{
+		Stream:   stream,
+		Name:     name,
+		AckFloor: nats.SequenceInfo{Stream: floor, Consumer: floor / 2},
+	}, nil
+}
+
+func TestSubscriptionHandle_AckFloor(t *testing.T) {
+	js := &floorsJetStream{floors: map[string]uint64{"orders_0": 40, "orders_1": 25}}
+	partition := 1
+	second := resolvedConsumer("orders_1")
+	second.partition = &partition
+	handle := &SubscriptionHandle{
+		topic:     "orders",
+		js:        js,
+		consumers: []*handleConsumer{resolvedConsumer("orders_0"), second},
+	}
+
+	floors, err := handle.AckFloors(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []AckFloor{
+		{Topic: "orders", Stream: "orders", Consumer: "orders_0", StreamSequence: 40, ConsumerSequence: 20},
+		{Topic: "orders", Partition: &partition, Stream: "orders", Consumer: "orders_1", StreamSequence: 25, ConsumerSequence: 12},
+	}, floors)
+
+	floor, err := handle.AckFloor(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, uint64(25), floor)
+
+	delete(js.floors, "orders_0")
+	_, err = handle.AckFloor(context.Background())
+	require.ErrorIs(t, err, nats.ErrConsumerNotFound)
+}
+
+func TestSubscriber_watchAckFloors(t *testing.T) {
+	js := &floorsJetStream{floors: map[string]uint64{"orders_0": 10}}
+	handle := &SubscriptionHandle{topic: "orders", js: js, consumers: []*handleConsumer{resolvedConsumer("orders_0")}}
+
+	clock := NewManualClock(time.Now())
+	advanced := make(chan AckFloor, 10)
+	s := faultySubscriber(SubscriberSubscriptionConfig{
+		Clock: clock,
+		AckFloor: AckFloorConfig{
+			OnAdvance: func(floor AckFloor) { advanced <- floor },
+		},
+	}, clientDecorator{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.watchAckFloors(ctx, handle, nil)
+	}()
+
+	require.Equal(t, uint64(10), (<-advanced).StreamSequence)
+
+	// an unchanged floor is not reported again
+	require.Eventually(t, func() bool { return clock.Timers() == 1 }, time.Second, time.Millisecond)
+	clock.Advance(30 * time.Second)
+	require.Eventually(t, func() bool { return clock.Timers() == 1 }, time.Second, time.Millisecond)
+	require.Empty(t, advanced)
+
+	js.floors["orders_0"] = 15
+	clock.Advance(30 * time.Second)
+	require.Equal(t, uint64(15), (<-advanced).StreamSequence)
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,245 @@
+package jetstream
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// AdaptiveConcurrencyConfig adjusts the number of messages of a subscription handled concurrently (Subscribe),
+// and the number of messages fetched at once (SubscribeBatch), between Min and Max according to the observed
+// handler latency and the ack pending level of the consumer, instead of tuning MaxInFlight and maxBatch per topic.
+// It is disabled unless TargetLatency is set.
+//
+// Every Interval the limit is halved (down to Min) when the average latency exceeded TargetLatency, or the
+// unacknowledged messages of the consumer reached AckPendingThreshold of its MaxAckPending; otherwise it grows
+// by one (up to Max) when messages were handled.  The limit starts at Max.  The latency is the time from delivery
+// to ack or nack of a message by Subscribe, and of a whole batch by SubscribeBatch.
+type AdaptiveConcurrencyConfig struct {
+	// TargetLatency is the handler latency above which the limit is lowered.
+	TargetLatency time.Duration
+
+	// Min is the lowest limit (defaults to 1).
+	Min int
+
+	// Max is the highest limit (defaults to SubscriberConfig.MaxInFlight), batches are also limited
+	// by the maxBatch of SubscribeBatch.
+	Max int
+
+	// AckPendingThreshold is the fraction of the MaxAckPending of the consumer from which the limit
+	// is lowered (defaults to 0.8), it is ignored for consumers without MaxAckPending.
+	AckPendingThreshold float64
+
+	// Interval is how often the limit is adjusted (defaults to 10 seconds).
+	Interval time.Duration
+}
+
+func (c AdaptiveConcurrencyConfig) enabled() bool {
+	return c.TargetLatency > 0
+}
+
+func (c *AdaptiveConcurrencyConfig) setDefaults() {
+	if c.Min == 0 {
+		c.Min = 1
+	}
+	if c.AckPendingThreshold == 0 {
+		c.AckPendingThreshold = 0.8
+	}
+	if c.Interval == 0 {
+		c.Interval = 10 * time.Second
+	}
+}
+
+// Validate ensures configuration is valid before use
+func (c AdaptiveConcurrencyConfig) Validate() error {
+	if c.TargetLatency < 0 {
+		return errors.New("AdaptiveConcurrencyConfig.TargetLatency can not be negative")
+	}
+	if !c.enabled() {
+		return nil
+	}
+
+	if c.Min < 1 {
+		return errors.New("AdaptiveConcurrencyConfig.Min must be positive")
+	}
+	if c.Max < c.Min {
+		return errors.New("AdaptiveConcurrencyConfig.Max (or SubscriberConfig.MaxInFlight) can not be lower than Min")
+	}
+	if c.AckPendingThreshold <= 0 || c.AckPendingThreshold > 1 {
+		return errors.New("AdaptiveConcurrencyConfig.AckPendingThreshold must be between 0 and 1")
+	}
+	if c.Interval < 0 {
+		return errors.New("AdaptiveConcurrencyConfig.Interval can not be negative")
+	}
+
+	return nil
+}
+
+// adaptiveLimit is a concurrency limit adjusted by the observed latency, used as an in-flight semaphore
+// by Subscribe and as the batch size by SubscribeBatch.
+type adaptiveLimit struct {
+	config   AdaptiveConcurrencyConfig
+	min, max int
+
+	lock     sync.Mutex
+	limit    int
+	inFlight int
+
+	// changed is closed and replaced when a slot is released or the limit changes
+	changed chan struct{}
+
+	latencies time.Duration
+	samples   int
+}
+
+// newAdaptiveLimit returns a limit adjusted between config.Min and max, starting at max.
+func newAdaptiveLimit(config AdaptiveConcurrencyConfig, max int) *adaptiveLimit {
+	min := config.Min
+	if min > max {
+		min = max
+	}
+
+	return &adaptiveLimit{
+		config:  config,
+		min:     min,
+		max:     max,
+		limit:   max,
+		changed: make(chan struct{}),
+	}
+}
+
+func (l *adaptiveLimit) current() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.limit
+}
+
+// acquire blocks until the messages in flight are below the limit, returning false when closing or ctx is done first.
+func (l *adaptiveLimit) acquire(ctx context.Context, closing <-chan struct{}) bool {
+	for {
+		l.lock.Lock()
+		if l.inFlight < l.limit {
+			l.inFlight++
+			l.lock.Unlock()
+			return true
+		}
+		changed := l.changed
+		l.lock.Unlock()
+
+		select {
+		case <-changed:
+		case <-closing:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+func (l *adaptiveLimit) release() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.inFlight--
+	l.notify()
+}
+
+func (l *adaptiveLimit) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// observe records the latency of a message (or batch).
+func (l *adaptiveLimit) observe(latency time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.latencies += latency
+	l.samples++
+}
+
+// adjust updates the limit from the latencies observed since the last adjustment and the ack pending ratio
+// of the consumer, returning the previous limit and the average latency.
+func (l *adaptiveLimit) adjust(ackPendingRatio float64) (previous int, latency time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	previous = l.limit
+	if l.samples > 0 {
+		latency = l.latencies / time.Duration(l.samples)
+	}
+
+	switch {
+	case latency > l.config.TargetLatency || ackPendingRatio >= l.config.AckPendingThreshold:
+		l.limit /= 2
+		if l.limit < l.min {
+			l.limit = l.min
+		}
+	case l.samples > 0 && l.limit < l.max:
+		l.limit++
+		l.notify()
+	}
+
+	l.latencies = 0
+	l.samples = 0
+
+	return previous, latency
+}
+
+// ackPendingRatio returns the highest ratio of unacknowledged messages to MaxAckPending of consumers.
+func ackPendingRatio(infos []*nats.ConsumerInfo) float64 {
+	var ratio float64
+	for _, info := range infos {
+		if info == nil || info.Config.MaxAckPending <= 0 {
+			continue
+		}
+		if r := float64(info.NumAckPending) / float64(info.Config.MaxAckPending); r > ratio {
+			ratio = r
+		}
+	}
+
+	return ratio
+}
+
+// adaptConcurrency adjusts limit every Interval until closing or ctx is done, with the ack pending
+// level of the consumers returned by consumers.
+func (s *Subscriber) adaptConcurrency(
+	ctx context.Context,
+	limit *adaptiveLimit,
+	consumers func() ([]*nats.ConsumerInfo, error),
+	logFields watermill.LogFields,
+) {
+	for {
+		wait, stop := after(s.config.Clock, s.config.AdaptiveConcurrency.Interval)
+		select {
+		case <-wait:
+		case <-s.closing:
+			stop()
+			return
+		case <-ctx.Done():
+			stop()
+			return
+		}
+
+		infos, err := consumers()
+		if err != nil {
+			s.logger.Debug("Cannot get consumer info, ack pending level ignored", logFields.Add(watermill.LogFields{"err": err}))
+		}
+		ratio := ackPendingRatio(infos)
+
+		previous, latency := limit.adjust(ratio)
+		if current := limit.current(); current != previous {
+			s.logger.Debug("Concurrency limit adjusted", logFields.Add(watermill.LogFields{
+				"limit":             current,
+				"previous_limit":    previous,
+				"latency":           latency,
+				"ack_pending_ratio": ratio,
+			}))
+		}
+	}
+}
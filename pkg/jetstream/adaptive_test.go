@@ -0,0 +1,121 @@
+package jetstream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdaptiveLimit_adjust(t *testing.T) {
+	config := AdaptiveConcurrencyConfig{TargetLatency: 100 * time.Millisecond, Max: 8}
+	config.setDefaults()
+	require.NoError(t, config.Validate())
+
+	limit := newAdaptiveLimit(config, config.Max)
+	require.Equal(t, 8, limit.current())
+
+	// slow handlers halve the limit, down to Min
+	limit.observe(300 * time.Millisecond)
+	limit.observe(100 * time.Millisecond)
+	previous, latency := limit.adjust(0)
+	require.Equal(t, 8, previous)
+	require.Equal(t, 200*time.Millisecond, latency)
+	require.Equal(t, 4, limit.current())
+
+	for i := 0; i < 5; i++ {
+		limit.observe(time.Second)
+		limit.adjust(0)
+	}
+	require.Equal(t, 1, limit.current())
+
+	// fast handlers grow the limit by one, up to Max
+	limit.observe(10 * time.Millisecond)
+	limit.adjust(0)
+	require.Equal(t, 2, limit.current())
+
+	// idle subscriptions keep their limit
+	limit.adjust(0)
+	require.Equal(t, 2, limit.current())
+
+	// a consumer close to MaxAckPending lowers the limit even with fast handlers
+	limit.observe(10 * time.Millisecond)
+	limit.adjust(0.9)
+	require.Equal(t, 1, limit.current())
+
+	for i := 0; i < 20; i++ {
+		limit.observe(10 * time.Millisecond)
+		limit.adjust(0.1)
+	}
+	require.Equal(t, 8, limit.current())
+}
+
+func TestAdaptiveLimit_acquire(t *testing.T) {
+	config := AdaptiveConcurrencyConfig{TargetLatency: time.Millisecond, Max: 2}
+	config.setDefaults()
+
+	limit := newAdaptiveLimit(config, config.Max)
+	limit.observe(time.Second)
+	limit.adjust(0)
+	require.Equal(t, 1, limit.current())
+
+	closing := make(chan struct{})
+	require.True(t, limit.acquire(context.Background(), closing))
+
+	acquired := make(chan bool)
+	go func() {
+		acquired <- limit.acquire(context.Background(), closing)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("acquired above the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// raising the limit frees a slot
+	limit.observe(0)
+	limit.adjust(0)
+	require.True(t, <-acquired)
+
+	go func() {
+		acquired <- limit.acquire(context.Background(), closing)
+	}()
+	close(closing)
+	require.False(t, <-acquired)
+
+	limit.release()
+	require.True(t, limit.acquire(context.Background(), make(chan struct{})))
+}
+
+func TestAckPendingRatio(t *testing.T) {
+	require.Zero(t, ackPendingRatio(nil))
+	require.Equal(t, 0.5, ackPendingRatio([]*nats.ConsumerInfo{
+		{NumAckPending: 10, Config: nats.ConsumerConfig{MaxAckPending: 100}},
+		{NumAckPending: 50, Config: nats.ConsumerConfig{MaxAckPending: 100}},
+		{NumAckPending: 1000, Config: nats.ConsumerConfig{MaxAckPending: -1}},
+		nil,
+	}))
+}
+
+func TestAdaptiveConcurrencyConfig_defaults(t *testing.T) {
+	config := SubscriberSubscriptionConfig{
+		Unmarshaler:         &GobMarshaler{},
+		MaxInFlight:         16,
+		AdaptiveConcurrency: AdaptiveConcurrencyConfig{TargetLatency: time.Second},
+	}
+	config.setDefaults()
+	require.NoError(t, config.Validate())
+	require.Equal(t, 16, config.AdaptiveConcurrency.Max)
+	require.Equal(t, 1, config.AdaptiveConcurrency.Min)
+
+	config.MaxInFlight = 0
+	config.AdaptiveConcurrency.Max = 0
+	require.Error(t, config.Validate())
+
+	// disabled without TargetLatency
+	config.AdaptiveConcurrency.TargetLatency = 0
+	require.NoError(t, config.Validate())
+}
@@ -0,0 +1,189 @@
+package jetstream
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+const (
+	// AdvisoryAPISubject is the subject JetStream publishes API audit advisories on.
+	AdvisoryAPISubject = "$JS.EVENT.ADVISORY.API"
+
+	// AdvisoryConsumerSubject matches all consumer related advisories (max deliveries, terminated messages, etc.).
+	AdvisoryConsumerSubject = "$JS.EVENT.ADVISORY.CONSUMER.>"
+)
+
+// AdvisoryHandler is a function called for every advisory received by an AdvisoryListener.
+type AdvisoryHandler func(advisory *Advisory)
+
+// Advisory is a JetStream advisory event.
+type Advisory struct {
+	// Subject is the NATS subject the advisory was received on.
+	Subject string `json:"-"`
+
+	// Type is the advisory schema type, for example io.nats.jetstream.advisory.v1.api_audit
+	Type string `json:"type"`
+
+	// ID is the unique advisory id.
+	ID string `json:"id"`
+
+	// Timestamp is the time the advisory was emitted by the server.
+	Timestamp time.Time `json:"timestamp"`
+
+	// Stream is the stream the advisory relates to (consumer advisories only).
+	Stream string `json:"stream,omitempty"`
+
+	// Consumer is the consumer the advisory relates to (consumer advisories only).
+	Consumer string `json:"consumer,omitempty"`
+
+	// APISubject is the JetStream API subject that was called (API advisories only).
+	APISubject string `json:"subject,omitempty"`
+
+	// Request is the raw API request (API advisories only).
+	Request string `json:"request,omitempty"`
+
+	// Response is the raw API response (API advisories only).
+	Response string `json:"response,omitempty"`
+
+	// Data is the raw advisory payload.
+	Data []byte `json:"-"`
+}
+
+type advisoryAPIResponse struct {
+	Error *struct {
+		Code        int    `json:"code"`
+		ErrCode     int    `json:"err_code"`
+		Description string `json:"description"`
+	} `json:"error,omitempty"`
+}
+
+// Err returns the error carried by the API response of an API advisory, or nil when the call succeeded.
+func (a *Advisory) Err() error {
+	if a.Response == "" {
+		return nil
+	}
+
+	var resp advisoryAPIResponse
+	if err := json.Unmarshal([]byte(a.Response), &resp); err != nil {
+		return nil
+	}
+
+	if resp.Error == nil {
+		return nil
+	}
+
+	return errors.Errorf("jetstream api error %d (%d): %s", resp.Error.Code, resp.Error.ErrCode, resp.Error.Description)
+}
+
+// AdvisoryListenerConfig is the configuration to create an advisory listener
+type AdvisoryListenerConfig struct {
+	// Subjects are the advisory subjects to listen on (defaults to AdvisoryAPISubject and AdvisoryConsumerSubject)
+	Subjects []string
+
+	// Handler is called for every advisory received, after it has been logged.
+	Handler AdvisoryHandler
+}
+
+func (c *AdvisoryListenerConfig) setDefaults() {
+	if len(c.Subjects) == 0 {
+		c.Subjects = []string{AdvisoryAPISubject, AdvisoryConsumerSubject}
+	}
+}
+
+// AdvisoryListener forwards JetStream advisories to the logger and an optional handler,
+// so misconfigurations (e.g. consumer create failures from other instances) surface in application logs.
+type AdvisoryListener struct {
+	config AdvisoryListenerConfig
+	logger watermill.LoggerAdapter
+
+	subsLock sync.Mutex
+	subs     []*nats.Subscription
+	closed   bool
+}
+
+// NewAdvisoryListener creates a new AdvisoryListener on the provided nats connection.
+// The connection is not closed when the listener is closed.
+func NewAdvisoryListener(conn *nats.Conn, config AdvisoryListenerConfig, logger watermill.LoggerAdapter) (*AdvisoryListener, error) {
+	config.setDefaults()
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	l := &AdvisoryListener{
+		config: config,
+		logger: logger,
+	}
+
+	for _, subject := range config.Subjects {
+		sub, err := conn.Subscribe(subject, l.handleMsg)
+		if err != nil {
+			_ = l.Close()
+			return nil, errors.Wrapf(err, "cannot subscribe to advisory subject %s", subject)
+		}
+		l.subs = append(l.subs, sub)
+	}
+
+	return l, nil
+}
+
+func (l *AdvisoryListener) handleMsg(m *nats.Msg) {
+	advisory := &Advisory{}
+	if err := json.Unmarshal(m.Data, advisory); err != nil {
+		l.logger.Error("Cannot decode advisory", err, watermill.LogFields{"subject": m.Subject})
+		return
+	}
+	advisory.Subject = m.Subject
+	advisory.Data = m.Data
+
+	logFields := watermill.LogFields{
+		"advisory_type": advisory.Type,
+		"subject":       m.Subject,
+	}
+	if advisory.Stream != "" {
+		logFields["stream"] = advisory.Stream
+	}
+	if advisory.Consumer != "" {
+		logFields["consumer"] = advisory.Consumer
+	}
+	if advisory.APISubject != "" {
+		logFields["api_subject"] = advisory.APISubject
+	}
+
+	if err := advisory.Err(); err != nil {
+		l.logger.Error("JetStream API error advisory", err, logFields)
+	} else if advisory.APISubject != "" {
+		l.logger.Trace("JetStream API advisory", logFields)
+	} else {
+		l.logger.Info("JetStream advisory", logFields)
+	}
+
+	if l.config.Handler != nil {
+		l.config.Handler(advisory)
+	}
+}
+
+// Close unsubscribes from all advisory subjects.
+func (l *AdvisoryListener) Close() error {
+	l.subsLock.Lock()
+	defer l.subsLock.Unlock()
+
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+
+	var err error
+	for _, sub := range l.subs {
+		if unsubErr := sub.Unsubscribe(); unsubErr != nil && err == nil {
+			err = errors.Wrap(unsubErr, "cannot unsubscribe from advisories")
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,57 @@
+package jetstream
+
+import (
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdvisory_Err(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		wantErr  bool
+	}{
+		{name: "No Response", response: "", wantErr: false},
+		{name: "Success", response: `{"type":"io.nats.jetstream.api.v1.consumer_create_response"}`, wantErr: false},
+		{name: "Error", response: `{"type":"io.nats.jetstream.api.v1.consumer_create_response","error":{"code":400,"err_code":10013,"description":"consumer name already in use"}}`, wantErr: true},
+		{name: "Invalid Response", response: `not json`, wantErr: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Advisory{Response: tt.response}
+
+			if tt.wantErr {
+				require.Error(t, a.Err())
+			} else {
+				require.NoError(t, a.Err())
+			}
+		})
+	}
+}
+
+func TestAdvisoryListener_handleMsg(t *testing.T) {
+	var received *Advisory
+
+	l := &AdvisoryListener{
+		config: AdvisoryListenerConfig{
+			Handler: func(advisory *Advisory) {
+				received = advisory
+			},
+		},
+		logger: watermill.NopLogger{},
+	}
+
+	l.handleMsg(&nats.Msg{
+		Subject: "$JS.EVENT.ADVISORY.CONSUMER.MAX_DELIVERIES.stream.consumer",
+		Data:    []byte(`{"type":"io.nats.jetstream.advisory.v1.max_deliver","id":"abc","stream":"stream","consumer":"consumer"}`),
+	})
+
+	require.NotNil(t, received)
+	require.Equal(t, "io.nats.jetstream.advisory.v1.max_deliver", received.Type)
+	require.Equal(t, "stream", received.Stream)
+	require.Equal(t, "consumer", received.Consumer)
+	require.Equal(t, "$JS.EVENT.ADVISORY.CONSUMER.MAX_DELIVERIES.stream.consumer", received.Subject)
+}
@@ -0,0 +1,212 @@
+package jetstream
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// AuditOutcome is what happened to an audited message.
+type AuditOutcome string
+
+const (
+	// AuditOutcomePublished is recorded when JetStream acknowledged a published message.
+	AuditOutcomePublished AuditOutcome = "published"
+
+	// AuditOutcomePublishFailed is recorded when publishing a message failed.
+	AuditOutcomePublishFailed AuditOutcome = "publish_failed"
+
+	// AuditOutcomeAck is recorded when a received message is acked.
+	AuditOutcomeAck AuditOutcome = "ack"
+
+	// AuditOutcomeNak is recorded when a received message is nacked, with or without delay.
+	AuditOutcomeNak AuditOutcome = "nak"
+
+	// AuditOutcomeTerm is recorded when a received message is terminated.
+	AuditOutcomeTerm AuditOutcome = "term"
+)
+
+// AuditRecord is the record published to the audit subject, encoded as JSON.
+type AuditRecord struct {
+	// UUID is the watermill UUID of the message.  Received messages carry it in the WatermillUUIDHdr header
+	// (set by NATSMarshaler) or in the Nats-Msg-Id header (set with TrackMsgId), it is empty otherwise.
+	UUID string `json:"uuid,omitempty"`
+
+	// Topic is the topic a message was published to, or the subject a received message was delivered on.
+	Topic string `json:"topic"`
+
+	// Sequence is the stream sequence of the message, zero when publishing failed.
+	Sequence uint64 `json:"sequence,omitempty"`
+
+	Outcome AuditOutcome `json:"outcome"`
+
+	// Latency is the round trip of a publish, or the time from storing a received message until it was settled.
+	Latency time.Duration `json:"latency"`
+
+	// Error is the error of a failed publish, ack or nak.
+	Error string `json:"error,omitempty"`
+
+	Time time.Time `json:"time"`
+
+	// PrevHash is the hex SHA-256 of the previous record published by the same publisher or subscriber,
+	// chaining records so a removed or altered record breaks the chain.  It is empty for the first record.
+	PrevHash string `json:"prev_hash,omitempty"`
+}
+
+// AuditConfig tees a compact record of every publish and every ack, nak and term to an audit subject,
+// for environments which need a processing log.  It is disabled unless Subject is set.
+//
+// Records are published synchronously and in order, so auditing adds a round trip to every publish and ack.
+// Failing to publish a record is logged and does not fail the audited operation.  The stream capturing
+// Subject is not provisioned, it should be created with DenyDelete and DenyPurge to keep the log tamper-evident.
+type AuditConfig struct {
+	// Subject is the NATS subject audit records are published to, it must be captured by a stream.
+	Subject string
+}
+
+func (c AuditConfig) enabled() bool {
+	return c.Subject != ""
+}
+
+// Validate ensures configuration is valid before use
+func (c AuditConfig) Validate() error {
+	if !c.enabled() {
+		return nil
+	}
+
+	if strings.ContainsAny(c.Subject, "*> \t") {
+		return errors.New("AuditConfig.Subject can not contain wildcards or whitespace")
+	}
+
+	return nil
+}
+
+// auditor publishes the audit records of a publisher or subscriber, chaining them by hash.
+type auditor struct {
+	subject string
+	js      nats.JetStream
+	logger  watermill.LoggerAdapter
+
+	// lock keeps records published in the order of the hash chain
+	lock     sync.Mutex
+	prevHash string
+}
+
+func newAuditor(config AuditConfig, js nats.JetStream, logger watermill.LoggerAdapter) *auditor {
+	return &auditor{
+		subject: config.Subject,
+		js:      js,
+		logger:  logger,
+	}
+}
+
+// record publishes record to the audit subject.
+func (a *auditor) record(record AuditRecord) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	record.PrevHash = a.prevHash
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		a.logger.Error("Cannot marshal audit record", err, watermill.LogFields{"message_uuid": record.UUID})
+		return
+	}
+
+	if _, err := a.js.PublishMsg(&nats.Msg{Subject: a.subject, Data: data}); err != nil {
+		a.logger.Error("Cannot publish audit record", err, watermill.LogFields{
+			"message_uuid": record.UUID,
+			"outcome":      record.Outcome,
+		})
+		return
+	}
+
+	hash := sha256.Sum256(data)
+	a.prevHash = hex.EncodeToString(hash[:])
+}
+
+// recordPublish records a publish of the message uuid to topic started at start.
+func (a *auditor) recordPublish(uuid, topic string, ack *nats.PubAck, start time.Time, err error) {
+	record := AuditRecord{
+		UUID:    uuid,
+		Topic:   topic,
+		Outcome: AuditOutcomePublished,
+		Latency: time.Since(start),
+		Time:    time.Now(),
+	}
+	if err != nil {
+		record.Outcome = AuditOutcomePublishFailed
+		record.Error = err.Error()
+	} else if ack != nil {
+		record.Sequence = ack.Sequence
+	}
+
+	a.record(record)
+}
+
+// recordSettle records m being settled with outcome.
+func (a *auditor) recordSettle(m *nats.Msg, outcome AuditOutcome, err error) {
+	now := time.Now()
+
+	record := AuditRecord{
+		UUID:    m.Header.Get(WatermillUUIDHdr),
+		Topic:   m.Subject,
+		Outcome: outcome,
+		Time:    now,
+	}
+	if record.UUID == "" {
+		record.UUID = m.Header.Get(nats.MsgIdHdr)
+	}
+	if meta, metaErr := m.Metadata(); metaErr == nil {
+		record.Sequence = meta.Sequence.Stream
+		record.Latency = now.Sub(meta.Timestamp)
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	a.record(record)
+}
+
+// auditAcker records the acks, naks and terms of the wrapped acker.
+type auditAcker struct {
+	msgAcker
+	auditor *auditor
+}
+
+func (a auditAcker) Ack(m *nats.Msg) error {
+	err := a.msgAcker.Ack(m)
+	a.auditor.recordSettle(m, AuditOutcomeAck, err)
+	return err
+}
+
+func (a auditAcker) AckSync(m *nats.Msg) error {
+	err := a.msgAcker.AckSync(m)
+	a.auditor.recordSettle(m, AuditOutcomeAck, err)
+	return err
+}
+
+func (a auditAcker) Nak(m *nats.Msg) error {
+	err := a.msgAcker.Nak(m)
+	a.auditor.recordSettle(m, AuditOutcomeNak, err)
+	return err
+}
+
+func (a auditAcker) NakWithDelay(m *nats.Msg, delay time.Duration) error {
+	err := a.msgAcker.NakWithDelay(m, delay)
+	a.auditor.recordSettle(m, AuditOutcomeNak, err)
+	return err
+}
+
+func (a auditAcker) Term(m *nats.Msg) error {
+	err := a.msgAcker.Term(m)
+	a.auditor.recordSettle(m, AuditOutcomeTerm, err)
+	return err
+}
@@ -0,0 +1,88 @@
+package jetstream
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func auditRecords(t *testing.T, published []*nats.Msg) []AuditRecord {
+	var records []AuditRecord
+	for _, m := range published {
+		if m.Subject != "audit" {
+			continue
+		}
+		var record AuditRecord
+		require.NoError(t, json.Unmarshal(m.Data, &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestAuditConfig_Validate(t *testing.T) {
+	require.NoError(t, AuditConfig{}.Validate())
+	require.NoError(t, AuditConfig{Subject: "audit.orders"}.Validate())
+	require.Error(t, AuditConfig{Subject: "audit.*"}.Validate())
+	require.Error(t, AuditConfig{Subject: "audit.>"}.Validate())
+}
+
+func TestPublisher_Audit(t *testing.T) {
+	js := &faultyJetStream{}
+	p := &Publisher{
+		config: PublisherPublishConfig{Marshaler: &GobMarshaler{}},
+		logger: watermill.NopLogger{},
+	}
+	p.decorateClient(clientDecorator{
+		jetStream: func(nats.JetStream) nats.JetStream { return js },
+	})
+	p.auditor = newAuditor(AuditConfig{Subject: "audit"}, p.js, p.logger)
+
+	first := message.NewMessage(watermill.NewUUID(), nil)
+	second := message.NewMessage(watermill.NewUUID(), nil)
+	require.NoError(t, p.Publish("orders", first, second))
+	require.Len(t, js.published, 4)
+
+	records := auditRecords(t, js.published)
+	require.Len(t, records, 2)
+
+	require.Equal(t, first.UUID, records[0].UUID)
+	require.Equal(t, "orders", records[0].Topic)
+	require.Equal(t, AuditOutcomePublished, records[0].Outcome)
+	require.Empty(t, records[0].PrevHash)
+
+	hash := sha256.Sum256(js.published[1].Data)
+	require.Equal(t, second.UUID, records[1].UUID)
+	require.Equal(t, hex.EncodeToString(hash[:]), records[1].PrevHash)
+}
+
+func TestSubscriber_AuditAcker(t *testing.T) {
+	js := &faultyJetStream{}
+	acker := auditAcker{
+		msgAcker: nopAcker{},
+		auditor:  newAuditor(AuditConfig{Subject: "audit"}, js, watermill.NopLogger{}),
+	}
+
+	m := storedMsg(time.Now().Add(-time.Second), nats.Header{WatermillUUIDHdr: []string{"uuid"}})
+
+	require.NoError(t, acker.NakWithDelay(m, time.Second))
+	require.NoError(t, acker.Ack(m))
+	require.NoError(t, acker.Term(m))
+
+	records := auditRecords(t, js.published)
+	require.Len(t, records, 3)
+
+	for i, outcome := range []AuditOutcome{AuditOutcomeNak, AuditOutcomeAck, AuditOutcomeTerm} {
+		require.Equal(t, outcome, records[i].Outcome)
+		require.Equal(t, "uuid", records[i].UUID)
+		require.Equal(t, "topic.uuid", records[i].Topic)
+		require.Equal(t, uint64(10), records[i].Sequence)
+		require.GreaterOrEqual(t, records[i].Latency, time.Second)
+	}
+}
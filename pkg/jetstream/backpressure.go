@@ -0,0 +1,126 @@
+package jetstream
+
+import (
+	"context"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// BackpressurePolicy decides what happens to a received message while the consumer is not ready to take it.
+type BackpressurePolicy int
+
+const (
+	// BackpressureBlock blocks the NATS callback until the consumer takes the message.
+	BackpressureBlock BackpressurePolicy = iota
+
+	// BackpressureNak naks the message when the consumer did not take it within Timeout, so it is redelivered later.
+	BackpressureNak
+
+	// BackpressureBuffer queues messages in a bounded buffer, naking messages received while the buffer is full.
+	// Buffered messages count against AckWaitTimeout, so the buffer should stay small relative to the processing rate.
+	BackpressureBuffer
+)
+
+func (p BackpressurePolicy) String() string {
+	switch p {
+	case BackpressureBlock:
+		return "block"
+	case BackpressureNak:
+		return "nak"
+	case BackpressureBuffer:
+		return "buffer"
+	default:
+		return "unknown"
+	}
+}
+
+// BackpressureConfig configures how a subscription handles a slow consumer.
+type BackpressureConfig struct {
+	// Policy is the backpressure policy (defaults to BackpressureBlock).
+	Policy BackpressurePolicy
+
+	// Timeout is how long BackpressureNak waits for the consumer (defaults to 5 seconds).
+	Timeout time.Duration
+
+	// BufferSize is the number of messages BackpressureBuffer queues per subscription (defaults to 64).
+	BufferSize int
+}
+
+func (c *BackpressureConfig) setDefaults() {
+	if c.Timeout <= 0 {
+		c.Timeout = 5 * time.Second
+	}
+	if c.BufferSize <= 0 {
+		c.BufferSize = 64
+	}
+}
+
+// Validate ensures configuration is valid before use
+func (c BackpressureConfig) Validate() error {
+	if c.Policy < BackpressureBlock || c.Policy > BackpressureBuffer {
+		return errors.Errorf("unknown backpressure policy %d", c.Policy)
+	}
+
+	return nil
+}
+
+// backpressureConfig returns the backpressure configuration of a subscription, see WithBackpressure.
+func (s *Subscriber) backpressureConfig(ctx context.Context) BackpressureConfig {
+	config, ok := BackpressureFromCtx(ctx)
+	if !ok {
+		return s.config.Backpressure
+	}
+
+	config.setDefaults()
+
+	return config
+}
+
+// deliverTimeout returns the channel signalling that the consumer did not take a message in time, nil when delivery blocks.
+func (c BackpressureConfig) deliverTimeout(clock Clock) (<-chan time.Time, func()) {
+	if c.Policy != BackpressureNak {
+		return nil, func() {}
+	}
+
+	return after(clock, c.Timeout)
+}
+
+// bufferedHandler returns a NATS callback queueing messages for a worker passing them to process.
+func (s *Subscriber) bufferedHandler(
+	ctx context.Context,
+	process nats.MsgHandler,
+	size int,
+	logFields watermill.LogFields,
+	done func(),
+) nats.MsgHandler {
+	buffer := make(chan *nats.Msg, size)
+
+	go func() {
+		defer done()
+
+		for {
+			select {
+			case m := <-buffer:
+				process(m)
+			case <-s.closing:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func(m *nats.Msg) {
+		select {
+		case buffer <- m:
+		default:
+			s.logger.Debug("Buffer full, message nacked", logFields)
+			if err := s.acker.Nak(m); err != nil {
+				s.logger.Error("Cannot send nak", err, logFields)
+			}
+		}
+	}
+}
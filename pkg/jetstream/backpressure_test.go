@@ -0,0 +1,36 @@
+package jetstream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackpressureConfig_Validate(t *testing.T) {
+	require.NoError(t, BackpressureConfig{}.Validate())
+	require.NoError(t, BackpressureConfig{Policy: BackpressureBuffer}.Validate())
+	require.Error(t, BackpressureConfig{Policy: BackpressurePolicy(42)}.Validate())
+}
+
+func TestSubscriber_BackpressureConfig(t *testing.T) {
+	config := SubscriberSubscriptionConfig{}
+	config.setDefaults()
+	s := &Subscriber{config: config}
+
+	bp := s.backpressureConfig(context.Background())
+	require.Equal(t, BackpressureBlock, bp.Policy)
+
+	timeout, stop := bp.deliverTimeout(s.config.Clock)
+	defer stop()
+	require.Nil(t, timeout)
+
+	bp = s.backpressureConfig(WithBackpressure(context.Background(), BackpressureConfig{Policy: BackpressureNak}))
+	require.Equal(t, BackpressureNak, bp.Policy)
+	require.Equal(t, 5*time.Second, bp.Timeout)
+
+	timeout, stop = bp.deliverTimeout(s.config.Clock)
+	defer stop()
+	require.NotNil(t, timeout)
+}
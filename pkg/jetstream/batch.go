@@ -0,0 +1,440 @@
+package jetstream
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// BatchSubscriber delivers messages in batches, e.g. for consumers doing bulk inserts.
+type BatchSubscriber interface {
+	// SubscribeBatch delivers batches of up to maxBatch messages of topic, waiting at most maxWait to fill a batch.
+	SubscribeBatch(ctx context.Context, topic string, maxBatch int, maxWait time.Duration) (<-chan []*message.Message, error)
+}
+
+var _ BatchSubscriber = (*Subscriber)(nil)
+
+// BatchAckMode decides how the messages of a batch are acked.
+type BatchAckMode int
+
+const (
+	// BatchAckPerMessage acks or nacks every message of a batch on its own.
+	BatchAckPerMessage BatchAckMode = iota
+
+	// BatchAckAll acks a batch once all of its messages are acked, a single nacked message nacks the whole batch.
+	BatchAckAll
+)
+
+// PullConsumerConfig limits the fetch requests a pull consumer accepts, protecting the server from abusive fetch
+// patterns.  Limits are only applied when the consumer is created, zero values leave the server defaults.
+type PullConsumerConfig struct {
+	// MaxWaiting is the maximum number of fetch requests waiting for messages at the same time.
+	MaxWaiting int
+
+	// MaxRequestBatch is the maximum number of messages a single fetch request can ask for.
+	MaxRequestBatch int
+
+	// MaxRequestExpires is the maximum time a single fetch request can wait for messages.
+	MaxRequestExpires time.Duration
+}
+
+// Validate ensures configuration is valid before use
+func (c PullConsumerConfig) Validate() error {
+	var errs ConfigErrors
+
+	if c.MaxWaiting < 0 {
+		errs.add("MaxWaiting", "can not be negative")
+	}
+	if c.MaxRequestBatch < 0 {
+		errs.add("MaxRequestBatch", "can not be negative")
+	}
+	if c.MaxRequestExpires < 0 {
+		errs.add("MaxRequestExpires", "can not be negative")
+	}
+
+	return errs.err()
+}
+
+// subOpts returns the options applying the limits to a pull consumer.
+func (c PullConsumerConfig) subOpts() []nats.SubOpt {
+	var opts []nats.SubOpt
+
+	if c.MaxWaiting > 0 {
+		opts = append(opts, nats.PullMaxWaiting(c.MaxWaiting))
+	}
+	if c.MaxRequestBatch > 0 {
+		opts = append(opts, nats.MaxRequestBatch(c.MaxRequestBatch))
+	}
+	if c.MaxRequestExpires > 0 {
+		opts = append(opts, nats.MaxRequestExpires(c.MaxRequestExpires))
+	}
+
+	return opts
+}
+
+// checkFetch ensures fetch requests of maxBatch messages waiting maxWait are within the limits.
+func (c PullConsumerConfig) checkFetch(maxBatch int, maxWait time.Duration) error {
+	if c.MaxRequestBatch > 0 && maxBatch > c.MaxRequestBatch {
+		return errors.Errorf("maxBatch %d exceeds SubscriberConfig.PullConsumer.MaxRequestBatch %d", maxBatch, c.MaxRequestBatch)
+	}
+	if c.MaxRequestExpires > 0 && maxWait > c.MaxRequestExpires {
+		return errors.Errorf("maxWait %s exceeds SubscriberConfig.PullConsumer.MaxRequestExpires %s", maxWait, c.MaxRequestExpires)
+	}
+
+	return nil
+}
+
+// batchResult is the outcome of a message of a batch.
+type batchResult struct {
+	index int
+	acked bool
+}
+
+// SubscribeBatch delivers batches of up to maxBatch messages of topic through a pull consumer, waiting at most
+// maxWait to fill a batch.  Every fetcher (see SubscriberConfig.PullFetchers) fetches its next batch once every
+// message of its current one was acked or nacked, or AckWaitTimeout elapsed; messages are acked according to BatchAckMode.
+//
+// Pull consumers need a DurableName, which can not be shared with push subscriptions of the same topic.
+// The pull subscriptions are removed once ctx is done or the subscriber is closed, the consumer is kept.
+func (s *Subscriber) SubscribeBatch(ctx context.Context, topic string, maxBatch int, maxWait time.Duration) (<-chan []*message.Message, error) {
+	if s.config.DurableName == "" {
+		return nil, errors.New("batch subscriptions require SubscriberConfig.DurableName")
+	}
+	if maxBatch < 1 {
+		return nil, errors.New("maxBatch must be positive")
+	}
+	if maxWait <= 0 {
+		return nil, errors.New("maxWait must be positive")
+	}
+	if err := s.config.PullConsumer.checkFetch(maxBatch, maxWait); err != nil {
+		return nil, err
+	}
+
+	topic, err := sanitizeTopic(topic, s.config.TopicSanitizer, s.config.EscapeTopics, s.config.AutoProvision)
+	if err != nil {
+		return nil, err
+	}
+	ctx = withTopic(ctx, topic)
+
+	if s.config.AutoProvision {
+		if err := s.SubscribeInitialize(topic); err != nil {
+			return nil, err
+		}
+	}
+
+	logFields := subscriptionLogFields(ctx, watermill.LogFields{
+		"topic":     topic,
+		"max_batch": maxBatch,
+	})
+
+	// every fetcher pulls from its own subscription bound to the shared durable consumer, fetches of a single
+	// subscription would share its inbox and steal each other's messages
+	timeouts := s.subscriptionTimeouts(ctx, topic)
+	if err := timeouts.Validate(); err != nil {
+		return nil, err
+	}
+	ackWait := timeouts.ackWait(s.config.AckWaitTimeout)
+
+	opts := append(append([]nats.SubOpt{}, s.config.SubscribeOptions...), nats.AckWait(s.config.consumerAckWait(ackWait)))
+	opts = append(opts, s.config.PullConsumer.subOpts()...)
+
+	if s.config.RequireExistingStream {
+		if err := s.topicInterpreter.requireStream(topic); err != nil {
+			return nil, err
+		}
+		opts = append(opts, nats.Bind(s.topicInterpreter.streamName(topic), s.topicInterpreter.durableName(s.config.DurableName, topic)))
+	} else if s.config.StreamNameCalculator != nil {
+		opts = append(opts, nats.BindStream(s.topicInterpreter.streamName(topic)))
+	}
+
+	subs := make([]*nats.Subscription, s.config.PullFetchers)
+	for i := range subs {
+		sub, err := s.js.PullSubscribe(
+			s.topicInterpreter.subjects(topic).Primary,
+			s.topicInterpreter.durableName(s.config.DurableName, topic),
+			opts...,
+		)
+		if err != nil {
+			s.detachPullSubscriptions(subs[:i], logFields)
+			return nil, errors.Wrap(err, "cannot create pull consumer")
+		}
+		subs[i] = sub
+	}
+
+	output := make(chan []*message.Message)
+
+	fetchersWg := &sync.WaitGroup{}
+	fetchersWg.Add(len(subs))
+
+	var adaptive *adaptiveLimit
+	if s.config.AdaptiveConcurrency.enabled() {
+		max := s.config.AdaptiveConcurrency.Max
+		if max > maxBatch {
+			max = maxBatch
+		}
+		adaptive = newAdaptiveLimit(s.config.AdaptiveConcurrency, max)
+
+		fetchersWg.Add(1)
+		go func() {
+			defer fetchersWg.Done()
+			s.adaptConcurrency(ctx, adaptive, func() ([]*nats.ConsumerInfo, error) {
+				info, err := subs[0].ConsumerInfo()
+				return []*nats.ConsumerInfo{info}, err
+			}, logFields)
+		}()
+	}
+
+	for i, sub := range subs {
+		go func(sub *nats.Subscription, logFields watermill.LogFields) {
+			defer fetchersWg.Done()
+			s.fetchBatches(ctx, topic, sub, maxBatch, maxWait, ackWait, adaptive, output, logFields)
+		}(sub, logFields.Add(watermill.LogFields{"fetcher_num": i}))
+	}
+
+	s.outputsWg.Add(1)
+	go func() {
+		defer s.outputsWg.Done()
+		fetchersWg.Wait()
+		s.detachPullSubscriptions(subs, logFields)
+		close(output)
+	}()
+
+	return output, nil
+}
+
+// detachPullSubscriptions removes the subscriptions of SubscribeBatch from the connection once their fetchers
+// stopped.  They are detached rather than unsubscribed, which would delete the durable consumer when the NATS
+// client created it.
+func (s *Subscriber) detachPullSubscriptions(subs []*nats.Subscription, logFields watermill.LogFields) {
+	for _, sub := range subs {
+		err := detachSubscription(sub)
+		if err != nil && !errors.Is(err, nats.ErrConnectionClosed) && !errors.Is(err, nats.ErrBadSubscription) {
+			s.logger.Error("Cannot detach pull subscription", err, logFields)
+		}
+	}
+}
+
+// fetchBatches fetches batches from sub and delivers them to output until closing or ctx is done.
+// Once the intake is stopped it stops fetching, keeping output open until closing or ctx is done.
+func (s *Subscriber) fetchBatches(
+	ctx context.Context,
+	topic string,
+	sub *nats.Subscription,
+	maxBatch int,
+	maxWait time.Duration,
+	ackWait time.Duration,
+	adaptive *adaptiveLimit,
+	output chan []*message.Message,
+	logFields watermill.LogFields,
+) {
+	s.logger.Debug("Starting batch subscriber", logFields)
+
+	for {
+		select {
+		case <-s.closing:
+			return
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		if s.isIntakeStopped() {
+			s.logger.Debug("Intake stopped, batch subscriber stops fetching", logFields)
+			select {
+			case <-s.closing:
+			case <-ctx.Done():
+			}
+			return
+		}
+
+		if until, paused := s.PausedUntil(); paused {
+			s.logger.Trace("Subscriber paused, batch subscriber waits", logFields)
+			wait, stop := after(s.config.Clock, until.Sub(s.now()))
+			select {
+			case <-wait:
+			case <-s.closing:
+			case <-ctx.Done():
+			}
+			stop()
+			continue
+		}
+
+		batchSize := maxBatch
+		if adaptive != nil {
+			batchSize = adaptive.current()
+		}
+
+		msgs, err := sub.Fetch(batchSize, nats.MaxWait(maxWait))
+		if errors.Is(err, nats.ErrTimeout) {
+			continue
+		}
+		if err != nil {
+			if s.isClosed() || ctx.Err() != nil {
+				return
+			}
+			s.logger.Error("Cannot fetch batch", err, logFields)
+			continue
+		}
+
+		start := s.now()
+		if !s.processBatch(ctx, topic, msgs, ackWait, output, logFields) {
+			return
+		}
+		if adaptive != nil {
+			adaptive.observe(s.now().Sub(start))
+		}
+	}
+}
+
+// processBatch delivers a fetched batch to output and acks it, returning false when delivery was interrupted.
+func (s *Subscriber) processBatch(
+	ctx context.Context,
+	topic string,
+	msgs []*nats.Msg,
+	ackWait time.Duration,
+	output chan []*message.Message,
+	logFields watermill.LogFields,
+) bool {
+	natsMsgs := make([]*nats.Msg, 0, len(msgs))
+	batch := make([]*message.Message, 0, len(msgs))
+
+	for _, m := range msgs {
+		if s.config.DropExpired && msgExpired(m, s.now()) {
+			s.logger.Debug("Message expired, dropped", logFields)
+			if err := s.acker.Ack(m); err != nil {
+				s.logger.Error("Cannot send ack", err, logFields)
+			}
+			continue
+		}
+
+		msg, err := s.readMessage(ctx, topic, m)
+		if err != nil {
+			s.readFailed(topic, m, err, logFields)
+			continue
+		}
+		msg.SetContext(WithNatsMsg(ctx, m))
+
+		natsMsgs = append(natsMsgs, m)
+		batch = append(batch, msg)
+	}
+
+	if len(batch) == 0 {
+		return true
+	}
+
+	batchLogFields := logFields.Add(watermill.LogFields{"batch_size": len(batch)})
+
+	select {
+	case output <- batch:
+		s.logger.Trace("Batch sent to consumer", batchLogFields)
+	case <-s.closing:
+		s.logger.Trace("Closing, batch discarded", batchLogFields)
+		s.nakDiscardedBatch(natsMsgs, batchLogFields)
+		return false
+	case <-ctx.Done():
+		s.logger.Trace("Context cancelled, batch discarded", batchLogFields)
+		s.nakDiscardedBatch(natsMsgs, batchLogFields)
+		return false
+	}
+
+	stopInProgress := s.startInProgress(natsMsgs, batchLogFields)
+	results, ok := s.waitBatchResults(ctx, batch, ackWait)
+	stopInProgress()
+	if !ok {
+		return false
+	}
+
+	nacked := false
+	for _, r := range results {
+		nacked = nacked || !r.acked
+	}
+
+	for _, r := range results {
+		m := natsMsgs[r.index]
+		messageLogFields := batchLogFields.Add(watermill.LogFields{"message_uuid": batch[r.index].UUID})
+
+		acked := r.acked
+		if s.config.BatchAckMode == BatchAckAll {
+			acked = len(results) == len(batch) && !nacked
+		}
+
+		if acked {
+			s.ackMsg(ctx, topic, m, messageLogFields)
+		} else {
+			s.nakMsg(topic, m, messageLogFields)
+		}
+	}
+
+	return true
+}
+
+// waitBatchResults collects the acks and nacks of batch until every message is resolved or ackWait elapsed,
+// stopping at the first nack when the whole batch is acked at once.  It returns false when interrupted.
+func (s *Subscriber) waitBatchResults(ctx context.Context, batch []*message.Message, ackWait time.Duration) ([]batchResult, bool) {
+	done := make(chan struct{})
+	defer close(done)
+
+	resolved := make(chan batchResult, len(batch))
+	for i, msg := range batch {
+		go func(i int, msg *message.Message) {
+			select {
+			case <-msg.Acked():
+				resolved <- batchResult{index: i, acked: true}
+			case <-msg.Nacked():
+				resolved <- batchResult{index: i, acked: false}
+			case <-done:
+			}
+		}(i, msg)
+	}
+
+	timeout, stopTimeout := after(s.config.Clock, ackWait)
+	defer stopTimeout()
+
+	results := make([]batchResult, 0, len(batch))
+	for len(results) < len(batch) {
+		select {
+		case r := <-resolved:
+			results = append(results, r)
+			if !r.acked && s.config.BatchAckMode == BatchAckAll {
+				return nackUnresolved(batch, results), true
+			}
+		case <-timeout:
+			s.logger.Trace("Ack timeout", watermill.LogFields{"batch_size": len(batch)})
+			return results, true
+		case <-s.closing:
+			return nil, false
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+
+	return results, true
+}
+
+// nakDiscardedBatch naks the messages of a batch discarded before it reached the consumer.
+func (s *Subscriber) nakDiscardedBatch(msgs []*nats.Msg, logFields watermill.LogFields) {
+	for _, m := range msgs {
+		s.nakDiscarded(m, logFields)
+	}
+}
+
+// nackUnresolved adds a nack result for every message of batch missing from results.
+func nackUnresolved(batch []*message.Message, results []batchResult) []batchResult {
+	seen := make(map[int]bool, len(results))
+	for _, r := range results {
+		seen[r.index] = true
+	}
+
+	for i := range batch {
+		if !seen[i] {
+			results = append(results, batchResult{index: i, acked: false})
+		}
+	}
+
+	return results
+}
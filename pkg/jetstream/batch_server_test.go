@@ -0,0 +1,47 @@
+package jetstream_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-jetstream/pkg/jetstream"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriber_SubscribeBatchUnsubscribesOnCancel(t *testing.T) {
+	conn, js := serverConn(t)
+
+	sub, err := jetstream.NewSubscriberWithNatsConn(conn, jetstream.SubscriberSubscriptionConfig{
+		Unmarshaler:   &jetstream.GobMarshaler{},
+		AutoProvision: true,
+		Consumer:      jetstream.ConsumerConfig{Durable: "batch"},
+		PullFetchers:  2,
+		CloseTimeout:  time.Second,
+	}, watermill.NopLogger{})
+	require.NoError(t, err)
+	defer sub.Close()
+
+	// the first JetStream API request of the connection subscribes to its replies, so it is made before counting
+	require.NoError(t, sub.SubscribeInitialize("reports"))
+	subscriptions := conn.NumSubscriptions()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	batches, err := sub.SubscribeBatch(ctx, "reports", 10, 100*time.Millisecond)
+	require.NoError(t, err)
+	require.Equal(t, subscriptions+2, conn.NumSubscriptions())
+
+	cancel()
+	select {
+	case _, ok := <-batches:
+		require.False(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("batches not closed")
+	}
+
+	// the pull subscriptions are gone, the durable consumer is kept
+	require.Equal(t, subscriptions, conn.NumSubscriptions())
+	_, err = js.ConsumerInfo("reports", "batch_reports")
+	require.NoError(t, err)
+}
@@ -0,0 +1,159 @@
+package jetstream
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriber_WaitBatchResults(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     BatchAckMode
+		resolve  func(batch []*message.Message)
+		expected []batchResult
+	}{
+		{
+			name: "per message",
+			mode: BatchAckPerMessage,
+			resolve: func(batch []*message.Message) {
+				batch[0].Ack()
+				batch[1].Nack()
+				batch[2].Ack()
+			},
+			expected: []batchResult{{index: 0, acked: true}, {index: 1, acked: false}, {index: 2, acked: true}},
+		},
+		{
+			name: "all nacked by a single message",
+			mode: BatchAckAll,
+			resolve: func(batch []*message.Message) {
+				batch[1].Nack()
+			},
+			expected: []batchResult{{index: 0, acked: false}, {index: 1, acked: false}, {index: 2, acked: false}},
+		},
+		{
+			name: "all acked",
+			mode: BatchAckAll,
+			resolve: func(batch []*message.Message) {
+				for _, msg := range batch {
+					msg.Ack()
+				}
+			},
+			expected: []batchResult{{index: 0, acked: true}, {index: 1, acked: true}, {index: 2, acked: true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Subscriber{
+				logger:  watermill.NopLogger{},
+				closing: make(chan struct{}),
+				config: SubscriberSubscriptionConfig{
+					AckWaitTimeout: time.Second,
+					BatchAckMode:   tt.mode,
+				},
+			}
+
+			batch := []*message.Message{
+				message.NewMessage("1", nil),
+				message.NewMessage("2", nil),
+				message.NewMessage("3", nil),
+			}
+			tt.resolve(batch)
+
+			results, ok := s.waitBatchResults(context.Background(), batch, s.config.AckWaitTimeout)
+			require.True(t, ok)
+			require.ElementsMatch(t, tt.expected, results)
+		})
+	}
+}
+
+func TestSubscriber_WaitBatchResults_Timeout(t *testing.T) {
+	s := &Subscriber{
+		logger:  watermill.NopLogger{},
+		closing: make(chan struct{}),
+		config:  SubscriberSubscriptionConfig{AckWaitTimeout: 50 * time.Millisecond},
+	}
+
+	batch := []*message.Message{message.NewMessage("1", nil), message.NewMessage("2", nil)}
+	batch[0].Ack()
+
+	results, ok := s.waitBatchResults(context.Background(), batch, s.config.AckWaitTimeout)
+	require.True(t, ok)
+	require.Equal(t, []batchResult{{index: 0, acked: true}}, results)
+}
+
+// pullJetStream counts the pull subscriptions created.
+type pullJetStream struct {
+	nats.JetStream
+	pullSubscribes int32
+}
+
+func (js *pullJetStream) PullSubscribe(subj, durable string, opts ...nats.SubOpt) (*nats.Subscription, error) {
+	atomic.AddInt32(&js.pullSubscribes, 1)
+	return &nats.Subscription{}, nil
+}
+
+func TestSubscriber_SubscribeBatch_PullFetchers(t *testing.T) {
+	js := &pullJetStream{}
+
+	s := faultySubscriber(SubscriberSubscriptionConfig{
+		DurableName:  "durable",
+		PullFetchers: 3,
+	}, clientDecorator{
+		jetStream: func(nats.JetStream) nats.JetStream { return js },
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	batches, err := s.SubscribeBatch(ctx, "topic", 10, time.Millisecond)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, atomic.LoadInt32(&js.pullSubscribes))
+
+	// the output is closed once all fetchers stopped
+	cancel()
+	select {
+	case _, ok := <-batches:
+		require.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("batches not closed")
+	}
+}
+
+func TestPullConsumerConfig(t *testing.T) {
+	require.Empty(t, PullConsumerConfig{}.subOpts())
+	require.NoError(t, PullConsumerConfig{}.checkFetch(1000, time.Hour))
+
+	c := PullConsumerConfig{MaxWaiting: 16, MaxRequestBatch: 100, MaxRequestExpires: time.Second}
+	require.NoError(t, c.Validate())
+	require.Len(t, c.subOpts(), 3)
+
+	require.NoError(t, c.checkFetch(100, time.Second))
+	require.EqualError(t, c.checkFetch(101, time.Second), "maxBatch 101 exceeds SubscriberConfig.PullConsumer.MaxRequestBatch 100")
+	require.EqualError(t, c.checkFetch(100, 2*time.Second), "maxWait 2s exceeds SubscriberConfig.PullConsumer.MaxRequestExpires 1s")
+
+	err := PullConsumerConfig{MaxWaiting: -1, MaxRequestExpires: -time.Second}.Validate()
+	require.EqualError(t, err, "MaxWaiting: can not be negative; MaxRequestExpires: can not be negative")
+}
+
+func TestSubscriber_SubscribeBatch_PullConsumerLimits(t *testing.T) {
+	js := &pullJetStream{}
+
+	s := faultySubscriber(SubscriberSubscriptionConfig{
+		DurableName:  "durable",
+		PullConsumer: PullConsumerConfig{MaxRequestBatch: 10},
+	}, clientDecorator{
+		jetStream: func(nats.JetStream) nats.JetStream { return js },
+	})
+
+	// the request is rejected before a consumer is created
+	_, err := s.SubscribeBatch(context.Background(), "topic", 11, time.Millisecond)
+	require.Error(t, err)
+	require.Zero(t, atomic.LoadInt32(&js.pullSubscribes))
+}
@@ -0,0 +1,291 @@
+package jetstream_test
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-jetstream/pkg/jetstream"
+	jetstreamtests "github.com/ThreeDotsLabs/watermill-jetstream/pkg/jetstream/tests"
+	"github.com/ThreeDotsLabs/watermill-jetstream/pkg/jetstream/wmpb"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+)
+
+// The benchmarks run against WATERMILL_TEST_NATS_URL when it is set, otherwise against a disposable server
+// (see jetstreamtests.RunServer).  WATERMILL_BENCH_PAYLOAD_SIZES overrides the payload sizes, e.g. "100,65536".
+
+var benchMarshalers = []struct {
+	name      string
+	marshaler jetstream.MarshalerUnmarshaler
+}{
+	{"gob", &jetstream.GobMarshaler{}},
+	{"json", &jetstream.JSONMarshaler{}},
+	{"nats", &jetstream.NATSMarshaler{}},
+	{"proto", &wmpb.NATSMarshaler{}},
+}
+
+func BenchmarkPublish(b *testing.B) {
+	url := benchServerURL(b)
+
+	for _, size := range benchPayloadSizes(b) {
+		b.Run(fmt.Sprintf("sync/%db", size), func(b *testing.B) {
+			topic := benchTopic(b, url)
+			pub := benchPublisher(b, url, &jetstream.GobMarshaler{})
+			messages := benchMessages(b.N, size)
+
+			b.SetBytes(int64(size))
+			b.ResetTimer()
+
+			for _, msg := range messages {
+				if err := pub.Publish(topic, msg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("async/%db", size), func(b *testing.B) {
+			topic := benchTopic(b, url)
+			js := benchJetStream(b, url)
+			messages := benchMessages(b.N, size)
+
+			b.SetBytes(int64(size))
+			b.ResetTimer()
+
+			publishAsync(b, js, &jetstream.GobMarshaler{}, topic, messages)
+		})
+	}
+}
+
+func BenchmarkSubscribe(b *testing.B) {
+	url := benchServerURL(b)
+
+	for _, size := range benchPayloadSizes(b) {
+		b.Run(fmt.Sprintf("push/%db", size), func(b *testing.B) {
+			topic := benchTopic(b, url)
+			publishAsync(b, benchJetStream(b, url), &jetstream.GobMarshaler{}, topic, benchMessages(b.N, size))
+			sub := benchSubscriber(b, url, jetstream.SubscriberConfig{Unmarshaler: &jetstream.GobMarshaler{}})
+
+			b.SetBytes(int64(size))
+			b.ResetTimer()
+
+			messages, err := sub.Subscribe(context.Background(), topic)
+			if err != nil {
+				b.Fatal(err)
+			}
+			consume(b, messages)
+		})
+
+		b.Run(fmt.Sprintf("push-channel/%db", size), func(b *testing.B) {
+			topic := benchTopic(b, url)
+			publishAsync(b, benchJetStream(b, url), &jetstream.GobMarshaler{}, topic, benchMessages(b.N, size))
+			sub := benchSubscriber(b, url, jetstream.SubscriberConfig{
+				Unmarshaler:     &jetstream.GobMarshaler{},
+				ChannelDelivery: jetstream.ChannelDeliveryConfig{Workers: runtime.GOMAXPROCS(0)},
+			})
+
+			b.SetBytes(int64(size))
+			b.ResetTimer()
+
+			messages, err := sub.Subscribe(context.Background(), topic)
+			if err != nil {
+				b.Fatal(err)
+			}
+			consume(b, messages)
+		})
+
+		b.Run(fmt.Sprintf("pull/%db", size), func(b *testing.B) {
+			topic := benchTopic(b, url)
+			publishAsync(b, benchJetStream(b, url), &jetstream.GobMarshaler{}, topic, benchMessages(b.N, size))
+			sub := benchSubscriber(b, url, jetstream.SubscriberConfig{
+				Unmarshaler: &jetstream.GobMarshaler{},
+				DurableName: "bench",
+			})
+
+			b.SetBytes(int64(size))
+			b.ResetTimer()
+
+			batches, err := sub.SubscribeBatch(context.Background(), topic, 100, 100*time.Millisecond)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			for received := 0; received < b.N; {
+				batch, ok := <-batches
+				if !ok {
+					b.Fatalf("batches closed after %d messages", received)
+				}
+				for _, msg := range batch {
+					msg.Ack()
+				}
+				received += len(batch)
+			}
+		})
+	}
+}
+
+func BenchmarkPublishSubscribe_Marshalers(b *testing.B) {
+	url := benchServerURL(b)
+
+	for _, size := range benchPayloadSizes(b) {
+		for _, m := range benchMarshalers {
+			b.Run(fmt.Sprintf("%s/%db", m.name, size), func(b *testing.B) {
+				topic := benchTopic(b, url)
+				pub := benchPublisher(b, url, m.marshaler)
+				sub := benchSubscriber(b, url, jetstream.SubscriberConfig{Unmarshaler: m.marshaler})
+
+				messages, err := sub.Subscribe(context.Background(), topic)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				b.SetBytes(int64(size))
+				b.ResetTimer()
+
+				go func() {
+					for _, msg := range benchMessages(b.N, size) {
+						if err := pub.Publish(topic, msg); err != nil {
+							panic(err)
+						}
+					}
+				}()
+
+				consume(b, messages)
+			})
+		}
+	}
+}
+
+func benchServerURL(b *testing.B) string {
+	if url := os.Getenv("WATERMILL_TEST_NATS_URL"); url != "" {
+		return url
+	}
+
+	return jetstreamtests.RunServer(b).URL
+}
+
+func benchPayloadSizes(b *testing.B) []int {
+	env := os.Getenv("WATERMILL_BENCH_PAYLOAD_SIZES")
+	if env == "" {
+		return []int{100, 1024, 10 * 1024}
+	}
+
+	var sizes []int
+	for _, s := range strings.Split(env, ",") {
+		size, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			b.Fatalf("invalid WATERMILL_BENCH_PAYLOAD_SIZES: %s", err)
+		}
+		sizes = append(sizes, size)
+	}
+
+	return sizes
+}
+
+// benchTopic creates a stream for a new topic, deleted when the benchmark finishes.
+func benchTopic(b *testing.B, url string) string {
+	topic := "bench_" + watermill.NewShortUUID()
+	js := benchJetStream(b, url)
+
+	if _, err := js.AddStream(&nats.StreamConfig{Name: topic, Subjects: []string{topic + ".*"}}); err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		_ = js.DeleteStream(topic)
+	})
+
+	return topic
+}
+
+func benchJetStream(b *testing.B, url string) nats.JetStreamContext {
+	conn, err := nats.Connect(url)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(conn.Close)
+
+	js, err := conn.JetStream(nats.PublishAsyncMaxPending(1024))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return js
+}
+
+func benchPublisher(b *testing.B, url string, marshaler jetstream.Marshaler) *jetstream.Publisher {
+	pub, err := jetstream.NewPublisher(jetstream.PublisherConfig{
+		URL:       url,
+		Marshaler: marshaler,
+	}, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		_ = pub.Close()
+	})
+
+	return pub
+}
+
+func benchSubscriber(b *testing.B, url string, config jetstream.SubscriberConfig) *jetstream.Subscriber {
+	config.URL = url
+	config.SubscribeOptions = []nats.SubOpt{nats.DeliverAll(), nats.AckExplicit()}
+	config.CloseTimeout = time.Second
+
+	sub, err := jetstream.NewSubscriber(config, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		_ = sub.Close()
+	})
+
+	return sub
+}
+
+func benchMessages(n, size int) []*message.Message {
+	messages := make([]*message.Message, n)
+	for i := range messages {
+		payload := make([]byte, size)
+		_, _ = rand.Read(payload)
+		messages[i] = message.NewMessage(watermill.NewUUID(), payload)
+	}
+
+	return messages
+}
+
+func publishAsync(b *testing.B, js nats.JetStreamContext, marshaler jetstream.Marshaler, topic string, messages []*message.Message) {
+	for _, msg := range messages {
+		natsMsg, err := marshaler.Marshal(topic, msg)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := js.PublishMsgAsync(natsMsg); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	select {
+	case <-js.PublishAsyncComplete():
+	case <-time.After(time.Minute):
+		b.Fatal("async publishes not acked")
+	}
+}
+
+func consume(b *testing.B, messages <-chan *message.Message) {
+	for i := 0; i < b.N; i++ {
+		select {
+		case msg := <-messages:
+			msg.Ack()
+		case <-time.After(time.Minute):
+			b.Fatalf("received %d of %d messages", i, b.N)
+		}
+	}
+}
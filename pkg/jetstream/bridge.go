@@ -0,0 +1,140 @@
+package jetstream
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// TopicMapper is a function used to map a source topic to a destination topic.
+type TopicMapper func(topic string) string
+
+// BridgeStats describes a message forwarded by a Bridge.
+type BridgeStats struct {
+	// SourceTopic is the topic the message was consumed from.
+	SourceTopic string
+
+	// DestinationTopic is the topic the message was published to.
+	DestinationTopic string
+
+	// Lag is the time between the message being stored in the source stream and being forwarded.
+	Lag time.Duration
+
+	// Pending is the number of messages still pending on the source consumer.
+	Pending uint64
+}
+
+// BridgeConfig is the configuration to create a bridge
+type BridgeConfig struct {
+	// TopicMapper maps source topics to destination topics (defaults to the source topic).
+	TopicMapper TopicMapper
+
+	// OnForward is called after every forwarded message, it can be used to export lag metrics.
+	OnForward func(stats BridgeStats)
+}
+
+func (c *BridgeConfig) setDefaults() {
+	if c.TopicMapper == nil {
+		c.TopicMapper = func(topic string) string { return topic }
+	}
+}
+
+// Bridge consumes topics with a Subscriber connected to one cluster or domain and publishes them with a Publisher
+// connected to another, for migrations and cross-region replication that stream mirroring cannot express.
+//
+// Messages are published with their UUID as Nats-Msg-Id, so redeliveries of the source are deduplicated
+// by the destination stream within its duplicate window.
+type Bridge struct {
+	subscriber *Subscriber
+	publisher  *Publisher
+	config     BridgeConfig
+	logger     watermill.LoggerAdapter
+}
+
+// NewBridge creates a new Bridge.  The subscriber and publisher are not closed by the bridge.
+func NewBridge(subscriber *Subscriber, publisher *Publisher, config BridgeConfig, logger watermill.LoggerAdapter) (*Bridge, error) {
+	config.setDefaults()
+
+	if subscriber == nil || publisher == nil {
+		return nil, errors.New("bridge requires a subscriber and a publisher")
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	return &Bridge{
+		subscriber: subscriber,
+		publisher:  publisher,
+		config:     config,
+		logger:     logger,
+	}, nil
+}
+
+// Run forwards the given topics until ctx is cancelled or the subscriber is closed.
+func (b *Bridge) Run(ctx context.Context, topics ...string) error {
+	wg := &sync.WaitGroup{}
+
+	for _, topic := range topics {
+		messages, err := b.subscriber.Subscribe(ctx, topic)
+		if err != nil {
+			return errors.Wrapf(err, "cannot subscribe to %s", topic)
+		}
+
+		wg.Add(1)
+		go func(topic string, messages <-chan *message.Message) {
+			defer wg.Done()
+			b.forward(topic, messages)
+		}(topic, messages)
+	}
+
+	wg.Wait()
+
+	return nil
+}
+
+func (b *Bridge) forward(topic string, messages <-chan *message.Message) {
+	destination := b.config.TopicMapper(topic)
+
+	logFields := watermill.LogFields{
+		"source_topic":      topic,
+		"destination_topic": destination,
+	}
+
+	if b.publisher.config.AutoProvision {
+		if err := b.publisher.topicInterpreter.ensureStream(destination); err != nil {
+			b.logger.Error("Cannot provision destination topic", err, logFields)
+		}
+	}
+
+	for msg := range messages {
+		messageLogFields := logFields.Add(watermill.LogFields{"message_uuid": msg.UUID})
+
+		if err := b.publisher.publishMessage(destination, msg, nats.MsgId(msg.UUID)); err != nil {
+			b.logger.Error("Cannot forward message", err, messageLogFields)
+			msg.Nack()
+			continue
+		}
+
+		msg.Ack()
+
+		b.logger.Trace("Message forwarded", messageLogFields)
+
+		if b.config.OnForward != nil {
+			stats := BridgeStats{
+				SourceTopic:      topic,
+				DestinationTopic: destination,
+			}
+			if meta, ok := MsgMetadataFromCtx(msg.Context()); ok {
+				stats.Lag = time.Since(meta.Timestamp)
+				stats.Pending = meta.NumPending
+			}
+			b.config.OnForward(stats)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package jetstream_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-jetstream/pkg/jetstream"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBridge_Forwards(t *testing.T) {
+	conn, js := serverConn(t)
+	pub := serverPublisher(t, conn)
+	sub := serverSubscriber(t, conn, jetstream.SubscriberSubscriptionConfig{})
+
+	published := make([]string, 3)
+	for i := range published {
+		msg := message.NewMessage(watermill.NewUUID(), []byte("payload"))
+		require.NoError(t, pub.Publish("orders", msg))
+		published[i] = msg.UUID
+	}
+
+	forwarded := make(chan jetstream.BridgeStats, len(published))
+	bridge, err := jetstream.NewBridge(sub, pub, jetstream.BridgeConfig{
+		TopicMapper: func(topic string) string { return "eu_" + topic },
+		OnForward:   func(stats jetstream.BridgeStats) { forwarded <- stats },
+	}, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- bridge.Run(ctx, "orders") }()
+
+	for range published {
+		select {
+		case stats := <-forwarded:
+			require.Equal(t, "orders", stats.SourceTopic)
+			require.Equal(t, "eu_orders", stats.DestinationTopic)
+		case <-ctx.Done():
+			t.Fatal("messages not forwarded")
+		}
+	}
+
+	var uuids []string
+	for _, msg := range streamMessages(t, js, "eu_orders") {
+		uuids = append(uuids, msg.UUID)
+	}
+	require.ElementsMatch(t, published, uuids)
+
+	// Run returns once ctx is cancelled
+	cancel()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("bridge still running")
+	}
+}
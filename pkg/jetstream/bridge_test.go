@@ -0,0 +1,25 @@
+package jetstream
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBridgeConfig_TopicMapper(t *testing.T) {
+	config := BridgeConfig{}
+	config.setDefaults()
+	require.Equal(t, "orders", config.TopicMapper("orders"))
+
+	config = BridgeConfig{TopicMapper: func(topic string) string { return "eu_" + topic }}
+	config.setDefaults()
+	require.Equal(t, "eu_orders", config.TopicMapper("orders"))
+}
+
+func TestNewBridge_RequiresSubscriberAndPublisher(t *testing.T) {
+	_, err := NewBridge(nil, &Publisher{}, BridgeConfig{}, nil)
+	require.Error(t, err)
+
+	_, err = NewBridge(&Subscriber{}, nil, BridgeConfig{}, nil)
+	require.Error(t, err)
+}
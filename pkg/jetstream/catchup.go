@@ -0,0 +1,127 @@
+package jetstream
+
+import (
+	"context"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+)
+
+// ReplayMetadataKey is the metadata key set to "true" on the historical messages delivered by SubscribeCatchUp.
+const ReplayMetadataKey = "replay"
+
+// SubscribeCatchUp delivers the messages of topic starting at from through a temporary ordered consumer, first
+// catching up with the messages already stored and then tailing new ones, e.g. for bootstrapping projections.
+//
+// Messages delivered while catching up carry ReplayMetadataKey.  The returned live channel is closed once the
+// subscription caught up (no message was pending anymore), following messages are live.  As the same consumer
+// keeps delivering, no message is skipped or delivered twice at the transition.
+//
+// Messages are delivered one at a time, a nacked message is delivered again.  The consumer state is not kept
+// between subscriptions, so projections need to keep track of their position themselves.
+func (s *Subscriber) SubscribeCatchUp(ctx context.Context, topic string, from StreamPosition) (<-chan *message.Message, <-chan struct{}, error) {
+	topic, err := sanitizeTopic(topic, s.config.TopicSanitizer, s.config.EscapeTopics, s.config.AutoProvision)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx = withTopic(ctx, topic)
+
+	logFields := subscriptionLogFields(ctx, watermill.LogFields{
+		"topic":    topic,
+		"catch_up": true,
+	})
+
+	sub, pending, err := s.orderedSubscription(topic, from)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	output := make(chan *message.Message)
+	live := make(chan struct{})
+
+	// NextMsgWithContext only returns early on ctx, so closing the subscriber cancels it
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-s.closing:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	s.outputsWg.Add(1)
+	go func() {
+		defer s.outputsWg.Done()
+		defer cancel()
+		defer close(output)
+		defer func() {
+			if err := sub.Unsubscribe(); err != nil {
+				s.logger.Error("Cannot unsubscribe", err, logFields)
+			}
+		}()
+
+		s.logger.Debug("Starting catch-up subscription", logFields)
+		defer s.logger.Debug("Catch-up subscription finished", logFields)
+
+		s.catchUp(ctx, sub.NextMsgWithContext, pending, output, live, logFields)
+	}()
+
+	return output, live, nil
+}
+
+// catchUp delivers the messages returned by next until delivery is interrupted, marking them as replayed
+// and closing live once no message is pending anymore.
+func (s *Subscriber) catchUp(
+	ctx context.Context,
+	next func(context.Context) (*nats.Msg, error),
+	pending uint64,
+	output chan *message.Message,
+	live chan struct{},
+	logFields watermill.LogFields,
+) {
+	caughtUp := false
+	goLive := func() {
+		caughtUp = true
+		close(live)
+		s.logger.Debug("Caught up, tailing live messages", logFields)
+	}
+
+	if pending == 0 {
+		goLive()
+	}
+
+	for {
+		m, err := next(ctx)
+		if err != nil {
+			if ctx.Err() == nil && !s.isClosed() {
+				s.logger.Error("Cannot read message", err, logFields)
+			}
+			return
+		}
+
+		var annotate func(*message.Message)
+		if !caughtUp {
+			annotate = func(msg *message.Message) {
+				msg.Metadata.Set(ReplayMetadataKey, "true")
+			}
+		}
+
+		if !s.deliverUntilAcked(ctx, m, output, logFields, annotate) {
+			return
+		}
+
+		if caughtUp {
+			continue
+		}
+
+		meta, err := m.Metadata()
+		if err != nil {
+			s.logger.Error("Cannot read message metadata", err, logFields)
+			return
+		}
+		if meta.NumPending == 0 {
+			goLive()
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package jetstream
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+// pendingMsg returns a message of stream sequence seq with pending messages left after it.
+func pendingMsg(t *testing.T, seq, pending uint64) *nats.Msg {
+	m, err := (&GobMarshaler{}).Marshal("topic", message.NewMessage(fmt.Sprint(seq), nil))
+	require.NoError(t, err)
+
+	m.Reply = fmt.Sprintf("$JS.ACK.topic.consumer.1.%d.%d.%d.%d", seq, seq, time.Now().UnixNano(), pending)
+	m.Sub = &nats.Subscription{}
+
+	return m
+}
+
+func TestSubscriber_CatchUp(t *testing.T) {
+	tests := []struct {
+		name    string
+		pending uint64
+		msgs    func(t *testing.T) []*nats.Msg
+		replays []string
+		lives   []string
+	}{
+		{
+			name: "nothing stored",
+			msgs: func(t *testing.T) []*nats.Msg {
+				return []*nats.Msg{pendingMsg(t, 1, 0)}
+			},
+			lives: []string{"1"},
+		},
+		{
+			name:    "stored then live",
+			pending: 2,
+			msgs: func(t *testing.T) []*nats.Msg {
+				return []*nats.Msg{pendingMsg(t, 1, 1), pendingMsg(t, 2, 0), pendingMsg(t, 3, 0)}
+			},
+			replays: []string{"1", "2"},
+			lives:   []string{"3"},
+		},
+		{
+			// messages published while catching up are replayed until nothing is pending
+			name:    "published while catching up",
+			pending: 1,
+			msgs: func(t *testing.T) []*nats.Msg {
+				return []*nats.Msg{pendingMsg(t, 1, 1), pendingMsg(t, 2, 0), pendingMsg(t, 3, 0)}
+			},
+			replays: []string{"1", "2"},
+			lives:   []string{"3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := faultySubscriber(SubscriberSubscriptionConfig{}, clientDecorator{})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			msgs := tt.msgs(t)
+			next := func(ctx context.Context) (*nats.Msg, error) {
+				if len(msgs) == 0 {
+					<-ctx.Done()
+					return nil, ctx.Err()
+				}
+				m := msgs[0]
+				msgs = msgs[1:]
+				return m, nil
+			}
+
+			output := make(chan *message.Message)
+			live := make(chan struct{})
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				s.catchUp(ctx, next, tt.pending, output, live, watermill.LogFields{})
+			}()
+
+			var replays, lives []string
+			for i := 0; i < len(tt.replays)+len(tt.lives); i++ {
+				msg := <-output
+
+				select {
+				case <-live:
+					require.Empty(t, msg.Metadata.Get(ReplayMetadataKey))
+					lives = append(lives, msg.UUID)
+				default:
+					require.Equal(t, "true", msg.Metadata.Get(ReplayMetadataKey))
+					replays = append(replays, msg.UUID)
+				}
+
+				msg.Ack()
+			}
+
+			require.Equal(t, tt.replays, replays)
+			require.Equal(t, tt.lives, lives)
+
+			cancel()
+			<-done
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package jetstream
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// CheckpointStore persists the last processed stream sequence per topic outside of JetStream consumer state,
+// for pipelines that need replayability independent of JetStream consumers (e.g. a SQL table or a KV bucket).
+type CheckpointStore interface {
+	// LoadCheckpoint returns the last processed stream sequence of topic, found is false when no checkpoint was saved yet.
+	LoadCheckpoint(ctx context.Context, topic string) (seq uint64, found bool, err error)
+
+	// SaveCheckpoint records seq as the last processed stream sequence of topic.
+	SaveCheckpoint(ctx context.Context, topic string, seq uint64) error
+}
+
+// KVCheckpointStore is a CheckpointStore backed by a JetStream KV bucket, keyed by topic.
+type KVCheckpointStore struct {
+	kv nats.KeyValue
+}
+
+// NewKVCheckpointStore creates a new KVCheckpointStore on the provided KV bucket.
+func NewKVCheckpointStore(kv nats.KeyValue) *KVCheckpointStore {
+	return &KVCheckpointStore{kv: kv}
+}
+
+// LoadCheckpoint returns the last processed stream sequence of topic.
+func (c *KVCheckpointStore) LoadCheckpoint(_ context.Context, topic string) (uint64, bool, error) {
+	entry, err := c.kv.Get(topic)
+	if errors.Is(err, nats.ErrKeyNotFound) || errors.Is(err, nats.ErrKeyDeleted) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, errors.Wrap(err, "cannot get checkpoint")
+	}
+
+	seq, err := strconv.ParseUint(string(entry.Value()), 10, 64)
+	if err != nil {
+		return 0, false, errors.Wrapf(err, "invalid checkpoint for topic %s", topic)
+	}
+
+	return seq, true, nil
+}
+
+// SaveCheckpoint records seq as the last processed stream sequence of topic.
+func (c *KVCheckpointStore) SaveCheckpoint(_ context.Context, topic string, seq uint64) error {
+	if _, err := c.kv.Put(topic, []byte(strconv.FormatUint(seq, 10))); err != nil {
+		return errors.Wrap(err, "cannot save checkpoint")
+	}
+
+	return nil
+}
+
+// checkpointStartOptions returns the subscribe options resuming after the saved checkpoint of topic, if there is one.
+func (s *Subscriber) checkpointStartOptions(ctx context.Context, topic string) ([]nats.SubOpt, error) {
+	seq, found, err := s.config.CheckpointStore.LoadCheckpoint(ctx, topic)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot load checkpoint")
+	}
+
+	if !found {
+		return nil, nil
+	}
+
+	s.logger.Debug("Resuming from checkpoint", watermill.LogFields{"topic": topic, "stream_seq": seq})
+
+	return []nats.SubOpt{nats.StartSequence(seq + 1)}, nil
+}
+
+// saveCheckpoint records the stream sequence of an acked message.
+func (s *Subscriber) saveCheckpoint(ctx context.Context, topic string, m *nats.Msg, logFields watermill.LogFields) {
+	meta, err := m.Metadata()
+	if err != nil {
+		s.logger.Error("Cannot read message metadata for checkpoint", err, logFields)
+		return
+	}
+
+	if err := s.config.CheckpointStore.SaveCheckpoint(ctx, topic, meta.Sequence.Stream); err != nil {
+		s.logger.Error("Cannot save checkpoint", err, logFields)
+	}
+}
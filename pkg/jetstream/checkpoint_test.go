@@ -0,0 +1,37 @@
+package jetstream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKVCheckpointStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewKVCheckpointStore(newMemoryKeyValue())
+
+	_, found, err := store.LoadCheckpoint(ctx, "topic")
+	require.NoError(t, err)
+	require.False(t, found)
+
+	require.NoError(t, store.SaveCheckpoint(ctx, "topic", 42))
+
+	seq, found, err := store.LoadCheckpoint(ctx, "topic")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, uint64(42), seq)
+}
+
+func TestSubscriberSubscriptionConfig_Validate_CheckpointStore(t *testing.T) {
+	c := &SubscriberSubscriptionConfig{
+		Unmarshaler:       &GobMarshaler{},
+		SubscribersCount:  1,
+		SubjectCalculator: defaultSubjectCalculator,
+		CheckpointStore:   NewKVCheckpointStore(newMemoryKeyValue()),
+	}
+	require.NoError(t, c.Validate())
+
+	c.DurableName = "durable"
+	require.Error(t, c.Validate())
+}
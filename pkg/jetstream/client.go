@@ -0,0 +1,80 @@
+package jetstream
+
+import (
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// msgAcker acknowledges the messages received by a Subscriber.  Together with the nats.JetStream of the
+// Publisher and Subscriber it is the boundary of the calls made to the NATS client, see clientDecorator.
+type msgAcker interface {
+	Ack(m *nats.Msg) error
+	AckSync(m *nats.Msg) error
+	Nak(m *nats.Msg) error
+	NakWithDelay(m *nats.Msg, delay time.Duration) error
+	Term(m *nats.Msg) error
+	InProgress(m *nats.Msg) error
+}
+
+// natsAcker acknowledges messages through the NATS client.
+type natsAcker struct{}
+
+func (natsAcker) Ack(m *nats.Msg) error {
+	return m.Ack()
+}
+
+func (natsAcker) AckSync(m *nats.Msg) error {
+	return m.AckSync()
+}
+
+func (natsAcker) Nak(m *nats.Msg) error {
+	return m.Nak()
+}
+
+func (natsAcker) NakWithDelay(m *nats.Msg, delay time.Duration) error {
+	return m.NakWithDelay(delay)
+}
+
+func (natsAcker) Term(m *nats.Msg) error {
+	return m.Term()
+}
+
+func (natsAcker) InProgress(m *nats.Msg) error {
+	return m.InProgress()
+}
+
+// clientDecorator wraps the calls a Publisher or Subscriber makes to the NATS client (publish, subscribe, ack),
+// so tests can inject faults such as timeouts, dropped acks or deleted consumers deterministically.
+// Nil fields leave the corresponding client unchanged.
+type clientDecorator struct {
+	jetStream func(nats.JetStream) nats.JetStream
+	acker     func(msgAcker) msgAcker
+}
+
+func (d clientDecorator) decorateJetStream(js nats.JetStream) nats.JetStream {
+	if d.jetStream == nil {
+		return js
+	}
+
+	return d.jetStream(js)
+}
+
+func (d clientDecorator) decorateAcker(acker msgAcker) msgAcker {
+	if d.acker == nil {
+		return acker
+	}
+
+	return d.acker(acker)
+}
+
+// decorateClient wraps the NATS client calls of the publisher with d.
+func (p *Publisher) decorateClient(d clientDecorator) {
+	p.js = d.decorateJetStream(p.js)
+}
+
+// decorateClient wraps the NATS client calls of the subscriber with d.
+func (s *Subscriber) decorateClient(d clientDecorator) {
+	s.js = d.decorateJetStream(s.js)
+	s.acker = d.decorateAcker(s.acker)
+}
@@ -0,0 +1,201 @@
+package jetstream
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+// faultyJetStream fails publishes and subscriptions with the configured errors.
+type faultyJetStream struct {
+	nats.JetStream
+	publishErr   error
+	subscribeErr error
+
+	published []*nats.Msg
+}
+
+func (js *faultyJetStream) PublishMsg(m *nats.Msg, opts ...nats.PubOpt) (*nats.PubAck, error) {
+	if js.publishErr != nil {
+		return nil, js.publishErr
+	}
+	js.published = append(js.published, m)
+	return &nats.PubAck{}, nil
+}
+
+func (js *faultyJetStream) QueueSubscribe(subj, queue string, cb nats.MsgHandler, opts ...nats.SubOpt) (*nats.Subscription, error) {
+	if js.subscribeErr != nil {
+		return nil, js.subscribeErr
+	}
+	return &nats.Subscription{}, nil
+}
+
+// droppingAcker records acks and naks, failing acks as if they were dropped.
+type droppingAcker struct {
+	acks int
+	naks int
+}
+
+func (a *droppingAcker) Ack(m *nats.Msg) error {
+	a.acks++
+	return nats.ErrTimeout
+}
+
+func (a *droppingAcker) AckSync(m *nats.Msg) error {
+	return a.Ack(m)
+}
+
+func (a *droppingAcker) Nak(m *nats.Msg) error {
+	a.naks++
+	return nil
+}
+
+func (a *droppingAcker) NakWithDelay(m *nats.Msg, delay time.Duration) error {
+	return a.Nak(m)
+}
+
+func (a *droppingAcker) Term(m *nats.Msg) error {
+	return a.Nak(m)
+}
+
+func (a *droppingAcker) InProgress(m *nats.Msg) error {
+	return nil
+}
+
+// nopAcker accepts every ack and nak without a server.
+type nopAcker struct{}
+
+func (nopAcker) Ack(*nats.Msg) error                         { return nil }
+func (nopAcker) AckSync(*nats.Msg) error                     { return nil }
+func (nopAcker) Nak(*nats.Msg) error                         { return nil }
+func (nopAcker) NakWithDelay(*nats.Msg, time.Duration) error { return nil }
+func (nopAcker) Term(*nats.Msg) error                        { return nil }
+func (nopAcker) InProgress(*nats.Msg) error                  { return nil }
+
+func faultySubscriber(config SubscriberSubscriptionConfig, d clientDecorator) *Subscriber {
+	config.Unmarshaler = &GobMarshaler{}
+	config.setDefaults()
+
+	s := &Subscriber{
+		logger:           watermill.NopLogger{},
+		config:           config,
+		closing:          make(chan struct{}),
+		acker:            natsAcker{},
+		topicInterpreter: newTopicInterpreter(nil, config.SubjectCalculator, 0),
+	}
+	s.decorateClient(d)
+
+	return s
+}
+
+func TestPublisher_PublishTimeout(t *testing.T) {
+	p := &Publisher{
+		config: PublisherPublishConfig{Marshaler: &GobMarshaler{}},
+		logger: watermill.NopLogger{},
+	}
+	p.decorateClient(clientDecorator{
+		jetStream: func(nats.JetStream) nats.JetStream {
+			return &faultyJetStream{publishErr: nats.ErrTimeout}
+		},
+	})
+
+	err := p.Publish("topic", message.NewMessage(watermill.NewUUID(), nil))
+	require.True(t, errors.Is(err, nats.ErrTimeout), "unexpected error: %v", err)
+}
+
+func TestSubscriber_SubscribeConsumerDeleted(t *testing.T) {
+	s := faultySubscriber(SubscriberSubscriptionConfig{}, clientDecorator{
+		jetStream: func(nats.JetStream) nats.JetStream {
+			return &faultyJetStream{subscribeErr: nats.ErrConsumerNotFound}
+		},
+	})
+
+	_, err := s.Subscribe(context.Background(), "topic")
+	require.True(t, errors.Is(err, nats.ErrConsumerNotFound), "unexpected error: %v", err)
+}
+
+func TestSubscriber_DroppedAck(t *testing.T) {
+	acker := &droppingAcker{}
+	kv := newMemoryKeyValue()
+
+	s := faultySubscriber(SubscriberSubscriptionConfig{
+		CheckpointStore: NewKVCheckpointStore(kv),
+	}, clientDecorator{
+		acker: func(msgAcker) msgAcker { return acker },
+	})
+
+	m, err := (&GobMarshaler{}).Marshal("topic", message.NewMessage(watermill.NewUUID(), nil))
+	require.NoError(t, err)
+	stored := storedMsg(time.Now(), nil)
+	m.Reply, m.Sub = stored.Reply, stored.Sub
+
+	output := make(chan *message.Message)
+	go func() {
+		(<-output).Ack()
+	}()
+
+	s.processMessage(&subscriptionHandler{
+		ctx:       context.Background(),
+		topic:     "topic",
+		output:    output,
+		logFields: watermill.LogFields{},
+	}, m)
+
+	require.Equal(t, 1, acker.acks)
+	require.Equal(t, 0, acker.naks)
+
+	// the checkpoint is only saved once the ack reached the server
+	_, found, err := s.config.CheckpointStore.LoadCheckpoint(context.Background(), "topic")
+	require.NoError(t, err)
+	require.False(t, found)
+}
+
+func BenchmarkSubscriber_ProcessMessage(b *testing.B) {
+	b.Run("retained payloads", func(b *testing.B) {
+		benchmarkProcessMessage(b, SubscriberSubscriptionConfig{})
+	})
+	b.Run("released payloads", func(b *testing.B) {
+		benchmarkProcessMessage(b, SubscriberSubscriptionConfig{ReleasePayloads: true})
+	})
+}
+
+func benchmarkProcessMessage(b *testing.B, config SubscriberSubscriptionConfig) {
+	s := faultySubscriber(config, clientDecorator{
+		acker: func(msgAcker) msgAcker { return nopAcker{} },
+	})
+
+	m, err := (&GobMarshaler{}).Marshal("topic", message.NewMessage(watermill.NewUUID(), []byte("payload")))
+	require.NoError(b, err)
+
+	output := make(chan *message.Message)
+	go func() {
+		for msg := range output {
+			msg.Ack()
+		}
+	}()
+	defer close(output)
+
+	// the context of a subscription is cancellable, as in Subscribe
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h := &subscriptionHandler{
+		ctx:       ctx,
+		topic:     "topic",
+		output:    output,
+		logFields: watermill.LogFields{"topic": "topic"},
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		s.processMessage(h, m)
+	}
+}
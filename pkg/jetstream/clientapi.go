@@ -0,0 +1,419 @@
+package jetstream
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	natsjs "github.com/nats-io/nats.go/jetstream"
+	"github.com/pkg/errors"
+)
+
+// ClientAPI is the API of the NATS client Subscribe consumes messages with.
+type ClientAPI int
+
+const (
+	// ClientAPILegacy consumes through push subscriptions of nats.JetStreamContext, it supports every feature
+	// of the Subscriber.
+	ClientAPILegacy ClientAPI = iota
+
+	// ClientAPIJetStream consumes through the Consumer handles of the github.com/nats-io/nats.go/jetstream package,
+	// pulling messages with Consume.  The consumer of a topic is a pull consumer, durable with DurableName (so it can
+	// not share its name with push consumers of the topic), otherwise ephemeral and deleted once the subscription
+	// stops.  Features without a counterpart in the jetstream package (QueueGroup, SubscribeOptions, retries,
+	// checkpoints, partitions and the delivery options) are rejected by Validate.
+	//
+	// It only applies to Subscribe and SubscribeWithHandle, the other subscriptions keep the legacy API.
+	ClientAPIJetStream
+)
+
+// validateClientAPI adds to errs the fields of c not supported by its ClientAPI.
+func (c *SubscriberSubscriptionConfig) validateClientAPI(errs *ConfigErrors) {
+	if c.ClientAPI < ClientAPILegacy || c.ClientAPI > ClientAPIJetStream {
+		errs.add("SubscriberConfig.ClientAPI", fmt.Sprintf("unknown client API %d", c.ClientAPI))
+		return
+	}
+	if c.ClientAPI == ClientAPILegacy {
+		return
+	}
+
+	unsupported := []struct {
+		field string
+		set   bool
+	}{
+		{"QueueGroup", c.QueueGroup != ""},
+		{"JetstreamOptions", len(c.JetstreamOptions) > 0},
+		{"SubscribeOptions", len(c.SubscribeOptions) > 0},
+		{"VerifyCompatibility", c.VerifyCompatibility},
+		{"Retry", c.Retry.enabled()},
+		{"SubscribeRetry", c.SubscribeRetry != nil},
+		{"UnavailableGracePeriod", c.UnavailableGracePeriod > 0},
+		{"DeduplicationWindow", c.DeduplicationWindow.enabled()},
+		{"NakRetry", c.NakRetry != nil},
+		{"Disposition", c.Disposition.Classifier != nil},
+		{"Quarantine", c.Quarantine.Enabled},
+		{"Encoding", c.Encoding.Policy == UndecodableQuarantine},
+		{"FinalAttemptThreshold", c.FinalAttemptThreshold > 0},
+		{"CheckpointStore", c.CheckpointStore != nil},
+		{"Partitioning", c.Partitioning.enabled()},
+		{"Backpressure", c.Backpressure.Policy != BackpressureBlock},
+		{"DropExpired", c.DropExpired},
+		{"MaxInFlight", c.MaxInFlight > 0},
+		{"AdaptiveConcurrency", c.AdaptiveConcurrency.enabled()},
+		{"Heartbeat", c.Heartbeat.enabled()},
+		{"PauseSchedule", c.PauseSchedule.enabled()},
+		{"Audit", c.Audit.enabled()},
+		{"ChannelDelivery", c.ChannelDelivery.enabled()},
+		{"AckBatching", c.AckBatching.enabled()},
+	}
+	for _, u := range unsupported {
+		if u.set {
+			errs.add("SubscriberConfig."+u.field, "is not supported with ClientAPIJetStream")
+		}
+	}
+}
+
+// consumeWithHandle subscribes topic like SubscribeWithHandle with ClientAPIJetStream: SubscribersCount
+// Consume calls share the pull consumer of topic.
+func (s *Subscriber) consumeWithHandle(ctx context.Context, topic string) (<-chan *message.Message, *SubscriptionHandle, error) {
+	if _, ok := EphemeralConsumerFromCtx(ctx); ok {
+		return nil, nil, errors.New("ephemeral consumer options are not supported with ClientAPIJetStream")
+	}
+	if backpressure := s.backpressureConfig(ctx); backpressure.Policy != BackpressureBlock {
+		return nil, nil, errors.New("backpressure policies are not supported with ClientAPIJetStream")
+	}
+
+	timeouts := s.subscriptionTimeouts(ctx, topic)
+	if err := timeouts.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	start, _ := StartPositionFromCtx(ctx)
+
+	stream, consumer, err := s.pullConsumer(ctx, topic, timeouts, start)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot subscribe")
+	}
+	name := consumer.CachedInfo().Name
+
+	output := make(chan *message.Message)
+	handle := &SubscriptionHandle{topic: topic, js: s.topicInterpreter.js}
+	handle.addNamed(stream, name)
+
+	// the context of the messages of the subscription, cancelled once it stopped
+	handlerCtx, cancelHandlers := context.WithCancel(ctx)
+
+	s.outputsWg.Add(1)
+	outputWg := &sync.WaitGroup{}
+	states := make([]*subscriptionState, 0, s.config.SubscribersCount)
+
+	// stop stops the subscription before it started, when a Consume call failed
+	stop := func() {
+		cancelHandlers()
+		outputWg.Wait()
+		s.deleteEphemeralConsumer(stream, name)
+		s.subscriptions.untrack(states...)
+		s.outputsWg.Done()
+	}
+
+	for i := 0; i < s.config.SubscribersCount; i++ {
+		subscriberLogFields := subscriptionLogFields(ctx, watermill.LogFields{
+			"subscriber_num": i,
+			"topic":          topic,
+			"consumer":       name,
+		})
+
+		s.logger.Debug("Starting subscriber", subscriberLogFields)
+
+		handler := &subscriptionHandler{
+			ctx:       handlerCtx,
+			topic:     topic,
+			output:    output,
+			timeouts:  timeouts,
+			logFields: subscriberLogFields,
+		}
+		state := s.subscriptions.track(topic, i, handler)
+		states = append(states, state)
+
+		consumeCtx, err := consumer.Consume(func(m natsjs.Msg) {
+			s.processJetStreamMsg(handler, m)
+		}, natsjs.ConsumeErrHandler(func(_ natsjs.ConsumeContext, err error) {
+			if !s.isClosed() {
+				s.logger.Error("Cannot consume", err, subscriberLogFields)
+			}
+		}))
+		if err != nil {
+			stop()
+			return nil, nil, errors.Wrap(err, "cannot subscribe")
+		}
+
+		outputWg.Add(1)
+		go func() {
+			defer outputWg.Done()
+			defer state.stop()
+
+			select {
+			case <-s.closing:
+			case <-handlerCtx.Done():
+			case <-s.intakeStoppingChan():
+				// messages are not pulled by this subscriber anymore, the buffered ones are nacked back to
+				// the consumer so the other subscribers of a durable consumer get them right away
+				consumeCtx.Drain()
+				<-consumeCtx.Closed()
+
+				select {
+				case <-s.closing:
+				case <-handlerCtx.Done():
+				}
+				return
+			}
+
+			consumeCtx.Stop()
+			// messages are not sent to output once Consume stopped
+			<-consumeCtx.Closed()
+		}()
+	}
+
+	if s.config.AckFloor.enabled() {
+		outputWg.Add(1)
+		go func() {
+			defer outputWg.Done()
+			s.watchAckFloors(handlerCtx, handle, subscriptionLogFields(ctx, watermill.LogFields{"topic": topic}))
+		}()
+	}
+
+	go func() {
+		defer s.outputsWg.Done()
+		outputWg.Wait()
+		cancelHandlers()
+		close(output)
+		s.deleteEphemeralConsumer(stream, name)
+		s.subscriptions.untrack(states...)
+	}()
+
+	return output, handle, nil
+}
+
+// pullConsumer returns the stream of topic and its pull consumer, created unless it is a durable consumer which
+// already exists.  The consumer starts at start.
+func (s *Subscriber) pullConsumer(ctx context.Context, topic string, timeouts Timeouts, start StreamPosition) (string, natsjs.Consumer, error) {
+	if s.config.AutoProvision {
+		if err := s.topicInterpreter.ensureStream(topic); err != nil {
+			return "", nil, errors.Wrap(err, "cannot initialize subscribe")
+		}
+	}
+	if s.config.RequireExistingStream {
+		if err := s.topicInterpreter.requireStream(topic); err != nil {
+			return "", nil, err
+		}
+	}
+
+	ctx, cancel := timeoutContext(ctx, s.config.Clock, s.config.SubscribeTimeout)
+	defer cancel()
+
+	subject := s.topicInterpreter.subjects(topic).Primary
+
+	stream := s.topicInterpreter.streamName(topic)
+	if !s.config.RequireExistingStream && s.config.StreamNameCalculator == nil {
+		// like the legacy API, the stream is looked up by subject
+		var err error
+		stream, err = s.jsAPI.StreamNameBySubject(ctx, subject)
+		if err != nil {
+			return "", nil, errors.Wrapf(err, "cannot find the stream of %s", subject)
+		}
+	}
+
+	cfg := s.pullConsumerConfig(topic, subject, timeouts, start)
+
+	if cfg.Durable == "" {
+		consumer, err := s.jsAPI.CreateConsumer(ctx, stream, cfg)
+		return stream, consumer, err
+	}
+
+	// an existing durable consumer keeps its configuration and position, like with the legacy API
+	consumer, err := s.jsAPI.Consumer(ctx, stream, cfg.Durable)
+	if errors.Is(err, natsjs.ErrConsumerNotFound) && !s.config.RequireExistingStream {
+		consumer, err = s.jsAPI.CreateConsumer(ctx, stream, cfg)
+	}
+
+	return stream, consumer, err
+}
+
+// pullConsumerConfig builds the configuration of the pull consumer of topic.
+func (s *Subscriber) pullConsumerConfig(topic, subject string, timeouts Timeouts, start StreamPosition) natsjs.ConsumerConfig {
+	cfg := natsjs.ConsumerConfig{
+		AckPolicy:         natsjs.AckExplicitPolicy,
+		AckWait:           s.config.consumerAckWait(timeouts.ackWait(s.config.AckWaitTimeout)),
+		MaxDeliver:        s.config.MaxDeliver,
+		BackOff:           s.config.BackOff,
+		FilterSubject:     subject,
+		MaxWaiting:        s.config.PullConsumer.MaxWaiting,
+		MaxRequestBatch:   s.config.PullConsumer.MaxRequestBatch,
+		MaxRequestExpires: s.config.PullConsumer.MaxRequestExpires,
+	}
+
+	if s.config.DurableName != "" {
+		cfg.Durable = s.topicInterpreter.durableName(s.config.DurableName, topic)
+	}
+	if s.config.SampleFrequency > 0 {
+		cfg.SampleFrequency = fmt.Sprintf("%d%%", s.config.SampleFrequency)
+	}
+	if s.config.StrictOrdering {
+		cfg.MaxAckPending = 1
+	}
+
+	switch {
+	case start.Sequence > 0:
+		cfg.DeliverPolicy = natsjs.DeliverByStartSequencePolicy
+		cfg.OptStartSeq = start.Sequence
+	case !start.Time.IsZero():
+		startTime := start.Time
+		cfg.DeliverPolicy = natsjs.DeliverByStartTimePolicy
+		cfg.OptStartTime = &startTime
+	case start.Last:
+		cfg.DeliverPolicy = natsjs.DeliverLastPolicy
+	case start.New:
+		cfg.DeliverPolicy = natsjs.DeliverNewPolicy
+	case start.LastPerSubject:
+		cfg.DeliverPolicy = natsjs.DeliverLastPerSubjectPolicy
+	default:
+		cfg.DeliverPolicy = natsjs.DeliverAllPolicy
+	}
+
+	return cfg
+}
+
+// deleteEphemeralConsumer deletes the consumer of a stopped subscription without DurableName, instead of
+// waiting for the server to remove it once inactive.
+func (s *Subscriber) deleteEphemeralConsumer(stream, name string) {
+	if s.config.DurableName != "" {
+		return
+	}
+
+	ctx, cancel := timeoutContext(context.Background(), s.config.Clock, s.config.SubscribeTimeout)
+	defer cancel()
+
+	err := s.jsAPI.DeleteConsumer(ctx, stream, name)
+	if err != nil && !errors.Is(err, natsjs.ErrConsumerNotFound) && !errors.Is(err, nats.ErrConnectionClosed) {
+		s.logger.Error("Cannot delete consumer", err, watermill.LogFields{"stream": stream, "consumer": name})
+	}
+}
+
+// processJetStreamMsg delivers m, received with ClientAPIJetStream, like processMessage.
+func (s *Subscriber) processJetStreamMsg(h *subscriptionHandler, m natsjs.Msg) {
+	select {
+	case <-s.closing:
+		s.nakJetStreamMsg(m, h.logFields)
+		return
+	default:
+	}
+
+	if s.isIntakeStopped() {
+		s.logger.Trace("Intake stopped, message discarded", h.logFields)
+		s.nakJetStreamMsg(m, h.logFields)
+		return
+	}
+
+	atomic.AddInt64(&h.inFlight, 1)
+	defer atomic.AddInt64(&h.inFlight, -1)
+
+	s.logger.Trace("Received message", h.logFields)
+
+	// the message is not bound to a nats.Subscription, so it can not be settled through the copy read here
+	msg, err := s.readMessage(h.ctx, h.topic, &nats.Msg{
+		Subject: m.Subject(),
+		Reply:   m.Reply(),
+		Header:  m.Headers(),
+		Data:    m.Data(),
+	})
+	if err != nil {
+		s.logger.Error("Cannot read message", err, h.logFields)
+
+		var undecodable *UndecodableMessageError
+		if errors.As(err, &undecodable) {
+			if err := m.Term(); err != nil {
+				s.logger.Error("Cannot terminate undecodable message", err, h.logFields)
+			}
+		}
+		return
+	}
+
+	ctx := WithJetStreamMsg(h.ctx, m)
+	msg.SetContext(ctx)
+
+	messageLogFields := s.config.Correlation.logFields(
+		h.logFields.Add(watermill.LogFields{"message_uuid": msg.UUID}),
+		s.config.Correlation.id(msg),
+	)
+	s.logger.Trace("Unmarshaled message", messageLogFields)
+
+	select {
+	case <-s.closing:
+		s.logger.Trace("Closing, message discarded", messageLogFields)
+		s.nakJetStreamMsg(m, messageLogFields)
+		return
+	case <-ctx.Done():
+		s.logger.Trace("Context cancelled, message discarded", messageLogFields)
+		s.nakJetStreamMsg(m, messageLogFields)
+		return
+	case h.output <- msg:
+		s.logger.Trace("Message sent to consumer", messageLogFields)
+	}
+
+	ackTimeout, stopAckTimeout := after(s.config.Clock, h.timeouts.ackWait(s.config.AckWaitTimeout))
+	defer stopAckTimeout()
+
+	stopInProgress := s.startSignalingInProgress(func() {
+		if err := m.InProgress(); err != nil {
+			s.logger.Error("Cannot signal message in progress", err, messageLogFields)
+		}
+	})
+	defer stopInProgress()
+
+	select {
+	case <-msg.Acked():
+		stopInProgress()
+		s.ackJetStreamMsg(ctx, m, messageLogFields)
+		s.releasePayload(msg)
+	case <-msg.Nacked():
+		stopInProgress()
+		s.nakJetStreamMsg(m, messageLogFields)
+		s.releasePayload(msg)
+	case <-ackTimeout:
+		s.logger.Trace("Ack timeout", messageLogFields)
+	case <-s.closing:
+		s.logger.Trace("Closing, message discarded before ack", messageLogFields)
+	case <-ctx.Done():
+		s.logger.Trace("Context cancelled, message discarded before ack", messageLogFields)
+	}
+}
+
+// ackJetStreamMsg acks m once its watermill message was acked, waiting for the server with AckSync.
+func (s *Subscriber) ackJetStreamMsg(ctx context.Context, m natsjs.Msg, logFields watermill.LogFields) {
+	var err error
+
+	if s.config.AckSync {
+		err = m.DoubleAck(ctx)
+	} else {
+		err = m.Ack()
+	}
+
+	if err != nil {
+		s.logger.Error("Cannot send ack", err, logFields)
+		return
+	}
+	s.logger.Trace("Message Acked", logFields)
+}
+
+// nakJetStreamMsg naks m, so it is redelivered right away.
+func (s *Subscriber) nakJetStreamMsg(m natsjs.Msg, logFields watermill.LogFields) {
+	if err := m.Nak(); err != nil {
+		s.logger.Error("Cannot send nak", err, logFields)
+		return
+	}
+	s.logger.Trace("Message Nacked", logFields)
+}
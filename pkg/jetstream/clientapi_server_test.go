@@ -0,0 +1,111 @@
+package jetstream_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-jetstream/pkg/jetstream"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriber_ClientAPIJetStream(t *testing.T) {
+	conn, js := serverConn(t)
+	pub := serverPublisher(t, conn)
+
+	newSubscriber := func(durable string) *jetstream.Subscriber {
+		sub, err := jetstream.NewSubscriberWithNatsConn(conn, jetstream.SubscriberSubscriptionConfig{
+			Unmarshaler:   &jetstream.GobMarshaler{},
+			ClientAPI:     jetstream.ClientAPIJetStream,
+			Consumer:      jetstream.ConsumerConfig{Durable: durable},
+			AutoProvision: true,
+			CloseTimeout:  time.Second,
+		}, watermill.NopLogger{})
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = sub.Close() })
+
+		return sub
+	}
+
+	var published []string
+	for i := 0; i < 3; i++ {
+		msg := message.NewMessage(watermill.NewUUID(), []byte("payload"))
+		require.NoError(t, pub.Publish("orders", msg))
+		published = append(published, msg.UUID)
+	}
+
+	// receive returns the UUIDs of n messages, nacking the first delivery of the first one
+	receive := func(messages <-chan *message.Message, n int) []string {
+		var uuids []string
+		nacked := false
+
+		for len(uuids) < n {
+			select {
+			case msg := <-messages:
+				_, ok := jetstream.JetStreamMsgFromCtx(msg.Context())
+				require.True(t, ok)
+
+				if !nacked {
+					nacked = true
+					msg.Nack()
+					continue
+				}
+				uuids = append(uuids, msg.UUID)
+				msg.Ack()
+			case <-time.After(10 * time.Second):
+				t.Fatalf("received %d of %d messages", len(uuids), n)
+			}
+		}
+
+		return uuids
+	}
+
+	requireClosed := func(messages <-chan *message.Message) {
+		select {
+		case _, ok := <-messages:
+			require.False(t, ok, "no message expected after cancel")
+		case <-time.After(10 * time.Second):
+			t.Fatal("channel not closed after cancel")
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	messages, handle, err := newSubscriber("reports").SubscribeWithHandle(ctx, "orders")
+	require.NoError(t, err)
+
+	require.ElementsMatch(t, published, receive(messages, len(published)))
+
+	durable := "reports_orders"
+	infos, err := handle.ConsumerInfo(ctx)
+	require.NoError(t, err)
+	require.Len(t, infos, 1)
+	require.Equal(t, durable, infos[0].Name)
+	require.Empty(t, infos[0].Config.DeliverSubject, "pull consumer expected")
+
+	require.Eventually(t, func() bool {
+		infos, err := handle.ConsumerInfo(ctx)
+		return err == nil && infos[0].NumAckPending == 0 && infos[0].AckFloor.Stream == 3
+	}, 10*time.Second, 100*time.Millisecond)
+
+	cancel()
+	requireClosed(messages)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	messages, err = newSubscriber("").Subscribe(ctx, "orders")
+	require.NoError(t, err)
+	require.ElementsMatch(t, published, receive(messages, len(published)))
+
+	cancel()
+	requireClosed(messages)
+
+	// the ephemeral consumer is deleted, the durable one is kept
+	var names []string
+	for name := range js.ConsumerNames("orders") {
+		names = append(names, name)
+	}
+	require.Equal(t, []string{durable}, names)
+}
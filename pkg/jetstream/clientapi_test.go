@@ -0,0 +1,98 @@
+package jetstream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	natsjs "github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriberSubscriptionConfig_ClientAPI(t *testing.T) {
+	c := SubscriberSubscriptionConfig{
+		Unmarshaler:        &GobMarshaler{},
+		ClientAPI:          ClientAPIJetStream,
+		Consumer:           ConsumerConfig{Durable: "reports"},
+		SubscribersCount:   2,
+		BackOff:            []time.Duration{time.Second},
+		MaxDeliver:         2,
+		InProgressInterval: time.Second,
+		ConsumerAckWait:    2 * time.Second,
+	}
+	c.setDefaults()
+	require.NoError(t, c.Validate())
+
+	c.SubscribeOptions = []nats.SubOpt{nats.DeliverAll()}
+	c.DropExpired = true
+	c.Backpressure.Policy = BackpressureNak
+
+	var errs ConfigErrors
+	require.ErrorAs(t, c.Validate(), &errs)
+
+	var fields []string
+	for _, err := range errs {
+		fields = append(fields, err.Field)
+	}
+	require.Equal(t, []string{
+		"SubscriberConfig.SubscribeOptions",
+		"SubscriberConfig.Backpressure",
+		"SubscriberConfig.DropExpired",
+	}, fields)
+
+	// the legacy API supports them
+	c.ClientAPI = ClientAPILegacy
+	require.NoError(t, c.Validate())
+
+	c.ClientAPI = ClientAPIJetStream + 1
+	require.ErrorAs(t, c.Validate(), &errs)
+	require.Equal(t, "SubscriberConfig.ClientAPI", errs[0].Field)
+}
+
+func TestSubscriber_pullConsumerConfig(t *testing.T) {
+	s := &Subscriber{
+		config: SubscriberSubscriptionConfig{
+			ClientAPI:      ClientAPIJetStream,
+			DurableName:    "reports",
+			AckWaitTimeout: time.Minute,
+			MaxDeliver:     5,
+			PullConsumer:   PullConsumerConfig{MaxWaiting: 10},
+		},
+		topicInterpreter: newTopicInterpreter(nil, defaultSubjectCalculator, 0),
+	}
+
+	cfg := s.pullConsumerConfig("orders", "orders.*", Timeouts{}, StreamPosition{})
+	require.Equal(t, "reports_orders", cfg.Durable)
+	require.Equal(t, "orders.*", cfg.FilterSubject)
+	require.Equal(t, natsjs.AckExplicitPolicy, cfg.AckPolicy)
+	require.Equal(t, time.Minute, cfg.AckWait)
+	require.Equal(t, 5, cfg.MaxDeliver)
+	require.Equal(t, 10, cfg.MaxWaiting)
+	require.Equal(t, natsjs.DeliverAllPolicy, cfg.DeliverPolicy)
+
+	cfg = s.pullConsumerConfig("orders", "orders.*", Timeouts{AckWaitTimeout: time.Second}, AtSequence(7))
+	require.Equal(t, time.Second, cfg.AckWait)
+	require.Equal(t, natsjs.DeliverByStartSequencePolicy, cfg.DeliverPolicy)
+	require.Equal(t, uint64(7), cfg.OptStartSeq)
+
+	start := time.Now()
+	cfg = s.pullConsumerConfig("orders", "orders.*", Timeouts{}, AtTime(start))
+	require.Equal(t, natsjs.DeliverByStartTimePolicy, cfg.DeliverPolicy)
+	require.Equal(t, start, *cfg.OptStartTime)
+
+	tests := []struct {
+		position StreamPosition
+		want     natsjs.DeliverPolicy
+	}{
+		{position: AtLast(), want: natsjs.DeliverLastPolicy},
+		{position: AtNew(), want: natsjs.DeliverNewPolicy},
+		{position: AtLastPerSubject(), want: natsjs.DeliverLastPerSubjectPolicy},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, s.pullConsumerConfig("orders", "orders.*", Timeouts{}, tt.position).DeliverPolicy)
+	}
+
+	// consumers of subscriptions without DurableName are ephemeral
+	s.config.DurableName = ""
+	require.Empty(t, s.pullConsumerConfig("orders", "orders.*", Timeouts{}, StreamPosition{}).Durable)
+}
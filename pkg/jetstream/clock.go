@@ -0,0 +1,199 @@
+package jetstream
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock is the source of time of a Subscriber, used for AckWaitTimeout, CloseTimeout, Backpressure.Timeout,
+// DropExpired, the delays of retry tiers, ack batching, heartbeat recovery and scheduled messages.  Publishers use
+// it for PublishRetry and UnavailableGracePeriod, repliers for AckWaitTimeout.  It defaults to RealClock, tests can
+// use a ManualClock to expire timeouts without waiting for them.
+//
+// Background loops of other components (leases of PartitionCoordinator and LeaderElection, StreamUsageMonitor,
+// latency reporting and spool replay) always run on the real time.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// NewTimer returns a timer sending the current time on its channel once d elapsed.
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a timer created by a Clock.
+type Timer interface {
+	// C returns the channel the time is sent on when the timer fires.
+	C() <-chan time.Time
+
+	// Stop prevents the timer from firing, it returns false when the timer already fired or was stopped.
+	Stop() bool
+}
+
+// RealClock is the Clock of the real time.
+type RealClock struct{}
+
+// Now returns time.Now.
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewTimer returns a time.Timer.
+func (RealClock) NewTimer(d time.Duration) Timer {
+	return realTimer{timer: time.NewTimer(d)}
+}
+
+type realTimer struct {
+	timer *time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t realTimer) Stop() bool {
+	return t.timer.Stop()
+}
+
+// isRealClock reports whether clock is the real time, nil being the real time for subscribers built without defaults.
+func isRealClock(clock Clock) bool {
+	if clock == nil {
+		return true
+	}
+	_, ok := clock.(RealClock)
+	return ok
+}
+
+// now returns the current time of the clock of the subscriber.
+func (s *Subscriber) now() time.Time {
+	return clockNow(s.config.Clock)
+}
+
+// clockNow returns the current time of clock.
+func clockNow(clock Clock) time.Time {
+	if isRealClock(clock) {
+		return time.Now()
+	}
+	return clock.Now()
+}
+
+// after returns a channel receiving once d elapsed on clock and a function stopping it.
+// The timers of the real clock are pooled, see acquireTimer.
+func after(clock Clock, d time.Duration) (<-chan time.Time, func()) {
+	if isRealClock(clock) {
+		timer := acquireTimer(d)
+		return timer.C, func() { releaseTimer(timer) }
+	}
+
+	timer := clock.NewTimer(d)
+	return timer.C(), func() { timer.Stop() }
+}
+
+// timeoutContext is context.WithTimeout measuring the timeout on clock.
+func timeoutContext(parent context.Context, clock Clock, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if isRealClock(clock) {
+		return context.WithTimeout(parent, timeout)
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	expired, stop := after(clock, timeout)
+
+	go func() {
+		defer stop()
+		select {
+		case <-expired:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// ManualClock is a Clock which only moves when advanced, so tests can expire timeouts deterministically.
+type ManualClock struct {
+	lock   sync.Mutex
+	now    time.Time
+	timers map[*manualTimer]struct{}
+}
+
+// NewManualClock creates a new ManualClock set to now.
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{
+		now:    now,
+		timers: make(map[*manualTimer]struct{}),
+	}
+}
+
+// Now returns the current time of the clock.
+func (c *ManualClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.now
+}
+
+// NewTimer returns a timer firing once the clock was advanced by d.
+func (c *ManualClock) NewTimer(d time.Duration) Timer {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	t := &manualTimer{
+		clock: c,
+		at:    c.now.Add(d),
+		c:     make(chan time.Time, 1),
+	}
+
+	if d <= 0 {
+		t.c <- c.now
+		return t
+	}
+
+	c.timers[t] = struct{}{}
+
+	return t
+}
+
+// Advance moves the clock forward by d, firing the timers which are due.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.now = c.now.Add(d)
+
+	for t := range c.timers {
+		if !t.at.After(c.now) {
+			t.c <- c.now
+			delete(c.timers, t)
+		}
+	}
+}
+
+// Timers returns the number of timers waiting to fire, e.g. to wait until a subscriber waits for an ack
+// before advancing the clock.
+func (c *ManualClock) Timers() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return len(c.timers)
+}
+
+type manualTimer struct {
+	clock *ManualClock
+	at    time.Time
+	c     chan time.Time
+}
+
+func (t *manualTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *manualTimer) Stop() bool {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+
+	_, waiting := t.clock.timers[t]
+	delete(t.clock.timers, t)
+
+	return waiting
+}
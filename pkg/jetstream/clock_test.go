@@ -0,0 +1,95 @@
+package jetstream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManualClock(t *testing.T) {
+	start := time.Now()
+	clock := NewManualClock(start)
+
+	short := clock.NewTimer(time.Second)
+	long := clock.NewTimer(time.Minute)
+	stopped := clock.NewTimer(time.Second)
+	require.Equal(t, 3, clock.Timers())
+
+	require.True(t, stopped.Stop())
+	require.False(t, stopped.Stop())
+
+	clock.Advance(time.Second)
+	require.Equal(t, start.Add(time.Second), clock.Now())
+	require.Equal(t, start.Add(time.Second), <-short.C())
+	require.False(t, short.Stop())
+	require.Equal(t, 1, clock.Timers())
+
+	select {
+	case <-long.C():
+		t.Fatal("timer fired before it was due")
+	default:
+	}
+
+	// timers without duration fire right away
+	require.Equal(t, clock.Now(), <-clock.NewTimer(0).C())
+}
+
+func TestTimeoutContext(t *testing.T) {
+	clock := NewManualClock(time.Now())
+
+	ctx, cancel := timeoutContext(context.Background(), clock, time.Minute)
+	defer cancel()
+
+	require.Eventually(t, func() bool { return clock.Timers() == 1 }, time.Second, time.Millisecond)
+	require.NoError(t, ctx.Err())
+
+	clock.Advance(time.Minute)
+	<-ctx.Done()
+
+	// cancelling stops the timer
+	ctx, cancel = timeoutContext(context.Background(), clock, time.Minute)
+	require.Eventually(t, func() bool { return clock.Timers() == 1 }, time.Second, time.Millisecond)
+	cancel()
+	require.Eventually(t, func() bool { return clock.Timers() == 0 }, time.Second, time.Millisecond)
+	require.Error(t, ctx.Err())
+}
+
+func TestSubscriber_AckWaitTimeoutClock(t *testing.T) {
+	clock := NewManualClock(time.Now())
+	acker := &droppingAcker{}
+
+	s := faultySubscriber(SubscriberSubscriptionConfig{
+		AckWaitTimeout: time.Hour,
+		Clock:          clock,
+	}, clientDecorator{
+		acker: func(msgAcker) msgAcker { return acker },
+	})
+
+	m, err := (&GobMarshaler{}).Marshal("topic", message.NewMessage(watermill.NewUUID(), nil))
+	require.NoError(t, err)
+
+	output := make(chan *message.Message, 1)
+	processed := make(chan struct{})
+	go func() {
+		s.processMessage(&subscriptionHandler{
+			ctx:       context.Background(),
+			topic:     "topic",
+			output:    output,
+			logFields: watermill.LogFields{},
+		}, m)
+		close(processed)
+	}()
+
+	<-output
+	require.Eventually(t, func() bool { return clock.Timers() == 1 }, time.Second, time.Millisecond)
+
+	// the message is dropped without ack or nak once AckWaitTimeout elapsed on the clock
+	clock.Advance(time.Hour)
+	<-processed
+	require.Zero(t, acker.acks)
+	require.Zero(t, acker.naks)
+}
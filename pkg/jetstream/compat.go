@@ -0,0 +1,155 @@
+package jetstream
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// IncompatibleStreamError is returned by Subscribe with VerifyCompatibility when the existing stream or durable
+// consumer of a topic can not deliver the messages of the subscription as the Subscriber expects.
+type IncompatibleStreamError struct {
+	Stream string
+
+	// Consumer is the durable consumer with the problem, empty for problems with the stream.
+	Consumer string
+
+	Problem string
+
+	// Fix suggests how to make the stream or consumer compatible.
+	Fix string
+}
+
+func (e *IncompatibleStreamError) Error() string {
+	target := "stream " + e.Stream
+	if e.Consumer != "" {
+		target = fmt.Sprintf("consumer %s of stream %s", e.Consumer, e.Stream)
+	}
+
+	return fmt.Sprintf("%s is incompatible: %s (%s)", target, e.Problem, e.Fix)
+}
+
+// verifyCompatibility checks that the stream of topic captures the subject of target, that no other consumer of
+// a work queue stream overlaps target and that the durable consumer of target, when it exists, is a push consumer
+// with explicit acks delivering target.  Missing streams and consumers are not checked, they are provisioned
+// or reported on subscribe.
+func (s *Subscriber) verifyCompatibility(topic string, target subscriptionTarget) error {
+	js := s.topicInterpreter.js
+	stream := s.topicInterpreter.streamName(topic)
+
+	streamInfo, err := js.StreamInfo(stream)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "cannot get info of stream %s", stream)
+	}
+
+	subjects := streamInfo.Config.Subjects
+	if len(subjects) == 0 {
+		// streams without subjects capture the subject named after them
+		subjects = []string{stream}
+	}
+	if !subjectsCover(subjects, target.subject) {
+		return &IncompatibleStreamError{
+			Stream:  stream,
+			Problem: fmt.Sprintf("subjects %v do not capture %s", subjects, target.subject),
+			Fix:     "add the subject to the stream or align SubjectCalculator and StreamNameCalculator with it",
+		}
+	}
+
+	if streamInfo.Config.Retention == nats.WorkQueuePolicy {
+		conflict, err := s.workQueueConflict(topic, target)
+		if err != nil {
+			return err
+		}
+		if conflict != nil {
+			return conflict
+		}
+	}
+
+	if s.config.DurableName == "" {
+		return nil
+	}
+
+	durableName := s.targetDurableName(topic, target)
+	consumerInfo, err := js.ConsumerInfo(stream, durableName)
+	if errors.Is(err, nats.ErrConsumerNotFound) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "cannot get info of consumer %s", durableName)
+	}
+
+	incompatible := func(problem, fix string) error {
+		return &IncompatibleStreamError{Stream: stream, Consumer: durableName, Problem: problem, Fix: fix}
+	}
+
+	cfg := consumerInfo.Config
+	switch {
+	case cfg.DeliverSubject == "":
+		return incompatible("it is a pull consumer", "subscribe with SubscribeBatch or recreate it as a push consumer")
+	case cfg.AckPolicy != nats.AckExplicitPolicy:
+		return incompatible(
+			fmt.Sprintf("ack policy is %s", cfg.AckPolicy),
+			"recreate it with the explicit ack policy, messages are acked one by one",
+		)
+	case cfg.FilterSubject != "" && cfg.FilterSubject != target.subject:
+		return incompatible(
+			fmt.Sprintf("it filters %s instead of %s", cfg.FilterSubject, target.subject),
+			"recreate it or change DurableName",
+		)
+	}
+
+	if queueGroup := s.targetQueueGroup(topic, target); cfg.DeliverGroup != queueGroup {
+		return incompatible(
+			fmt.Sprintf("it delivers to queue group %q instead of %q", cfg.DeliverGroup, queueGroup),
+			"recreate it or align QueueGroup with it",
+		)
+	}
+
+	return nil
+}
+
+// subjectsCover reports whether every subject matched by filter is captured by one of subjects.
+func subjectsCover(subjects []string, filter string) bool {
+	for _, subject := range subjects {
+		if subjectCovers(subject, filter) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// subjectCovers reports whether every subject matched by filter is matched by subject.
+func subjectCovers(subject, filter string) bool {
+	subjectTokens := strings.Split(subject, ".")
+	filterTokens := strings.Split(filter, ".")
+
+	for i, token := range subjectTokens {
+		if token == ">" {
+			return len(filterTokens) > i
+		}
+		if i >= len(filterTokens) {
+			return false
+		}
+
+		switch filterTokens[i] {
+		case ">":
+			return false
+		case "*":
+			if token != "*" {
+				return false
+			}
+		default:
+			if token != "*" && token != filterTokens[i] {
+				return false
+			}
+		}
+	}
+
+	return len(filterTokens) == len(subjectTokens)
+}
@@ -0,0 +1,103 @@
+package jetstream
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubjectCovers(t *testing.T) {
+	tests := []struct {
+		subject string
+		filter  string
+		covers  bool
+	}{
+		{subject: "topic.*", filter: "topic.*", covers: true},
+		{subject: "topic.>", filter: "topic.*", covers: true},
+		{subject: "topic.>", filter: "topic.p1.*", covers: true},
+		{subject: ">", filter: "topic.*", covers: true},
+		{subject: "topic.*", filter: "topic.uuid", covers: true},
+		{subject: "topic.uuid", filter: "topic.*", covers: false},
+		{subject: "topic.*", filter: "topic.>", covers: false},
+		{subject: "topic.*", filter: "topic.p1.*", covers: false},
+		{subject: "topic.>", filter: "topic", covers: false},
+		{subject: "other.*", filter: "topic.*", covers: false},
+	}
+
+	for _, tt := range tests {
+		require.Equal(t, tt.covers, subjectCovers(tt.subject, tt.filter), "%s covers %s", tt.subject, tt.filter)
+	}
+}
+
+func TestSubscriber_VerifyCompatibility(t *testing.T) {
+	compatibleConsumer := func() *nats.ConsumerConfig {
+		return &nats.ConsumerConfig{
+			Durable:        "durable_topic",
+			DeliverSubject: "inbox",
+			DeliverGroup:   "group.topic",
+			AckPolicy:      nats.AckExplicitPolicy,
+			FilterSubject:  "topic.*",
+		}
+	}
+
+	tests := []struct {
+		name       string
+		subjects   []string
+		consumer   func(cfg *nats.ConsumerConfig)
+		noStream   bool
+		compatible bool
+	}{
+		{name: "compatible", subjects: []string{"topic.*"}, compatible: true},
+		{name: "missing stream", noStream: true, compatible: true},
+		{name: "wider stream subject", subjects: []string{"topic.>"}, compatible: true},
+		{name: "stream not capturing topic", subjects: []string{"other.*"}},
+		{name: "pull consumer", subjects: []string{"topic.*"}, consumer: func(cfg *nats.ConsumerConfig) {
+			cfg.DeliverSubject = ""
+		}},
+		{name: "ack none", subjects: []string{"topic.*"}, consumer: func(cfg *nats.ConsumerConfig) {
+			cfg.AckPolicy = nats.AckNonePolicy
+		}},
+		{name: "other filter", subjects: []string{"topic.>"}, consumer: func(cfg *nats.ConsumerConfig) {
+			cfg.FilterSubject = "topic.p1.*"
+		}},
+		{name: "other queue group", subjects: []string{"topic.*"}, consumer: func(cfg *nats.ConsumerConfig) {
+			cfg.DeliverGroup = ""
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			js := &provisioningJetStream{
+				streams:   map[string]*nats.StreamConfig{},
+				consumers: map[string]*nats.ConsumerConfig{},
+			}
+			if !tt.noStream {
+				js.streams["topic"] = &nats.StreamConfig{Name: "topic", Subjects: tt.subjects}
+			}
+			consumer := compatibleConsumer()
+			if tt.consumer != nil {
+				tt.consumer(consumer)
+			}
+			js.consumers[consumer.Durable] = consumer
+
+			s := faultySubscriber(SubscriberSubscriptionConfig{
+				DurableName:         "durable",
+				QueueGroup:          "group",
+				VerifyCompatibility: true,
+			}, clientDecorator{})
+			s.topicInterpreter = newSubscriberTopicInterpreter(js, s.config)
+
+			err := s.verifyCompatibility("topic", subscriptionTarget{subject: "topic.*"})
+			if tt.compatible {
+				require.NoError(t, err)
+				return
+			}
+
+			var incompatibleErr *IncompatibleStreamError
+			require.True(t, errors.As(err, &incompatibleErr), "unexpected error: %v", err)
+			require.Equal(t, "topic", incompatibleErr.Stream)
+		})
+	}
+}
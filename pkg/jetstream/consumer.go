@@ -0,0 +1,35 @@
+package jetstream
+
+// ConsumerConfig names the JetStream consumers of the topics a subscriber subscribes to.  It replaces
+// the DurableName and QueueGroup fields of SubscriberConfig, named after their NATS Streaming counterparts.
+type ConsumerConfig struct {
+	// Durable is the name of the durable consumer of a topic (calculated as "{Durable}_{topic}",
+	// see DurableNameCalculator).  The server keeps a durable consumer and its ack state when subscribers
+	// disconnect, so subscriptions with the same Durable resume with the first message which was not acked.
+	Durable string
+
+	// DeliverGroup is the deliver group of the push consumer of a topic (calculated as "{DeliverGroup}.{topic}",
+	// see QueueGroupCalculator).  All subscriptions with the same deliver group share the consumer, each
+	// message is delivered to only one of them.
+	DeliverGroup string
+}
+
+// apply sets the deprecated durableName and queueGroup from c, keeping the ones already set.
+func (c ConsumerConfig) apply(durableName, queueGroup *string) {
+	if *durableName == "" {
+		*durableName = c.Durable
+	}
+	if *queueGroup == "" {
+		*queueGroup = c.DeliverGroup
+	}
+}
+
+// validate adds to errs the fields of c conflicting with the deprecated durableName and queueGroup.
+func (c ConsumerConfig) validate(errs *ConfigErrors, durableName, queueGroup string) {
+	if c.Durable != "" && durableName != "" && c.Durable != durableName {
+		errs.add("SubscriberConfig.Consumer.Durable", "can not be combined with SubscriberConfig.DurableName")
+	}
+	if c.DeliverGroup != "" && queueGroup != "" && c.DeliverGroup != queueGroup {
+		errs.add("SubscriberConfig.Consumer.DeliverGroup", "can not be combined with SubscriberConfig.QueueGroup")
+	}
+}
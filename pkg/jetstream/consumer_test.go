@@ -0,0 +1,39 @@
+package jetstream
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumerConfig(t *testing.T) {
+	c := SubscriberSubscriptionConfig{
+		Unmarshaler:      &GobMarshaler{},
+		SubscribersCount: 3,
+		Consumer:         ConsumerConfig{Durable: "durable", DeliverGroup: "group"},
+	}
+	c.setDefaults()
+
+	require.NoError(t, c.Validate())
+	require.Equal(t, "durable", c.DurableName)
+	require.Equal(t, "group", c.QueueGroup)
+
+	// the deprecated fields can still be used alone
+	c = SubscriberSubscriptionConfig{Unmarshaler: &GobMarshaler{}, DurableName: "durable", QueueGroup: "group"}
+	c.setDefaults()
+
+	require.NoError(t, c.Validate())
+	require.Equal(t, ConsumerConfig{}, c.Consumer)
+
+	c = SubscriberSubscriptionConfig{
+		Unmarshaler: &GobMarshaler{},
+		DurableName: "old",
+		QueueGroup:  "old",
+		Consumer:    ConsumerConfig{Durable: "new", DeliverGroup: "new"},
+	}
+	c.setDefaults()
+
+	var errs ConfigErrors
+	require.ErrorAs(t, c.Validate(), &errs)
+	require.Len(t, errs, 2)
+}
@@ -0,0 +1,92 @@
+package jetstream
+
+import (
+	"context"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/pkg/errors"
+)
+
+// ConsumerUpdate are the settings of live durable consumers changed by UpdateConsumer,
+// e.g. to throttle a misbehaving consumer without a deploy.  Nil fields are left unchanged.
+type ConsumerUpdate struct {
+	// MaxAckPending is the maximum number of messages delivered and not acked yet (-1 for no limit).
+	MaxAckPending *int
+
+	// RateLimit is the delivery rate limit of push consumers in bits per second (0 for no limit).
+	RateLimit *uint64
+
+	// BackOff is the redelivery schedule of the consumer, it must stay shorter than MaxDeliver.
+	BackOff []time.Duration
+}
+
+// Validate ensures configuration is valid before use
+func (u ConsumerUpdate) Validate() error {
+	if u.MaxAckPending != nil && *u.MaxAckPending < -1 {
+		return errors.New("ConsumerUpdate.MaxAckPending can not be lower than -1")
+	}
+	for _, delay := range u.BackOff {
+		if delay <= 0 {
+			return errors.New("ConsumerUpdate.BackOff values must be positive")
+		}
+	}
+
+	return nil
+}
+
+// UpdateConsumer changes the settings of the durable consumers of topic (one per partition when partitioning is
+// enabled) while they are consumed.  Running subscriptions keep consuming, the server applies the new settings to
+// the following deliveries.  Settings not in update are left as they are on the server.
+//
+// Consumers are updated in place, they keep the new settings when the subscriber subscribes again, as existing
+// consumers are not recreated.  It requires DurableName, ephemeral consumers can not be updated.
+func (s *Subscriber) UpdateConsumer(topic string, update ConsumerUpdate) error {
+	if s.config.DurableName == "" {
+		return errors.New("updating consumers requires SubscriberConfig.DurableName")
+	}
+	if err := update.Validate(); err != nil {
+		return err
+	}
+
+	topic, err := sanitizeTopic(topic, s.config.TopicSanitizer, s.config.EscapeTopics, s.config.AutoProvision)
+	if err != nil {
+		return err
+	}
+
+	stream := s.topicInterpreter.streamName(topic)
+
+	for _, target := range s.subscriptionTargets(context.Background(), topic) {
+		durableName := s.targetDurableName(topic, target)
+
+		info, err := s.topicInterpreter.js.ConsumerInfo(stream, durableName)
+		if err != nil {
+			return errors.Wrapf(err, "cannot get consumer %s", durableName)
+		}
+
+		cfg := info.Config
+		if update.MaxAckPending != nil {
+			cfg.MaxAckPending = *update.MaxAckPending
+		}
+		if update.RateLimit != nil {
+			cfg.RateLimit = *update.RateLimit
+		}
+		if update.BackOff != nil {
+			cfg.BackOff = update.BackOff
+		}
+
+		if _, err := s.topicInterpreter.js.UpdateConsumer(stream, &cfg); err != nil {
+			return errors.Wrapf(err, "cannot update consumer %s", durableName)
+		}
+
+		s.logger.Info("Consumer updated", watermill.LogFields{
+			"topic":           topic,
+			"consumer":        durableName,
+			"max_ack_pending": cfg.MaxAckPending,
+			"rate_limit":      cfg.RateLimit,
+			"backoff":         cfg.BackOff,
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package jetstream
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+// updatingJetStream records the consumers updated.
+type updatingJetStream struct {
+	provisioningJetStream
+}
+
+func (js *updatingJetStream) UpdateConsumer(stream string, cfg *nats.ConsumerConfig, opts ...nats.JSOpt) (*nats.ConsumerInfo, error) {
+	if _, ok := js.consumers[cfg.Durable]; !ok {
+		return nil, nats.ErrConsumerNotFound
+	}
+	js.consumers[cfg.Durable] = cfg
+	return &nats.ConsumerInfo{Stream: stream, Name: cfg.Durable, Config: *cfg}, nil
+}
+
+func TestSubscriber_UpdateConsumer(t *testing.T) {
+	js := &updatingJetStream{provisioningJetStream{
+		streams: map[string]*nats.StreamConfig{},
+		consumers: map[string]*nats.ConsumerConfig{
+			"durable_orders_p0": {Durable: "durable_orders_p0", MaxAckPending: 1, RateLimit: 1024, MaxDeliver: 5},
+			"durable_orders_p1": {Durable: "durable_orders_p1", MaxAckPending: 1, RateLimit: 1024, MaxDeliver: 5},
+		},
+	}}
+
+	s := faultySubscriber(SubscriberSubscriptionConfig{
+		DurableName:  "durable",
+		Partitioning: PartitionConfig{Count: 2},
+	}, clientDecorator{})
+	s.topicInterpreter = newTopicInterpreter(js, s.config.SubjectCalculator, 0)
+
+	rateLimit := uint64(0)
+	require.NoError(t, s.UpdateConsumer("orders", ConsumerUpdate{
+		RateLimit: &rateLimit,
+		BackOff:   []time.Duration{time.Second, time.Minute},
+	}))
+
+	for _, name := range []string{"durable_orders_p0", "durable_orders_p1"} {
+		cfg := js.consumers[name]
+		require.Zero(t, cfg.RateLimit)
+		require.Equal(t, []time.Duration{time.Second, time.Minute}, cfg.BackOff)
+
+		// settings which are not updated are kept
+		require.Equal(t, 1, cfg.MaxAckPending)
+		require.Equal(t, 5, cfg.MaxDeliver)
+	}
+
+	err := s.UpdateConsumer("payments", ConsumerUpdate{})
+	require.True(t, errors.Is(err, nats.ErrConsumerNotFound), "unexpected error: %v", err)
+
+	maxAckPending := -2
+	require.EqualError(t, s.UpdateConsumer("orders", ConsumerUpdate{MaxAckPending: &maxAckPending}),
+		"ConsumerUpdate.MaxAckPending can not be lower than -1")
+
+	ephemeral := faultySubscriber(SubscriberSubscriptionConfig{}, clientDecorator{})
+	require.Error(t, ephemeral.UpdateConsumer("orders", ConsumerUpdate{}))
+}
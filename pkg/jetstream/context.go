@@ -0,0 +1,258 @@
+package jetstream
+
+import (
+	"context"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/nats-io/nats.go"
+	natsjs "github.com/nats-io/nats.go/jetstream"
+)
+
+type ctxKey string
+
+const (
+	startPositionKey ctxKey = "start_position"
+	natsMsgKey       ctxKey = "nats_msg"
+	jetStreamMsgKey  ctxKey = "jetstream_msg"
+	partitionsKey    ctxKey = "assigned_partitions"
+	backpressureKey  ctxKey = "backpressure"
+	replySubjectKey  ctxKey = "reply_subject"
+	boundConsumerKey ctxKey = "bound_consumer"
+	tenantKey        ctxKey = "tenant"
+	subscriptionKey  ctxKey = "subscription"
+	timeoutsKey      ctxKey = "timeouts"
+	ephemeralKey     ctxKey = "ephemeral_consumer"
+	topicKey         ctxKey = "topic"
+)
+
+// WithStartPosition returns a context making Subscribe start the subscription at pos,
+// overriding the position configured on the Subscriber for a single call (e.g. for one-off backfills).
+//
+// The position is only applied when the consumer is created, an existing durable consumer keeps its position.
+func WithStartPosition(ctx context.Context, pos StreamPosition) context.Context {
+	return context.WithValue(ctx, startPositionKey, pos)
+}
+
+// StartPositionFromCtx returns the start position set with WithStartPosition.
+func StartPositionFromCtx(ctx context.Context) (StreamPosition, bool) {
+	pos, ok := ctx.Value(startPositionKey).(StreamPosition)
+	return pos, ok
+}
+
+// WithBackpressure returns a context making Subscribe use config instead of the backpressure configured on the Subscriber.
+func WithBackpressure(ctx context.Context, config BackpressureConfig) context.Context {
+	return context.WithValue(ctx, backpressureKey, config)
+}
+
+// BackpressureFromCtx returns the backpressure configuration set with WithBackpressure.
+func BackpressureFromCtx(ctx context.Context) (BackpressureConfig, bool) {
+	config, ok := ctx.Value(backpressureKey).(BackpressureConfig)
+	return config, ok
+}
+
+// WithTimeouts returns a context making Subscribe and SubscribeBatch override the timeouts of the Subscriber
+// (and of SubscriberConfig.TopicTimeouts) with the ones set in timeouts, see Timeouts.
+func WithTimeouts(ctx context.Context, timeouts Timeouts) context.Context {
+	return context.WithValue(ctx, timeoutsKey, timeouts)
+}
+
+// TimeoutsFromCtx returns the timeouts set with WithTimeouts.
+func TimeoutsFromCtx(ctx context.Context) (Timeouts, bool) {
+	timeouts, ok := ctx.Value(timeoutsKey).(Timeouts)
+	return timeouts, ok
+}
+
+// WithEphemeralConsumer returns a context making Subscribe create the ephemeral consumers of the subscription
+// as set in config, see EphemeralConsumerConfig.  Subscribing with it fails when the Subscriber has a DurableName.
+func WithEphemeralConsumer(ctx context.Context, config EphemeralConsumerConfig) context.Context {
+	return context.WithValue(ctx, ephemeralKey, config)
+}
+
+// EphemeralConsumerFromCtx returns the ephemeral consumer configuration set with WithEphemeralConsumer.
+func EphemeralConsumerFromCtx(ctx context.Context) (EphemeralConsumerConfig, bool) {
+	config, ok := ctx.Value(ephemeralKey).(EphemeralConsumerConfig)
+	return config, ok
+}
+
+// subscriptionLabels are the name and log fields set with WithSubscriptionName and WithSubscriptionLogFields.
+type subscriptionLabels struct {
+	name      string
+	logFields watermill.LogFields
+}
+
+func subscriptionLabelsFromCtx(ctx context.Context) subscriptionLabels {
+	labels, _ := ctx.Value(subscriptionKey).(subscriptionLabels)
+	return labels
+}
+
+// WithSubscriptionName returns a context making Subscribe, SubscribeBatch and Replay log name as subscription_name,
+// to correlate the logs of a subscription with the component consuming it.
+func WithSubscriptionName(ctx context.Context, name string) context.Context {
+	labels := subscriptionLabelsFromCtx(ctx)
+	labels.name = name
+	return context.WithValue(ctx, subscriptionKey, labels)
+}
+
+// WithSubscriptionLogFields returns a context making Subscribe, SubscribeBatch and Replay add fields to the logs
+// of the subscription.  Fields set by earlier calls are kept unless overridden.
+func WithSubscriptionLogFields(ctx context.Context, fields watermill.LogFields) context.Context {
+	labels := subscriptionLabelsFromCtx(ctx)
+	labels.logFields = labels.logFields.Add(fields)
+	return context.WithValue(ctx, subscriptionKey, labels)
+}
+
+// SubscriptionNameFromCtx returns the subscription name set with WithSubscriptionName.
+func SubscriptionNameFromCtx(ctx context.Context) (string, bool) {
+	labels := subscriptionLabelsFromCtx(ctx)
+	return labels.name, labels.name != ""
+}
+
+// subscriptionLogFields returns fields extended with the name and log fields of the subscription started with ctx.
+// The fields logged by the Subscriber itself take precedence over custom ones.
+func subscriptionLogFields(ctx context.Context, fields watermill.LogFields) watermill.LogFields {
+	labels := subscriptionLabelsFromCtx(ctx)
+
+	custom := labels.logFields.Add(nil)
+	if labels.name != "" {
+		custom["subscription_name"] = labels.name
+	}
+
+	return custom.Add(fields)
+}
+
+// WithNatsMsg returns a context carrying the raw NATS message m, as set by the Subscriber on delivered messages.
+// It lets handlers and middlewares using NatsMsgFromCtx be tested without a Subscriber.
+func WithNatsMsg(ctx context.Context, m *nats.Msg) context.Context {
+	return context.WithValue(ctx, natsMsgKey, m)
+}
+
+// NatsMsgFromCtx returns the raw NATS message delivered with ctx by the Subscriber, e.g. to signal progress with
+// InProgress while handling a long running message.
+//
+// The Subscriber still acks or naks the NATS message once the watermill message is acked or nacked, so handlers
+// settling it themselves should ack the watermill message too, the second acknowledgement is ignored by the server.
+func NatsMsgFromCtx(ctx context.Context) (*nats.Msg, bool) {
+	m, ok := ctx.Value(natsMsgKey).(*nats.Msg)
+	return m, ok
+}
+
+// NatsReplyFromCtx returns the NATS reply subject of the message delivered with ctx by the Subscriber.
+// For messages of JetStream consumers it is the ack subject, publishing to it settles the message.
+func NatsReplyFromCtx(ctx context.Context) (string, bool) {
+	m, ok := NatsMsgFromCtx(ctx)
+	if !ok || m.Reply == "" {
+		return "", false
+	}
+
+	return m.Reply, true
+}
+
+// MsgMetadataFromCtx returns the JetStream metadata (stream/consumer sequences, delivery count, pending count, timestamp)
+// of the message delivered with ctx by the Subscriber.
+func MsgMetadataFromCtx(ctx context.Context) (*nats.MsgMetadata, bool) {
+	m, ok := NatsMsgFromCtx(ctx)
+	if !ok {
+		return nil, false
+	}
+
+	meta, err := m.Metadata()
+	if err != nil {
+		return nil, false
+	}
+
+	return meta, true
+}
+
+// WithJetStreamMsg returns a context carrying the message m of the jetstream package, as set by the Subscriber on
+// messages delivered with ClientAPIJetStream.
+func WithJetStreamMsg(ctx context.Context, m natsjs.Msg) context.Context {
+	return context.WithValue(ctx, jetStreamMsgKey, m)
+}
+
+// JetStreamMsgFromCtx returns the message of the jetstream package delivered with ctx by a Subscriber consuming
+// with ClientAPIJetStream.  The Subscriber still acks or naks it once the watermill message is acked or nacked.
+func JetStreamMsgFromCtx(ctx context.Context) (natsjs.Msg, bool) {
+	m, ok := ctx.Value(jetStreamMsgKey).(natsjs.Msg)
+	return m, ok
+}
+
+// withTopic returns a context carrying the topic of a subscription, set on the messages it delivers.
+func withTopic(ctx context.Context, topic string) context.Context {
+	return context.WithValue(ctx, topicKey, topic)
+}
+
+// TopicFromCtx returns the topic of the subscription which delivered the message of ctx, after TopicSanitizer
+// and EscapeTopics were applied.  Messages of SubscribeStream carry the topic of their subject.
+func TopicFromCtx(ctx context.Context) (string, bool) {
+	topic, ok := ctx.Value(topicKey).(string)
+	return topic, ok
+}
+
+// StreamFromCtx returns the stream the message delivered with ctx by the Subscriber was stored in.
+func StreamFromCtx(ctx context.Context) (string, bool) {
+	meta, ok := MsgMetadataFromCtx(ctx)
+	if !ok {
+		return "", false
+	}
+
+	return meta.Stream, true
+}
+
+// ConsumerFromCtx returns the name of the consumer which delivered the message of ctx, the name picked by
+// the server for ephemeral consumers.  The subscription name set with WithSubscriptionName is returned
+// by SubscriptionNameFromCtx.
+func ConsumerFromCtx(ctx context.Context) (string, bool) {
+	meta, ok := MsgMetadataFromCtx(ctx)
+	if !ok {
+		return "", false
+	}
+
+	return meta.Consumer, true
+}
+
+// withAssignedPartitions returns a context making Subscribe consume partitions instead of the configured ones.
+func withAssignedPartitions(ctx context.Context, partitions []int) context.Context {
+	return context.WithValue(ctx, partitionsKey, partitions)
+}
+
+func assignedPartitionsFromCtx(ctx context.Context) ([]int, bool) {
+	partitions, ok := ctx.Value(partitionsKey).([]int)
+	return partitions, ok
+}
+
+// WithTenant returns a context making Subscribe consume on the connection of tenant, see SubscriberConfig.TenantCredentials.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey, tenant)
+}
+
+// TenantFromCtx returns the tenant set with WithTenant.
+func TenantFromCtx(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey).(string)
+	return tenant, ok && tenant != ""
+}
+
+// withBoundConsumer returns a context making Subscribe create durable consumers up front and bind them,
+// so they are unsubscribed (and not deleted) when ctx is cancelled.
+func withBoundConsumer(ctx context.Context) context.Context {
+	return context.WithValue(ctx, boundConsumerKey, true)
+}
+
+func boundConsumerFromCtx(ctx context.Context) bool {
+	bound, _ := ctx.Value(boundConsumerKey).(bool)
+	return bound
+}
+
+func withReplySubject(ctx context.Context, reply string) context.Context {
+	if reply == "" {
+		return ctx
+	}
+
+	return context.WithValue(ctx, replySubjectKey, reply)
+}
+
+// ReplySubjectFromCtx returns the NATS reply subject of the request delivered with ctx by a Replier.
+// For messages delivered by the Subscriber, see NatsReplyFromCtx.
+func ReplySubjectFromCtx(ctx context.Context) (string, bool) {
+	reply, ok := ctx.Value(replySubjectKey).(string)
+	return reply, ok
+}
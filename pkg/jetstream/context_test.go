@@ -0,0 +1,64 @@
+package jetstream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriber_SubscriptionContext(t *testing.T) {
+	s := faultySubscriber(SubscriberSubscriptionConfig{AckWaitTimeout: time.Second}, clientDecorator{
+		acker: func(msgAcker) msgAcker { return nopAcker{} },
+	})
+
+	m, err := (&GobMarshaler{}).Marshal("topic", message.NewMessage(watermill.NewUUID(), nil))
+	require.NoError(t, err)
+	stored := storedMsg(time.Now(), m.Header)
+	stored.Data = m.Data
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	output := make(chan *message.Message)
+	go s.processMessage(&subscriptionHandler{
+		ctx:       withTopic(WithSubscriptionName(ctx, "billing"), "topic"),
+		topic:     "topic",
+		output:    output,
+		logFields: watermill.LogFields{},
+	}, stored)
+
+	msg := <-output
+	defer msg.Ack()
+
+	topic, ok := TopicFromCtx(msg.Context())
+	require.True(t, ok)
+	require.Equal(t, "topic", topic)
+
+	stream, ok := StreamFromCtx(msg.Context())
+	require.True(t, ok)
+	require.Equal(t, "topic", stream)
+
+	consumer, ok := ConsumerFromCtx(msg.Context())
+	require.True(t, ok)
+	require.Equal(t, "consumer", consumer)
+
+	name, ok := SubscriptionNameFromCtx(msg.Context())
+	require.True(t, ok)
+	require.Equal(t, "billing", name)
+}
+
+func TestContextAccessors_Missing(t *testing.T) {
+	ctx := WithNatsMsg(context.Background(), &nats.Msg{Subject: "topic.uuid"})
+
+	_, ok := TopicFromCtx(ctx)
+	require.False(t, ok)
+	_, ok = StreamFromCtx(ctx)
+	require.False(t, ok)
+	_, ok = ConsumerFromCtx(ctx)
+	require.False(t, ok)
+}
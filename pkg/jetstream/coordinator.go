@@ -0,0 +1,270 @@
+package jetstream
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// PartitionCoordinatorConfig is the configuration to create a partition coordinator
+type PartitionCoordinatorConfig struct {
+	// Bucket is the KV bucket instance leases are kept in, it is created when missing.
+	Bucket string
+
+	// InstanceID identifies this subscriber instance (defaults to a random ID).  It must be a valid KV key token.
+	InstanceID string
+
+	// LeaseTTL is how long an instance keeps its partitions without renewing its lease (defaults to 15 seconds).
+	// It is the TTL of the bucket, so every coordinator using the bucket needs the same LeaseTTL.
+	LeaseTTL time.Duration
+
+	// RefreshInterval is how often the lease is renewed and the assignment is checked (defaults to a third of LeaseTTL).
+	RefreshInterval time.Duration
+
+	// JetstreamOptions are custom Jetstream options for a connection.
+	JetstreamOptions []nats.JSOpt
+}
+
+func (c *PartitionCoordinatorConfig) setDefaults() {
+	if c.InstanceID == "" {
+		c.InstanceID = watermill.NewShortUUID()
+	}
+	if c.LeaseTTL <= 0 {
+		c.LeaseTTL = 15 * time.Second
+	}
+	if c.RefreshInterval <= 0 {
+		c.RefreshInterval = c.LeaseTTL / 3
+	}
+}
+
+// Validate ensures configuration is valid before use
+func (c PartitionCoordinatorConfig) Validate() error {
+	if c.Bucket == "" {
+		return errors.New("PartitionCoordinatorConfig.Bucket is missing")
+	}
+
+	if c.RefreshInterval >= c.LeaseTTL {
+		return errors.New("PartitionCoordinatorConfig.RefreshInterval must be shorter than PartitionCoordinatorConfig.LeaseTTL")
+	}
+
+	return nil
+}
+
+// PartitionCoordinator assigns the partitions of a topic to the live subscriber instances.
+//
+// Every instance keeps a lease in a KV bucket, renewed every RefreshInterval and expiring after LeaseTTL.
+// Partitions are spread round-robin over the sorted IDs of the live instances, so every instance computes the
+// same assignment without further coordination, and partitions move when instances join or leave.
+// While the assignment converges a partition may briefly be consumed by two instances, which is safe as partition
+// consumers are durable and deliver one message at a time.
+type PartitionCoordinator struct {
+	kv     nats.KeyValue
+	config PartitionCoordinatorConfig
+	logger watermill.LoggerAdapter
+}
+
+// NewPartitionCoordinator creates a new PartitionCoordinator with the provided nats connection.
+func NewPartitionCoordinator(conn *nats.Conn, config PartitionCoordinatorConfig, logger watermill.LoggerAdapter) (*PartitionCoordinator, error) {
+	config.setDefaults()
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	js, err := conn.JetStream(config.JetstreamOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	kv, err := ensureKeyValue(js, &nats.KeyValueConfig{
+		Bucket: config.Bucket,
+		TTL:    config.LeaseTTL,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &PartitionCoordinator{
+		kv:     kv,
+		config: config,
+		logger: logger,
+	}, nil
+}
+
+// Subscribe consumes the partitions of topic assigned to this instance with subscriber until ctx is cancelled,
+// resubscribing whenever the assignment changes.
+//
+// The subscriber needs Partitioning and a DurableName, so partition consumers keep their position when they are handed over.
+func (c *PartitionCoordinator) Subscribe(ctx context.Context, subscriber *Subscriber, topic string) (<-chan *message.Message, error) {
+	if !subscriber.config.Partitioning.enabled() {
+		return nil, errors.New("partition coordination requires SubscriberConfig.Partitioning")
+	}
+	if subscriber.config.DurableName == "" {
+		return nil, errors.New("partition coordination requires SubscriberConfig.DurableName")
+	}
+
+	logFields := watermill.LogFields{
+		"topic":       topic,
+		"instance_id": c.config.InstanceID,
+	}
+
+	if err := c.renewLease(topic); err != nil {
+		return nil, err
+	}
+
+	output := make(chan *message.Message)
+
+	go func() {
+		defer close(output)
+
+		forwardersWg := &sync.WaitGroup{}
+		defer forwardersWg.Wait()
+
+		var assigned []int
+		cancelSubscription := func() {}
+		defer func() { cancelSubscription() }()
+
+		defer func() {
+			if err := c.kv.Delete(c.leaseKey(topic)); err != nil {
+				c.logger.Error("Cannot release lease", err, logFields)
+			}
+		}()
+
+		ticker := time.NewTicker(c.config.RefreshInterval)
+		defer ticker.Stop()
+
+		for {
+			members, err := c.members(topic)
+			if err != nil {
+				c.logger.Error("Cannot list instances", err, logFields)
+			} else if next := assignPartitions(members, c.config.InstanceID, subscriber.config.Partitioning.Count); !equalPartitions(assigned, next) {
+				c.logger.Info("Partitions assigned", logFields.Add(watermill.LogFields{"partitions": next, "instances": len(members)}))
+
+				cancelSubscription()
+				cancelSubscription = func() {}
+				assigned = next
+
+				if len(assigned) > 0 {
+					subCtx, cancel := context.WithCancel(ctx)
+					messages, err := subscriber.Subscribe(withAssignedPartitions(subCtx, assigned), topic)
+					if err != nil {
+						cancel()
+						c.logger.Error("Cannot subscribe to assigned partitions", err, logFields)
+						// retried on the next refresh
+						assigned = nil
+					} else {
+						cancelSubscription = cancel
+
+						forwardersWg.Add(1)
+						go func() {
+							defer forwardersWg.Done()
+							forwardMessages(ctx, messages, output)
+						}()
+					}
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-subscriber.closing:
+				return
+			case <-ticker.C:
+			}
+
+			if err := c.renewLease(topic); err != nil {
+				c.logger.Error("Cannot renew lease", err, logFields)
+			}
+		}
+	}()
+
+	return output, nil
+}
+
+func (c *PartitionCoordinator) leaseKey(topic string) string {
+	return topic + "." + c.config.InstanceID
+}
+
+func (c *PartitionCoordinator) renewLease(topic string) error {
+	if _, err := c.kv.Put(c.leaseKey(topic), []byte(time.Now().UTC().Format(time.RFC3339))); err != nil {
+		return errors.Wrap(err, "cannot renew lease")
+	}
+
+	return nil
+}
+
+// members returns the IDs of the instances holding a lease for topic.
+func (c *PartitionCoordinator) members(topic string) ([]string, error) {
+	keys, err := c.kv.Keys()
+	if errors.Is(err, nats.ErrNoKeysFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := topic + "."
+
+	var members []string
+	for _, key := range keys {
+		if strings.HasPrefix(key, prefix) {
+			members = append(members, strings.TrimPrefix(key, prefix))
+		}
+	}
+
+	return members, nil
+}
+
+// assignPartitions spreads partitions round-robin over the sorted members, returning the partitions of instanceID.
+func assignPartitions(members []string, instanceID string, partitions int) []int {
+	sorted := append([]string(nil), members...)
+	sort.Strings(sorted)
+
+	index := sort.SearchStrings(sorted, instanceID)
+	if index == len(sorted) || sorted[index] != instanceID {
+		return nil
+	}
+
+	var assigned []int
+	for p := index; p < partitions; p += len(sorted) {
+		assigned = append(assigned, p)
+	}
+
+	return assigned
+}
+
+func equalPartitions(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// forwardMessages sends the messages of input to output until input is closed.
+func forwardMessages(ctx context.Context, input <-chan *message.Message, output chan<- *message.Message) {
+	for msg := range input {
+		select {
+		case output <- msg:
+		case <-ctx.Done():
+			msg.Nack()
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package jetstream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssignPartitions(t *testing.T) {
+	tests := []struct {
+		name       string
+		members    []string
+		instanceID string
+		partitions int
+		want       []int
+	}{
+		{name: "single instance", members: []string{"a"}, instanceID: "a", partitions: 3, want: []int{0, 1, 2}},
+		{name: "first of two", members: []string{"b", "a"}, instanceID: "a", partitions: 5, want: []int{0, 2, 4}},
+		{name: "second of two", members: []string{"b", "a"}, instanceID: "b", partitions: 5, want: []int{1, 3}},
+		{name: "more instances than partitions", members: []string{"a", "b", "c"}, instanceID: "c", partitions: 2, want: nil},
+		{name: "without lease", members: []string{"a", "b"}, instanceID: "c", partitions: 4, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, assignPartitions(tt.members, tt.instanceID, tt.partitions))
+		})
+	}
+}
+
+func TestPartitionCoordinatorConfig_Validate(t *testing.T) {
+	config := PartitionCoordinatorConfig{Bucket: "leases"}
+	config.setDefaults()
+	require.NoError(t, config.Validate())
+	require.NotEmpty(t, config.InstanceID)
+	require.Equal(t, 5*time.Second, config.RefreshInterval)
+
+	require.Error(t, PartitionCoordinatorConfig{LeaseTTL: time.Second, RefreshInterval: time.Millisecond}.Validate())
+	require.Error(t, PartitionCoordinatorConfig{Bucket: "leases", LeaseTTL: time.Second, RefreshInterval: time.Second}.Validate())
+}
@@ -0,0 +1,116 @@
+package jetstream
+
+import (
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// CorrelationIDMetadataKey is the default metadata key of correlation ids, the key of the CorrelationID
+	// middleware of the watermill router, so correlation ids flow between handlers and services.
+	CorrelationIDMetadataKey = "correlation_id"
+
+	// CorrelationIDHdr is the NATS header holding the correlation id of published messages, so it can be read
+	// without unmarshaling (e.g. by non-watermill consumers or with the nats CLI).
+	CorrelationIDHdr = "Watermill-Correlation-Id"
+)
+
+// CorrelationConfig propagates correlation ids, enabled unless Disabled is set.
+//
+// The publisher generates a correlation id for messages without one and copies it to the CorrelationIDHdr header,
+// whatever the marshaler.  The subscriber restores the metadata from the header when the message lacks it, and
+// both log it as correlation_id.
+type CorrelationConfig struct {
+	// Disabled turns correlation id propagation off.
+	Disabled bool
+
+	// MetadataKey is the metadata key holding the correlation id (defaults to CorrelationIDMetadataKey).
+	MetadataKey string
+
+	// Generate generates the correlation id of published messages without one (defaults to watermill.NewUUID).
+	Generate func() string
+}
+
+func (c *CorrelationConfig) setDefaults() {
+	if c.MetadataKey == "" {
+		c.MetadataKey = CorrelationIDMetadataKey
+	}
+	if c.Generate == nil {
+		c.Generate = watermill.NewUUID
+	}
+}
+
+// metadataKey returns MetadataKey, the default for configs built without defaults.
+func (c CorrelationConfig) metadataKey() string {
+	if c.MetadataKey == "" {
+		return CorrelationIDMetadataKey
+	}
+	return c.MetadataKey
+}
+
+// ensure sets a generated correlation id on msg when it has none, returning its correlation id.
+func (c CorrelationConfig) ensure(msg *message.Message) string {
+	if c.Disabled {
+		return ""
+	}
+
+	id := msg.Metadata.Get(c.metadataKey())
+	if id == "" {
+		if c.Generate != nil {
+			id = c.Generate()
+		} else {
+			id = watermill.NewUUID()
+		}
+		if msg.Metadata == nil {
+			msg.Metadata = make(message.Metadata)
+		}
+		msg.Metadata.Set(c.metadataKey(), id)
+	}
+
+	return id
+}
+
+// setHeader copies the correlation id to the header of the marshaled message.
+func (c CorrelationConfig) setHeader(m *nats.Msg, id string) {
+	if id == "" {
+		return
+	}
+
+	if m.Header == nil {
+		m.Header = nats.Header{}
+	}
+	m.Header.Set(CorrelationIDHdr, id)
+}
+
+// restore sets the correlation id of the header of m on msg when it has none.
+func (c CorrelationConfig) restore(msg *message.Message, m *nats.Msg) {
+	if c.Disabled || msg.Metadata.Get(c.metadataKey()) != "" {
+		return
+	}
+
+	if id := m.Header.Get(CorrelationIDHdr); id != "" {
+		if msg.Metadata == nil {
+			msg.Metadata = make(message.Metadata)
+		}
+		msg.Metadata.Set(c.metadataKey(), id)
+	}
+}
+
+// id returns the correlation id of msg, empty when propagation is disabled.
+func (c CorrelationConfig) id(msg *message.Message) string {
+	if c.Disabled {
+		return ""
+	}
+
+	return msg.Metadata.Get(c.metadataKey())
+}
+
+// logFields adds the correlation id to fields.
+func (c CorrelationConfig) logFields(fields watermill.LogFields, id string) watermill.LogFields {
+	if id == "" {
+		return fields
+	}
+
+	return fields.Add(watermill.LogFields{"correlation_id": id})
+}
@@ -0,0 +1,80 @@
+package jetstream
+
+import (
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func correlationPublisher(js *faultyJetStream, correlation CorrelationConfig) *Publisher {
+	config := PublisherPublishConfig{
+		Marshaler:   &GobMarshaler{},
+		Correlation: correlation,
+	}
+	config.setDefaults()
+
+	p := &Publisher{config: config, logger: watermill.NopLogger{}}
+	p.decorateClient(clientDecorator{
+		jetStream: func(nats.JetStream) nats.JetStream { return js },
+	})
+
+	return p
+}
+
+func TestPublisher_Correlation(t *testing.T) {
+	js := &faultyJetStream{}
+	p := correlationPublisher(js, CorrelationConfig{Generate: func() string { return "generated" }})
+
+	withID := message.NewMessage(watermill.NewUUID(), nil)
+	withID.Metadata.Set(CorrelationIDMetadataKey, "existing")
+
+	require.NoError(t, p.Publish("orders", message.NewMessage(watermill.NewUUID(), nil), withID))
+	require.Len(t, js.published, 2)
+
+	for i, expected := range []string{"generated", "existing"} {
+		require.Equal(t, expected, js.published[i].Header.Get(CorrelationIDHdr))
+
+		published, err := (&GobMarshaler{}).Unmarshal(js.published[i])
+		require.NoError(t, err)
+		require.Equal(t, expected, published.Metadata.Get(CorrelationIDMetadataKey))
+	}
+}
+
+func TestPublisher_CorrelationDisabled(t *testing.T) {
+	js := &faultyJetStream{}
+	p := correlationPublisher(js, CorrelationConfig{Disabled: true})
+
+	msg := message.NewMessage(watermill.NewUUID(), nil)
+	require.NoError(t, p.Publish("orders", msg))
+	require.Len(t, js.published, 1)
+
+	require.Empty(t, msg.Metadata.Get(CorrelationIDMetadataKey))
+	require.Empty(t, js.published[0].Header.Get(CorrelationIDHdr))
+}
+
+func TestSubscriber_CorrelationRestore(t *testing.T) {
+	s := faultySubscriber(SubscriberSubscriptionConfig{
+		Correlation: CorrelationConfig{MetadataKey: "trace"},
+	}, clientDecorator{})
+
+	m, err := (&GobMarshaler{}).Marshal("orders", message.NewMessage(watermill.NewUUID(), nil))
+	require.NoError(t, err)
+	m.Header = nats.Header{CorrelationIDHdr: []string{"from-header"}}
+
+	msg, err := s.unmarshal("orders", m)
+	require.NoError(t, err)
+	require.Equal(t, "from-header", msg.Metadata.Get("trace"))
+
+	withID := message.NewMessage(watermill.NewUUID(), nil)
+	withID.Metadata.Set("trace", "from-metadata")
+	m, err = (&GobMarshaler{}).Marshal("orders", withID)
+	require.NoError(t, err)
+	m.Header = nats.Header{CorrelationIDHdr: []string{"from-header"}}
+
+	msg, err = s.unmarshal("orders", m)
+	require.NoError(t, err)
+	require.Equal(t, "from-metadata", msg.Metadata.Get("trace"))
+}
@@ -0,0 +1,143 @@
+package jetstream
+
+import (
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// DeduplicationKeyFunc is a function used to calculate the deduplication key of a message.
+// Keys must be valid KV keys (letters, digits, '-', '_', '/', '=' and '.').
+type DeduplicationKeyFunc func(msg *message.Message) string
+
+// KVDeduplicatorConfig is the configuration to create a KV backed deduplicator
+type KVDeduplicatorConfig struct {
+	// Bucket is the KV bucket processed message keys are recorded in, it is created when missing.
+	Bucket string
+
+	// TTL is how long processed message keys are remembered (defaults to 24 hours).
+	TTL time.Duration
+
+	// KeyFunc calculates the deduplication key of a message (defaults to the message UUID).
+	KeyFunc DeduplicationKeyFunc
+
+	// JetstreamOptions are custom Jetstream options for a connection.
+	JetstreamOptions []nats.JSOpt
+}
+
+func (c *KVDeduplicatorConfig) setDefaults() {
+	if c.TTL <= 0 {
+		c.TTL = 24 * time.Hour
+	}
+	if c.KeyFunc == nil {
+		c.KeyFunc = defaultDeduplicationKey
+	}
+}
+
+// Validate ensures configuration is valid before use
+func (c KVDeduplicatorConfig) Validate() error {
+	if c.Bucket == "" {
+		return errors.New("KVDeduplicatorConfig.Bucket is missing")
+	}
+
+	return nil
+}
+
+func defaultDeduplicationKey(msg *message.Message) string {
+	return msg.UUID
+}
+
+// KVDeduplicator records processed messages in a JetStream KV bucket and skips duplicates before they reach the handler,
+// making non-idempotent handlers safe under at-least-once delivery.
+type KVDeduplicator struct {
+	kv     nats.KeyValue
+	config KVDeduplicatorConfig
+	logger watermill.LoggerAdapter
+}
+
+// NewKVDeduplicator creates a new KVDeduplicator with the provided nats connection.
+func NewKVDeduplicator(conn *nats.Conn, config KVDeduplicatorConfig, logger watermill.LoggerAdapter) (*KVDeduplicator, error) {
+	config.setDefaults()
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	js, err := conn.JetStream(config.JetstreamOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	kv, err := ensureKeyValue(js, &nats.KeyValueConfig{
+		Bucket: config.Bucket,
+		TTL:    config.TTL,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &KVDeduplicator{
+		kv:     kv,
+		config: config,
+		logger: logger,
+	}, nil
+}
+
+// IsDuplicate checks whether the message was already processed.
+func (d *KVDeduplicator) IsDuplicate(msg *message.Message) (bool, error) {
+	_, err := d.kv.Get(d.config.KeyFunc(msg))
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, nats.ErrKeyNotFound), errors.Is(err, nats.ErrKeyDeleted):
+		return false, nil
+	default:
+		return false, errors.Wrap(err, "cannot check deduplication key")
+	}
+}
+
+// MarkProcessed records the message as processed.
+func (d *KVDeduplicator) MarkProcessed(msg *message.Message) error {
+	if _, err := d.kv.Put(d.config.KeyFunc(msg), []byte(time.Now().UTC().Format(time.RFC3339))); err != nil {
+		return errors.Wrap(err, "cannot record deduplication key")
+	}
+
+	return nil
+}
+
+// Middleware is a watermill handler middleware which acks duplicates without calling the handler
+// and records messages as processed once the handler succeeded.
+func (d *KVDeduplicator) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		logFields := watermill.LogFields{"message_uuid": msg.UUID}
+
+		duplicate, err := d.IsDuplicate(msg)
+		if err != nil {
+			return nil, err
+		}
+
+		if duplicate {
+			d.logger.Debug("Duplicate message skipped", logFields)
+			return nil, nil
+		}
+
+		produced, err := h(msg)
+		if err != nil {
+			return produced, err
+		}
+
+		if err := d.MarkProcessed(msg); err != nil {
+			// the handler succeeded, so the message is not failed - it may be processed again on redelivery
+			d.logger.Error("Cannot mark message as processed", err, logFields)
+		}
+
+		return produced, nil
+	}
+}
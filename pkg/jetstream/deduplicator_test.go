@@ -0,0 +1,42 @@
+package jetstream
+
+import (
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKVDeduplicator_Middleware(t *testing.T) {
+	config := KVDeduplicatorConfig{Bucket: "dedup"}
+	config.setDefaults()
+
+	d := &KVDeduplicator{
+		kv:     newMemoryKeyValue(),
+		config: config,
+		logger: watermill.NopLogger{},
+	}
+
+	calls := 0
+	h := d.Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		calls++
+		return nil, nil
+	})
+
+	_, err := h(message.NewMessage("uuid-1", nil))
+	require.NoError(t, err)
+
+	_, err = h(message.NewMessage("uuid-1", nil))
+	require.NoError(t, err)
+
+	_, err = h(message.NewMessage("uuid-2", nil))
+	require.NoError(t, err)
+
+	require.Equal(t, 2, calls)
+}
+
+func TestKVDeduplicatorConfig_Validate(t *testing.T) {
+	require.Error(t, KVDeduplicatorConfig{}.Validate())
+	require.NoError(t, KVDeduplicatorConfig{Bucket: "dedup"}.Validate())
+}
@@ -0,0 +1,162 @@
+package jetstream
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// DeduplicationWindowConfig skips messages delivered again while they are processed, or shortly after they
+// were acked, remembering the keys of recent messages in memory.  It covers the redelivery of a message
+// whose handler outlives the AckWait of the consumer, for consumers which can not use KVDeduplicator.
+// It is disabled unless Size is set.
+//
+// A message delivered again while it is processed is dropped, the processed delivery settles it.  A message
+// delivered again once it was acked (e.g. because the ack was lost, or published twice with the same
+// Nats-Msg-Id) is acked without reaching the consumer.  Nacked messages are forgotten, so they are processed
+// again on redelivery.  Keys are only remembered by this subscriber, duplicates delivered to other instances
+// are not detected.
+type DeduplicationWindowConfig struct {
+	// Size is the number of message keys remembered, the least recently used key is forgotten past it.
+	Size int
+
+	// TTL is how long the key of an acked message is remembered (defaults to 10 minutes).
+	TTL time.Duration
+
+	// KeyFunc calculates the deduplication key of a message (defaults to its Nats-Msg-Id, or its UUID without one).
+	KeyFunc DeduplicationKeyFunc
+}
+
+func (c DeduplicationWindowConfig) enabled() bool {
+	return c.Size > 0
+}
+
+func (c *DeduplicationWindowConfig) setDefaults() {
+	if c.TTL == 0 {
+		c.TTL = 10 * time.Minute
+	}
+	if c.KeyFunc == nil {
+		c.KeyFunc = msgIdDeduplicationKey
+	}
+}
+
+// Validate ensures configuration is valid before use
+func (c DeduplicationWindowConfig) Validate() error {
+	if c.Size < 0 {
+		return errors.New("DeduplicationWindowConfig.Size can not be negative")
+	}
+	if c.TTL < 0 {
+		return errors.New("DeduplicationWindowConfig.TTL can not be negative")
+	}
+
+	return nil
+}
+
+// dedupState is the state of a message key in the deduplication window.
+type dedupState int
+
+const (
+	dedupNew dedupState = iota
+	dedupProcessing
+	dedupProcessed
+)
+
+type dedupEntry struct {
+	key        string
+	processing bool
+	expires    time.Time
+}
+
+// dedupWindow is an LRU of the keys of messages being processed or recently acked.
+type dedupWindow struct {
+	config DeduplicationWindowConfig
+	clock  Clock
+
+	lock    sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+func newDedupWindow(config DeduplicationWindowConfig, clock Clock) *dedupWindow {
+	return &dedupWindow{
+		config:  config,
+		clock:   clock,
+		entries: make(map[string]*list.Element, config.Size),
+		lru:     list.New(),
+	}
+}
+
+// begin records key as being processed, returning the state it was in before.
+func (w *dedupWindow) begin(key string) dedupState {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if elem, ok := w.entries[key]; ok {
+		entry := elem.Value.(*dedupEntry)
+		if entry.processing {
+			w.lru.MoveToFront(elem)
+			return dedupProcessing
+		}
+		if w.clock.Now().Before(entry.expires) {
+			w.lru.MoveToFront(elem)
+			return dedupProcessed
+		}
+
+		entry.processing = true
+		w.lru.MoveToFront(elem)
+		return dedupNew
+	}
+
+	w.entries[key] = w.lru.PushFront(&dedupEntry{key: key, processing: true})
+
+	for w.lru.Len() > w.config.Size {
+		oldest := w.lru.Back()
+		w.lru.Remove(oldest)
+		delete(w.entries, oldest.Value.(*dedupEntry).key)
+	}
+
+	return dedupNew
+}
+
+// end records key as processed for TTL when acked, and forgets it otherwise.
+func (w *dedupWindow) end(key string, acked bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	elem, ok := w.entries[key]
+	if !ok {
+		return
+	}
+
+	if !acked {
+		w.lru.Remove(elem)
+		delete(w.entries, key)
+		return
+	}
+
+	entry := elem.Value.(*dedupEntry)
+	entry.processing = false
+	entry.expires = w.clock.Now().Add(w.config.TTL)
+}
+
+// skipDuplicate reports whether m is a duplicate and was settled, recording its key as being
+// processed otherwise.
+func (s *Subscriber) skipDuplicate(m *nats.Msg, key string, logFields watermill.LogFields) bool {
+	switch s.dedup.begin(key) {
+	case dedupProcessing:
+		s.logger.Debug("Message delivered again while processed, skipped", logFields)
+		return true
+	case dedupProcessed:
+		s.logger.Debug("Message already processed, acked", logFields)
+		if err := s.acker.Ack(m); err != nil {
+			s.logger.Error("Cannot send ack", err, logFields)
+		}
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,95 @@
+package jetstream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeduplicationWindowConfig_Validate(t *testing.T) {
+	require.NoError(t, DeduplicationWindowConfig{}.Validate())
+	require.NoError(t, DeduplicationWindowConfig{Size: 100, TTL: time.Minute}.Validate())
+	require.Error(t, DeduplicationWindowConfig{Size: -1}.Validate())
+	require.Error(t, DeduplicationWindowConfig{Size: 100, TTL: -1}.Validate())
+}
+
+func TestDedupWindow(t *testing.T) {
+	clock := NewManualClock(time.Now())
+	w := newDedupWindow(DeduplicationWindowConfig{Size: 2, TTL: time.Minute}, clock)
+
+	require.Equal(t, dedupNew, w.begin("a"))
+	require.Equal(t, dedupProcessing, w.begin("a"))
+
+	// nacked messages are forgotten
+	w.end("a", false)
+	require.Equal(t, dedupNew, w.begin("a"))
+
+	// acked messages are remembered for TTL
+	w.end("a", true)
+	require.Equal(t, dedupProcessed, w.begin("a"))
+	clock.Advance(time.Minute)
+	require.Equal(t, dedupNew, w.begin("a"))
+	w.end("a", true)
+
+	// the least recently used key is forgotten past Size
+	require.Equal(t, dedupNew, w.begin("b"))
+	w.end("b", true)
+	require.Equal(t, dedupProcessed, w.begin("a"))
+	require.Equal(t, dedupNew, w.begin("c"))
+	require.Equal(t, dedupProcessed, w.begin("a"))
+	require.Equal(t, dedupNew, w.begin("b"))
+}
+
+func TestSubscriber_DeduplicationWindow(t *testing.T) {
+	acker := &settlingAcker{}
+	s := faultySubscriber(SubscriberSubscriptionConfig{
+		AckWaitTimeout:      time.Second,
+		DeduplicationWindow: DeduplicationWindowConfig{Size: 10},
+	}, clientDecorator{
+		acker: func(msgAcker) msgAcker { return acker },
+	})
+	s.dedup = newDedupWindow(s.config.DeduplicationWindow, s.config.Clock)
+
+	m, err := (&GobMarshaler{}).Marshal("topic", message.NewMessage(watermill.NewUUID(), nil))
+	require.NoError(t, err)
+	m.Header = nats.Header{nats.MsgIdHdr: []string{"order-1"}}
+
+	delivery := func() *nats.Msg {
+		stored := storedMsg(time.Now(), m.Header)
+		stored.Data = m.Data
+		return stored
+	}
+
+	output := make(chan *message.Message, 1)
+	h := &subscriptionHandler{
+		ctx:       context.Background(),
+		topic:     "topic",
+		output:    output,
+		logFields: watermill.LogFields{},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.processMessage(h, delivery())
+	}()
+	msg := <-output
+
+	// delivered again while processed, dropped without settling it
+	s.processMessage(h, delivery())
+	require.Empty(t, output)
+
+	msg.Ack()
+	<-done
+	require.Equal(t, []string{"ack"}, acker.calls)
+
+	// delivered again once acked, acked without reaching the consumer
+	s.processMessage(h, delivery())
+	require.Empty(t, output)
+	require.Equal(t, []string{"ack", "ack"}, acker.calls)
+}
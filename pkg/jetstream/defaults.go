@@ -0,0 +1,67 @@
+package jetstream
+
+import (
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// DefaultPublisherConfig returns a publisher configuration for production use, connecting to url as clientName:
+// the connection reconnects forever, streams are provisioned on first use and message UUIDs are tracked as
+// Nats-Msg-Id for deduplication.  Fields can be adjusted before passing it to NewPublisher.
+func DefaultPublisherConfig(url, clientName string) PublisherConfig {
+	return PublisherConfig{
+		URL:           url,
+		NatsOptions:   defaultNatsOptions(clientName),
+		Marshaler:     &NATSMarshaler{},
+		AutoProvision: true,
+		TrackMsgId:    true,
+	}
+}
+
+// DefaultSubscriberConfig returns a subscriber configuration for production use, connecting to url as clientName:
+// the connection reconnects forever, streams are provisioned on first use, and every instance of the service shares
+// a durable queue consumer named after clientName, so messages are load balanced and consumption resumes after restarts.
+// Fields can be adjusted before passing it to NewSubscriber.
+func DefaultSubscriberConfig(url, clientName string) SubscriberConfig {
+	name := durableClientName(clientName)
+
+	return SubscriberConfig{
+		URL:              url,
+		NatsOptions:      defaultNatsOptions(clientName),
+		Unmarshaler:      &NATSMarshaler{},
+		QueueGroup:       name,
+		DurableName:      name,
+		SubscribersCount: 1,
+		AckWaitTimeout:   30 * time.Second,
+		CloseTimeout:     30 * time.Second,
+		SubscribeTimeout: 30 * time.Second,
+		AutoProvision:    true,
+		SubscribeOptions: []nats.SubOpt{nats.DeliverAll(), nats.AckExplicit()},
+		Backpressure: BackpressureConfig{
+			Policy:     BackpressureBuffer,
+			BufferSize: 64,
+		},
+	}
+}
+
+func defaultNatsOptions(clientName string) []nats.Option {
+	return []nats.Option{
+		nats.Name(clientName),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(time.Second),
+	}
+}
+
+// durableClientName turns clientName into a valid durable name and queue group, which can not contain
+// subject tokens separators, wildcards or whitespace.
+func durableClientName(clientName string) string {
+	return strings.Map(func(r rune) rune {
+		if invalidNameRune(r) {
+			return '_'
+		}
+		return r
+	}, clientName)
+}
@@ -0,0 +1,29 @@
+package jetstream
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultPublisherConfig(t *testing.T) {
+	c := DefaultPublisherConfig("nats://localhost:4222", "orders-service")
+	c.setDefaults()
+
+	require.NoError(t, c.Validate())
+	require.Equal(t, "nats://localhost:4222", c.URL)
+	require.True(t, c.AutoProvision)
+	require.True(t, c.TrackMsgId)
+	require.NotEmpty(t, c.NatsOptions)
+}
+
+func TestDefaultSubscriberConfig(t *testing.T) {
+	c := DefaultSubscriberConfig("nats://localhost:4222", "orders.service v2")
+
+	require.Equal(t, "orders_service_v2", c.DurableName)
+	require.Equal(t, "orders_service_v2", c.QueueGroup)
+
+	subscriptionConfig := c.GetSubscriberSubscriptionConfig()
+	subscriptionConfig.setDefaults()
+	require.NoError(t, subscriptionConfig.Validate())
+}
@@ -0,0 +1,79 @@
+package jetstream
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// ChannelDeliveryConfig configures channel based delivery: the NATS client pushes the messages of a subscription
+// into a buffered channel drained by a fixed pool of workers, instead of calling a callback per message from
+// a single goroutine.  It improves throughput when handlers are slower than the delivery of messages.
+type ChannelDeliveryConfig struct {
+	// Workers is the number of goroutines processing the messages of every subscription,
+	// channel based delivery is disabled when it is 0.
+	Workers int
+
+	// BufferSize is the capacity of the channel of every subscription (defaults to 256).  The NATS client drops
+	// messages when the channel is full (they are redelivered after AckWaitTimeout), so it should cover the
+	// messages the server pushes ahead (MaxAckPending).
+	BufferSize int
+}
+
+func (c *ChannelDeliveryConfig) setDefaults() {
+	if c.BufferSize <= 0 {
+		c.BufferSize = 256
+	}
+}
+
+// Validate ensures configuration is valid before use
+func (c ChannelDeliveryConfig) Validate() error {
+	if c.Workers < 0 {
+		return errors.New("ChannelDeliveryConfig.Workers can not be negative")
+	}
+
+	return nil
+}
+
+func (c ChannelDeliveryConfig) enabled() bool {
+	return c.Workers > 0
+}
+
+// subscribeFunc creates the NATS subscription of a target to subject in queueGroup.
+type subscribeFunc func(subject, queueGroup string, opts ...nats.SubOpt) (*nats.Subscription, error)
+
+// callbackDelivery subscribes with cb called for every message.
+func (s *Subscriber) callbackDelivery(cb nats.MsgHandler) subscribeFunc {
+	return func(subject, queueGroup string, opts ...nats.SubOpt) (*nats.Subscription, error) {
+		return s.js.QueueSubscribe(subject, queueGroup, cb, opts...)
+	}
+}
+
+// channelDelivery subscribes with messages pushed into ch.
+func (s *Subscriber) channelDelivery(ch chan *nats.Msg) subscribeFunc {
+	return func(subject, queueGroup string, opts ...nats.SubOpt) (*nats.Subscription, error) {
+		return s.js.ChanQueueSubscribe(subject, queueGroup, ch, opts...)
+	}
+}
+
+// startDeliveryWorkers starts the workers passing the messages of ch to process until closing or ctx is done,
+// calling done when each of them stops.  Messages left in ch are redelivered by the server.
+func (s *Subscriber) startDeliveryWorkers(ctx context.Context, ch <-chan *nats.Msg, process nats.MsgHandler, done func()) {
+	for i := 0; i < s.config.ChannelDelivery.Workers; i++ {
+		go func() {
+			defer done()
+
+			for {
+				select {
+				case m := <-ch:
+					process(m)
+				case <-s.closing:
+					return
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+}
@@ -0,0 +1,104 @@
+package jetstream
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+// chanJetStream records the channels of channel based subscriptions.
+type chanJetStream struct {
+	nats.JetStream
+	channels chan chan *nats.Msg
+}
+
+func (js *chanJetStream) ChanQueueSubscribe(subj, queue string, ch chan *nats.Msg, opts ...nats.SubOpt) (*nats.Subscription, error) {
+	js.channels <- ch
+	return &nats.Subscription{}, nil
+}
+
+// countingAcker counts acks.
+type countingAcker struct {
+	nopAcker
+	lock sync.Mutex
+	acks int
+}
+
+func (a *countingAcker) Ack(*nats.Msg) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.acks++
+	return nil
+}
+
+func TestChannelDeliveryConfig_Validate(t *testing.T) {
+	require.NoError(t, ChannelDeliveryConfig{}.Validate())
+	require.NoError(t, ChannelDeliveryConfig{Workers: 4}.Validate())
+	require.Error(t, ChannelDeliveryConfig{Workers: -1}.Validate())
+
+	c := ChannelDeliveryConfig{Workers: 4}
+	c.setDefaults()
+	require.Equal(t, 256, c.BufferSize)
+}
+
+func TestSubscriber_ChannelDelivery(t *testing.T) {
+	js := &chanJetStream{channels: make(chan chan *nats.Msg, 1)}
+	acker := &countingAcker{}
+
+	s := faultySubscriber(SubscriberSubscriptionConfig{
+		ChannelDelivery: ChannelDeliveryConfig{Workers: 4},
+	}, clientDecorator{
+		jetStream: func(nats.JetStream) nats.JetStream { return js },
+		acker:     func(msgAcker) msgAcker { return acker },
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	output, err := s.Subscribe(ctx, "topic")
+	require.NoError(t, err)
+
+	ch := <-js.channels
+	require.Equal(t, 256, cap(ch))
+
+	const messagesCount = 8
+	for i := 0; i < messagesCount; i++ {
+		m, err := (&GobMarshaler{}).Marshal("topic", message.NewMessage(watermill.NewUUID(), nil))
+		require.NoError(t, err)
+		ch <- m
+	}
+
+	// all workers hold a message before any of them is acked
+	var received []*message.Message
+	for i := 0; i < 4; i++ {
+		select {
+		case msg := <-output:
+			received = append(received, msg)
+		case <-time.After(time.Second):
+			t.Fatal("messages are not processed concurrently")
+		}
+	}
+	for _, msg := range received {
+		msg.Ack()
+	}
+
+	for i := 4; i < messagesCount; i++ {
+		(<-output).Ack()
+	}
+
+	require.Eventually(t, func() bool {
+		acker.lock.Lock()
+		defer acker.lock.Unlock()
+		return acker.acks == messagesCount
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	for range output {
+	}
+}
@@ -0,0 +1,233 @@
+package jetstream
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// HandlerErrorMetadataKey is the metadata key holding the error recorded with RecordHandlerError.
+	HandlerErrorMetadataKey = "handler_error"
+
+	// DeadLetterReasonHdr is the NATS header holding why a message was dead lettered.
+	DeadLetterReasonHdr = "Watermill-Dead-Letter-Reason"
+
+	// DeadLetterSubjectHdr is the NATS header holding the subject a dead lettered message was received on.
+	DeadLetterSubjectHdr = "Watermill-Dead-Letter-Subject"
+
+	// DeadLetterTopicHdr is the NATS header holding the topic a dead lettered message was received on.
+	DeadLetterTopicHdr = "Watermill-Dead-Letter-Topic"
+)
+
+// Disposition is how a handled message is settled with JetStream.
+type Disposition int
+
+const (
+	// DispositionDefault acks an acked message and naks a nacked one, going through retry tiers when configured.
+	DispositionDefault Disposition = iota
+
+	// DispositionAck acks the message.
+	DispositionAck
+
+	// DispositionNak naks the message, so it is redelivered immediately.
+	DispositionNak
+
+	// DispositionNakWithDelay naks the message, so it is redelivered after Decision.Delay.
+	DispositionNakWithDelay
+
+	// DispositionTerm terminates the message, so it is never redelivered.
+	DispositionTerm
+
+	// DispositionDeadLetter republishes the message to its dead letter topic and terminates it.
+	DispositionDeadLetter
+)
+
+func (d Disposition) String() string {
+	switch d {
+	case DispositionDefault:
+		return "default"
+	case DispositionAck:
+		return "ack"
+	case DispositionNak:
+		return "nak"
+	case DispositionNakWithDelay:
+		return "nak_with_delay"
+	case DispositionTerm:
+		return "term"
+	case DispositionDeadLetter:
+		return "dead_letter"
+	default:
+		return "unknown"
+	}
+}
+
+// Decision is the disposition of a handled message, returned by a DispositionClassifier.
+type Decision struct {
+	Disposition Disposition
+
+	// Delay is the redelivery delay of DispositionNakWithDelay.
+	Delay time.Duration
+
+	// Reason is sent in the DeadLetterReasonHdr header of dead lettered messages.
+	Reason string
+}
+
+// DispositionClassifier decides how a message is settled once the consumer acked or nacked it,
+// e.g. from the error recorded with RecordHandlerError.
+type DispositionClassifier func(msg *message.Message, acked bool) Decision
+
+// DeadLetterTopicCalculator is a function used to calculate the dead letter topic of the given topic.
+type DeadLetterTopicCalculator func(topic string) string
+
+// DispositionConfig centralizes the retry policy of Subscribe in the subscriber.
+type DispositionConfig struct {
+	// Classifier decides how handled messages are settled, messages are acked or nacked as usual when it is nil.
+	Classifier DispositionClassifier
+
+	// DeadLetterTopicCalculator calculates the topic of DispositionDeadLetter (defaults to "{topic}_dlq").
+	// Messages are republished in NATS wire format with their original topic in DeadLetterTopicHdr, so they
+	// can be redriven to it with Publisher.Redrive.
+	DeadLetterTopicCalculator DeadLetterTopicCalculator
+}
+
+func (c *DispositionConfig) setDefaults() {
+	if c.DeadLetterTopicCalculator == nil {
+		c.DeadLetterTopicCalculator = defaultDeadLetterTopicCalculator
+	}
+}
+
+func defaultDeadLetterTopicCalculator(topic string) string {
+	return fmt.Sprintf("%s_dlq", topic)
+}
+
+type handlerErrorKey struct{}
+
+// RecordHandlerError records why the handler failed msg, for the DispositionClassifier.
+// The error message is also stored in the HandlerErrorMetadataKey metadata.
+func RecordHandlerError(msg *message.Message, err error) {
+	msg.Metadata.Set(HandlerErrorMetadataKey, err.Error())
+	msg.SetContext(context.WithValue(msg.Context(), handlerErrorKey{}, err))
+}
+
+// HandlerErrorFromMsg returns the error recorded with RecordHandlerError, which can be inspected with errors.As.
+func HandlerErrorFromMsg(msg *message.Message) (error, bool) {
+	err, ok := msg.Context().Value(handlerErrorKey{}).(error)
+	return err, ok
+}
+
+type decisionKey struct{}
+
+// SetDecision makes the Subscriber settle msg with decision once it is acked or nacked, instead of asking the
+// DispositionClassifier, e.g. for router middlewares dead lettering or delaying the redelivery of failed messages.
+// It only applies to messages delivered by Subscribe.
+func SetDecision(msg *message.Message, decision Decision) {
+	msg.SetContext(context.WithValue(msg.Context(), decisionKey{}, decision))
+}
+
+// DecisionFromMsg returns the decision set with SetDecision.
+func DecisionFromMsg(msg *message.Message) (Decision, bool) {
+	decision, ok := msg.Context().Value(decisionKey{}).(Decision)
+	return decision, ok
+}
+
+// settleMsg acks or naks a message once the consumer handled it, as decided with SetDecision or by the disposition classifier.
+func (s *Subscriber) settleMsg(
+	ctx context.Context,
+	topic string,
+	msg *message.Message,
+	m *nats.Msg,
+	acked bool,
+	logFields watermill.LogFields,
+) {
+	decision, ok := DecisionFromMsg(msg)
+	if !ok && s.config.Disposition.Classifier != nil {
+		decision = s.config.Disposition.Classifier(msg, acked)
+	}
+
+	if decision.Disposition != DispositionDefault {
+		logFields = logFields.Add(watermill.LogFields{"disposition": decision.Disposition.String()})
+	}
+
+	var err error
+
+	switch decision.Disposition {
+	case DispositionAck:
+		s.ackMsg(ctx, topic, m, logFields)
+		return
+	case DispositionNak:
+		err = s.acker.Nak(m)
+	case DispositionNakWithDelay:
+		err = s.acker.NakWithDelay(m, decision.Delay)
+	case DispositionTerm:
+		err = s.acker.Term(m)
+	case DispositionDeadLetter:
+		s.deadLetter(topic, m, decision.Reason, logFields)
+		return
+	default:
+		if acked {
+			s.ackMsg(ctx, topic, m, logFields)
+		} else {
+			s.nakMsg(topic, m, logFields)
+		}
+		return
+	}
+
+	if err != nil {
+		s.logger.Error("Cannot settle message", err, logFields)
+		return
+	}
+	s.logger.Trace("Message settled", logFields)
+}
+
+// deadLetter republishes a message to the dead letter topic of topic and terminates it,
+// naking it when it could not be republished.
+func (s *Subscriber) deadLetter(topic string, m *nats.Msg, reason string, logFields watermill.LogFields) {
+	dlqTopic := s.config.Disposition.DeadLetterTopicCalculator(topic)
+	logFields = logFields.Add(watermill.LogFields{"dlq_topic": dlqTopic})
+
+	if err := s.republish(dlqTopic, m, nats.Header{
+		DeadLetterReasonHdr:  []string{reason},
+		DeadLetterSubjectHdr: []string{m.Subject},
+		DeadLetterTopicHdr:   []string{topic},
+	}); err != nil {
+		s.logger.Error("Cannot dead letter message", err, logFields)
+		if err := s.acker.Nak(m); err != nil {
+			s.logger.Error("Cannot send nak", err, logFields)
+		}
+		return
+	}
+
+	if err := s.acker.Term(m); err != nil {
+		s.logger.Error("Cannot terminate dead lettered message", err, logFields)
+		return
+	}
+
+	s.logger.Trace("Message dead lettered", logFields)
+}
+
+// republish publishes the raw NATS message m to topic with the extra headers, provisioning topic when needed.
+func (s *Subscriber) republish(topic string, m *nats.Msg, extra nats.Header) error {
+	if s.config.AutoProvision {
+		if err := s.topicInterpreter.ensureStream(topic); err != nil {
+			return err
+		}
+	}
+
+	header := copyHeader(m.Header)
+	for k, v := range extra {
+		header[k] = v
+	}
+
+	_, err := s.js.PublishMsg(&nats.Msg{
+		Subject: PublishSubject(topic, watermill.NewUUID()),
+		Header:  header,
+		Data:    m.Data,
+	})
+
+	return err
+}
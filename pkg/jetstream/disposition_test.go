@@ -0,0 +1,162 @@
+package jetstream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// settlingAcker records how messages were settled.
+type settlingAcker struct {
+	calls []string
+	delay time.Duration
+}
+
+func (a *settlingAcker) Ack(*nats.Msg) error     { a.calls = append(a.calls, "ack"); return nil }
+func (a *settlingAcker) AckSync(*nats.Msg) error { a.calls = append(a.calls, "ack_sync"); return nil }
+func (a *settlingAcker) Nak(*nats.Msg) error     { a.calls = append(a.calls, "nak"); return nil }
+func (a *settlingAcker) Term(*nats.Msg) error    { a.calls = append(a.calls, "term"); return nil }
+
+func (a *settlingAcker) InProgress(*nats.Msg) error {
+	a.calls = append(a.calls, "in_progress")
+	return nil
+}
+
+func (a *settlingAcker) NakWithDelay(_ *nats.Msg, delay time.Duration) error {
+	a.calls = append(a.calls, "nak_with_delay")
+	a.delay = delay
+	return nil
+}
+
+type poisonError struct{}
+
+func (poisonError) Error() string { return "poison" }
+
+func TestSubscriber_SettleMsg(t *testing.T) {
+	classifier := func(msg *message.Message, acked bool) Decision {
+		err, ok := HandlerErrorFromMsg(msg)
+		if !ok {
+			return Decision{}
+		}
+
+		var poison poisonError
+		if errors.As(err, &poison) {
+			return Decision{Disposition: DispositionDeadLetter, Reason: err.Error()}
+		}
+
+		switch msg.Metadata.Get("policy") {
+		case "ack":
+			return Decision{Disposition: DispositionAck}
+		case "nak":
+			return Decision{Disposition: DispositionNak}
+		case "term":
+			return Decision{Disposition: DispositionTerm}
+		default:
+			return Decision{Disposition: DispositionNakWithDelay, Delay: time.Minute}
+		}
+	}
+
+	tests := []struct {
+		name       string
+		classifier DispositionClassifier
+		acked      bool
+		policy     string
+		handlerErr error
+		calls      []string
+		deadLetter bool
+	}{
+		{name: "acked without classifier", acked: true, calls: []string{"ack"}},
+		{name: "nacked without classifier", calls: []string{"nak"}},
+		{name: "no handler error", classifier: classifier, acked: true, calls: []string{"ack"}},
+		{name: "ack", classifier: classifier, policy: "ack", handlerErr: errors.New("ignored"), calls: []string{"ack"}},
+		{name: "nak", classifier: classifier, policy: "nak", handlerErr: errors.New("failed"), calls: []string{"nak"}},
+		{name: "term", classifier: classifier, policy: "term", handlerErr: errors.New("failed"), calls: []string{"term"}},
+		{name: "nak with delay", classifier: classifier, handlerErr: errors.New("failed"), calls: []string{"nak_with_delay"}},
+		{
+			name:       "dead letter",
+			classifier: classifier,
+			handlerErr: errors.Wrap(poisonError{}, "cannot handle"),
+			calls:      []string{"term"},
+			deadLetter: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acker := &settlingAcker{}
+			js := &faultyJetStream{}
+			s := faultySubscriber(SubscriberSubscriptionConfig{
+				Disposition: DispositionConfig{Classifier: tt.classifier},
+			}, clientDecorator{
+				jetStream: func(nats.JetStream) nats.JetStream { return js },
+				acker:     func(msgAcker) msgAcker { return acker },
+			})
+
+			msg := message.NewMessage(watermill.NewUUID(), nil)
+			msg.Metadata.Set("policy", tt.policy)
+			if tt.handlerErr != nil {
+				RecordHandlerError(msg, tt.handlerErr)
+				require.Equal(t, tt.handlerErr.Error(), msg.Metadata.Get(HandlerErrorMetadataKey))
+			}
+
+			m := &nats.Msg{Subject: "orders.1", Data: []byte("data")}
+			s.settleMsg(context.Background(), "orders", msg, m, tt.acked, watermill.LogFields{})
+
+			require.Equal(t, tt.calls, acker.calls)
+			if tt.calls[0] == "nak_with_delay" {
+				require.Equal(t, time.Minute, acker.delay)
+			}
+
+			if !tt.deadLetter {
+				require.Empty(t, js.published)
+				return
+			}
+
+			require.Len(t, js.published, 1)
+			dead := js.published[0]
+			require.Regexp(t, `^orders_dlq\.`, dead.Subject)
+			require.Equal(t, []byte("data"), dead.Data)
+			require.Equal(t, "cannot handle: poison", dead.Header.Get(DeadLetterReasonHdr))
+			require.Equal(t, "orders.1", dead.Header.Get(DeadLetterSubjectHdr))
+		})
+	}
+}
+
+func TestSubscriber_DeadLetterPublishFailure(t *testing.T) {
+	acker := &settlingAcker{}
+	s := faultySubscriber(SubscriberSubscriptionConfig{}, clientDecorator{
+		jetStream: func(nats.JetStream) nats.JetStream { return &faultyJetStream{publishErr: nats.ErrTimeout} },
+		acker:     func(msgAcker) msgAcker { return acker },
+	})
+
+	s.deadLetter("orders", &nats.Msg{Subject: "orders.1"}, "poison", watermill.LogFields{})
+
+	// the message is redelivered instead of being lost
+	require.Equal(t, []string{"nak"}, acker.calls)
+}
+
+func TestSubscriber_SetDecision(t *testing.T) {
+	acker := &settlingAcker{}
+	s := faultySubscriber(SubscriberSubscriptionConfig{
+		Disposition: DispositionConfig{Classifier: func(*message.Message, bool) Decision {
+			return Decision{Disposition: DispositionTerm}
+		}},
+	}, clientDecorator{
+		acker: func(msgAcker) msgAcker { return acker },
+	})
+
+	msg := message.NewMessage(watermill.NewUUID(), nil)
+	SetDecision(msg, Decision{Disposition: DispositionNakWithDelay, Delay: time.Second})
+
+	s.settleMsg(context.Background(), "orders", msg, &nats.Msg{Subject: "orders.1"}, false, watermill.LogFields{})
+
+	// the decision set on the message takes precedence over the classifier
+	require.Equal(t, []string{"nak_with_delay"}, acker.calls)
+	require.Equal(t, time.Second, acker.delay)
+}
@@ -0,0 +1,108 @@
+package jetstream
+
+import (
+	"fmt"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+const (
+	// EncodingHdr is the NATS header naming the codec the payload of a message is encoded with (e.g. "gzip").
+	EncodingHdr = "Watermill-Encoding"
+
+	// EncryptionHdr is the NATS header naming the scheme the payload of a message is encrypted with.
+	EncryptionHdr = "Watermill-Encryption"
+)
+
+// UndecodableMessageError is returned when a message is encoded or encrypted (see EncodingHdr and EncryptionHdr)
+// with a codec the subscriber does not decode, see EncodingConfig.
+type UndecodableMessageError struct {
+	// Header is EncodingHdr or EncryptionHdr.
+	Header string
+	Value  string
+}
+
+func (e *UndecodableMessageError) Error() string {
+	return fmt.Sprintf("message payload has %s %q, which the subscriber does not decode", e.Header, e.Value)
+}
+
+// UndecodablePolicy decides how a message the subscriber can not decode is settled.
+type UndecodablePolicy int
+
+const (
+	// UndecodableTerm terminates the message, it is not redelivered.
+	UndecodableTerm UndecodablePolicy = iota
+
+	// UndecodableQuarantine republishes the message to the quarantine topic of its topic (see QuarantineConfig)
+	// and terminates it, even when Quarantine is not enabled.
+	UndecodableQuarantine
+)
+
+// EncodingConfig declares the encodings and encryptions of payloads the subscriber decodes, e.g. with a
+// custom Unmarshaler or transformer.  A message whose EncodingHdr or EncryptionHdr names another one is not
+// delivered to handlers, which would otherwise receive undecoded bytes: an UndecodableMessageError is logged
+// and the message is settled according to Policy.  Messages without these headers are always delivered.
+type EncodingConfig struct {
+	// Encodings are the values of EncodingHdr decoded by the subscriber.
+	Encodings []string
+
+	// Encryptions are the values of EncryptionHdr decrypted by the subscriber.
+	Encryptions []string
+
+	// Policy decides how undecodable messages are settled (defaults to UndecodableTerm).
+	Policy UndecodablePolicy
+}
+
+// Validate ensures configuration is valid before use
+func (c EncodingConfig) Validate() error {
+	if c.Policy < UndecodableTerm || c.Policy > UndecodableQuarantine {
+		return errors.Errorf("unknown undecodable policy %d", c.Policy)
+	}
+
+	return nil
+}
+
+// check ensures the subscriber decodes the encoding and the encryption of m.
+func (c EncodingConfig) check(m *nats.Msg) error {
+	if err := checkDecodes(m, EncodingHdr, c.Encodings); err != nil {
+		return err
+	}
+
+	return checkDecodes(m, EncryptionHdr, c.Encryptions)
+}
+
+func checkDecodes(m *nats.Msg, header string, decoded []string) error {
+	if m.Header == nil {
+		return nil
+	}
+
+	value := m.Header.Get(header)
+	if value == "" {
+		return nil
+	}
+
+	for _, d := range decoded {
+		if d == value {
+			return nil
+		}
+	}
+
+	return &UndecodableMessageError{Header: header, Value: value}
+}
+
+// undecodable settles a message of topic which the subscriber can not decode according to EncodingConfig.Policy.
+func (s *Subscriber) undecodable(topic string, m *nats.Msg, err error, logFields watermill.LogFields) {
+	if s.config.Encoding.Policy == UndecodableQuarantine {
+		s.quarantine(topic, m, err, logFields)
+		return
+	}
+
+	if err := s.acker.Term(m); err != nil {
+		s.logger.Error("Cannot terminate undecodable message", err, logFields)
+		return
+	}
+
+	s.logger.Info("Undecodable message terminated", logFields.Add(watermill.LogFields{"reason": err.Error()}))
+}
@@ -0,0 +1,85 @@
+package jetstream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriber_Encoding(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      EncodingConfig
+		header      nats.Header
+		delivered   bool
+		calls       []string
+		quarantined bool
+	}{
+		{name: "plain", delivered: true},
+		{name: "declared encoding", config: EncodingConfig{Encodings: []string{"gzip"}}, header: nats.Header{EncodingHdr: []string{"gzip"}}, delivered: true},
+		{name: "unknown encoding", config: EncodingConfig{Encodings: []string{"gzip"}}, header: nats.Header{EncodingHdr: []string{"zstd"}}, calls: []string{"term"}},
+		{name: "unknown encryption", header: nats.Header{EncryptionHdr: []string{"aes-gcm"}}, calls: []string{"term"}},
+		{
+			name:        "quarantined",
+			config:      EncodingConfig{Policy: UndecodableQuarantine},
+			header:      nats.Header{EncodingHdr: []string{"gzip"}},
+			calls:       []string{"term"},
+			quarantined: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acker := &settlingAcker{}
+			js := &faultyJetStream{}
+			s := faultySubscriber(SubscriberSubscriptionConfig{Encoding: tt.config}, clientDecorator{
+				jetStream: func(nats.JetStream) nats.JetStream { return js },
+				acker:     func(msgAcker) msgAcker { return acker },
+			})
+
+			m, err := s.config.Unmarshaler.(Marshaler).Marshal("orders", message.NewMessage(watermill.NewUUID(), []byte("payload")))
+			require.NoError(t, err)
+			if m.Header == nil {
+				m.Header = nats.Header{}
+			}
+			for k, v := range tt.header {
+				m.Header[k] = v
+			}
+
+			msg, err := s.unmarshal("orders", m)
+			if tt.delivered {
+				require.NoError(t, err)
+				require.Equal(t, "payload", string(msg.Payload))
+				return
+			}
+
+			var undecodable *UndecodableMessageError
+			require.True(t, errors.As(err, &undecodable))
+
+			output := make(chan *message.Message, 1)
+			s.processMessage(&subscriptionHandler{
+				ctx:       context.Background(),
+				topic:     "orders",
+				output:    output,
+				logFields: watermill.LogFields{},
+			}, m)
+
+			require.Empty(t, output)
+			require.Equal(t, tt.calls, acker.calls)
+
+			if !tt.quarantined {
+				require.Empty(t, js.published)
+				return
+			}
+
+			require.Len(t, js.published, 1)
+			require.Regexp(t, `^orders_quarantine\.`, js.published[0].Subject)
+			require.Contains(t, js.published[0].Header.Get(QuarantineErrorHdr), `Watermill-Encoding "gzip"`)
+		})
+	}
+}
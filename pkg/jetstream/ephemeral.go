@@ -0,0 +1,43 @@
+package jetstream
+
+import (
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// EphemeralConsumerConfig labels the ephemeral consumers of a subscription and sets their lifetime,
+// see WithEphemeralConsumer.
+type EphemeralConsumerConfig struct {
+	// Name is set as description of the consumers, so dashboards (e.g. nats consumer ls) show what they are
+	// consumed by instead of their random names.  The NATS client does not support named ephemeral consumers yet,
+	// their names are still picked by the server.
+	Name string
+
+	// InactiveThreshold is how long the server keeps the consumers once their subscription is gone
+	// (the server default is used when zero).
+	InactiveThreshold time.Duration
+}
+
+// Validate ensures configuration is valid before use
+func (c EphemeralConsumerConfig) Validate() error {
+	if c.InactiveThreshold < 0 {
+		return errors.New("EphemeralConsumerConfig.InactiveThreshold can not be negative")
+	}
+
+	return nil
+}
+
+// subOpts returns the subscription options creating consumers as configured.
+func (c EphemeralConsumerConfig) subOpts() []nats.SubOpt {
+	var opts []nats.SubOpt
+	if c.Name != "" {
+		opts = append(opts, nats.Description(c.Name))
+	}
+	if c.InactiveThreshold > 0 {
+		opts = append(opts, nats.InactiveThreshold(c.InactiveThreshold))
+	}
+
+	return opts
+}
@@ -0,0 +1,35 @@
+package jetstream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEphemeralConsumerConfig(t *testing.T) {
+	require.Empty(t, EphemeralConsumerConfig{}.subOpts())
+	require.Len(t, EphemeralConsumerConfig{Name: "billing-dashboard", InactiveThreshold: time.Minute}.subOpts(), 2)
+
+	require.Error(t, EphemeralConsumerConfig{InactiveThreshold: -time.Second}.Validate())
+}
+
+func TestSubscriber_WithEphemeralConsumer(t *testing.T) {
+	decorator := clientDecorator{
+		jetStream: func(nats.JetStream) nats.JetStream { return &faultyJetStream{} },
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = WithEphemeralConsumer(ctx, EphemeralConsumerConfig{Name: "billing-dashboard", InactiveThreshold: time.Minute})
+
+	s := faultySubscriber(SubscriberSubscriptionConfig{}, decorator)
+	_, err := s.Subscribe(ctx, "orders")
+	require.NoError(t, err)
+
+	s = faultySubscriber(SubscriberSubscriptionConfig{DurableName: "durable"}, decorator)
+	_, err = s.Subscribe(ctx, "orders")
+	require.Error(t, err)
+}
@@ -0,0 +1,197 @@
+package jetstream
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+const (
+	// AnyVersion disables the expected version check of EventStore.Append.
+	AnyVersion uint64 = math.MaxUint64
+
+	// EventVersionMetadataKey is the metadata key holding the version (stream sequence) of an event read from an EventStore.
+	EventVersionMetadataKey = "event_version"
+)
+
+// ErrWrongExpectedVersion is returned by EventStore.Append when the event stream is not at the expected version.
+var ErrWrongExpectedVersion = errors.New("wrong expected version")
+
+// EventStoreConfig is the configuration to create an event store
+type EventStoreConfig struct {
+	// Topic is the topic (JetStream stream) holding the events of all event streams.
+	Topic string
+
+	// Marshaler is used to marshal appended events and unmarshal read events.
+	Marshaler MarshalerUnmarshaler
+
+	// AutoProvision creates the stream of Topic when it does not exist.
+	AutoProvision bool
+
+	// JetstreamOptions are custom Jetstream options for a connection.
+	JetstreamOptions []nats.JSOpt
+}
+
+// Validate ensures configuration is valid before use
+func (c EventStoreConfig) Validate() error {
+	if c.Topic == "" {
+		return errors.New("EventStoreConfig.Topic is missing")
+	}
+
+	if c.Marshaler == nil {
+		return errors.New("EventStoreConfig.Marshaler is missing")
+	}
+
+	return nil
+}
+
+// EventStore stores event streams of event sourced aggregates in a JetStream stream, with optimistic concurrency.
+//
+// The events of an event stream are published to the subject "{topic}.{streamID}", the version of an event stream
+// is the stream sequence of its last event (0 when it has no events).
+type EventStore struct {
+	js     nats.JetStreamContext
+	config EventStoreConfig
+	logger watermill.LoggerAdapter
+}
+
+// NewEventStore creates a new EventStore with the provided nats connection.
+func NewEventStore(conn *nats.Conn, config EventStoreConfig, logger watermill.LoggerAdapter) (*EventStore, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	js, err := conn.JetStream(config.JetstreamOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.AutoProvision {
+		if err := newTopicInterpreter(js, nil, 0).ensureStream(config.Topic); err != nil {
+			return nil, errors.Wrap(err, "cannot provision event store stream")
+		}
+	}
+
+	return &EventStore{
+		js:     js,
+		config: config,
+		logger: logger,
+	}, nil
+}
+
+// Append appends events to the event stream streamID, which needs to be at expectedVersion (or AnyVersion),
+// and returns the new version.  ErrWrongExpectedVersion is returned when the event stream was modified concurrently.
+//
+// Events are published one by one, each expecting the version left by the previous one, so a failure can leave
+// the first events appended.
+func (e *EventStore) Append(ctx context.Context, streamID string, expectedVersion uint64, events ...*message.Message) (uint64, error) {
+	if strings.ContainsAny(streamID, ".*> ") || streamID == "" {
+		return 0, errors.Errorf("invalid stream id %q", streamID)
+	}
+
+	subject := e.subject(streamID)
+	version := expectedVersion
+
+	for _, event := range events {
+		natsMsg, err := e.config.Marshaler.Marshal(e.config.Topic, event)
+		if err != nil {
+			return 0, err
+		}
+		natsMsg.Subject = subject
+
+		if version != AnyVersion {
+			if natsMsg.Header == nil {
+				natsMsg.Header = make(nats.Header)
+			}
+			// set directly, as nats.ExpectLastSequencePerSubject can not expect an empty event stream
+			natsMsg.Header.Set(nats.ExpectedLastSubjSeqHdr, strconv.FormatUint(version, 10))
+		}
+
+		ack, err := e.js.PublishMsg(natsMsg, nats.MsgId(event.UUID), nats.Context(ctx))
+		if err != nil {
+			if isWrongLastSequence(err) {
+				return 0, errors.Wrapf(ErrWrongExpectedVersion, "cannot append to %s at version %d", streamID, version)
+			}
+			return 0, errors.Wrap(err, "cannot append event")
+		}
+
+		version = ack.Sequence
+	}
+
+	e.logger.Trace("Events appended", watermill.LogFields{
+		"stream_id": streamID,
+		"events":    len(events),
+		"version":   version,
+	})
+
+	return version, nil
+}
+
+// ReadStream returns the events of the event stream streamID in order, with their version as EventVersionMetadataKey.
+func (e *EventStore) ReadStream(ctx context.Context, streamID string) ([]*message.Message, error) {
+	sub, err := e.js.SubscribeSync(
+		e.subject(streamID),
+		nats.BindStream(e.config.Topic),
+		nats.OrderedConsumer(),
+		nats.DeliverAll(),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create ordered consumer")
+	}
+	defer func() {
+		if err := sub.Unsubscribe(); err != nil {
+			e.logger.Error("Cannot unsubscribe", err, watermill.LogFields{"stream_id": streamID})
+		}
+	}()
+
+	info, err := sub.ConsumerInfo()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get ordered consumer info")
+	}
+
+	pending := orderedPending(info)
+	events := make([]*message.Message, 0, pending)
+
+	for pending > 0 {
+		m, err := sub.NextMsgWithContext(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot read event")
+		}
+
+		meta, err := m.Metadata()
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot read event metadata")
+		}
+		pending = meta.NumPending
+
+		event, err := e.config.Marshaler.Unmarshal(m)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot unmarshal event")
+		}
+		event.Metadata.Set(EventVersionMetadataKey, strconv.FormatUint(meta.Sequence.Stream, 10))
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+func (e *EventStore) subject(streamID string) string {
+	return fmt.Sprintf("%s.%s", e.config.Topic, streamID)
+}
+
+// isWrongLastSequence reports whether err is the JetStream error of a failed expected last sequence check.
+func isWrongLastSequence(err error) bool {
+	return strings.Contains(err.Error(), "wrong last sequence")
+}
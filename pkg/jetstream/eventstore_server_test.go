@@ -0,0 +1,70 @@
+package jetstream_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-jetstream/pkg/jetstream"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventStore(t *testing.T) {
+	conn, _ := serverConn(t)
+
+	store, err := jetstream.NewEventStore(conn, jetstream.EventStoreConfig{
+		Topic:         "orders",
+		Marshaler:     &jetstream.GobMarshaler{},
+		AutoProvision: true,
+	}, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	event := func(payload string) *message.Message {
+		return message.NewMessage(watermill.NewUUID(), []byte(payload))
+	}
+
+	events, err := store.ReadStream(ctx, "order-1")
+	require.NoError(t, err)
+	require.Empty(t, events)
+
+	version, err := store.Append(ctx, "order-1", 0, event("created"), event("paid"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), version)
+
+	// event streams are versioned independently
+	otherVersion, err := store.Append(ctx, "order-2", 0, event("created"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), otherVersion)
+
+	// a writer which did not see the last events is rejected
+	_, err = store.Append(ctx, "order-1", 0, event("cancelled"))
+	require.True(t, errors.Is(err, jetstream.ErrWrongExpectedVersion), "unexpected error: %v", err)
+	_, err = store.Append(ctx, "order-1", 1, event("cancelled"))
+	require.True(t, errors.Is(err, jetstream.ErrWrongExpectedVersion), "unexpected error: %v", err)
+
+	version, err = store.Append(ctx, "order-1", version, event("shipped"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), version)
+
+	version, err = store.Append(ctx, "order-1", jetstream.AnyVersion, event("delivered"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), version)
+
+	events, err = store.ReadStream(ctx, "order-1")
+	require.NoError(t, err)
+
+	var payloads, versions []string
+	for _, e := range events {
+		payloads = append(payloads, string(e.Payload))
+		versions = append(versions, e.Metadata.Get(jetstream.EventVersionMetadataKey))
+	}
+	require.Equal(t, []string{"created", "paid", "shipped", "delivered"}, payloads)
+	require.Equal(t, []string{"1", "2", "4", strconv.FormatUint(version, 10)}, versions)
+}
@@ -0,0 +1,36 @@
+package jetstream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventStore_AppendInvalidStreamID(t *testing.T) {
+	e := &EventStore{
+		config: EventStoreConfig{Topic: "orders", Marshaler: &NATSMarshaler{}},
+		logger: watermill.NopLogger{},
+	}
+
+	for _, streamID := range []string{"", "order.1", "order-*", ">"} {
+		_, err := e.Append(context.Background(), streamID, 0, message.NewMessage("uuid", nil))
+		require.Error(t, err, streamID)
+	}
+
+	require.Equal(t, "orders.order-1", e.subject("order-1"))
+}
+
+func TestIsWrongLastSequence(t *testing.T) {
+	require.True(t, isWrongLastSequence(errors.New("nats: wrong last sequence: 4")))
+	require.False(t, isWrongLastSequence(errors.New("nats: timeout")))
+}
+
+func TestEventStoreConfig_Validate(t *testing.T) {
+	require.Error(t, EventStoreConfig{Marshaler: &NATSMarshaler{}}.Validate())
+	require.Error(t, EventStoreConfig{Topic: "orders"}.Validate())
+	require.NoError(t, EventStoreConfig{Topic: "orders", Marshaler: &NATSMarshaler{}}.Validate())
+}
@@ -0,0 +1,51 @@
+package jetstream
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// SubscribeMultiple subscribes to all topics and merges their messages into a single channel, with the topic
+// of every message set as SourceTopicMetadataKey, so a single handler can serve many low-volume topics.
+//
+// The channel is closed once every topic subscription is closed.
+func (s *Subscriber) SubscribeMultiple(ctx context.Context, topics ...string) (<-chan *message.Message, error) {
+	if len(topics) == 0 {
+		return nil, errors.New("at least one topic is required")
+	}
+
+	output := make(chan *message.Message)
+	wg := &sync.WaitGroup{}
+
+	for _, topic := range topics {
+		messages, err := s.Subscribe(ctx, topic)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot subscribe to %s", topic)
+		}
+
+		wg.Add(1)
+		go func(topic string, messages <-chan *message.Message) {
+			defer wg.Done()
+
+			for msg := range messages {
+				msg.Metadata.Set(SourceTopicMetadataKey, topic)
+
+				select {
+				case output <- msg:
+				case <-ctx.Done():
+					msg.Nack()
+				}
+			}
+		}(topic, messages)
+	}
+
+	go func() {
+		wg.Wait()
+		close(output)
+	}()
+
+	return output, nil
+}
@@ -0,0 +1,59 @@
+package jetstream_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-jetstream/pkg/jetstream"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriber_SubscribeMultiple(t *testing.T) {
+	conn, _ := serverConn(t)
+	pub := serverPublisher(t, conn)
+	sub := serverSubscriber(t, conn, jetstream.SubscriberSubscriptionConfig{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := sub.SubscribeMultiple(ctx)
+	require.Error(t, err)
+
+	topics := []string{"orders", "payments", "refunds"}
+
+	published := map[string]string{}
+	for _, topic := range topics {
+		for i := 0; i < 2; i++ {
+			msg := message.NewMessage(watermill.NewUUID(), []byte("payload"))
+			require.NoError(t, pub.Publish(topic, msg))
+			published[msg.UUID] = topic
+		}
+	}
+
+	messages, err := sub.SubscribeMultiple(ctx, topics...)
+	require.NoError(t, err)
+
+	received := map[string]string{}
+	for len(received) < len(published) {
+		select {
+		case msg := <-messages:
+			received[msg.UUID] = msg.Metadata.Get(jetstream.SourceTopicMetadataKey)
+			msg.Ack()
+		case <-time.After(10 * time.Second):
+			t.Fatalf("received %d of %d messages", len(received), len(published))
+		}
+	}
+	require.Equal(t, published, received)
+
+	cancel()
+
+	select {
+	case _, ok := <-messages:
+		require.False(t, ok, "no message expected after cancel")
+	case <-time.After(10 * time.Second):
+		t.Fatal("channel not closed after cancel")
+	}
+}
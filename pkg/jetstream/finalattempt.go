@@ -0,0 +1,21 @@
+package jetstream
+
+import "github.com/nats-io/nats.go"
+
+// FinalAttemptMetadataKey is the metadata key set to "true" on messages delivered more than
+// SubscriberConfig.FinalAttemptThreshold times.
+const FinalAttemptMetadataKey = "jetstream_final_attempt"
+
+// finalAttempt reports whether m was delivered more than FinalAttemptThreshold times.
+func (s *Subscriber) finalAttempt(m *nats.Msg) bool {
+	if s.config.FinalAttemptThreshold <= 0 {
+		return false
+	}
+
+	meta, err := m.Metadata()
+	if err != nil {
+		return false
+	}
+
+	return meta.NumDelivered > uint64(s.config.FinalAttemptThreshold)
+}
@@ -0,0 +1,61 @@
+package jetstream
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriber_FinalAttempt(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		delivered int
+		wantFinal bool
+	}{
+		{name: "disabled", delivered: 5},
+		{name: "below threshold", threshold: 3, delivered: 3},
+		{name: "above threshold", threshold: 3, delivered: 4, wantFinal: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := faultySubscriber(SubscriberSubscriptionConfig{FinalAttemptThreshold: tt.threshold}, clientDecorator{})
+
+			m, err := (&GobMarshaler{}).Marshal("topic", message.NewMessage(watermill.NewUUID(), nil))
+			require.NoError(t, err)
+			m.Reply = fmt.Sprintf("$JS.ACK.topic.consumer.%d.10.5.%d.0", tt.delivered, time.Now().UnixNano())
+			m.Sub = &nats.Subscription{}
+
+			msg, err := s.unmarshal("topic", m)
+			require.NoError(t, err)
+
+			if tt.wantFinal {
+				require.Equal(t, "true", msg.Metadata.Get(FinalAttemptMetadataKey))
+			} else {
+				require.Empty(t, msg.Metadata.Get(FinalAttemptMetadataKey))
+			}
+		})
+	}
+}
+
+func TestSubscriberSubscriptionConfig_ValidateFinalAttemptThreshold(t *testing.T) {
+	c := SubscriberSubscriptionConfig{
+		Unmarshaler:           &GobMarshaler{},
+		FinalAttemptThreshold: 4,
+		MaxDeliver:            5,
+	}
+	c.setDefaults()
+	require.NoError(t, c.Validate())
+
+	c.FinalAttemptThreshold = 5
+	require.EqualError(t, c.Validate(), "SubscriberConfig.FinalAttemptThreshold: must be lower than SubscriberConfig.MaxDeliver")
+
+	c.FinalAttemptThreshold = -1
+	require.EqualError(t, c.Validate(), "SubscriberConfig.FinalAttemptThreshold: can not be negative")
+}
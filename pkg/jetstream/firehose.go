@@ -0,0 +1,121 @@
+package jetstream
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+const (
+	// SourceTopicMetadataKey is the metadata key holding the topic a message was consumed from,
+	// set on messages delivered by SubscribeStream and SubscribeMultiple.
+	SourceTopicMetadataKey = "_watermill_source_topic"
+
+	// SourceSubjectMetadataKey is the metadata key holding the NATS subject of a message, set on messages
+	// delivered by SubscribeStream.
+	SourceSubjectMetadataKey = "_watermill_source_subject"
+)
+
+// SubscribeStream consumes every subject of stream through a temporary ordered consumer, e.g. for audit pipelines
+// and analytics sinks.  Messages carry their original topic (SourceTopicMetadataKey) and subject (SourceSubjectMetadataKey).
+//
+// The subscription starts at the beginning of the stream unless a position is set with WithStartPosition.
+// Messages are delivered one at a time, a nacked message is delivered again.  The consumer state is not kept
+// between subscriptions.
+func (s *Subscriber) SubscribeStream(ctx context.Context, stream string) (<-chan *message.Message, error) {
+	logFields := watermill.LogFields{
+		"stream":   stream,
+		"firehose": true,
+	}
+
+	from, _ := StartPositionFromCtx(ctx)
+
+	sub, err := s.js.SubscribeSync(
+		"",
+		nats.BindStream(stream),
+		nats.OrderedConsumer(),
+		from.startOption(),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create ordered consumer")
+	}
+
+	output := make(chan *message.Message)
+
+	// NextMsgWithContext only returns early on ctx, so closing the subscriber cancels it
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-s.closing:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	s.outputsWg.Add(1)
+	go func() {
+		defer s.outputsWg.Done()
+		defer cancel()
+		defer close(output)
+		defer func() {
+			if err := sub.Unsubscribe(); err != nil {
+				s.logger.Error("Cannot unsubscribe", err, logFields)
+			}
+		}()
+
+		s.logger.Debug("Starting stream subscription", logFields)
+		defer s.logger.Debug("Stream subscription finished", logFields)
+
+		for {
+			m, err := sub.NextMsgWithContext(ctx)
+			if err != nil {
+				if ctx.Err() == nil && !s.isClosed() {
+					s.logger.Error("Cannot read stream message", err, logFields)
+				}
+				return
+			}
+
+			annotate := func(msg *message.Message) {
+				msg.Metadata.Set(SourceTopicMetadataKey, s.sourceTopic(m.Subject))
+				msg.Metadata.Set(SourceSubjectMetadataKey, m.Subject)
+				msg.SetContext(withTopic(msg.Context(), subjectTopic(m.Subject)))
+			}
+
+			if !s.deliverUntilAcked(ctx, m, output, logFields, annotate) {
+				return
+			}
+		}
+	}()
+
+	return output, nil
+}
+
+// subjectTopic returns the topic of a subject published with PublishSubject or PartitionSubject.
+func subjectTopic(subject string) string {
+	i := strings.LastIndex(subject, ".")
+	if i < 0 {
+		return subject
+	}
+
+	return subject[:i]
+}
+
+// sourceTopic returns the topic of subject, unescaped when topics are escaped (see EscapeTopic).
+func (s *Subscriber) sourceTopic(subject string) string {
+	topic := subjectTopic(subject)
+	if !s.config.EscapeTopics {
+		return topic
+	}
+
+	unescaped, err := UnescapeTopic(topic)
+	if err != nil {
+		// not published with escaping, kept as is
+		return topic
+	}
+
+	return unescaped
+}
@@ -0,0 +1,73 @@
+package jetstream_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-jetstream/pkg/jetstream"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriber_SubscribeStream(t *testing.T) {
+	conn, js := serverConn(t)
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "events", Subjects: []string{"orders.*", "payments.*"}})
+	require.NoError(t, err)
+
+	pub, err := jetstream.NewPublisherWithNatsConn(conn, jetstream.PublisherPublishConfig{
+		Marshaler: &jetstream.GobMarshaler{},
+	}, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	type published struct{ uuid, topic string }
+	var messages []published
+	for _, topic := range []string{"orders", "payments", "orders"} {
+		msg := message.NewMessage(watermill.NewUUID(), []byte(topic))
+		require.NoError(t, pub.Publish(topic, msg))
+		messages = append(messages, published{uuid: msg.UUID, topic: topic})
+	}
+
+	sub := serverSubscriber(t, conn, jetstream.SubscriberSubscriptionConfig{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	output, err := sub.SubscribeStream(ctx, "events")
+	require.NoError(t, err)
+
+	receive := func() *message.Message {
+		select {
+		case msg := <-output:
+			return msg
+		case <-ctx.Done():
+			t.Fatal("message not received")
+			return nil
+		}
+	}
+
+	// a nacked message is delivered again before the next one
+	first := receive()
+	require.Equal(t, messages[0].uuid, first.UUID)
+	first.Nack()
+
+	for _, want := range messages {
+		msg := receive()
+		require.Equal(t, want.uuid, msg.UUID)
+		require.Equal(t, want.topic, msg.Metadata.Get(jetstream.SourceTopicMetadataKey))
+		require.Equal(t, jetstream.PublishSubject(want.topic, want.uuid), msg.Metadata.Get(jetstream.SourceSubjectMetadataKey))
+		msg.Ack()
+	}
+
+	// the subscription ends with ctx
+	cancel()
+	select {
+	case _, ok := <-output:
+		require.False(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("output not closed")
+	}
+}
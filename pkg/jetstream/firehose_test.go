@@ -0,0 +1,31 @@
+package jetstream
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubjectTopic(t *testing.T) {
+	tests := []struct {
+		subject string
+		want    string
+	}{
+		{subject: PublishSubject("orders", "c3f1"), want: "orders"},
+		{subject: PartitionSubject("orders", 3), want: "orders"},
+		{subject: PublishSubject("billing.invoices", "c3f1"), want: "billing.invoices"},
+		{subject: "orders", want: "orders"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.subject, func(t *testing.T) {
+			require.Equal(t, tt.want, subjectTopic(tt.subject))
+		})
+	}
+}
+
+func TestSubscriber_SourceTopic_Escaped(t *testing.T) {
+	s := &Subscriber{config: SubscriberSubscriptionConfig{EscapeTopics: true}}
+
+	require.Equal(t, "orders eu", s.sourceTopic(PublishSubject(EscapeTopic("orders eu"), "c3f1")))
+	require.Equal(t, "orders%zz", s.sourceTopic(PublishSubject("orders%zz", "c3f1")))
+}
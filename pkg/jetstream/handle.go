@@ -0,0 +1,93 @@
+package jetstream
+
+import (
+	"context"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// SubscriptionHandle is a handle on the consumers of a subscription started with SubscribeWithHandle,
+// one consumer per partition when partitioning is enabled.
+type SubscriptionHandle struct {
+	topic     string
+	js        nats.JetStreamManager
+	consumers []*handleConsumer
+}
+
+// handleConsumer is a consumer of a subscription, whose stream and name are resolved on first use:
+// ephemeral consumers are named by the server, and renamed when the heartbeat watchdog recreates them.
+type handleConsumer struct {
+	partition *int
+	current   func() *nats.Subscription
+
+	lock     sync.Mutex
+	resolved *nats.Subscription
+	stream   string
+	name     string
+}
+
+func (h *SubscriptionHandle) add(partition *int, current func() *nats.Subscription) {
+	h.consumers = append(h.consumers, &handleConsumer{
+		partition: partition,
+		current:   current,
+	})
+}
+
+// addNamed adds a consumer whose stream and name are known when subscribing, queried by name only.
+func (h *SubscriptionHandle) addNamed(stream, name string) {
+	h.consumers = append(h.consumers, &handleConsumer{
+		current: func() *nats.Subscription { return nil },
+		stream:  stream,
+		name:    name,
+	})
+}
+
+// Topic returns the topic of the subscription.
+func (h *SubscriptionHandle) Topic() string {
+	return h.topic
+}
+
+// ConsumerInfo returns the current state of the consumers of the subscription, in partition order, with their
+// pending (NumPending), unacknowledged (NumAckPending) and redelivered (NumRedelivered) message counts,
+// e.g. as autoscaling signals.  Every call queries the server.
+func (h *SubscriptionHandle) ConsumerInfo(ctx context.Context) ([]*nats.ConsumerInfo, error) {
+	infos := make([]*nats.ConsumerInfo, 0, len(h.consumers))
+
+	for _, consumer := range h.consumers {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		info, err := consumer.info(ctx, h.js)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot get consumer info of topic %s", h.topic)
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+func (c *handleConsumer) info(ctx context.Context, js nats.JetStreamManager) (*nats.ConsumerInfo, error) {
+	sub := c.current()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if sub != c.resolved {
+		info, err := sub.ConsumerInfo()
+		if err != nil {
+			return nil, err
+		}
+
+		c.resolved = sub
+		c.stream = info.Stream
+		c.name = info.Name
+
+		return info, nil
+	}
+
+	return js.ConsumerInfo(c.stream, c.name, nats.Context(ctx))
+}
@@ -0,0 +1,82 @@
+package jetstream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// statsJetStream returns consumer infos with the pending counts of their consumer.
+type statsJetStream struct {
+	nats.JetStreamContext
+	pending map[string]uint64
+}
+
+func (js *statsJetStream) ConsumerInfo(stream, name string, opts ...nats.JSOpt) (*nats.ConsumerInfo, error) {
+	pending, ok := js.pending[name]
+	if !ok {
+		return nil, nats.ErrConsumerNotFound
+	}
+	return &nats.ConsumerInfo{Stream: stream, Name: name, NumPending: pending}, nil
+}
+
+// resolvedConsumer returns a consumer of a handle whose stream and name were already resolved.
+func resolvedConsumer(name string) *handleConsumer {
+	sub := &nats.Subscription{}
+	return &handleConsumer{
+		current:  func() *nats.Subscription { return sub },
+		resolved: sub,
+		stream:   "orders",
+		name:     name,
+	}
+}
+
+func TestSubscriptionHandle_ConsumerInfo(t *testing.T) {
+	js := &statsJetStream{pending: map[string]uint64{"orders_0": 3, "orders_1": 5}}
+	handle := &SubscriptionHandle{
+		topic:     "orders",
+		js:        js,
+		consumers: []*handleConsumer{resolvedConsumer("orders_0"), resolvedConsumer("orders_1")},
+	}
+	require.Equal(t, "orders", handle.Topic())
+
+	infos, err := handle.ConsumerInfo(context.Background())
+	require.NoError(t, err)
+	require.Len(t, infos, 2)
+	require.Equal(t, uint64(3), infos[0].NumPending)
+	require.Equal(t, uint64(5), infos[1].NumPending)
+
+	js.pending["orders_1"] = 0
+	infos, err = handle.ConsumerInfo(context.Background())
+	require.NoError(t, err)
+	require.Zero(t, infos[1].NumPending, "consumer infos are refreshed on every call")
+
+	delete(js.pending, "orders_0")
+	_, err = handle.ConsumerInfo(context.Background())
+	require.True(t, errors.Is(err, nats.ErrConsumerNotFound), "unexpected error: %v", err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = handle.ConsumerInfo(ctx)
+	require.True(t, errors.Is(err, context.Canceled), "unexpected error: %v", err)
+}
+
+func TestSubscriber_SubscribeWithHandle(t *testing.T) {
+	s := faultySubscriber(SubscriberSubscriptionConfig{
+		Partitioning: PartitionConfig{Count: 2},
+	}, clientDecorator{
+		jetStream: func(nats.JetStream) nats.JetStream { return &faultyJetStream{} },
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, handle, err := s.SubscribeWithHandle(ctx, "orders")
+	require.NoError(t, err)
+	require.Len(t, handle.consumers, 2)
+	require.Equal(t, 0, *handle.consumers[0].partition)
+	require.Equal(t, 1, *handle.consumers[1].partition)
+}
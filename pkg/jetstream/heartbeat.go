@@ -0,0 +1,246 @@
+package jetstream
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// HeartbeatConfig enables idle heartbeats on push consumers and recreates subscriptions missing them.
+//
+// The NATS client reports a subscription whose consumer neither delivered a message nor a heartbeat for two
+// intervals (e.g. because the consumer was deleted or delivery stalled on flow control).  The subscription is
+// then unsubscribed and created again, until it succeeds or the subscriber is closed.
+//
+// Heartbeats are not supported on queue subscriptions, so a subscriber with heartbeats subscribes without a
+// queue group: it requires a single subscriber (SubscribersCount) and no QueueGroup, and a durable consumer can
+// only be consumed by one instance at a time.  Durable consumers are created up front and bound, so recreating
+// a subscription keeps their state, while ephemeral consumers start again at their start position.
+// Existing durable consumers are not updated, they need heartbeats configured.
+type HeartbeatConfig struct {
+	// Interval is the idle heartbeat interval of push consumers, heartbeats are disabled when zero.
+	Interval time.Duration
+
+	// OnRecover is called each time a subscription missing heartbeats was recreated, with the error
+	// of recreating it (nil when it succeeded), e.g. to count recoveries in a metric.
+	OnRecover func(topic string, err error)
+
+	// Retry paces the attempts to recreate a subscription (defaults to retrying every Interval until it
+	// succeeds), the subscription is given up once its attempts are exhausted.
+	Retry RetryPolicy
+}
+
+func (c HeartbeatConfig) enabled() bool {
+	return c.Interval > 0
+}
+
+// Validate ensures configuration is valid before use
+func (c HeartbeatConfig) Validate() error {
+	if c.Interval < 0 {
+		return errors.New("HeartbeatConfig.Interval can not be negative")
+	}
+	if err := validateRetryPolicy(c.Retry); err != nil {
+		return errors.Wrap(err, "HeartbeatConfig.Retry")
+	}
+
+	return nil
+}
+
+func (c HeartbeatConfig) retryPolicy() RetryPolicy {
+	if c.Retry != nil {
+		return c.Retry
+	}
+	return FixedRetryPolicy{Delay: c.Interval}
+}
+
+// watchedSubscription is a subscription recreated by the heartbeat watchdog.
+type watchedSubscription struct {
+	topic       string
+	logFields   watermill.LogFields
+	resubscribe func() (*nats.Subscription, error)
+
+	lock    sync.Mutex
+	sub     *nats.Subscription
+	stopped bool
+}
+
+// current returns the current subscription, replaced whenever it is recreated.
+func (w *watchedSubscription) current() *nats.Subscription {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.sub
+}
+
+// stop stops recreating the subscription, returning the current one.
+func (w *watchedSubscription) stop() *nats.Subscription {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.stopped = true
+	return w.sub
+}
+
+// heartbeatWatchdog recreates the subscriptions reported as not active by the NATS client.
+type heartbeatWatchdog struct {
+	config  HeartbeatConfig
+	clock   Clock
+	logger  watermill.LoggerAdapter
+	closing chan struct{}
+
+	lock sync.Mutex
+	subs map[*nats.Subscription]*watchedSubscription
+}
+
+func newHeartbeatWatchdog(
+	config HeartbeatConfig,
+	clock Clock,
+	logger watermill.LoggerAdapter,
+	closing chan struct{},
+) *heartbeatWatchdog {
+	return &heartbeatWatchdog{
+		config:  config,
+		clock:   clock,
+		logger:  logger,
+		closing: closing,
+		subs:    make(map[*nats.Subscription]*watchedSubscription),
+	}
+}
+
+// install makes the watchdog handle the asynchronous errors of conn, keeping the error handler already set.
+func (d *heartbeatWatchdog) install(conn *nats.Conn) {
+	previous := conn.Opts.AsyncErrorCB
+
+	conn.SetErrorHandler(func(nc *nats.Conn, sub *nats.Subscription, err error) {
+		d.handleAsyncError(sub, err)
+
+		if previous != nil {
+			previous(nc, sub, err)
+		}
+	})
+}
+
+// watch starts watching sub, recreating it with resubscribe when it misses heartbeats.
+func (d *heartbeatWatchdog) watch(
+	sub *nats.Subscription,
+	topic string,
+	resubscribe func() (*nats.Subscription, error),
+	logFields watermill.LogFields,
+) *watchedSubscription {
+	w := &watchedSubscription{
+		topic:       topic,
+		logFields:   logFields,
+		resubscribe: resubscribe,
+		sub:         sub,
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.subs[sub] = w
+
+	return w
+}
+
+// unwatch stops watching w, returning its current subscription.
+func (d *heartbeatWatchdog) unwatch(w *watchedSubscription) *nats.Subscription {
+	sub := w.stop()
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	delete(d.subs, sub)
+
+	return sub
+}
+
+func (d *heartbeatWatchdog) handleAsyncError(sub *nats.Subscription, err error) {
+	if !errors.Is(err, nats.ErrConsumerNotActive) {
+		return
+	}
+
+	d.lock.Lock()
+	w, ok := d.subs[sub]
+	delete(d.subs, sub)
+	d.lock.Unlock()
+
+	if !ok {
+		return
+	}
+
+	// the handler runs on the dispatch goroutine of the connection, which recreating the subscription must not block
+	go d.recover(w, sub)
+}
+
+// recover recreates the subscription of w until it succeeds, its retries are exhausted or the subscriber is closed.
+func (d *heartbeatWatchdog) recover(w *watchedSubscription, missing *nats.Subscription) {
+	d.logger.Info("Missed heartbeats, recreating subscription", w.logFields)
+
+	if err := missing.Unsubscribe(); err != nil {
+		d.logger.Debug("Cannot unsubscribe subscription missing heartbeats", w.logFields.Add(watermill.LogFields{"err": err}))
+	}
+
+	retry := d.config.retryPolicy()
+
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-d.closing:
+			return
+		default:
+		}
+
+		sub, err := w.resubscribe()
+		if err == nil && !d.replace(w, sub) {
+			return
+		}
+
+		if d.config.OnRecover != nil {
+			d.config.OnRecover(w.topic, err)
+		}
+
+		if err == nil {
+			d.logger.Info("Subscription recreated", w.logFields)
+			return
+		}
+
+		d.logger.Error("Cannot recreate subscription", err, w.logFields)
+
+		if retriesExhausted(retry, attempt) {
+			d.logger.Error("Giving up recreating subscription", err, w.logFields.Add(watermill.LogFields{"attempts": attempt}))
+			return
+		}
+
+		wait, stop := after(d.clock, retry.NextDelay(attempt))
+		select {
+		case <-d.closing:
+			stop()
+			return
+		case <-wait:
+			stop()
+		}
+	}
+}
+
+// replace makes sub the subscription of w, returning false and unsubscribing it when w was stopped meanwhile.
+func (d *heartbeatWatchdog) replace(w *watchedSubscription, sub *nats.Subscription) bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.stopped {
+		if err := sub.Unsubscribe(); err != nil {
+			d.logger.Error("Cannot unsubscribe subscription recreated while closing", err, w.logFields)
+		}
+		return false
+	}
+
+	w.sub = sub
+
+	d.lock.Lock()
+	d.subs[sub] = w
+	d.lock.Unlock()
+
+	return true
+}
@@ -0,0 +1,160 @@
+package jetstream
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// recoveries records the calls of HeartbeatConfig.OnRecover.
+type recoveries struct {
+	lock sync.Mutex
+	errs []error
+}
+
+func (r *recoveries) onRecover(topic string, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.errs = append(r.errs, err)
+}
+
+func (r *recoveries) get() []error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]error(nil), r.errs...)
+}
+
+func TestHeartbeatWatchdog_Recover(t *testing.T) {
+	recovered := &recoveries{}
+	d := newHeartbeatWatchdog(HeartbeatConfig{
+		Interval:  time.Millisecond,
+		OnRecover: recovered.onRecover,
+	}, RealClock{}, watermill.NopLogger{}, make(chan struct{}))
+
+	missing := &nats.Subscription{}
+	recreated := &nats.Subscription{}
+
+	attempts := 0
+	w := d.watch(missing, "topic", func() (*nats.Subscription, error) {
+		attempts++
+		if attempts == 1 {
+			return nil, nats.ErrTimeout
+		}
+		return recreated, nil
+	}, watermill.LogFields{})
+
+	// other errors and subscriptions which are not watched are ignored
+	d.handleAsyncError(missing, nats.ErrSlowConsumer)
+	d.handleAsyncError(&nats.Subscription{}, nats.ErrConsumerNotActive)
+	require.Empty(t, recovered.get())
+
+	d.handleAsyncError(missing, nats.ErrConsumerNotActive)
+
+	// a failed attempt is reported and retried
+	require.Eventually(t, func() bool { return len(recovered.get()) == 2 }, time.Second, time.Millisecond)
+	errs := recovered.get()
+	require.True(t, errors.Is(errs[0], nats.ErrTimeout))
+	require.NoError(t, errs[1])
+
+	// the recreated subscription is watched in place of the missing one
+	d.lock.Lock()
+	require.Equal(t, map[*nats.Subscription]*watchedSubscription{recreated: w}, d.subs)
+	d.lock.Unlock()
+
+	require.Equal(t, recreated, d.unwatch(w))
+	require.Empty(t, d.subs)
+}
+
+func TestHeartbeatWatchdog_RetryExhausted(t *testing.T) {
+	recovered := &recoveries{}
+	d := newHeartbeatWatchdog(HeartbeatConfig{
+		Interval:  time.Hour,
+		OnRecover: recovered.onRecover,
+		Retry:     FixedRetryPolicy{Delay: time.Millisecond, Attempts: 3},
+	}, RealClock{}, watermill.NopLogger{}, make(chan struct{}))
+
+	missing := &nats.Subscription{}
+	attempts := 0
+	d.watch(missing, "topic", func() (*nats.Subscription, error) {
+		attempts++
+		return nil, nats.ErrTimeout
+	}, watermill.LogFields{})
+
+	d.recover(d.subs[missing], missing)
+	require.Equal(t, 3, attempts)
+	require.Len(t, recovered.get(), 3)
+}
+
+func TestHeartbeatWatchdog_Closed(t *testing.T) {
+	closing := make(chan struct{})
+	close(closing)
+
+	recovered := &recoveries{}
+	d := newHeartbeatWatchdog(HeartbeatConfig{Interval: time.Millisecond, OnRecover: recovered.onRecover}, RealClock{}, watermill.NopLogger{}, closing)
+
+	missing := &nats.Subscription{}
+	d.watch(missing, "topic", func() (*nats.Subscription, error) {
+		t.Error("subscription recreated after closing")
+		return nil, nil
+	}, watermill.LogFields{})
+
+	d.recover(d.subs[missing], missing)
+	require.Empty(t, recovered.get())
+}
+
+func TestSubscriber_HeartbeatSubscription(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     SubscriberSubscriptionConfig
+		queueGroup string
+		optsCount  int
+	}{
+		{
+			name:       "queue subscription",
+			config:     SubscriberSubscriptionConfig{QueueGroup: "group"},
+			queueGroup: "group.topic",
+			optsCount:  1,
+		},
+		{
+			// heartbeats are not supported on queue subscriptions, IdleHeartbeat is added to the options
+			name:      "ephemeral with heartbeats",
+			config:    SubscriberSubscriptionConfig{Heartbeat: HeartbeatConfig{Interval: time.Second}},
+			optsCount: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := faultySubscriber(tt.config, clientDecorator{})
+
+			deliver := func(subject, queueGroup string, opts ...nats.SubOpt) (*nats.Subscription, error) {
+				require.Equal(t, tt.queueGroup, queueGroup)
+				require.Len(t, opts, tt.optsCount)
+				return &nats.Subscription{}, nil
+			}
+
+			_, err := s.subscribeTargetWith("topic", subscriptionTarget{subject: "topic.*"}, deliver)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestSubscriberSubscriptionConfig_ValidateHeartbeat(t *testing.T) {
+	c := SubscriberSubscriptionConfig{
+		Unmarshaler: &GobMarshaler{},
+		DurableName: "durable",
+		Heartbeat:   HeartbeatConfig{Interval: time.Second},
+	}
+	c.setDefaults()
+	require.NoError(t, c.Validate())
+
+	c.QueueGroup = "group"
+	c.SubscribersCount = 2
+	require.EqualError(t, c.Validate(), "SubscriberConfig.Heartbeat: can not be combined with SubscriberConfig.QueueGroup; "+
+		"SubscriberConfig.Heartbeat: requires a single subscriber (SubscriberConfig.SubscribersCount)")
+}
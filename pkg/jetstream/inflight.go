@@ -0,0 +1,48 @@
+package jetstream
+
+import (
+	"context"
+)
+
+// concurrencyLimiter limits the messages of a subscription handled concurrently.
+type concurrencyLimiter interface {
+	// acquire blocks until a slot is free, returning false when closing or ctx is done first.
+	acquire(ctx context.Context, closing <-chan struct{}) bool
+	release()
+}
+
+// inFlightLimiter is a semaphore limiting the messages of a subscription handled concurrently.
+// A nil limiter does not limit.
+type inFlightLimiter chan struct{}
+
+func newInFlightLimiter(limit int) inFlightLimiter {
+	if limit <= 0 {
+		return nil
+	}
+
+	return make(inFlightLimiter, limit)
+}
+
+// acquire blocks until a slot is free, returning false when closing or ctx is done first.
+func (l inFlightLimiter) acquire(ctx context.Context, closing <-chan struct{}) bool {
+	if l == nil {
+		return true
+	}
+
+	select {
+	case l <- struct{}{}:
+		return true
+	case <-closing:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (l inFlightLimiter) release() {
+	if l == nil {
+		return
+	}
+
+	<-l
+}
@@ -0,0 +1,26 @@
+package jetstream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInFlightLimiter(t *testing.T) {
+	unlimited := newInFlightLimiter(0)
+	for i := 0; i < 10; i++ {
+		require.True(t, unlimited.acquire(context.Background(), nil))
+	}
+
+	l := newInFlightLimiter(2)
+	require.True(t, l.acquire(context.Background(), nil))
+	require.True(t, l.acquire(context.Background(), nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.False(t, l.acquire(ctx, nil))
+
+	l.release()
+	require.True(t, l.acquire(context.Background(), nil))
+}
@@ -0,0 +1,62 @@
+package jetstream
+
+import (
+	"sync"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/nats-io/nats.go"
+)
+
+// startInProgress signals msgs in progress every InProgressInterval until the returned function is called,
+// resetting the AckWait of the consumer while the consumer handles them.
+func (s *Subscriber) startInProgress(msgs []*nats.Msg, logFields watermill.LogFields) func() {
+	// checked before building the closure, which would be allocated for every message
+	if s.config.InProgressInterval <= 0 {
+		return func() {}
+	}
+
+	return s.startSignalingInProgress(func() {
+		for _, m := range msgs {
+			if err := s.acker.InProgress(m); err != nil {
+				s.logger.Error("Cannot signal message in progress", err, logFields)
+			}
+		}
+	})
+}
+
+// startSignalingInProgress calls signal every InProgressInterval until the returned function is called.
+func (s *Subscriber) startSignalingInProgress(signal func()) func() {
+	interval := s.config.InProgressInterval
+	if interval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		for {
+			wait, stop := after(s.config.Clock, interval)
+			select {
+			case <-done:
+				stop()
+				return
+			case <-wait:
+				stop()
+			}
+
+			signal()
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			// messages are not signaled in progress once they are settled
+			<-stopped
+		})
+	}
+}
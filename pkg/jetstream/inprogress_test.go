@@ -0,0 +1,95 @@
+package jetstream
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+// inProgressAcker counts the messages signaled in progress and acked.
+type inProgressAcker struct {
+	nopAcker
+	inProgress int64
+	acks       int64
+}
+
+func (a *inProgressAcker) Ack(*nats.Msg) error {
+	atomic.AddInt64(&a.acks, 1)
+	return nil
+}
+
+func (a *inProgressAcker) InProgress(*nats.Msg) error {
+	atomic.AddInt64(&a.inProgress, 1)
+	return nil
+}
+
+func TestSubscriberSubscriptionConfig_ConsumerAckWait(t *testing.T) {
+	c := SubscriberSubscriptionConfig{
+		Unmarshaler:     &GobMarshaler{},
+		AckWaitTimeout:  10 * time.Minute,
+		ConsumerAckWait: 2 * time.Minute,
+	}
+	c.setDefaults()
+	require.NoError(t, c.Validate())
+	require.Equal(t, time.Minute, c.InProgressInterval)
+	require.Equal(t, 2*time.Minute, c.consumerAckWait(c.AckWaitTimeout))
+
+	c.InProgressInterval = 2 * time.Minute
+	require.EqualError(t, c.Validate(), "SubscriberConfig.InProgressInterval: must be shorter than the AckWait of the consumer")
+
+	// the consumer waits as long as the subscriber without ConsumerAckWait
+	c = SubscriberSubscriptionConfig{Unmarshaler: &GobMarshaler{}, AckWaitTimeout: time.Minute}
+	c.setDefaults()
+	require.NoError(t, c.Validate())
+	require.Zero(t, c.InProgressInterval)
+	require.Equal(t, time.Minute, c.consumerAckWait(c.AckWaitTimeout))
+}
+
+func TestSubscriber_InProgress(t *testing.T) {
+	clock := NewManualClock(time.Now())
+	acker := &inProgressAcker{}
+
+	s := faultySubscriber(SubscriberSubscriptionConfig{
+		AckWaitTimeout:  10 * time.Second,
+		ConsumerAckWait: 2 * time.Second,
+		Clock:           clock,
+	}, clientDecorator{
+		acker: func(msgAcker) msgAcker { return acker },
+	})
+
+	m, err := (&GobMarshaler{}).Marshal("topic", message.NewMessage(watermill.NewUUID(), nil))
+	require.NoError(t, err)
+
+	output := make(chan *message.Message, 1)
+	processed := make(chan struct{})
+	go func() {
+		s.processMessage(&subscriptionHandler{
+			ctx:       context.Background(),
+			topic:     "topic",
+			output:    output,
+			logFields: watermill.LogFields{},
+		}, m)
+		close(processed)
+	}()
+
+	msg := <-output
+
+	// the message is signaled in progress every second while the handler runs
+	for i := int64(1); i <= 3; i++ {
+		require.Eventually(t, func() bool { return clock.Timers() == 2 }, time.Second, time.Millisecond)
+		clock.Advance(time.Second)
+		require.Eventually(t, func() bool { return atomic.LoadInt64(&acker.inProgress) == i }, time.Second, time.Millisecond)
+	}
+
+	msg.Ack()
+	<-processed
+	require.Equal(t, int64(1), atomic.LoadInt64(&acker.acks))
+	require.Equal(t, int64(3), atomic.LoadInt64(&acker.inProgress))
+	require.Zero(t, clock.Timers())
+}
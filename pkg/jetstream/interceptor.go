@@ -0,0 +1,82 @@
+package jetstream
+
+import (
+	"context"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// PublishInvoker sends a marshaled message to JetStream: it is the publish itself, or the next interceptor.
+type PublishInvoker func(ctx context.Context, topic string, msg *message.Message, natsMsg *nats.Msg) error
+
+// PublishInterceptor intercepts the publish of every message, like a gRPC client interceptor, e.g. to add auth
+// headers, record metrics or start a trace span.  It is called once msg was marshaled to natsMsg (with its headers
+// and subject), with the context of msg, and calls invoker to continue publishing: it can modify natsMsg, or
+// return an error instead of calling invoker, which fails Publish.
+type PublishInterceptor func(ctx context.Context, topic string, msg *message.Message, natsMsg *nats.Msg, invoker PublishInvoker) error
+
+// ChainPublishInterceptors returns an interceptor calling interceptors in order, the first one being the outermost.
+func ChainPublishInterceptors(interceptors ...PublishInterceptor) PublishInterceptor {
+	return func(ctx context.Context, topic string, msg *message.Message, natsMsg *nats.Msg, invoker PublishInvoker) error {
+		return chainPublishInvoker(interceptors, invoker)(ctx, topic, msg, natsMsg)
+	}
+}
+
+// chainPublishInvoker returns an invoker calling interceptors in order before invoker.
+func chainPublishInvoker(interceptors []PublishInterceptor, invoker PublishInvoker) PublishInvoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoker
+		invoker = func(ctx context.Context, topic string, msg *message.Message, natsMsg *nats.Msg) error {
+			return interceptor(ctx, topic, msg, natsMsg, next)
+		}
+	}
+
+	return invoker
+}
+
+// ConsumeInvoker reads a received message: it unmarshals and transforms it, or calls the next interceptor.
+type ConsumeInvoker func(ctx context.Context, topic string, natsMsg *nats.Msg) (*message.Message, error)
+
+// ConsumeInterceptor intercepts every message received by Subscribe and SubscribeBatch, like a gRPC server
+// interceptor, e.g. to verify auth headers, validate messages or record metrics.  It calls invoker to read
+// natsMsg, and can inspect or modify the returned message before it is delivered to the consumer.  Returning an
+// error stops the message like a failing transformer: it is not delivered, and quarantined when QuarantineConfig
+// is enabled.  The outcome of the handler can be observed with the Acked and Nacked channels of the message.
+type ConsumeInterceptor func(ctx context.Context, topic string, natsMsg *nats.Msg, invoker ConsumeInvoker) (*message.Message, error)
+
+// ChainConsumeInterceptors returns an interceptor calling interceptors in order, the first one being the outermost.
+func ChainConsumeInterceptors(interceptors ...ConsumeInterceptor) ConsumeInterceptor {
+	return func(ctx context.Context, topic string, natsMsg *nats.Msg, invoker ConsumeInvoker) (*message.Message, error) {
+		return chainConsumeInvoker(interceptors, invoker)(ctx, topic, natsMsg)
+	}
+}
+
+// chainConsumeInvoker returns an invoker calling interceptors in order before invoker.
+func chainConsumeInvoker(interceptors []ConsumeInterceptor, invoker ConsumeInvoker) ConsumeInvoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoker
+		invoker = func(ctx context.Context, topic string, natsMsg *nats.Msg) (*message.Message, error) {
+			return interceptor(ctx, topic, natsMsg, next)
+		}
+	}
+
+	return invoker
+}
+
+// readMessage reads a message received on topic through the consume interceptors of the subscriber.
+func (s *Subscriber) readMessage(ctx context.Context, topic string, m *nats.Msg) (*message.Message, error) {
+	if len(s.config.ConsumeInterceptors) == 0 {
+		return s.unmarshal(topic, m)
+	}
+
+	msg, err := chainConsumeInvoker(s.config.ConsumeInterceptors, func(_ context.Context, topic string, m *nats.Msg) (*message.Message, error) {
+		return s.unmarshal(topic, m)
+	})(ctx, topic, m)
+	if err == nil && msg == nil {
+		return nil, errors.New("consume interceptor returned no message")
+	}
+
+	return msg, err
+}
@@ -0,0 +1,110 @@
+package jetstream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublisher_PublishInterceptors(t *testing.T) {
+	var calls []string
+	record := func(name string) PublishInterceptor {
+		return func(ctx context.Context, topic string, msg *message.Message, natsMsg *nats.Msg, invoker PublishInvoker) error {
+			calls = append(calls, name+" "+topic)
+			natsMsg.Header.Set("Authorization", name)
+			err := invoker(ctx, topic, msg, natsMsg)
+			calls = append(calls, name+" done")
+			return err
+		}
+	}
+
+	js := &faultyJetStream{}
+	config := PublisherPublishConfig{
+		Marshaler:           &GobMarshaler{},
+		PublishInterceptors: []PublishInterceptor{record("first"), record("second")},
+	}
+	config.setDefaults()
+
+	p := &Publisher{config: config, logger: watermill.NopLogger{}}
+	p.decorateClient(clientDecorator{
+		jetStream: func(nats.JetStream) nats.JetStream { return js },
+	})
+
+	require.NoError(t, p.Publish("orders", message.NewMessage(watermill.NewUUID(), nil)))
+	require.Equal(t, []string{"first orders", "second orders", "second done", "first done"}, calls)
+	require.Len(t, js.published, 1)
+	require.Equal(t, "second", js.published[0].Header.Get("Authorization"))
+
+	errRejected := errors.New("rejected")
+	p.config.PublishInterceptors = []PublishInterceptor{
+		func(context.Context, string, *message.Message, *nats.Msg, PublishInvoker) error { return errRejected },
+	}
+	require.ErrorIs(t, p.Publish("orders", message.NewMessage(watermill.NewUUID(), nil)), errRejected)
+	require.Len(t, js.published, 1)
+}
+
+func TestSubscriber_ConsumeInterceptors(t *testing.T) {
+	errUnauthorized := errors.New("unauthorized")
+
+	auth := func(ctx context.Context, topic string, natsMsg *nats.Msg, invoker ConsumeInvoker) (*message.Message, error) {
+		if natsMsg.Header.Get("Authorization") == "" {
+			return nil, errUnauthorized
+		}
+		return invoker(ctx, topic, natsMsg)
+	}
+	tag := func(ctx context.Context, topic string, natsMsg *nats.Msg, invoker ConsumeInvoker) (*message.Message, error) {
+		msg, err := invoker(ctx, topic, natsMsg)
+		if err != nil {
+			return nil, err
+		}
+		msg.Metadata.Set("intercepted", topic)
+		return msg, nil
+	}
+
+	s := faultySubscriber(SubscriberSubscriptionConfig{
+		ConsumeInterceptors: []ConsumeInterceptor{auth, tag},
+	}, clientDecorator{})
+
+	m, err := (&GobMarshaler{}).Marshal("orders", message.NewMessage(watermill.NewUUID(), []byte("payload")))
+	require.NoError(t, err)
+	m.Header = nats.Header{}
+
+	_, err = s.readMessage(context.Background(), "orders", m)
+	require.ErrorIs(t, err, errUnauthorized)
+
+	m.Header.Set("Authorization", "token")
+	msg, err := s.readMessage(context.Background(), "orders", m)
+	require.NoError(t, err)
+	require.Equal(t, "payload", string(msg.Payload))
+	require.Equal(t, "orders", msg.Metadata.Get("intercepted"))
+
+	s.config.ConsumeInterceptors = []ConsumeInterceptor{
+		func(context.Context, string, *nats.Msg, ConsumeInvoker) (*message.Message, error) { return nil, nil },
+	}
+	_, err = s.readMessage(context.Background(), "orders", m)
+	require.Error(t, err)
+}
+
+func TestChainConsumeInterceptors(t *testing.T) {
+	var calls []string
+	record := func(name string) ConsumeInterceptor {
+		return func(ctx context.Context, topic string, natsMsg *nats.Msg, invoker ConsumeInvoker) (*message.Message, error) {
+			calls = append(calls, name)
+			return invoker(ctx, topic, natsMsg)
+		}
+	}
+
+	chain := ChainConsumeInterceptors(record("first"), record("second"))
+	msg, err := chain(context.Background(), "orders", &nats.Msg{}, func(context.Context, string, *nats.Msg) (*message.Message, error) {
+		calls = append(calls, "invoker")
+		return message.NewMessage("1", nil), nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "1", msg.UUID)
+	require.Equal(t, []string{"first", "second", "invoker"}, calls)
+}
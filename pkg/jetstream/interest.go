@@ -0,0 +1,82 @@
+package jetstream
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// InterestCheckConfig makes the publisher warn when publishing to a stream with interest retention
+// (see InterestRetention) which has no consumer: the server drops such messages right away, while Publish succeeds.
+// It is disabled unless Interval is set.
+//
+// The stream of a topic is looked up on the first publish to the topic and then at most once per Interval,
+// so consumers created meanwhile are only noticed on the next check.  Failing lookups are logged and ignored.
+type InterestCheckConfig struct {
+	// Interval is the minimum interval between two checks of the stream of a topic.
+	Interval time.Duration
+}
+
+func (c InterestCheckConfig) enabled() bool {
+	return c.Interval > 0
+}
+
+// Validate ensures configuration is valid before use
+func (c InterestCheckConfig) Validate() error {
+	if c.Interval < 0 {
+		return errors.New("InterestCheckConfig.Interval can not be negative")
+	}
+
+	return nil
+}
+
+// interestChecker checks the streams of the topics published to, see InterestCheckConfig.
+type interestChecker struct {
+	config           InterestCheckConfig
+	topicInterpreter *topicInterpreter
+	logger           watermill.LoggerAdapter
+	now              func() time.Time
+
+	lock    sync.Mutex
+	checked map[string]time.Time
+}
+
+func newInterestChecker(config InterestCheckConfig, topicInterpreter *topicInterpreter, logger watermill.LoggerAdapter) *interestChecker {
+	return &interestChecker{
+		config:           config,
+		topicInterpreter: topicInterpreter,
+		logger:           logger,
+		now:              time.Now,
+		checked:          map[string]time.Time{},
+	}
+}
+
+// check warns when the stream of topic has interest retention and no consumer, unless it was checked
+// less than Interval ago.
+func (c *interestChecker) check(topic string) {
+	now := c.now()
+
+	c.lock.Lock()
+	if last, ok := c.checked[topic]; ok && now.Sub(last) < c.config.Interval {
+		c.lock.Unlock()
+		return
+	}
+	c.checked[topic] = now
+	c.lock.Unlock()
+
+	stream := c.topicInterpreter.streamName(topic)
+	logFields := watermill.LogFields{"topic_name": topic, "stream": stream}
+
+	info, err := c.topicInterpreter.js.StreamInfo(stream)
+	if err != nil {
+		c.logger.Debug("Cannot check stream interest", logFields.Add(watermill.LogFields{"err": err}))
+		return
+	}
+
+	if info.Config.Retention == nats.InterestPolicy && info.State.Consumers == 0 {
+		c.logger.Info("Publishing to interest stream without consumers, messages are dropped", logFields)
+	}
+}
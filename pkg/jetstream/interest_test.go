@@ -0,0 +1,88 @@
+package jetstream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+// consumersJetStream reports streams with the configured consumer count.
+type consumersJetStream struct {
+	nats.JetStreamContext
+	retention nats.RetentionPolicy
+	consumers int
+	lookups   int
+}
+
+func (js *consumersJetStream) StreamInfo(stream string, opts ...nats.JSOpt) (*nats.StreamInfo, error) {
+	js.lookups++
+	return &nats.StreamInfo{
+		Config: nats.StreamConfig{Name: stream, Retention: js.retention},
+		State:  nats.StreamState{Consumers: js.consumers},
+	}, nil
+}
+
+func TestInterestChecker(t *testing.T) {
+	js := &consumersJetStream{retention: nats.InterestPolicy}
+	logger := watermill.NewCaptureLogger()
+
+	now := time.Now()
+	checker := newInterestChecker(InterestCheckConfig{Interval: time.Minute}, newTopicInterpreter(js, nil, 0), logger)
+	checker.now = func() time.Time { return now }
+
+	checker.check("orders")
+	require.True(t, logger.Has(watermill.CapturedMessage{
+		Level:  watermill.InfoLogLevel,
+		Fields: watermill.LogFields{"topic_name": "orders", "stream": "orders"},
+		Msg:    "Publishing to interest stream without consumers, messages are dropped",
+	}))
+
+	// the stream is checked again once the interval elapsed
+	checker.check("orders")
+	require.Equal(t, 1, js.lookups)
+	now = now.Add(time.Minute)
+	checker.check("orders")
+	require.Equal(t, 2, js.lookups)
+}
+
+func TestInterestChecker_Consumers(t *testing.T) {
+	for _, js := range []*consumersJetStream{
+		{retention: nats.InterestPolicy, consumers: 1},
+		{retention: nats.LimitsPolicy},
+	} {
+		logger := watermill.NewCaptureLogger()
+		checker := newInterestChecker(InterestCheckConfig{Interval: time.Minute}, newTopicInterpreter(js, nil, 0), logger)
+
+		checker.check("orders")
+		require.Equal(t, 1, js.lookups)
+		require.Empty(t, logger.Captured()[watermill.InfoLogLevel])
+	}
+}
+
+func TestInterestRetention(t *testing.T) {
+	js := &provisioningJetStream{
+		streams:   map[string]*nats.StreamConfig{},
+		consumers: map[string]*nats.ConsumerConfig{},
+	}
+	b := newTopicInterpreter(js, nil, 0)
+	b.streamPreset = InterestRetention
+
+	require.NoError(t, b.ensureStream("orders"))
+	require.Equal(t, nats.InterestPolicy, js.streams["orders"].Retention)
+	require.Equal(t, []string{"orders.*"}, js.streams["orders"].Subjects)
+}
+
+func TestLastPerSubjectRetention(t *testing.T) {
+	js := &provisioningJetStream{
+		streams:   map[string]*nats.StreamConfig{},
+		consumers: map[string]*nats.ConsumerConfig{},
+	}
+	b := newTopicInterpreter(js, nil, 0)
+	b.streamPreset = LastPerSubjectRetention
+
+	require.NoError(t, b.ensureStream("customers"))
+	require.Equal(t, int64(1), js.streams["customers"].MaxMsgsPerSubject)
+}
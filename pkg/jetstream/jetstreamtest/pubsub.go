@@ -0,0 +1,376 @@
+// Package jetstreamtest provides an in-memory Pub/Sub mimicking the delivery semantics of the JetStream Pub/Sub,
+// for unit tests which should not depend on a NATS server.
+//
+// Messages are kept per topic by a Server shared by any number of publishers and subscribers.  Subscriptions without a queue group
+// receive every message of the topic, from the first one; subscriptions sharing a queue group share a durable
+// consumer, so every message is handled by one of them and the group keeps its position across subscribers.
+// A subscription delivers one message at a time, nacked messages are redelivered right away and messages
+// neither acked nor nacked within AckWaitTimeout are redelivered, at most MaxDeliver times.
+package jetstreamtest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// Server keeps the messages and consumer groups of the publishers and subscribers created on it.
+type Server struct {
+	mu      sync.Mutex
+	streams map[string]*stream
+	groups  map[groupKey]*consumer
+}
+
+type groupKey struct {
+	topic string
+	group string
+}
+
+// stream holds the messages of a topic.
+type stream struct {
+	messages []*message.Message
+
+	// published is closed (and replaced) whenever a message is added
+	published chan struct{}
+}
+
+// consumer tracks which messages of a stream were delivered, shared by the subscriptions of a queue group.
+type consumer struct {
+	// next is the index of the first message never delivered
+	next int
+
+	// redeliver holds the indexes of messages waiting for redelivery
+	redeliver []int
+
+	// deliveries counts the delivery attempts of in-flight and redelivered messages
+	deliveries map[int]int
+}
+
+// NewServer creates a new in-memory Server.
+func NewServer() *Server {
+	return &Server{
+		streams: map[string]*stream{},
+		groups:  map[groupKey]*consumer{},
+	}
+}
+
+// Messages returns copies of the messages published to topic, in publish order.
+func (s *Server) Messages(topic string) message.Messages {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.streams[topic]
+	if !ok {
+		return nil
+	}
+
+	messages := make(message.Messages, 0, len(st.messages))
+	for _, msg := range st.messages {
+		messages = append(messages, msg.Copy())
+	}
+
+	return messages
+}
+
+// stream returns the stream of topic, creating it when missing.  It must be called with mu held.
+func (s *Server) stream(topic string) *stream {
+	st, ok := s.streams[topic]
+	if !ok {
+		st = &stream{published: make(chan struct{})}
+		s.streams[topic] = st
+	}
+
+	return st
+}
+
+func (s *Server) publish(topic string, messages []*message.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := s.stream(topic)
+	for _, msg := range messages {
+		st.messages = append(st.messages, msg.Copy())
+	}
+
+	close(st.published)
+	st.published = make(chan struct{})
+}
+
+// consumer returns the consumer of group on topic, a new consumer when group is empty.
+func (s *Server) consumer(topic, group string) *consumer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stream(topic)
+
+	if group == "" {
+		return newConsumer()
+	}
+
+	key := groupKey{topic: topic, group: group}
+	c, ok := s.groups[key]
+	if !ok {
+		c = newConsumer()
+		s.groups[key] = c
+	}
+
+	return c
+}
+
+func newConsumer() *consumer {
+	return &consumer{deliveries: map[int]int{}}
+}
+
+// take returns the next message of c to deliver, or a channel closed once a message is published.
+func (s *Server) take(topic string, c *consumer) (int, *message.Message, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := s.stream(topic)
+
+	index := -1
+	if len(c.redeliver) > 0 {
+		index = c.redeliver[0]
+		c.redeliver = c.redeliver[1:]
+	} else if c.next < len(st.messages) {
+		index = c.next
+		c.next++
+	}
+
+	if index < 0 {
+		return -1, nil, st.published
+	}
+
+	c.deliveries[index]++
+	return index, st.messages[index].Copy(), nil
+}
+
+// resolve records the outcome of a delivery, returning whether the message is redelivered.
+func (s *Server) resolve(c *consumer, index int, acked bool, maxDeliver int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if acked || (maxDeliver > 0 && c.deliveries[index] >= maxDeliver) {
+		delete(c.deliveries, index)
+		return false
+	}
+
+	// keep redeliveries in stream order
+	i := 0
+	for i < len(c.redeliver) && c.redeliver[i] < index {
+		i++
+	}
+	c.redeliver = append(c.redeliver, 0)
+	copy(c.redeliver[i+1:], c.redeliver[i:])
+	c.redeliver[i] = index
+
+	return true
+}
+
+// Publisher is an in-memory Publisher on a Server.
+type Publisher struct {
+	server *Server
+
+	closeLock sync.Mutex
+	closed    bool
+}
+
+// NewPublisher creates a new Publisher on server.
+func NewPublisher(server *Server) *Publisher {
+	return &Publisher{server: server}
+}
+
+// Publish stores messages in topic.
+func (p *Publisher) Publish(topic string, messages ...*message.Message) error {
+	p.closeLock.Lock()
+	defer p.closeLock.Unlock()
+
+	if p.closed {
+		return errors.New("publisher is closed")
+	}
+
+	p.server.publish(topic, messages)
+
+	return nil
+}
+
+// Close closes the publisher.
+func (p *Publisher) Close() error {
+	p.closeLock.Lock()
+	defer p.closeLock.Unlock()
+
+	p.closed = true
+
+	return nil
+}
+
+// SubscriberConfig is the configuration to create a subscriber
+type SubscriberConfig struct {
+	// QueueGroup makes subscriptions share a durable consumer per topic, see the package documentation.
+	QueueGroup string
+
+	// AckWaitTimeout is how long a delivered message waits for Ack/Nack before it is redelivered (defaults to 30 seconds).
+	AckWaitTimeout time.Duration
+
+	// MaxDeliver is the maximum number of delivery attempts of a message (defaults to no limit).
+	MaxDeliver int
+}
+
+func (c *SubscriberConfig) setDefaults() {
+	if c.AckWaitTimeout <= 0 {
+		c.AckWaitTimeout = 30 * time.Second
+	}
+}
+
+// Subscriber is an in-memory Subscriber on a Server.
+type Subscriber struct {
+	server *Server
+	config SubscriberConfig
+	logger watermill.LoggerAdapter
+
+	closeLock sync.Mutex
+	closed    bool
+	closing   chan struct{}
+
+	outputsWg sync.WaitGroup
+}
+
+// NewSubscriber creates a new Subscriber on server.
+func NewSubscriber(server *Server, config SubscriberConfig, logger watermill.LoggerAdapter) *Subscriber {
+	config.setDefaults()
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	return &Subscriber{
+		server:  server,
+		config:  config,
+		logger:  logger,
+		closing: make(chan struct{}),
+	}
+}
+
+// SubscribeInitialize creates topic, for parity with the JetStream Subscriber.
+func (s *Subscriber) SubscribeInitialize(topic string) error {
+	s.server.mu.Lock()
+	defer s.server.mu.Unlock()
+
+	s.server.stream(topic)
+
+	return nil
+}
+
+// Subscribe delivers the messages of topic until ctx is cancelled or the Subscriber is closed.
+func (s *Subscriber) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	if s.isClosed() {
+		return nil, errors.New("subscriber is closed")
+	}
+
+	c := s.server.consumer(topic, s.config.QueueGroup)
+	output := make(chan *message.Message)
+
+	logFields := watermill.LogFields{
+		"topic":       topic,
+		"queue_group": s.config.QueueGroup,
+	}
+
+	s.outputsWg.Add(1)
+	go func() {
+		defer s.outputsWg.Done()
+		defer close(output)
+
+		for {
+			index, msg, published := s.server.take(topic, c)
+			if msg == nil {
+				select {
+				case <-published:
+					continue
+				case <-s.closing:
+					return
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			acked, interrupted := s.deliver(ctx, msg, output, logFields)
+			s.server.resolve(c, index, acked, s.config.MaxDeliver)
+
+			if interrupted {
+				return
+			}
+		}
+	}()
+
+	return output, nil
+}
+
+// deliver sends msg to output and waits for its Ack/Nack, returning whether it was acked and whether the
+// subscription was interrupted.
+func (s *Subscriber) deliver(
+	ctx context.Context,
+	msg *message.Message,
+	output chan *message.Message,
+	logFields watermill.LogFields,
+) (bool, bool) {
+	msgCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	msg.SetContext(msgCtx)
+
+	messageLogFields := logFields.Add(watermill.LogFields{"message_uuid": msg.UUID})
+
+	select {
+	case output <- msg:
+		s.logger.Trace("Message sent to consumer", messageLogFields)
+	case <-s.closing:
+		return false, true
+	case <-ctx.Done():
+		return false, true
+	}
+
+	timeout := time.NewTimer(s.config.AckWaitTimeout)
+	defer timeout.Stop()
+
+	select {
+	case <-msg.Acked():
+		s.logger.Trace("Message Acked", messageLogFields)
+		return true, false
+	case <-msg.Nacked():
+		s.logger.Trace("Message Nacked", messageLogFields)
+		return false, false
+	case <-timeout.C:
+		s.logger.Trace("Ack timeout", messageLogFields)
+		return false, false
+	case <-s.closing:
+		return false, true
+	case <-ctx.Done():
+		return false, true
+	}
+}
+
+// Close stops the subscriptions of the Subscriber, the messages and queue groups are kept by the Server.
+func (s *Subscriber) Close() error {
+	s.closeLock.Lock()
+	defer s.closeLock.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	close(s.closing)
+	s.outputsWg.Wait()
+
+	return nil
+}
+
+func (s *Subscriber) isClosed() bool {
+	s.closeLock.Lock()
+	defer s.closeLock.Unlock()
+
+	return s.closed
+}
@@ -0,0 +1,60 @@
+package jetstreamtest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-jetstream/pkg/jetstream/jetstreamtest"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/pubsub/tests"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishSubscribe(t *testing.T) {
+	server := jetstreamtest.NewServer()
+
+	tests.TestPubSub(
+		t,
+		tests.Features{
+			ConsumerGroups:                      true,
+			GuaranteedOrder:                     true,
+			GuaranteedOrderWithSingleSubscriber: true,
+			Persistent:                          true,
+			NewSubscriberReceivesOldMessages:    true,
+		},
+		func(t *testing.T) (message.Publisher, message.Subscriber) {
+			return jetstreamtest.NewPublisher(server), jetstreamtest.NewSubscriber(server, jetstreamtest.SubscriberConfig{}, nil)
+		},
+		func(t *testing.T, consumerGroup string) (message.Publisher, message.Subscriber) {
+			return jetstreamtest.NewPublisher(server), jetstreamtest.NewSubscriber(server, jetstreamtest.SubscriberConfig{QueueGroup: consumerGroup}, nil)
+		},
+	)
+}
+
+func TestSubscriber_MaxDeliver(t *testing.T) {
+	server := jetstreamtest.NewServer()
+
+	sub := jetstreamtest.NewSubscriber(server, jetstreamtest.SubscriberConfig{
+		AckWaitTimeout: 10 * time.Millisecond,
+		MaxDeliver:     3,
+	}, nil)
+	defer sub.Close()
+
+	require.NoError(t, jetstreamtest.NewPublisher(server).Publish("topic", message.NewMessage(watermill.NewUUID(), nil)))
+
+	messages, err := sub.Subscribe(context.Background(), "topic")
+	require.NoError(t, err)
+
+	// nacked, timed out and nacked again
+	(<-messages).Nack()
+	<-messages
+	(<-messages).Nack()
+
+	select {
+	case msg := <-messages:
+		t.Fatalf("message %s delivered after MaxDeliver", msg.UUID)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,25 @@
+package jetstream
+
+import (
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// ensureKeyValue binds to the KV bucket described by cfg, creating it when it does not exist yet.
+func ensureKeyValue(js nats.KeyValueManager, cfg *nats.KeyValueConfig) (nats.KeyValue, error) {
+	kv, err := js.KeyValue(cfg.Bucket)
+	if err == nil {
+		return kv, nil
+	}
+
+	if !errors.Is(err, nats.ErrBucketNotFound) {
+		return nil, errors.Wrapf(err, "cannot bind to bucket %s", cfg.Bucket)
+	}
+
+	kv, err = js.CreateKeyValue(cfg)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot create bucket %s", cfg.Bucket)
+	}
+
+	return kv, nil
+}
@@ -0,0 +1,103 @@
+package jetstream
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryKeyValueEntry struct {
+	nats.KeyValueEntry
+	bucket   string
+	key      string
+	value    []byte
+	revision uint64
+	op       nats.KeyValueOp
+}
+
+func (e memoryKeyValueEntry) Bucket() string             { return e.bucket }
+func (e memoryKeyValueEntry) Key() string                { return e.key }
+func (e memoryKeyValueEntry) Value() []byte              { return e.value }
+func (e memoryKeyValueEntry) Revision() uint64           { return e.revision }
+func (e memoryKeyValueEntry) Operation() nats.KeyValueOp { return e.op }
+
+type memoryKeyValue struct {
+	nats.KeyValue
+	values   map[string]memoryKeyValueEntry
+	revision uint64
+}
+
+func newMemoryKeyValue() *memoryKeyValue {
+	return &memoryKeyValue{values: map[string]memoryKeyValueEntry{}}
+}
+
+func (kv *memoryKeyValue) Get(key string) (nats.KeyValueEntry, error) {
+	entry, ok := kv.values[key]
+	if !ok {
+		return nil, nats.ErrKeyNotFound
+	}
+	return entry, nil
+}
+
+func (kv *memoryKeyValue) Put(key string, value []byte) (uint64, error) {
+	kv.revision++
+	kv.values[key] = memoryKeyValueEntry{key: key, value: value, revision: kv.revision}
+	return kv.revision, nil
+}
+
+func (kv *memoryKeyValue) Create(key string, value []byte) (uint64, error) {
+	if _, ok := kv.values[key]; ok {
+		return 0, errors.New("key exists")
+	}
+	return kv.Put(key, value)
+}
+
+func (kv *memoryKeyValue) Update(key string, value []byte, last uint64) (uint64, error) {
+	if entry, ok := kv.values[key]; !ok || entry.revision != last {
+		return 0, errors.New("wrong last sequence")
+	}
+	return kv.Put(key, value)
+}
+
+func (kv *memoryKeyValue) Delete(key string, _ ...nats.DeleteOpt) error {
+	delete(kv.values, key)
+	return nil
+}
+
+type memoryKeyValueManager struct {
+	nats.KeyValueManager
+	buckets map[string]nats.KeyValue
+}
+
+func (m *memoryKeyValueManager) KeyValue(bucket string) (nats.KeyValue, error) {
+	kv, ok := m.buckets[bucket]
+	if !ok {
+		return nil, nats.ErrBucketNotFound
+	}
+	return kv, nil
+}
+
+func (m *memoryKeyValueManager) CreateKeyValue(cfg *nats.KeyValueConfig) (nats.KeyValue, error) {
+	kv := newMemoryKeyValue()
+	m.buckets[cfg.Bucket] = kv
+	return kv, nil
+}
+
+func (m *memoryKeyValueManager) DeleteKeyValue(bucket string) error {
+	delete(m.buckets, bucket)
+	return nil
+}
+
+func TestEnsureKeyValue(t *testing.T) {
+	m := &memoryKeyValueManager{buckets: map[string]nats.KeyValue{}}
+
+	created, err := ensureKeyValue(m, &nats.KeyValueConfig{Bucket: "bucket"})
+	require.NoError(t, err)
+	require.Len(t, m.buckets, 1)
+
+	bound, err := ensureKeyValue(m, &nats.KeyValueConfig{Bucket: "bucket"})
+	require.NoError(t, err)
+	require.Same(t, created, bound)
+}
@@ -0,0 +1,155 @@
+package jetstream
+
+import (
+	"strconv"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// KVExpectedRevisionMetadataKey is the metadata key holding the revision a KV message expects the key to be at.
+// Revision 0 expects the key not to exist.
+const KVExpectedRevisionMetadataKey = "kv_expected_revision"
+
+// KVPublisherConfig is the configuration to create a KV publisher
+type KVPublisherConfig struct {
+	// Bucket is the KV bucket messages are written into.
+	Bucket string
+
+	// KeyMetadata is the metadata key holding the key a message is written to (defaults to KVKeyMetadataKey).
+	// Messages without it are written to the topic passed to Publish.
+	KeyMetadata string
+
+	// AutoProvision creates the bucket when it does not exist.
+	AutoProvision bool
+
+	// JetstreamOptions are custom Jetstream options for a connection.
+	JetstreamOptions []nats.JSOpt
+}
+
+func (c *KVPublisherConfig) setDefaults() {
+	if c.KeyMetadata == "" {
+		c.KeyMetadata = KVKeyMetadataKey
+	}
+}
+
+// Validate ensures configuration is valid before use
+func (c KVPublisherConfig) Validate() error {
+	if c.Bucket == "" {
+		return errors.New("KVPublisherConfig.Bucket is missing")
+	}
+
+	return nil
+}
+
+// KVPublisher writes messages into a JetStream KV bucket, so a watermill pipeline can maintain materialized key-value state.
+//
+// The payload of a message is stored under its key.  The kv_operation metadata ("delete" or "purge", see KVOperationMetadataKey)
+// removes the key instead, and KVExpectedRevisionMetadataKey makes the write fail unless the key is at the given revision.
+// The revision written is set as KVRevisionMetadataKey on the message.
+type KVPublisher struct {
+	kv     nats.KeyValue
+	config KVPublisherConfig
+	logger watermill.LoggerAdapter
+}
+
+// NewKVPublisher creates a new KVPublisher with the provided nats connection.
+func NewKVPublisher(conn *nats.Conn, config KVPublisherConfig, logger watermill.LoggerAdapter) (*KVPublisher, error) {
+	config.setDefaults()
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	js, err := conn.JetStream(config.JetstreamOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	var kv nats.KeyValue
+	if config.AutoProvision {
+		kv, err = ensureKeyValue(js, &nats.KeyValueConfig{Bucket: config.Bucket})
+	} else {
+		kv, err = js.KeyValue(config.Bucket)
+		err = errors.Wrapf(err, "cannot bind to bucket %s", config.Bucket)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &KVPublisher{
+		kv:     kv,
+		config: config,
+		logger: logger,
+	}, nil
+}
+
+// Publish writes messages into the bucket, keyed by their key metadata or topic.
+// When one of the writes fails - function is interrupted.
+func (p *KVPublisher) Publish(topic string, messages ...*message.Message) error {
+	for _, msg := range messages {
+		if err := p.write(topic, msg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *KVPublisher) write(topic string, msg *message.Message) error {
+	key := msg.Metadata.Get(p.config.KeyMetadata)
+	if key == "" {
+		key = topic
+	}
+
+	logFields := watermill.LogFields{
+		"message_uuid": msg.UUID,
+		"bucket":       p.config.Bucket,
+		"key":          key,
+	}
+
+	p.logger.Trace("Writing message", logFields)
+
+	switch msg.Metadata.Get(KVOperationMetadataKey) {
+	case "delete":
+		return errors.Wrapf(p.kv.Delete(key), "cannot delete key %s", key)
+	case "purge":
+		return errors.Wrapf(p.kv.Purge(key), "cannot purge key %s", key)
+	}
+
+	var revision uint64
+	var err error
+
+	if expected := msg.Metadata.Get(KVExpectedRevisionMetadataKey); expected != "" {
+		last, parseErr := strconv.ParseUint(expected, 10, 64)
+		if parseErr != nil {
+			return errors.Wrapf(parseErr, "invalid expected revision of message %s", msg.UUID)
+		}
+
+		if last == 0 {
+			revision, err = p.kv.Create(key, msg.Payload)
+		} else {
+			revision, err = p.kv.Update(key, msg.Payload, last)
+		}
+	} else {
+		revision, err = p.kv.Put(key, msg.Payload)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "cannot write key %s", key)
+	}
+
+	msg.Metadata.Set(KVRevisionMetadataKey, strconv.FormatUint(revision, 10))
+
+	return nil
+}
+
+// Close closes the publisher, the nats connection is not closed.
+func (p *KVPublisher) Close() error {
+	return nil
+}
@@ -0,0 +1,49 @@
+package jetstream
+
+import (
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKVPublisher_Publish(t *testing.T) {
+	kv := newMemoryKeyValue()
+
+	config := KVPublisherConfig{Bucket: "state"}
+	config.setDefaults()
+
+	p := &KVPublisher{kv: kv, config: config, logger: watermill.NopLogger{}}
+
+	byTopic := message.NewMessage("uuid-1", []byte("v1"))
+	require.NoError(t, p.Publish("orders.1", byTopic))
+	require.Equal(t, "1", byTopic.Metadata.Get(KVRevisionMetadataKey))
+
+	byKey := message.NewMessage("uuid-2", []byte("v2"))
+	byKey.Metadata.Set(KVKeyMetadataKey, "orders.2")
+	require.NoError(t, p.Publish("orders", byKey))
+
+	entry, err := kv.Get("orders.2")
+	require.NoError(t, err)
+	require.Equal(t, []byte("v2"), entry.Value())
+
+	staleUpdate := message.NewMessage("uuid-3", []byte("v3"))
+	staleUpdate.Metadata.Set(KVExpectedRevisionMetadataKey, "5")
+	require.Error(t, p.Publish("orders.1", staleUpdate))
+
+	update := message.NewMessage("uuid-4", []byte("v4"))
+	update.Metadata.Set(KVExpectedRevisionMetadataKey, "1")
+	require.NoError(t, p.Publish("orders.1", update))
+
+	create := message.NewMessage("uuid-5", []byte("v5"))
+	create.Metadata.Set(KVExpectedRevisionMetadataKey, "0")
+	require.Error(t, p.Publish("orders.1", create))
+
+	deletion := message.NewMessage("uuid-6", nil)
+	deletion.Metadata.Set(KVOperationMetadataKey, "delete")
+	require.NoError(t, p.Publish("orders.2", deletion))
+
+	_, err = kv.Get("orders.2")
+	require.Error(t, err)
+}
@@ -0,0 +1,269 @@
+package jetstream
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	watermillSync "github.com/ThreeDotsLabs/watermill/pubsub/sync"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+const (
+	// KVBucketMetadataKey is the metadata key holding the bucket of a KV message.
+	KVBucketMetadataKey = "kv_bucket"
+
+	// KVKeyMetadataKey is the metadata key holding the key of a KV message.
+	KVKeyMetadataKey = "kv_key"
+
+	// KVRevisionMetadataKey is the metadata key holding the revision of a KV message.
+	KVRevisionMetadataKey = "kv_revision"
+
+	// KVOperationMetadataKey is the metadata key holding the operation of a KV message (put, delete or purge).
+	KVOperationMetadataKey = "kv_operation"
+)
+
+// KVSubscriberConfig is the configuration to create a KV subscriber
+type KVSubscriberConfig struct {
+	// Bucket is the watched KV bucket, it needs to exist.
+	Bucket string
+
+	// IncludeHistory delivers all historical values of the watched keys instead of only their latest value when subscribing.
+	IncludeHistory bool
+
+	// UpdatesOnly skips the values present when subscribing, only delivering later updates.
+	UpdatesOnly bool
+
+	// IgnoreDeletes skips delete and purge operations.
+	IgnoreDeletes bool
+
+	// CloseTimeout determines how long subscriber will wait for Ack/Nack on close (defaults to 30 seconds).
+	CloseTimeout time.Duration
+
+	// JetstreamOptions are custom Jetstream options for a connection.
+	JetstreamOptions []nats.JSOpt
+}
+
+func (c *KVSubscriberConfig) setDefaults() {
+	if c.CloseTimeout <= 0 {
+		c.CloseTimeout = time.Second * 30
+	}
+}
+
+// Validate ensures configuration is valid before use
+func (c KVSubscriberConfig) Validate() error {
+	if c.Bucket == "" {
+		return errors.New("KVSubscriberConfig.Bucket is missing")
+	}
+
+	if c.IncludeHistory && c.UpdatesOnly {
+		return errors.New("KVSubscriberConfig.IncludeHistory can not be combined with KVSubscriberConfig.UpdatesOnly")
+	}
+
+	return nil
+}
+
+// KVSubscriber watches a JetStream KV bucket and delivers its updates as watermill messages, e.g. for
+// configuration changes or presence events.
+//
+// The topic passed to Subscribe is the watched key, it can contain wildcards ("config.>", or ">" for all keys).
+// Messages carry the value as payload and the key, revision and operation as metadata (see KVKeyMetadataKey).
+// Updates are delivered one at a time, a nacked message is delivered again.
+type KVSubscriber struct {
+	kv     nats.KeyValue
+	config KVSubscriberConfig
+	logger watermill.LoggerAdapter
+
+	closedLock sync.Mutex
+	closed     bool
+	closing    chan struct{}
+	outputsWg  sync.WaitGroup
+}
+
+// NewKVSubscriber creates a new KVSubscriber with the provided nats connection.
+func NewKVSubscriber(conn *nats.Conn, config KVSubscriberConfig, logger watermill.LoggerAdapter) (*KVSubscriber, error) {
+	config.setDefaults()
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	js, err := conn.JetStream(config.JetstreamOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	kv, err := js.KeyValue(config.Bucket)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot bind to bucket %s", config.Bucket)
+	}
+
+	return &KVSubscriber{
+		kv:      kv,
+		config:  config,
+		logger:  logger,
+		closing: make(chan struct{}),
+	}, nil
+}
+
+// Subscribe watches the keys matching topic.
+func (s *KVSubscriber) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	logFields := watermill.LogFields{
+		"bucket": s.config.Bucket,
+		"topic":  topic,
+	}
+
+	var opts []nats.WatchOpt
+	if s.config.IncludeHistory {
+		opts = append(opts, nats.IncludeHistory())
+	}
+	if s.config.IgnoreDeletes {
+		opts = append(opts, nats.IgnoreDeletes())
+	}
+
+	watcher, err := s.kv.Watch(topic, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot watch bucket")
+	}
+
+	output := make(chan *message.Message)
+
+	s.outputsWg.Add(1)
+	go func() {
+		defer s.outputsWg.Done()
+		defer close(output)
+		defer func() {
+			if err := watcher.Stop(); err != nil {
+				s.logger.Error("Cannot stop watcher", err, logFields)
+			}
+		}()
+
+		// the watcher sends a nil entry once the values present when subscribing were delivered
+		initial := true
+
+		for {
+			var entry nats.KeyValueEntry
+			select {
+			case e, ok := <-watcher.Updates():
+				if !ok {
+					return
+				}
+				entry = e
+			case <-s.closing:
+				return
+			case <-ctx.Done():
+				return
+			}
+
+			if entry == nil {
+				initial = false
+				continue
+			}
+
+			if initial && s.config.UpdatesOnly {
+				continue
+			}
+
+			if !s.deliverUntilAcked(ctx, kvEntryMessage(entry), output, logFields) {
+				return
+			}
+		}
+	}()
+
+	return output, nil
+}
+
+// deliverUntilAcked sends msg to output until it is acked, returning false when delivery was interrupted.
+func (s *KVSubscriber) deliverUntilAcked(ctx context.Context, msg *message.Message, output chan *message.Message, logFields watermill.LogFields) bool {
+	return deliverCopiesUntilAcked(ctx, s.closing, msg, output, s.logger, logFields)
+}
+
+// deliverCopiesUntilAcked sends msg to output until it is acked, delivering a copy after every nack.
+// It returns false when delivery was interrupted.
+func deliverCopiesUntilAcked(
+	ctx context.Context,
+	closing chan struct{},
+	msg *message.Message,
+	output chan *message.Message,
+	logger watermill.LoggerAdapter,
+	logFields watermill.LogFields,
+) bool {
+	messageLogFields := logFields.Add(watermill.LogFields{"message_uuid": msg.UUID})
+
+	for {
+		select {
+		case output <- msg:
+			logger.Trace("Message sent to consumer", messageLogFields)
+		case <-closing:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+
+		select {
+		case <-msg.Acked():
+			logger.Trace("Message Acked", messageLogFields)
+			return true
+		case <-msg.Nacked():
+			logger.Trace("Message Nacked, delivering again", messageLogFields)
+			msg = msg.Copy()
+		case <-closing:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// kvEntryMessage converts a KV entry into a watermill message.
+func kvEntryMessage(entry nats.KeyValueEntry) *message.Message {
+	msg := message.NewMessage(watermill.NewUUID(), entry.Value())
+
+	msg.Metadata.Set(KVBucketMetadataKey, entry.Bucket())
+	msg.Metadata.Set(KVKeyMetadataKey, entry.Key())
+	msg.Metadata.Set(KVRevisionMetadataKey, strconv.FormatUint(entry.Revision(), 10))
+	msg.Metadata.Set(KVOperationMetadataKey, kvOperation(entry.Operation()))
+
+	return msg
+}
+
+func kvOperation(op nats.KeyValueOp) string {
+	switch op {
+	case nats.KeyValueDelete:
+		return "delete"
+	case nats.KeyValuePurge:
+		return "purge"
+	default:
+		return "put"
+	}
+}
+
+// Close stops all watches.  It will attempt to wait for in-flight messages to complete.
+func (s *KVSubscriber) Close() error {
+	s.closedLock.Lock()
+	defer s.closedLock.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	s.logger.Debug("Closing KV subscriber", nil)
+	defer s.logger.Info("KV subscriber closed", nil)
+
+	close(s.closing)
+
+	if watermillSync.WaitGroupTimeout(&s.outputsWg, s.config.CloseTimeout) {
+		return errors.New("output wait group did not finish")
+	}
+
+	return nil
+}
@@ -0,0 +1,31 @@
+package jetstream
+
+import (
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKVEntryMessage(t *testing.T) {
+	msg := kvEntryMessage(memoryKeyValueEntry{
+		bucket:   "config",
+		key:      "feature.flags",
+		value:    []byte("on"),
+		revision: 7,
+		op:       nats.KeyValueDelete,
+	})
+
+	require.NotEmpty(t, msg.UUID)
+	require.Equal(t, []byte("on"), []byte(msg.Payload))
+	require.Equal(t, "config", msg.Metadata.Get(KVBucketMetadataKey))
+	require.Equal(t, "feature.flags", msg.Metadata.Get(KVKeyMetadataKey))
+	require.Equal(t, "7", msg.Metadata.Get(KVRevisionMetadataKey))
+	require.Equal(t, "delete", msg.Metadata.Get(KVOperationMetadataKey))
+}
+
+func TestKVSubscriberConfig_Validate(t *testing.T) {
+	require.Error(t, KVSubscriberConfig{}.Validate())
+	require.NoError(t, KVSubscriberConfig{Bucket: "config"}.Validate())
+	require.Error(t, KVSubscriberConfig{Bucket: "config", IncludeHistory: true, UpdatesOnly: true}.Validate())
+}
@@ -0,0 +1,79 @@
+package jetstream
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PublishStats describes a message published by a Publisher.
+type PublishStats struct {
+	// Topic is the topic the message was published to.
+	Topic string
+
+	// Latency is the round trip of the publish, from sending the message until JetStream acknowledged it.
+	Latency time.Duration
+
+	// Err is the error of the publish, nil when it was acknowledged.
+	Err error
+}
+
+// LatencyConfig reports the latency of a publisher, e.g. to export it as metrics.
+//
+// Comparing the publish latency of a topic with the round trip time to the server tells whether slow publishes
+// are caused by the broker (storing or replicating the message) or by the network and the application.
+type LatencyConfig struct {
+	// OnPublish is called after every publish, including failed ones, with its round trip latency.
+	OnPublish func(stats PublishStats)
+
+	// RTTInterval is the interval the round trip time to the server is probed at, probing is disabled when zero.
+	RTTInterval time.Duration
+
+	// OnRTT is called with every probed round trip time, or the error of probing it.
+	OnRTT func(rtt time.Duration, err error)
+}
+
+func (c LatencyConfig) probes() bool {
+	return c.RTTInterval > 0
+}
+
+// Validate ensures configuration is valid before use
+func (c LatencyConfig) Validate() error {
+	if c.RTTInterval < 0 {
+		return errors.New("LatencyConfig.RTTInterval can not be negative")
+	}
+	if c.probes() && c.OnRTT == nil {
+		return errors.New("LatencyConfig.RTTInterval requires LatencyConfig.OnRTT")
+	}
+
+	return nil
+}
+
+// recordPublish reports a publish to topic started at start.
+func (c LatencyConfig) recordPublish(topic string, start time.Time, err error) {
+	if c.OnPublish == nil {
+		return
+	}
+
+	c.OnPublish(PublishStats{
+		Topic:   topic,
+		Latency: time.Since(start),
+		Err:     err,
+	})
+}
+
+// probeRTT reports the round trip time measured by rtt every RTTInterval until closing is closed.
+func (c LatencyConfig) probeRTT(rtt func() (time.Duration, error), closing chan struct{}) {
+	ticker := time.NewTicker(c.RTTInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closing:
+			return
+		case <-ticker.C:
+		}
+
+		c.OnRTT(rtt())
+	}
+}
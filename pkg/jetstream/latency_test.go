@@ -0,0 +1,93 @@
+package jetstream
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatencyConfig_Validate(t *testing.T) {
+	require.NoError(t, LatencyConfig{}.Validate())
+	require.NoError(t, LatencyConfig{RTTInterval: time.Second, OnRTT: func(time.Duration, error) {}}.Validate())
+	require.EqualError(t, LatencyConfig{RTTInterval: -time.Second}.Validate(), "LatencyConfig.RTTInterval can not be negative")
+	require.EqualError(t, LatencyConfig{RTTInterval: time.Second}.Validate(), "LatencyConfig.RTTInterval requires LatencyConfig.OnRTT")
+}
+
+func TestPublisher_PublishLatency(t *testing.T) {
+	var stats []PublishStats
+
+	js := &faultyJetStream{}
+	p := &Publisher{
+		config: PublisherPublishConfig{
+			Marshaler: &GobMarshaler{},
+			Latency: LatencyConfig{
+				OnPublish: func(s PublishStats) { stats = append(stats, s) },
+			},
+		},
+		logger: watermill.NopLogger{},
+	}
+	p.decorateClient(clientDecorator{
+		jetStream: func(nats.JetStream) nats.JetStream { return js },
+	})
+
+	require.NoError(t, p.Publish("topic", message.NewMessage(watermill.NewUUID(), nil)))
+
+	js.publishErr = nats.ErrTimeout
+	require.Error(t, p.Publish("other", message.NewMessage(watermill.NewUUID(), nil)))
+
+	require.Len(t, stats, 2)
+	require.Equal(t, "topic", stats[0].Topic)
+	require.NoError(t, stats[0].Err)
+	require.Equal(t, "other", stats[1].Topic)
+	require.True(t, errors.Is(stats[1].Err, nats.ErrTimeout))
+}
+
+func TestLatencyConfig_ProbeRTT(t *testing.T) {
+	var (
+		lock   sync.Mutex
+		probed []error
+	)
+
+	c := LatencyConfig{
+		RTTInterval: time.Millisecond,
+		OnRTT: func(rtt time.Duration, err error) {
+			lock.Lock()
+			defer lock.Unlock()
+			probed = append(probed, err)
+		},
+	}
+
+	probes := 0
+	rtt := func() (time.Duration, error) {
+		probes++
+		if probes == 1 {
+			return 0, nats.ErrConnectionClosed
+		}
+		return time.Millisecond, nil
+	}
+
+	closing := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		c.probeRTT(rtt, closing)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(probed) >= 2
+	}, time.Second, time.Millisecond)
+
+	close(closing)
+	<-done
+
+	require.True(t, errors.Is(probed[0], nats.ErrConnectionClosed))
+	require.NoError(t, probed[1])
+}
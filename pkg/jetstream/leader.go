@@ -0,0 +1,226 @@
+package jetstream
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// LeaderElectionConfig is the configuration to create a leader election
+type LeaderElectionConfig struct {
+	// Bucket is the KV bucket leadership leases are kept in, it is created when missing.
+	Bucket string
+
+	// InstanceID identifies this subscriber instance (defaults to a random ID).
+	InstanceID string
+
+	// LeaseTTL is how long the leader keeps leadership without renewing its lease (defaults to 15 seconds).
+	// It is the TTL of the bucket, so every instance using the bucket needs the same LeaseTTL.
+	LeaseTTL time.Duration
+
+	// RefreshInterval is how often the leader renews its lease and standbys try to take over
+	// (defaults to a third of LeaseTTL).
+	RefreshInterval time.Duration
+
+	// JetstreamOptions are custom Jetstream options for a connection.
+	JetstreamOptions []nats.JSOpt
+}
+
+func (c *LeaderElectionConfig) setDefaults() {
+	if c.InstanceID == "" {
+		c.InstanceID = watermill.NewShortUUID()
+	}
+	if c.LeaseTTL <= 0 {
+		c.LeaseTTL = 15 * time.Second
+	}
+	if c.RefreshInterval <= 0 {
+		c.RefreshInterval = c.LeaseTTL / 3
+	}
+}
+
+// Validate ensures configuration is valid before use
+func (c LeaderElectionConfig) Validate() error {
+	if c.Bucket == "" {
+		return errors.New("LeaderElectionConfig.Bucket is missing")
+	}
+
+	if c.RefreshInterval >= c.LeaseTTL {
+		return errors.New("LeaderElectionConfig.RefreshInterval must be shorter than LeaderElectionConfig.LeaseTTL")
+	}
+
+	return nil
+}
+
+// LeaderElection makes a single instance out of a group consume a topic, with the others on hot standby.
+//
+// The leader holds a lease keyed by topic in a KV bucket, created only when the key is missing and renewed
+// with a revision check every RefreshInterval.  When the leader dies its lease expires after LeaseTTL and
+// the first standby to create it again takes over.  A leader failing to renew stops consuming right away,
+// but as with any lease a stalled leader may overlap with its successor for up to RefreshInterval.
+type LeaderElection struct {
+	kv     nats.KeyValue
+	config LeaderElectionConfig
+	logger watermill.LoggerAdapter
+}
+
+// NewLeaderElection creates a new LeaderElection with the provided nats connection.
+func NewLeaderElection(conn *nats.Conn, config LeaderElectionConfig, logger watermill.LoggerAdapter) (*LeaderElection, error) {
+	config.setDefaults()
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	js, err := conn.JetStream(config.JetstreamOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	kv, err := ensureKeyValue(js, &nats.KeyValueConfig{
+		Bucket: config.Bucket,
+		TTL:    config.LeaseTTL,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &LeaderElection{
+		kv:     kv,
+		config: config,
+		logger: logger,
+	}, nil
+}
+
+// Subscribe consumes topic with subscriber while this instance is the leader, until ctx is cancelled.
+//
+// The subscriber needs a DurableName, so the consumer keeps its position when leadership moves.
+func (l *LeaderElection) Subscribe(ctx context.Context, subscriber *Subscriber, topic string) (<-chan *message.Message, error) {
+	if subscriber.config.DurableName == "" {
+		return nil, errors.New("leader election requires SubscriberConfig.DurableName")
+	}
+
+	logFields := watermill.LogFields{
+		"topic":       topic,
+		"instance_id": l.config.InstanceID,
+	}
+
+	lease := &leaderLease{kv: l.kv, key: topic, id: l.config.InstanceID}
+	output := make(chan *message.Message)
+
+	go func() {
+		defer close(output)
+
+		forwardersWg := &sync.WaitGroup{}
+		defer forwardersWg.Wait()
+
+		cancelSubscription := func() {}
+		defer func() { cancelSubscription() }()
+
+		defer func() {
+			if err := lease.release(); err != nil {
+				l.logger.Error("Cannot release leadership", err, logFields)
+			}
+		}()
+
+		ticker := time.NewTicker(l.config.RefreshInterval)
+		defer ticker.Stop()
+
+		for {
+			wasLeader := lease.held()
+			leader, err := lease.refresh()
+
+			switch {
+			case leader && !wasLeader:
+				l.logger.Info("Leadership acquired", logFields)
+
+				subCtx, cancel := context.WithCancel(ctx)
+				messages, err := subscriber.Subscribe(withBoundConsumer(subCtx), topic)
+				if err != nil {
+					cancel()
+					l.logger.Error("Cannot subscribe as leader", err, logFields)
+					// let another instance take over
+					if err := lease.release(); err != nil {
+						l.logger.Error("Cannot release leadership", err, logFields)
+					}
+					break
+				}
+				cancelSubscription = cancel
+
+				forwardersWg.Add(1)
+				go func() {
+					defer forwardersWg.Done()
+					forwardMessages(ctx, messages, output)
+				}()
+			case !leader && wasLeader:
+				l.logger.Error("Leadership lost", err, logFields)
+
+				cancelSubscription()
+				cancelSubscription = func() {}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-subscriber.closing:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return output, nil
+}
+
+// leaderLease is the leadership lease of an instance in a KV bucket.
+type leaderLease struct {
+	kv  nats.KeyValue
+	key string
+	id  string
+
+	// revision is the revision of the lease held by this instance, zero when it is not the leader
+	revision uint64
+}
+
+func (l *leaderLease) held() bool {
+	return l.revision != 0
+}
+
+// refresh renews the lease when it is held, or tries to acquire it otherwise, returning whether it is held.
+func (l *leaderLease) refresh() (bool, error) {
+	var (
+		revision uint64
+		err      error
+	)
+	if l.held() {
+		revision, err = l.kv.Update(l.key, []byte(l.id), l.revision)
+	} else {
+		revision, err = l.kv.Create(l.key, []byte(l.id))
+	}
+
+	if err != nil {
+		l.revision = 0
+		return false, err
+	}
+
+	l.revision = revision
+	return true, nil
+}
+
+// release deletes the lease when it is held, so a standby can take over without waiting for it to expire.
+func (l *leaderLease) release() error {
+	if !l.held() {
+		return nil
+	}
+
+	l.revision = 0
+	return l.kv.Delete(l.key)
+}
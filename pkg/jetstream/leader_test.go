@@ -0,0 +1,54 @@
+package jetstream
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeaderLease_Failover(t *testing.T) {
+	kv := newMemoryKeyValue()
+
+	first := &leaderLease{kv: kv, key: "topic", id: "first"}
+	second := &leaderLease{kv: kv, key: "topic", id: "second"}
+
+	leader, err := first.refresh()
+	require.NoError(t, err)
+	require.True(t, leader)
+
+	leader, _ = second.refresh()
+	require.False(t, leader)
+
+	// renewing keeps leadership
+	leader, err = first.refresh()
+	require.NoError(t, err)
+	require.True(t, leader)
+
+	// the lease expires, the standby takes over
+	require.NoError(t, kv.Delete("topic"))
+	leader, err = second.refresh()
+	require.NoError(t, err)
+	require.True(t, leader)
+
+	// the previous leader notices it lost the lease
+	leader, _ = first.refresh()
+	require.False(t, leader)
+	require.False(t, first.held())
+
+	require.NoError(t, second.release())
+	leader, err = first.refresh()
+	require.NoError(t, err)
+	require.True(t, leader)
+}
+
+func TestLeaderElectionConfig_Validate(t *testing.T) {
+	config := LeaderElectionConfig{}
+	config.setDefaults()
+	require.Error(t, config.Validate())
+
+	config.Bucket = "leaders"
+	require.NoError(t, config.Validate())
+
+	config.RefreshInterval = config.LeaseTTL
+	require.Error(t, config.Validate())
+}
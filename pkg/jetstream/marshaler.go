@@ -41,31 +41,35 @@ type GobMarshaler struct{}
 
 // Marshal transforms a watermill message into gob format.
 func (GobMarshaler) Marshal(topic string, msg *message.Message) (*nats.Msg, error) {
-	buf := new(bytes.Buffer)
+	buf := acquireBuffer()
+	defer releaseBuffer(buf)
 
 	encoder := gob.NewEncoder(buf)
 	if err := encoder.Encode(msg); err != nil {
 		return nil, errors.Wrap(err, "cannot encode message")
 	}
 
-	return defaultNatsMsg(topic, msg.UUID, buf.Bytes(), nil), nil
+	// the pooled buffer is reused once the message is encoded, so the data needs its own copy
+	data := make([]byte, buf.Len())
+	copy(data, buf.Bytes())
+
+	return defaultNatsMsg(topic, msg.UUID, data, nil), nil
 }
 
 // Unmarshal extracts a watermill message from a nats message.
 func (GobMarshaler) Unmarshal(natsMsg *nats.Msg) (*message.Message, error) {
-	buf := new(bytes.Buffer)
-
-	_, err := buf.Write(natsMsg.Data)
-	if err != nil {
-		return nil, errors.Wrap(err, "cannot write nats message data to buffer")
-	}
+	decoder := gob.NewDecoder(bytes.NewReader(natsMsg.Data))
 
-	decoder := gob.NewDecoder(buf)
-
-	var decodedMsg message.Message
+	// gob decodes into the capacity of a released payload when there is one
+	decodedMsg := message.Message{Payload: acquirePayload()}
 	if err := decoder.Decode(&decodedMsg); err != nil {
+		releasePayload(decodedMsg.Payload)
 		return nil, errors.Wrap(err, "cannot decode message")
 	}
+	if len(decodedMsg.Payload) == 0 {
+		releasePayload(decodedMsg.Payload)
+		decodedMsg.Payload = nil
+	}
 
 	// creating clean message, to avoid invalid internal state with ack
 	msg := message.NewMessage(decodedMsg.UUID, decodedMsg.Payload)
@@ -74,6 +78,8 @@ func (GobMarshaler) Unmarshal(natsMsg *nats.Msg) (*message.Message, error) {
 	return msg, nil
 }
 
+func (GobMarshaler) poolsPayloads() {}
+
 // JSONMarshaler uses encoding/json to marshal Watermill messages.
 type JSONMarshaler struct{}
 
@@ -104,6 +110,8 @@ func (JSONMarshaler) Unmarshal(natsMsg *nats.Msg) (*message.Message, error) {
 
 // NATSMarshaler uses NATS header to marshal directly between watermill and NATS formats.
 // The watermill UUID is stored at _watermill_message_uuid
+//
+// The payload is not copied: an unmarshaled payload is the NATS message data, so it must not be modified.
 type NATSMarshaler struct{}
 
 // reserved header for NATSMarshaler to send UUID
@@ -137,7 +145,7 @@ func (*NATSMarshaler) Unmarshal(natsMsg *nats.Msg) (*message.Message, error) {
 
 	for k, v := range hdr {
 		switch k {
-		case WatermillUUIDHdr, nats.MsgIdHdr, nats.ExpectedLastMsgIdHdr, nats.ExpectedStreamHdr, nats.ExpectedLastSubjSeqHdr, nats.ExpectedLastSeqHdr:
+		case WatermillUUIDHdr, CorrelationIDHdr, nats.MsgIdHdr, nats.ExpectedLastMsgIdHdr, nats.ExpectedStreamHdr, nats.ExpectedLastSubjSeqHdr, nats.ExpectedLastSeqHdr:
 			continue
 		default:
 			if len(v) == 1 {
@@ -0,0 +1,203 @@
+// Package middleware provides watermill router middlewares for messages received from JetStream by
+// jetstream.Subscriber, using the JetStream metadata (delivery count, ack subject) they are delivered with.
+//
+// Middlewares deciding how failed messages are settled (DeadLetter, Backoff) do it with jetstream.SetDecision,
+// so they only apply to messages delivered by Subscribe.  The handler error is still returned, so the router logs
+// it and nacks the message, and the Subscriber settles it as decided.  Messages without JetStream metadata
+// (e.g. from another Pub/Sub) go through the middlewares unchanged.
+package middleware
+
+import (
+	"math"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-jetstream/pkg/jetstream"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// numDelivered returns how many times msg was delivered by JetStream, false for messages without JetStream metadata.
+func numDelivered(msg *message.Message) (uint64, bool) {
+	meta, ok := jetstream.MsgMetadataFromCtx(msg.Context())
+	if !ok {
+		return 0, false
+	}
+
+	return meta.NumDelivered, true
+}
+
+// DeadLetterConfig is the configuration of DeadLetter.
+type DeadLetterConfig struct {
+	// MaxDeliveries is the delivery count from which failed messages are dead lettered instead of nacked.
+	// It should be lower than the MaxDeliver of the consumer, the server stops redelivering messages past it.
+	MaxDeliveries uint64
+}
+
+// Validate ensures configuration is valid before use
+func (c DeadLetterConfig) Validate() error {
+	if c.MaxDeliveries == 0 {
+		return errors.New("DeadLetterConfig.MaxDeliveries must be positive")
+	}
+
+	return nil
+}
+
+// DeadLetter dead letters messages failing their last delivery, once they were delivered MaxDeliveries times.
+// They are republished to the dead letter topic of jetstream.DispositionConfig (in NATS wire format,
+// so they can be redriven) with the handler error as reason, and terminated.
+func DeadLetter(config DeadLetterConfig) (message.HandlerMiddleware, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return func(h message.HandlerFunc) message.HandlerFunc {
+		return func(msg *message.Message) ([]*message.Message, error) {
+			produced, err := h(msg)
+			if err == nil {
+				return produced, nil
+			}
+
+			if delivered, ok := numDelivered(msg); ok && delivered >= config.MaxDeliveries {
+				jetstream.SetDecision(msg, jetstream.Decision{
+					Disposition: jetstream.DispositionDeadLetter,
+					Reason:      err.Error(),
+				})
+			}
+
+			return produced, err
+		}
+	}, nil
+}
+
+// BackoffConfig is the configuration of Backoff.
+type BackoffConfig struct {
+	// InitialDelay is the redelivery delay of a message failing its first delivery.
+	InitialDelay time.Duration
+
+	// Multiplier multiplies the delay with every delivery (defaults to 2).
+	Multiplier float64
+
+	// MaxDelay caps the redelivery delay, it is not capped when zero.
+	MaxDelay time.Duration
+}
+
+func (c *BackoffConfig) setDefaults() {
+	if c.Multiplier == 0 {
+		c.Multiplier = 2
+	}
+}
+
+// Validate ensures configuration is valid before use
+func (c BackoffConfig) Validate() error {
+	if c.InitialDelay <= 0 {
+		return errors.New("BackoffConfig.InitialDelay must be positive")
+	}
+	if c.Multiplier < 1 {
+		return errors.New("BackoffConfig.Multiplier can not be lower than 1")
+	}
+	if c.MaxDelay < 0 {
+		return errors.New("BackoffConfig.MaxDelay can not be negative")
+	}
+
+	return nil
+}
+
+// delay returns the redelivery delay of a message failing its delivered-th delivery.
+func (c BackoffConfig) delay(delivered uint64) time.Duration {
+	if delivered > math.MaxInt32 {
+		delivered = math.MaxInt32
+	}
+
+	return jetstream.ExponentialRetryPolicy{
+		InitialDelay: c.InitialDelay,
+		Multiplier:   c.Multiplier,
+		MaxDelay:     c.MaxDelay,
+	}.NextDelay(int(delivered))
+}
+
+// Backoff naks failed messages with a delay growing with their delivery count, so a failing message is not
+// redelivered right away over and over.  Unlike the BackOff of the consumer, it applies to nacked messages
+// and can be changed without recreating the consumer.
+//
+// DeadLetter should wrap Backoff (be added to the router before it), so messages failing their last delivery
+// are dead lettered.
+func Backoff(config BackoffConfig) (message.HandlerMiddleware, error) {
+	config.setDefaults()
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return func(h message.HandlerFunc) message.HandlerFunc {
+		return func(msg *message.Message) ([]*message.Message, error) {
+			produced, err := h(msg)
+			if err == nil {
+				return produced, nil
+			}
+
+			if delivered, ok := numDelivered(msg); ok && delivered > 0 {
+				jetstream.SetDecision(msg, jetstream.Decision{
+					Disposition: jetstream.DispositionNakWithDelay,
+					Delay:       config.delay(delivered),
+				})
+			}
+
+			return produced, err
+		}
+	}, nil
+}
+
+// InProgress signals JetStream that messages are still being handled every interval while the handler runs,
+// resetting their ack wait, so long running handlers are not redelivered to another subscriber meanwhile.
+// The interval should be well below the AckWait of the consumer.
+func InProgress(interval time.Duration, logger watermill.LoggerAdapter) message.HandlerMiddleware {
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	return func(h message.HandlerFunc) message.HandlerFunc {
+		return func(msg *message.Message) ([]*message.Message, error) {
+			m, ok := jetstream.NatsMsgFromCtx(msg.Context())
+			if !ok || interval <= 0 {
+				return h(msg)
+			}
+
+			done := make(chan struct{})
+			defer close(done)
+
+			go signalInProgress(m, interval, done, logger, watermill.LogFields{"message_uuid": msg.UUID})
+
+			return h(msg)
+		}
+	}
+}
+
+func signalInProgress(
+	m *nats.Msg,
+	interval time.Duration,
+	done chan struct{},
+	logger watermill.LoggerAdapter,
+	logFields watermill.LogFields,
+) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		if err := m.InProgress(); err != nil {
+			logger.Error("Cannot signal message in progress", err, logFields)
+		}
+	}
+}
+
+// Deduplicate skips messages already processed according to deduplicator, see jetstream.KVDeduplicator.
+func Deduplicate(deduplicator *jetstream.KVDeduplicator) message.HandlerMiddleware {
+	return deduplicator.Middleware
+}
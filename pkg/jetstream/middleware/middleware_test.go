@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-jetstream/pkg/jetstream"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+var errHandler = errors.New("handler failed")
+
+// deliveredMsg returns a message as delivered by the Subscriber for the delivered-th time.
+func deliveredMsg(delivered uint64) *message.Message {
+	m := &nats.Msg{
+		Subject: "orders",
+		Reply:   fmt.Sprintf("$JS.ACK.orders.consumer.%d.10.5.%d.0", delivered, time.Now().UnixNano()),
+		Sub:     &nats.Subscription{},
+	}
+
+	msg := message.NewMessage(watermill.NewUUID(), nil)
+	msg.SetContext(jetstream.WithNatsMsg(context.Background(), m))
+
+	return msg
+}
+
+func failing(*message.Message) ([]*message.Message, error) {
+	return nil, errHandler
+}
+
+func TestDeadLetter(t *testing.T) {
+	_, err := DeadLetter(DeadLetterConfig{})
+	require.Error(t, err)
+
+	mw, err := DeadLetter(DeadLetterConfig{MaxDeliveries: 3})
+	require.NoError(t, err)
+	h := mw(failing)
+
+	msg := deliveredMsg(2)
+	_, err = h(msg)
+	require.True(t, errors.Is(err, errHandler), "unexpected error: %v", err)
+	_, decided := jetstream.DecisionFromMsg(msg)
+	require.False(t, decided)
+
+	msg = deliveredMsg(3)
+	_, err = h(msg)
+	require.True(t, errors.Is(err, errHandler), "unexpected error: %v", err)
+	decision, decided := jetstream.DecisionFromMsg(msg)
+	require.True(t, decided)
+	require.Equal(t, jetstream.DispositionDeadLetter, decision.Disposition)
+	require.Equal(t, errHandler.Error(), decision.Reason)
+
+	msg = message.NewMessage(watermill.NewUUID(), nil)
+	_, err = h(msg)
+	require.True(t, errors.Is(err, errHandler), "unexpected error: %v", err)
+	_, decided = jetstream.DecisionFromMsg(msg)
+	require.False(t, decided, "messages without JetStream metadata are left unchanged")
+}
+
+func TestBackoff(t *testing.T) {
+	_, err := Backoff(BackoffConfig{})
+	require.Error(t, err)
+
+	mw, err := Backoff(BackoffConfig{InitialDelay: time.Second, MaxDelay: 5 * time.Second})
+	require.NoError(t, err)
+	h := mw(failing)
+
+	for delivered, expected := range map[uint64]time.Duration{
+		1: time.Second,
+		2: 2 * time.Second,
+		3: 4 * time.Second,
+		4: 5 * time.Second,
+	} {
+		msg := deliveredMsg(delivered)
+		_, err := h(msg)
+		require.True(t, errors.Is(err, errHandler), "unexpected error: %v", err)
+
+		decision, decided := jetstream.DecisionFromMsg(msg)
+		require.True(t, decided)
+		require.Equal(t, jetstream.DispositionNakWithDelay, decision.Disposition)
+		require.Equal(t, expected, decision.Delay, "delivery %d", delivered)
+	}
+
+	msg := deliveredMsg(1)
+	_, err = mw(func(*message.Message) ([]*message.Message, error) { return nil, nil })(msg)
+	require.NoError(t, err)
+	_, decided := jetstream.DecisionFromMsg(msg)
+	require.False(t, decided)
+}
+
+func TestDeadLetter_WrapsBackoff(t *testing.T) {
+	deadLetter, err := DeadLetter(DeadLetterConfig{MaxDeliveries: 3})
+	require.NoError(t, err)
+	backoff, err := Backoff(BackoffConfig{InitialDelay: time.Second})
+	require.NoError(t, err)
+
+	msg := deliveredMsg(3)
+	_, _ = deadLetter(backoff(failing))(msg)
+
+	decision, _ := jetstream.DecisionFromMsg(msg)
+	require.Equal(t, jetstream.DispositionDeadLetter, decision.Disposition)
+}
+
+func TestInProgress(t *testing.T) {
+	logger := watermill.NewCaptureLogger()
+	h := InProgress(10*time.Millisecond, logger)(func(*message.Message) ([]*message.Message, error) {
+		time.Sleep(50 * time.Millisecond)
+		return nil, nil
+	})
+
+	// the message is not bound to a connection, signalling progress fails and is logged
+	msg := deliveredMsg(1)
+	m, _ := jetstream.NatsMsgFromCtx(msg.Context())
+	m.Sub = nil
+
+	_, err := h(msg)
+	require.NoError(t, err)
+	require.True(t, logger.HasError(nats.ErrMsgNotBound))
+}
@@ -0,0 +1,323 @@
+package jetstream
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// MigratorConfig is the configuration to create a migrator
+type MigratorConfig struct {
+	// IdleTimeout is how long Migrate waits for the next source message before it considers the channel migrated
+	// (defaults to 10 seconds).
+	IdleTimeout time.Duration
+}
+
+func (c *MigratorConfig) setDefaults() {
+	if c.IdleTimeout <= 0 {
+		c.IdleTimeout = 10 * time.Second
+	}
+}
+
+// Migrator copies the messages of a NATS Streaming (STAN) channel into a JetStream topic, preserving their order
+// and UUIDs, for moving off the STAN adapter this package evolved from.
+//
+// The source is any watermill subscriber, typically the NATS Streaming subscriber of watermill-nats configured
+// to deliver all available messages.  Messages are republished one at a time with their UUID as Nats-Msg-Id,
+// and only acked on the source once stored, so an interrupted migration can be restarted (with a durable source
+// subscription it resumes, otherwise the duplicate window of the topic drops what was already copied).
+type Migrator struct {
+	source    message.Subscriber
+	publisher *Publisher
+	config    MigratorConfig
+	logger    watermill.LoggerAdapter
+}
+
+// NewMigrator creates a new Migrator reading from source and publishing with publisher.
+func NewMigrator(source message.Subscriber, publisher *Publisher, config MigratorConfig, logger watermill.LoggerAdapter) (*Migrator, error) {
+	config.setDefaults()
+
+	if source == nil || publisher == nil {
+		return nil, errors.New("migrator requires a source subscriber and a publisher")
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	return &Migrator{
+		source:    source,
+		publisher: publisher,
+		config:    config,
+		logger:    logger,
+	}, nil
+}
+
+// Migrate copies channel into topic until no message arrived for IdleTimeout, returning the number of copied messages.
+func (m *Migrator) Migrate(ctx context.Context, channel, topic string) (int, error) {
+	logFields := watermill.LogFields{
+		"channel": channel,
+		"topic":   topic,
+	}
+
+	if m.publisher.config.AutoProvision {
+		if err := m.publisher.topicInterpreter.ensureStream(topic); err != nil {
+			return 0, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	messages, err := m.source.Subscribe(ctx, channel)
+	if err != nil {
+		return 0, errors.Wrapf(err, "cannot subscribe to channel %s", channel)
+	}
+
+	m.logger.Info("Starting migration", logFields)
+
+	copied := 0
+	idle := time.NewTimer(m.config.IdleTimeout)
+	defer idle.Stop()
+
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				return copied, nil
+			}
+
+			if err := m.publisher.publishMessage(topic, msg, nats.MsgId(msg.UUID)); err != nil {
+				msg.Nack()
+				return copied, errors.Wrapf(err, "cannot copy message %s", msg.UUID)
+			}
+			msg.Ack()
+			copied++
+
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(m.config.IdleTimeout)
+		case <-idle.C:
+			m.logger.Info("Migration finished", logFields.Add(watermill.LogFields{"copied": copied}))
+			return copied, nil
+		case <-ctx.Done():
+			return copied, ctx.Err()
+		}
+	}
+}
+
+// DualSubscriberConfig is the configuration to create a dual subscriber
+type DualSubscriberConfig struct {
+	// SecondaryTopic maps a topic to the topic subscribed on the secondary subscriber (defaults to the same topic).
+	SecondaryTopic TopicMapper
+
+	// DeduplicationWindow is the number of recent message keys remembered to drop messages received from
+	// both subscribers (defaults to 10000).
+	DeduplicationWindow int
+
+	// DeduplicationKey calculates the key messages are deduplicated on (defaults to the Nats-Msg-Id header
+	// of messages received from JetStream, and to the message UUID otherwise).
+	DeduplicationKey DeduplicationKeyFunc
+}
+
+func (c *DualSubscriberConfig) setDefaults() {
+	if c.SecondaryTopic == nil {
+		c.SecondaryTopic = func(topic string) string { return topic }
+	}
+	if c.DeduplicationWindow <= 0 {
+		c.DeduplicationWindow = 10000
+	}
+	if c.DeduplicationKey == nil {
+		c.DeduplicationKey = msgIdDeduplicationKey
+	}
+}
+
+// msgIdDeduplicationKey returns the Nats-Msg-Id of messages received from JetStream, the UUID of other messages.
+func msgIdDeduplicationKey(msg *message.Message) string {
+	if m, ok := NatsMsgFromCtx(msg.Context()); ok {
+		if msgId := m.Header.Get(nats.MsgIdHdr); msgId != "" {
+			return msgId
+		}
+	}
+
+	return msg.UUID
+}
+
+// DualSubscriber reads a topic from two subscribers at once during a cutover, e.g. the NATS Streaming
+// subscriber and the JetStream Subscriber while producers move over, or two JetStream Subscribers reading
+// the old and the new stream (see StreamNameCalculator) while a stream is renamed.  Messages already received
+// from the other subscriber (by DeduplicationKey, within DeduplicationWindow) are acked and dropped.
+//
+// Once producers moved over and the primary subscriber was drained, Cutover stops reading from the primary
+// subscriber without resubscribing.
+type DualSubscriber struct {
+	primary   message.Subscriber
+	secondary message.Subscriber
+	config    DualSubscriberConfig
+	logger    watermill.LoggerAdapter
+
+	seen *recentUUIDs
+
+	// cutover is closed by Cutover, cutoverOnce guards it
+	cutover     chan struct{}
+	cutoverOnce sync.Once
+}
+
+// NewDualSubscriber creates a new DualSubscriber.  Closing it closes both subscribers.
+func NewDualSubscriber(primary, secondary message.Subscriber, config DualSubscriberConfig, logger watermill.LoggerAdapter) (*DualSubscriber, error) {
+	config.setDefaults()
+
+	if primary == nil || secondary == nil {
+		return nil, errors.New("dual subscriber requires two subscribers")
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	return &DualSubscriber{
+		primary:   primary,
+		secondary: secondary,
+		config:    config,
+		logger:    logger,
+		seen:      newRecentUUIDs(config.DeduplicationWindow),
+		cutover:   make(chan struct{}),
+	}, nil
+}
+
+// Subscribe subscribes to topic on both subscribers, or only on the secondary subscriber after Cutover.
+func (d *DualSubscriber) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	secondaryTopic := d.config.SecondaryTopic(topic)
+
+	if d.isCutover() {
+		return d.secondary.Subscribe(ctx, secondaryTopic)
+	}
+
+	// the primary subscription is closed on cutover
+	primaryCtx, cancelPrimary := context.WithCancel(ctx)
+	go func() {
+		defer cancelPrimary()
+		select {
+		case <-d.cutover:
+			d.logger.Debug("Cut over, primary subscription closed", watermill.LogFields{"topic": topic})
+		case <-ctx.Done():
+		}
+	}()
+
+	primary, err := d.primary.Subscribe(primaryCtx, topic)
+	if err != nil {
+		cancelPrimary()
+		return nil, errors.Wrap(err, "cannot subscribe on primary subscriber")
+	}
+
+	secondary, err := d.secondary.Subscribe(ctx, secondaryTopic)
+	if err != nil {
+		cancelPrimary()
+		return nil, errors.Wrap(err, "cannot subscribe on secondary subscriber")
+	}
+
+	output := make(chan *message.Message)
+	wg := &sync.WaitGroup{}
+
+	for _, input := range []<-chan *message.Message{primary, secondary} {
+		wg.Add(1)
+		go func(input <-chan *message.Message) {
+			defer wg.Done()
+
+			for msg := range input {
+				if !d.seen.add(d.config.DeduplicationKey(msg)) {
+					d.logger.Trace("Duplicate message dropped", watermill.LogFields{"message_uuid": msg.UUID, "topic": topic})
+					msg.Ack()
+					continue
+				}
+
+				select {
+				case output <- msg:
+				case <-ctx.Done():
+					msg.Nack()
+				}
+			}
+		}(input)
+	}
+
+	go func() {
+		wg.Wait()
+		close(output)
+	}()
+
+	return output, nil
+}
+
+// Cutover stops reading from the primary subscriber: its subscriptions are closed, and later subscriptions
+// only subscribe on the secondary subscriber.  It can not be undone.
+func (d *DualSubscriber) Cutover() {
+	d.cutoverOnce.Do(func() {
+		close(d.cutover)
+		d.logger.Info("Cut over to secondary subscriber", nil)
+	})
+}
+
+func (d *DualSubscriber) isCutover() bool {
+	select {
+	case <-d.cutover:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close closes both subscribers.
+func (d *DualSubscriber) Close() error {
+	primaryErr := d.primary.Close()
+	secondaryErr := d.secondary.Close()
+
+	if primaryErr != nil {
+		return errors.Wrap(primaryErr, "cannot close primary subscriber")
+	}
+	if secondaryErr != nil {
+		return errors.Wrap(secondaryErr, "cannot close secondary subscriber")
+	}
+
+	return nil
+}
+
+// recentUUIDs remembers the last size UUIDs added.
+type recentUUIDs struct {
+	mu    sync.Mutex
+	size  int
+	order []string
+	set   map[string]struct{}
+}
+
+func newRecentUUIDs(size int) *recentUUIDs {
+	return &recentUUIDs{
+		size: size,
+		set:  make(map[string]struct{}, size),
+	}
+}
+
+// add records uuid, returning false when it was already recorded.
+func (r *recentUUIDs) add(uuid string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.set[uuid]; ok {
+		return false
+	}
+
+	r.set[uuid] = struct{}{}
+	r.order = append(r.order, uuid)
+
+	if len(r.order) > r.size {
+		delete(r.set, r.order[0])
+		r.order = r.order[1:]
+	}
+
+	return true
+}
@@ -0,0 +1,118 @@
+package jetstream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecentUUIDs_Add(t *testing.T) {
+	r := newRecentUUIDs(2)
+
+	require.True(t, r.add("a"))
+	require.False(t, r.add("a"))
+	require.True(t, r.add("b"))
+	require.True(t, r.add("c"))
+
+	// "a" was evicted from the window
+	require.True(t, r.add("a"))
+	require.False(t, r.add("c"))
+}
+
+func TestDualSubscriber_DropsDuplicates(t *testing.T) {
+	logger := watermill.NopLogger{}
+	legacy := gochannel.NewGoChannel(gochannel.Config{}, logger)
+	current := gochannel.NewGoChannel(gochannel.Config{}, logger)
+
+	sub, err := NewDualSubscriber(legacy, current, DualSubscriberConfig{
+		SecondaryTopic: func(topic string) string { return "js_" + topic },
+	}, logger)
+	require.NoError(t, err)
+	defer sub.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	messages, err := sub.Subscribe(ctx, "orders")
+	require.NoError(t, err)
+
+	require.NoError(t, legacy.Publish("orders", message.NewMessage("uuid-1", nil), message.NewMessage("uuid-2", nil)))
+	require.NoError(t, current.Publish("js_orders", message.NewMessage("uuid-1", nil), message.NewMessage("uuid-3", nil)))
+
+	received := map[string]int{}
+	for len(received) < 3 {
+		select {
+		case msg := <-messages:
+			received[msg.UUID]++
+			msg.Ack()
+		case <-ctx.Done():
+			t.Fatal("timeout waiting for messages")
+		}
+	}
+
+	select {
+	case msg := <-messages:
+		t.Fatalf("unexpected message %s", msg.UUID)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	require.Equal(t, map[string]int{"uuid-1": 1, "uuid-2": 1, "uuid-3": 1}, received)
+}
+
+func TestDualSubscriber_Cutover(t *testing.T) {
+	logger := watermill.NopLogger{}
+	legacy := gochannel.NewGoChannel(gochannel.Config{}, logger)
+	current := gochannel.NewGoChannel(gochannel.Config{}, logger)
+
+	sub, err := NewDualSubscriber(legacy, current, DualSubscriberConfig{}, logger)
+	require.NoError(t, err)
+	defer sub.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	messages, err := sub.Subscribe(ctx, "orders")
+	require.NoError(t, err)
+
+	sub.Cutover()
+	sub.Cutover()
+
+	later, err := sub.Subscribe(ctx, "orders")
+	require.NoError(t, err)
+
+	// the primary subscription is closed asynchronously
+	time.Sleep(100 * time.Millisecond)
+
+	require.NoError(t, legacy.Publish("orders", message.NewMessage("legacy", nil)))
+	require.NoError(t, current.Publish("orders", message.NewMessage("uuid-1", nil)))
+
+	for _, messages := range []<-chan *message.Message{messages, later} {
+		select {
+		case msg := <-messages:
+			require.Equal(t, "uuid-1", msg.UUID)
+			msg.Ack()
+		case <-ctx.Done():
+			t.Fatal("timeout waiting for messages")
+		}
+	}
+
+	select {
+	case msg := <-messages:
+		t.Fatalf("unexpected message %s", msg.UUID)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestMsgIdDeduplicationKey(t *testing.T) {
+	msg := message.NewMessage("uuid", nil)
+	require.Equal(t, "uuid", msgIdDeduplicationKey(msg))
+
+	msg.SetContext(WithNatsMsg(msg.Context(), &nats.Msg{Header: nats.Header{nats.MsgIdHdr: []string{"msg-id"}}}))
+	require.Equal(t, "msg-id", msgIdDeduplicationKey(msg))
+}
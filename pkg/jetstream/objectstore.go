@@ -0,0 +1,349 @@
+package jetstream
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	watermillSync "github.com/ThreeDotsLabs/watermill/pubsub/sync"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ObjectBucketMetadataKey is the metadata key holding the bucket of an object message.
+	ObjectBucketMetadataKey = "object_bucket"
+
+	// ObjectNameMetadataKey is the metadata key holding the name of an object message.
+	ObjectNameMetadataKey = "object_name"
+
+	// ObjectSizeMetadataKey is the metadata key holding the size in bytes of an object message.
+	ObjectSizeMetadataKey = "object_size"
+
+	// ObjectDigestMetadataKey is the metadata key holding the digest of an object message.
+	ObjectDigestMetadataKey = "object_digest"
+
+	// ObjectDeletedMetadataKey is the metadata key set to "true" when an object message reports a deleted object.
+	ObjectDeletedMetadataKey = "object_deleted"
+)
+
+// ObjectPublisherConfig is the configuration to create an object store publisher
+type ObjectPublisherConfig struct {
+	// AutoProvision creates buckets when they do not exist.
+	AutoProvision bool
+
+	// JetstreamOptions are custom Jetstream options for a connection.
+	JetstreamOptions []nats.JSOpt
+}
+
+// ObjectPublisher stores messages as objects in JetStream object stores, for file-drop style integrations.
+//
+// The topic passed to Publish is the bucket.  The payload of a message is stored under the name held by
+// ObjectNameMetadataKey, or the message UUID when it is missing.  The UUID and the other metadata are stored
+// as object headers, so ObjectSubscriber restores them.
+type ObjectPublisher struct {
+	js     nats.JetStreamContext
+	config ObjectPublisherConfig
+	logger watermill.LoggerAdapter
+
+	storesLock sync.Mutex
+	stores     map[string]nats.ObjectStore
+}
+
+// NewObjectPublisher creates a new ObjectPublisher with the provided nats connection.
+func NewObjectPublisher(conn *nats.Conn, config ObjectPublisherConfig, logger watermill.LoggerAdapter) (*ObjectPublisher, error) {
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	js, err := conn.JetStream(config.JetstreamOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ObjectPublisher{
+		js:     js,
+		config: config,
+		logger: logger,
+		stores: map[string]nats.ObjectStore{},
+	}, nil
+}
+
+// Publish stores messages in the bucket topic.
+// When one of the puts fails - function is interrupted.
+func (p *ObjectPublisher) Publish(topic string, messages ...*message.Message) error {
+	store, err := p.objectStore(topic)
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range messages {
+		meta := objectMeta(msg)
+
+		p.logger.Trace("Putting object", watermill.LogFields{
+			"message_uuid": msg.UUID,
+			"bucket":       topic,
+			"object_name":  meta.Name,
+		})
+
+		if _, err := store.Put(meta, bytes.NewReader(msg.Payload)); err != nil {
+			return errors.Wrapf(err, "cannot put object %s", meta.Name)
+		}
+	}
+
+	return nil
+}
+
+func (p *ObjectPublisher) objectStore(bucket string) (nats.ObjectStore, error) {
+	p.storesLock.Lock()
+	defer p.storesLock.Unlock()
+
+	if store, ok := p.stores[bucket]; ok {
+		return store, nil
+	}
+
+	store, err := p.js.ObjectStore(bucket)
+	if errors.Is(err, nats.ErrStreamNotFound) && p.config.AutoProvision {
+		store, err = p.js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: bucket})
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot bind to object store %s", bucket)
+	}
+
+	p.stores[bucket] = store
+
+	return store, nil
+}
+
+// objectMeta builds the object meta of msg.
+func objectMeta(msg *message.Message) *nats.ObjectMeta {
+	name := msg.Metadata.Get(ObjectNameMetadataKey)
+	if name == "" {
+		name = msg.UUID
+	}
+
+	headers := make(nats.Header)
+	headers.Set(WatermillUUIDHdr, msg.UUID)
+	for k, v := range msg.Metadata {
+		headers.Set(k, v)
+	}
+
+	return &nats.ObjectMeta{
+		Name:    name,
+		Headers: headers,
+	}
+}
+
+// Close closes the publisher, the nats connection is not closed.
+func (p *ObjectPublisher) Close() error {
+	return nil
+}
+
+// ObjectSubscriberConfig is the configuration to create an object store subscriber
+type ObjectSubscriberConfig struct {
+	// FetchPayload fetches the content of objects as message payload, otherwise messages only carry object metadata.
+	FetchPayload bool
+
+	// IncludeHistory delivers all historical versions of objects instead of only their latest one when subscribing.
+	IncludeHistory bool
+
+	// UpdatesOnly skips the objects present when subscribing, only delivering later puts and deletes.
+	UpdatesOnly bool
+
+	// IgnoreDeletes skips deleted objects.
+	IgnoreDeletes bool
+
+	// CloseTimeout determines how long subscriber will wait for Ack/Nack on close (defaults to 30 seconds).
+	CloseTimeout time.Duration
+
+	// JetstreamOptions are custom Jetstream options for a connection.
+	JetstreamOptions []nats.JSOpt
+}
+
+func (c *ObjectSubscriberConfig) setDefaults() {
+	if c.CloseTimeout <= 0 {
+		c.CloseTimeout = time.Second * 30
+	}
+}
+
+// Validate ensures configuration is valid before use
+func (c ObjectSubscriberConfig) Validate() error {
+	if c.IncludeHistory && c.UpdatesOnly {
+		return errors.New("ObjectSubscriberConfig.IncludeHistory can not be combined with ObjectSubscriberConfig.UpdatesOnly")
+	}
+
+	return nil
+}
+
+// ObjectSubscriber watches JetStream object stores and delivers a message for every put or deleted object.
+//
+// The topic passed to Subscribe is the bucket, it needs to exist.  Messages carry the object metadata
+// (see ObjectNameMetadataKey) and, with FetchPayload, the object content as payload.
+// Objects are delivered one at a time, a nacked message is delivered again.
+type ObjectSubscriber struct {
+	js     nats.JetStreamContext
+	config ObjectSubscriberConfig
+	logger watermill.LoggerAdapter
+
+	closedLock sync.Mutex
+	closed     bool
+	closing    chan struct{}
+	outputsWg  sync.WaitGroup
+}
+
+// NewObjectSubscriber creates a new ObjectSubscriber with the provided nats connection.
+func NewObjectSubscriber(conn *nats.Conn, config ObjectSubscriberConfig, logger watermill.LoggerAdapter) (*ObjectSubscriber, error) {
+	config.setDefaults()
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	js, err := conn.JetStream(config.JetstreamOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ObjectSubscriber{
+		js:      js,
+		config:  config,
+		logger:  logger,
+		closing: make(chan struct{}),
+	}, nil
+}
+
+// Subscribe watches the objects of the bucket topic.
+func (s *ObjectSubscriber) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	logFields := watermill.LogFields{"bucket": topic}
+
+	store, err := s.js.ObjectStore(topic)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot bind to object store %s", topic)
+	}
+
+	var opts []nats.WatchOpt
+	if s.config.IncludeHistory {
+		opts = append(opts, nats.IncludeHistory())
+	}
+	if s.config.IgnoreDeletes {
+		opts = append(opts, nats.IgnoreDeletes())
+	}
+
+	watcher, err := store.Watch(opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot watch object store")
+	}
+
+	output := make(chan *message.Message)
+
+	s.outputsWg.Add(1)
+	go func() {
+		defer s.outputsWg.Done()
+		defer close(output)
+		defer func() {
+			if err := watcher.Stop(); err != nil {
+				s.logger.Error("Cannot stop watcher", err, logFields)
+			}
+		}()
+
+		// the watcher sends a nil info once the objects present when subscribing were delivered
+		initial := true
+
+		for {
+			var info *nats.ObjectInfo
+			select {
+			case i, ok := <-watcher.Updates():
+				if !ok {
+					return
+				}
+				info = i
+			case <-s.closing:
+				return
+			case <-ctx.Done():
+				return
+			}
+
+			if info == nil {
+				initial = false
+				continue
+			}
+
+			if initial && s.config.UpdatesOnly {
+				continue
+			}
+
+			msg := objectInfoMessage(info)
+
+			if s.config.FetchPayload && !info.Deleted {
+				payload, err := store.GetBytes(info.Name)
+				if err != nil {
+					s.logger.Error("Cannot fetch object", err, logFields.Add(watermill.LogFields{"object_name": info.Name}))
+					continue
+				}
+				msg.Payload = payload
+			}
+
+			if !deliverCopiesUntilAcked(ctx, s.closing, msg, output, s.logger, logFields) {
+				return
+			}
+		}
+	}()
+
+	return output, nil
+}
+
+// objectInfoMessage converts object info into a watermill message.
+func objectInfoMessage(info *nats.ObjectInfo) *message.Message {
+	uuid := info.Headers.Get(WatermillUUIDHdr)
+	if uuid == "" {
+		uuid = watermill.NewUUID()
+	}
+
+	msg := message.NewMessage(uuid, nil)
+
+	for k, v := range info.Headers {
+		if k != WatermillUUIDHdr && len(v) > 0 {
+			msg.Metadata.Set(k, v[0])
+		}
+	}
+
+	msg.Metadata.Set(ObjectBucketMetadataKey, info.Bucket)
+	msg.Metadata.Set(ObjectNameMetadataKey, info.Name)
+	msg.Metadata.Set(ObjectSizeMetadataKey, strconv.FormatUint(info.Size, 10))
+	msg.Metadata.Set(ObjectDigestMetadataKey, info.Digest)
+	if info.Deleted {
+		msg.Metadata.Set(ObjectDeletedMetadataKey, "true")
+	}
+
+	return msg
+}
+
+// Close stops all watches.  It will attempt to wait for in-flight messages to complete.
+func (s *ObjectSubscriber) Close() error {
+	s.closedLock.Lock()
+	defer s.closedLock.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	s.logger.Debug("Closing object subscriber", nil)
+	defer s.logger.Info("Object subscriber closed", nil)
+
+	close(s.closing)
+
+	if watermillSync.WaitGroupTimeout(&s.outputsWg, s.config.CloseTimeout) {
+		return errors.New("output wait group did not finish")
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package jetstream
+
+import (
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObjectMeta_RoundTrip(t *testing.T) {
+	msg := message.NewMessage("uuid-1", []byte("content"))
+	msg.Metadata.Set(ObjectNameMetadataKey, "reports/2024.csv")
+	msg.Metadata.Set("source", "sftp")
+
+	meta := objectMeta(msg)
+	require.Equal(t, "reports/2024.csv", meta.Name)
+
+	received := objectInfoMessage(&nats.ObjectInfo{
+		ObjectMeta: *meta,
+		Bucket:     "drops",
+		Size:       7,
+		Digest:     "SHA-256=abc",
+	})
+
+	require.Equal(t, "uuid-1", received.UUID)
+	require.Equal(t, "sftp", received.Metadata.Get("source"))
+	require.Equal(t, "drops", received.Metadata.Get(ObjectBucketMetadataKey))
+	require.Equal(t, "reports/2024.csv", received.Metadata.Get(ObjectNameMetadataKey))
+	require.Equal(t, "7", received.Metadata.Get(ObjectSizeMetadataKey))
+	require.Equal(t, "SHA-256=abc", received.Metadata.Get(ObjectDigestMetadataKey))
+	require.Empty(t, received.Metadata.Get(ObjectDeletedMetadataKey))
+}
+
+func TestObjectMeta_DefaultsToUUID(t *testing.T) {
+	require.Equal(t, "uuid-1", objectMeta(message.NewMessage("uuid-1", nil)).Name)
+
+	deleted := objectInfoMessage(&nats.ObjectInfo{ObjectMeta: nats.ObjectMeta{Name: "gone"}, Deleted: true})
+	require.NotEmpty(t, deleted.UUID)
+	require.Equal(t, "true", deleted.Metadata.Get(ObjectDeletedMetadataKey))
+}
@@ -0,0 +1,101 @@
+package jetstream
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// defaultPartitionKeyMetadata is the metadata key holding the partition key of a message.
+const defaultPartitionKeyMetadata = "partition_key"
+
+// Partitioner is a function used to map a partition key to one of partitions.
+type Partitioner func(key string, partitions int) int
+
+// PartitionConfig configures key-based partitioning of topics.
+//
+// When enabled, publishers publish every message to the partition subject (see PartitionSubject) picked from its
+// partition key, and subscribers create one consumer per partition delivering one message at a time, so messages
+// with the same key are processed in order while partitions are processed concurrently.
+// Partition subjects are "{topic}.p{partition}", so the stream of the topic needs to cover "{topic}.*" (the default).
+type PartitionConfig struct {
+	// Count is the number of partitions of every topic, partitioning is disabled when it is 0.
+	// Publishers and subscribers of a topic need to use the same Count.
+	Count int
+
+	// KeyMetadata is the metadata key holding the partition key (defaults to "partition_key").
+	// Messages without a partition key are partitioned by UUID.
+	KeyMetadata string
+
+	// Partitioner maps a partition key to a partition (defaults to a FNV-1a hash of the key)
+	Partitioner Partitioner
+
+	// Assigned lists the partitions consumed by a subscriber (defaults to all partitions), it is not used by publishers.
+	Assigned []int
+}
+
+func (c *PartitionConfig) setDefaults() {
+	if c.KeyMetadata == "" {
+		c.KeyMetadata = defaultPartitionKeyMetadata
+	}
+	if c.Partitioner == nil {
+		c.Partitioner = defaultPartitioner
+	}
+}
+
+// Validate ensures configuration is valid before use
+func (c PartitionConfig) Validate() error {
+	if c.Count < 0 {
+		return errors.New("PartitionConfig.Count can not be negative")
+	}
+
+	for _, p := range c.Assigned {
+		if p < 0 || p >= c.Count {
+			return errors.Errorf("PartitionConfig.Assigned partition %d is out of range", p)
+		}
+	}
+
+	return nil
+}
+
+func (c PartitionConfig) enabled() bool {
+	return c.Count > 0
+}
+
+// partition returns the partition of msg.
+func (c PartitionConfig) partition(msg *message.Message) int {
+	key := msg.Metadata.Get(c.KeyMetadata)
+	if key == "" {
+		key = msg.UUID
+	}
+
+	return c.Partitioner(key, c.Count)
+}
+
+// assigned returns the partitions consumed by a subscriber.
+func (c PartitionConfig) assigned() []int {
+	if len(c.Assigned) > 0 {
+		return c.Assigned
+	}
+
+	all := make([]int, c.Count)
+	for i := range all {
+		all[i] = i
+	}
+
+	return all
+}
+
+func defaultPartitioner(key string, partitions int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+
+	return int(h.Sum32() % uint32(partitions))
+}
+
+// PartitionSubject returns the subject messages of partition are published to.
+func PartitionSubject(topic string, partition int) string {
+	return fmt.Sprintf("%s.p%d", topic, partition)
+}
@@ -0,0 +1,82 @@
+package jetstream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartitionConfig_Partition(t *testing.T) {
+	config := PartitionConfig{Count: 8}
+	config.setDefaults()
+
+	first := message.NewMessage("uuid-1", nil)
+	first.Metadata.Set(defaultPartitionKeyMetadata, "customer-42")
+
+	second := message.NewMessage("uuid-2", nil)
+	second.Metadata.Set(defaultPartitionKeyMetadata, "customer-42")
+
+	require.Equal(t, config.partition(first), config.partition(second))
+
+	withoutKey := message.NewMessage("uuid-3", nil)
+	require.Equal(t, defaultPartitioner("uuid-3", 8), config.partition(withoutKey))
+
+	for _, key := range []string{"", "a", "b", "customer-1", "customer-2"} {
+		p := defaultPartitioner(key, 8)
+		require.True(t, p >= 0 && p < 8)
+	}
+}
+
+func TestPartitionConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  PartitionConfig
+		wantErr bool
+	}{
+		{name: "disabled", config: PartitionConfig{}},
+		{name: "all partitions", config: PartitionConfig{Count: 4}},
+		{name: "assigned", config: PartitionConfig{Count: 4, Assigned: []int{0, 3}}},
+		{name: "negative count", config: PartitionConfig{Count: -1}, wantErr: true},
+		{name: "assigned out of range", config: PartitionConfig{Count: 4, Assigned: []int{4}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestSubscriber_SubscriptionTargets(t *testing.T) {
+	s := &Subscriber{
+		config: SubscriberSubscriptionConfig{
+			SubscribersCount:  2,
+			SubjectCalculator: defaultSubjectCalculator,
+		},
+		topicInterpreter: newTopicInterpreter(nil, defaultSubjectCalculator, 0),
+	}
+
+	targets := s.subscriptionTargets(context.Background(), "orders")
+	require.Len(t, targets, 2)
+	require.Equal(t, "orders.*", targets[0].subject)
+	require.Nil(t, targets[0].partition)
+
+	s.config.Partitioning = PartitionConfig{Count: 4, Assigned: []int{1, 3}}
+
+	targets = s.subscriptionTargets(context.Background(), "orders")
+	require.Len(t, targets, 2)
+	require.Equal(t, "orders.p1", targets[0].subject)
+	require.Equal(t, 1, *targets[0].partition)
+	require.Equal(t, "orders.p3", targets[1].subject)
+	require.Equal(t, 3, *targets[1].partition)
+
+	targets = s.subscriptionTargets(withAssignedPartitions(context.Background(), []int{2}), "orders")
+	require.Len(t, targets, 1)
+	require.Equal(t, "orders.p2", targets[0].subject)
+}
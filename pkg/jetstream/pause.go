@@ -0,0 +1,176 @@
+package jetstream
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// PauseWindow is a daily window during which a Subscriber pauses consumption, see PauseScheduleConfig.
+type PauseWindow struct {
+	// Start is the time of day the window starts at, as the duration since midnight (e.g. 2*time.Hour for 02:00).
+	Start time.Duration
+
+	// Duration is how long the window lasts, it may extend past midnight.
+	Duration time.Duration
+}
+
+// PauseScheduleConfig pauses consumption during daily windows, e.g. while a database is under maintenance,
+// and resumes it afterwards.  It is disabled unless Windows are set.
+//
+// Pausing is local to the Subscriber, consumers are left untouched: messages delivered to Subscribe while paused
+// are nacked with a delay lasting until the end of the window, and SubscribeBatch stops fetching.  Messages
+// being handled when a window starts are not interrupted.
+type PauseScheduleConfig struct {
+	// Windows are the daily pause windows, overlapping windows pause until the end of the last one.
+	Windows []PauseWindow
+
+	// Location is the time zone of the windows (defaults to UTC).
+	Location *time.Location
+
+	// OnPause is called when a window starts, with the time consumption resumes at.
+	OnPause func(until time.Time)
+
+	// OnResume is called when consumption resumes.
+	OnResume func()
+}
+
+func (c PauseScheduleConfig) enabled() bool {
+	return len(c.Windows) > 0
+}
+
+func (c *PauseScheduleConfig) setDefaults() {
+	if c.Location == nil {
+		c.Location = time.UTC
+	}
+}
+
+// Validate ensures configuration is valid before use
+func (c PauseScheduleConfig) Validate() error {
+	for _, window := range c.Windows {
+		if window.Start < 0 || window.Start >= 24*time.Hour {
+			return errors.New("PauseScheduleConfig.Windows start must be within a day")
+		}
+		if window.Duration <= 0 || window.Duration > 24*time.Hour {
+			return errors.New("PauseScheduleConfig.Windows duration must be positive and at most a day")
+		}
+	}
+
+	return nil
+}
+
+// windowStart returns when window starts on the day of t, days later.
+func (c PauseScheduleConfig) windowStart(window PauseWindow, t time.Time, days int) time.Time {
+	t = t.In(c.location())
+	return time.Date(t.Year(), t.Month(), t.Day()+days, 0, 0, 0, 0, t.Location()).Add(window.Start)
+}
+
+func (c PauseScheduleConfig) location() *time.Location {
+	if c.Location == nil {
+		return time.UTC
+	}
+	return c.Location
+}
+
+// pausedUntil returns the end of the windows now is in, false when it is in none.
+func (c PauseScheduleConfig) pausedUntil(now time.Time) (time.Time, bool) {
+	var until time.Time
+	for _, window := range c.Windows {
+		// windows started the day before may extend past midnight
+		for _, days := range []int{-1, 0} {
+			start := c.windowStart(window, now, days)
+			end := start.Add(window.Duration)
+			if !now.Before(start) && now.Before(end) && end.After(until) {
+				until = end
+			}
+		}
+	}
+
+	return until, !until.IsZero()
+}
+
+// nextStart returns the start of the next window after now.
+func (c PauseScheduleConfig) nextStart(now time.Time) time.Time {
+	var next time.Time
+	for _, window := range c.Windows {
+		for _, days := range []int{0, 1} {
+			start := c.windowStart(window, now, days)
+			if start.After(now) && (next.IsZero() || start.Before(next)) {
+				next = start
+			}
+		}
+	}
+
+	return next
+}
+
+// runPauseSchedule pauses and resumes consumption as scheduled until the subscriber is closed.
+func (s *Subscriber) runPauseSchedule() {
+	for {
+		now := s.now()
+
+		next, paused := s.config.PauseSchedule.pausedUntil(now)
+		s.setPaused(next, paused)
+		if !paused {
+			next = s.config.PauseSchedule.nextStart(now)
+		}
+
+		wait, stop := after(s.config.Clock, next.Sub(now))
+		select {
+		case <-s.closing:
+			stop()
+			return
+		case <-wait:
+			stop()
+		}
+	}
+}
+
+// setPaused records whether consumption is paused until until, calling the hooks when it changed.
+func (s *Subscriber) setPaused(until time.Time, paused bool) {
+	var untilNano int64
+	if paused {
+		untilNano = until.UnixNano()
+	}
+
+	previous := atomic.SwapInt64(&s.pausedUntilNano, untilNano)
+	switch {
+	case paused && previous == 0:
+		s.logger.Info("Subscriber paused", watermill.LogFields{"until": until})
+		if s.config.PauseSchedule.OnPause != nil {
+			s.config.PauseSchedule.OnPause(until)
+		}
+	case !paused && previous != 0:
+		s.logger.Info("Subscriber resumed", nil)
+		if s.config.PauseSchedule.OnResume != nil {
+			s.config.PauseSchedule.OnResume()
+		}
+	}
+}
+
+// PausedUntil returns the time consumption resumes at while it is paused by PauseScheduleConfig,
+// false when it is not paused.
+func (s *Subscriber) PausedUntil() (time.Time, bool) {
+	untilNano := atomic.LoadInt64(&s.pausedUntilNano)
+	if untilNano == 0 {
+		return time.Time{}, false
+	}
+
+	// the window may have ended before the schedule noticed it
+	until := time.Unix(0, untilNano)
+	if !until.After(s.now()) {
+		return time.Time{}, false
+	}
+
+	return until, true
+}
+
+// nakPaused naks m, delivered while consumption is paused, with a delay lasting until consumption resumes.
+func (s *Subscriber) nakPaused(m *nats.Msg, until time.Time, logFields watermill.LogFields) {
+	if err := s.acker.NakWithDelay(m, until.Sub(s.now())); err != nil {
+		s.logger.Error("Cannot send nak for message received while paused", err, logFields)
+	}
+}
@@ -0,0 +1,95 @@
+package jetstream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPauseScheduleConfig(t *testing.T) {
+	config := PauseScheduleConfig{Windows: []PauseWindow{
+		{Start: 2 * time.Hour, Duration: time.Hour},
+		{Start: 23 * time.Hour, Duration: 2 * time.Hour},
+	}}
+	require.NoError(t, config.Validate())
+
+	day := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	until, paused := config.pausedUntil(day.Add(2*time.Hour + 30*time.Minute))
+	require.True(t, paused)
+	require.Equal(t, day.Add(3*time.Hour), until)
+
+	// the window started the day before extends past midnight
+	until, paused = config.pausedUntil(day.Add(30 * time.Minute))
+	require.True(t, paused)
+	require.Equal(t, day.Add(time.Hour), until)
+
+	_, paused = config.pausedUntil(day.Add(3 * time.Hour))
+	require.False(t, paused)
+
+	require.Equal(t, day.Add(23*time.Hour), config.nextStart(day.Add(3*time.Hour)))
+	require.Equal(t, day.Add(26*time.Hour), config.nextStart(day.Add(23*time.Hour)))
+
+	require.Error(t, PauseScheduleConfig{Windows: []PauseWindow{{Start: 24 * time.Hour, Duration: time.Hour}}}.Validate())
+	require.Error(t, PauseScheduleConfig{Windows: []PauseWindow{{Start: time.Hour}}}.Validate())
+}
+
+func TestSubscriber_PauseSchedule(t *testing.T) {
+	day := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewManualClock(day.Add(time.Hour))
+
+	paused := make(chan time.Time, 1)
+	resumed := make(chan struct{}, 1)
+
+	acker := &settlingAcker{}
+	s := faultySubscriber(SubscriberSubscriptionConfig{
+		Clock: clock,
+		PauseSchedule: PauseScheduleConfig{
+			Windows:  []PauseWindow{{Start: 2 * time.Hour, Duration: time.Hour}},
+			OnPause:  func(until time.Time) { paused <- until },
+			OnResume: func() { resumed <- struct{}{} },
+		},
+	}, clientDecorator{
+		acker: func(msgAcker) msgAcker { return acker },
+	})
+	defer close(s.closing)
+
+	go s.runPauseSchedule()
+
+	require.Eventually(t, func() bool { return clock.Timers() == 1 }, time.Second, time.Millisecond)
+	_, isPaused := s.PausedUntil()
+	require.False(t, isPaused)
+
+	clock.Advance(time.Hour + 15*time.Minute)
+	select {
+	case until := <-paused:
+		require.Equal(t, day.Add(3*time.Hour), until)
+	case <-time.After(time.Second):
+		t.Fatal("subscriber not paused")
+	}
+
+	// messages delivered while paused are redelivered once the window ended
+	m, err := (&GobMarshaler{}).Marshal("topic", message.NewMessage(watermill.NewUUID(), nil))
+	require.NoError(t, err)
+	s.processMessage(&subscriptionHandler{
+		topic:     "topic",
+		output:    make(chan *message.Message),
+		logFields: watermill.LogFields{},
+	}, m)
+	require.Equal(t, []string{"nak_with_delay"}, acker.calls)
+	require.Equal(t, 45*time.Minute, acker.delay)
+
+	require.Eventually(t, func() bool { return clock.Timers() == 1 }, time.Second, time.Millisecond)
+	clock.Advance(45 * time.Minute)
+	select {
+	case <-resumed:
+	case <-time.After(time.Second):
+		t.Fatal("subscriber not resumed")
+	}
+
+	_, isPaused = s.PausedUntil()
+	require.False(t, isPaused)
+}
@@ -0,0 +1,51 @@
+package jetstream
+
+import (
+	"context"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// Peek returns up to n messages of topic starting at from, without acking them or advancing any durable consumer,
+// for debugging dashboards and support tooling.  Fewer messages are returned when the end of the stream is reached.
+func (s *Subscriber) Peek(ctx context.Context, topic string, from StreamPosition, n int) ([]*message.Message, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	sub, pending, err := s.orderedSubscription(topic, from)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := sub.Unsubscribe(); err != nil {
+			s.logger.Error("Cannot unsubscribe", err, watermill.LogFields{"topic": topic})
+		}
+	}()
+
+	messages := make([]*message.Message, 0, n)
+
+	for pending > 0 && len(messages) < n {
+		m, err := sub.NextMsgWithContext(ctx)
+		if err != nil {
+			return messages, errors.Wrap(err, "cannot read message")
+		}
+
+		meta, err := m.Metadata()
+		if err != nil {
+			return messages, errors.Wrap(err, "cannot read message metadata")
+		}
+		pending = meta.NumPending
+
+		msg, err := s.config.Unmarshaler.Unmarshal(m)
+		if err != nil {
+			return messages, errors.Wrap(err, "cannot unmarshal message")
+		}
+
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
@@ -0,0 +1,63 @@
+package jetstream_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-jetstream/pkg/jetstream"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriber_Peek(t *testing.T) {
+	conn, js := serverConn(t)
+	pub := serverPublisher(t, conn)
+	sub := serverSubscriber(t, conn, jetstream.SubscriberSubscriptionConfig{
+		Consumer: jetstream.ConsumerConfig{Durable: "reports"},
+	})
+
+	var published []string
+	for i := 0; i < 3; i++ {
+		msg := message.NewMessage(watermill.NewUUID(), []byte("payload"))
+		require.NoError(t, pub.Publish("orders", msg))
+		published = append(published, msg.UUID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	peeked := func(from jetstream.StreamPosition, n int) []string {
+		messages, err := sub.Peek(ctx, "orders", from, n)
+		require.NoError(t, err)
+
+		var uuids []string
+		for _, msg := range messages {
+			uuids = append(uuids, msg.UUID)
+		}
+		return uuids
+	}
+
+	require.Equal(t, published[:2], peeked(jetstream.StreamPosition{}, 2))
+	require.Equal(t, published[1:], peeked(jetstream.AtSequence(2), 5), "fewer messages at the end of the stream")
+
+	// peeking again returns the same messages, nothing was acked or consumed
+	require.Equal(t, published[:2], peeked(jetstream.StreamPosition{}, 2))
+	require.Equal(t, uint64(3), streamMsgs(t, js, "orders"))
+
+	messages, err := sub.Subscribe(ctx, "orders")
+	require.NoError(t, err)
+
+	var received []string
+	for len(received) < len(published) {
+		select {
+		case msg := <-messages:
+			received = append(received, msg.UUID)
+			msg.Ack()
+		case <-time.After(10 * time.Second):
+			t.Fatalf("received %d of %d messages after peeking", len(received), len(published))
+		}
+	}
+	require.Equal(t, published, received)
+}
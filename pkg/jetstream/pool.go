@@ -0,0 +1,61 @@
+package jetstream
+
+import (
+	"bytes"
+	"sync"
+)
+
+// maxPooledSize is the capacity above which buffers are left to the GC, so a few large messages
+// do not keep memory pinned in the pools.
+const maxPooledSize = 64 * 1024
+
+// bufferPool holds the scratch buffers messages are encoded into by the marshalers.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+func acquireBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+func releaseBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledSize {
+		return
+	}
+
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+// payloadPool holds the payloads released by subscribers with SubscriberConfig.ReleasePayloads,
+// reused by GobMarshaler to decode payloads into.  It stays empty when no subscriber releases payloads.
+var payloadPool sync.Pool
+
+// payloadPooler is implemented by unmarshalers decoding payloads into buffers of payloadPool, the only ones whose
+// payloads can be released: other unmarshalers may return payloads aliasing the NATS message data.
+type payloadPooler interface {
+	poolsPayloads()
+}
+
+func poolsPayloads(unmarshaler Unmarshaler) bool {
+	_, ok := unmarshaler.(payloadPooler)
+	return ok
+}
+
+func acquirePayload() []byte {
+	if p, ok := payloadPool.Get().(*[]byte); ok {
+		return (*p)[:0]
+	}
+
+	return nil
+}
+
+func releasePayload(payload []byte) {
+	if cap(payload) == 0 || cap(payload) > maxPooledSize {
+		return
+	}
+
+	payloadPool.Put(&payload)
+}
@@ -0,0 +1,119 @@
+package jetstream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGobMarshaler_ReleasedPayloads(t *testing.T) {
+	marshaler := GobMarshaler{}
+
+	tests := []struct {
+		name    string
+		payload message.Payload
+	}{
+		{name: "shorter than released", payload: []byte("short")},
+		{name: "longer than released", payload: make([]byte, 1024)},
+		{name: "empty", payload: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			releasePayload([]byte("a released payload with stale contents"))
+
+			msg := message.NewMessage(watermill.NewUUID(), tt.payload)
+			msg.Metadata.Set("key", "value")
+
+			natsMsg, err := marshaler.Marshal("topic", msg)
+			require.NoError(t, err)
+
+			unmarshaled, err := marshaler.Unmarshal(natsMsg)
+			require.NoError(t, err)
+
+			require.Equal(t, msg.UUID, unmarshaled.UUID)
+			require.Equal(t, tt.payload, unmarshaled.Payload)
+			require.Equal(t, msg.Metadata, unmarshaled.Metadata)
+		})
+	}
+}
+
+func TestReleasePayload_Oversized(t *testing.T) {
+	// oversized payloads are never pooled, so acquiring can not return them
+	releasePayload(make([]byte, maxPooledSize+1))
+	require.LessOrEqual(t, cap(acquirePayload()), maxPooledSize)
+}
+
+func TestSubscriber_ReleasePayloads(t *testing.T) {
+	tests := []struct {
+		name            string
+		releasePayloads bool
+	}{
+		{name: "disabled", releasePayloads: false},
+		{name: "enabled", releasePayloads: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := faultySubscriber(SubscriberSubscriptionConfig{
+				ReleasePayloads: tt.releasePayloads,
+			}, clientDecorator{
+				acker: func(msgAcker) msgAcker { return nopAcker{} },
+			})
+
+			m, err := (&GobMarshaler{}).Marshal("topic", message.NewMessage(watermill.NewUUID(), []byte("payload")))
+			require.NoError(t, err)
+
+			output := make(chan *message.Message, 1)
+			go func() {
+				msg := <-output
+				output <- msg
+				msg.Ack()
+			}()
+
+			s.processMessage(&subscriptionHandler{
+				ctx:       context.Background(),
+				topic:     "topic",
+				output:    output,
+				logFields: watermill.LogFields{},
+			}, m)
+
+			msg := <-output
+			if tt.releasePayloads {
+				require.Nil(t, msg.Payload)
+			} else {
+				require.Equal(t, message.Payload("payload"), msg.Payload)
+			}
+		})
+	}
+}
+
+func TestSubscriberConfig_ValidateReleasePayloads(t *testing.T) {
+	tests := []struct {
+		name        string
+		unmarshaler Unmarshaler
+		wantErr     bool
+	}{
+		{name: "gob", unmarshaler: GobMarshaler{}},
+		{name: "gob pointer", unmarshaler: &GobMarshaler{}},
+		{name: "nats", unmarshaler: &NATSMarshaler{}, wantErr: true},
+		{name: "json", unmarshaler: JSONMarshaler{}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := SubscriberSubscriptionConfig{Unmarshaler: tt.unmarshaler, ReleasePayloads: true}
+			config.setDefaults()
+
+			err := config.Validate()
+			if tt.wantErr {
+				require.ErrorContains(t, err, "SubscriberConfig.ReleasePayloads")
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package jetstream
+
+import (
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// StreamPosition is a position in the stream of a topic, identified by a stream sequence, a time,
+// or the last/next message of the stream.
+// The zero value is the beginning of the stream when used as a start, and the end of the stream when used as an end.
+type StreamPosition struct {
+	// Sequence is the stream sequence of the position, it takes precedence over all other fields.
+	Sequence uint64
+
+	// Time is the time of the position.
+	Time time.Time
+
+	// Last is the last message stored in the stream.
+	Last bool
+
+	// New is the first message published after the subscription was created.
+	New bool
+
+	// LastPerSubject is the last message stored for each subject of the topic, see AtLastPerSubject.
+	LastPerSubject bool
+}
+
+// AtSequence returns the position of the given stream sequence.
+func AtSequence(seq uint64) StreamPosition {
+	return StreamPosition{Sequence: seq}
+}
+
+// AtTime returns the position of the first message stored at or after t.
+func AtTime(t time.Time) StreamPosition {
+	return StreamPosition{Time: t}
+}
+
+// AtLast returns the position of the last message stored in the stream.
+func AtLast() StreamPosition {
+	return StreamPosition{Last: true}
+}
+
+// AtNew returns the position of the first message published after the subscription was created.
+func AtNew() StreamPosition {
+	return StreamPosition{New: true}
+}
+
+// AtLastPerSubject returns the position of the last message stored for each subject of the topic.
+//
+// A subscription started there receives the latest message of every subject, then live updates, e.g. to bootstrap
+// a cache or a materialized view from a compacted topic (a stream keeping one message per subject).
+// Messages are published to a subject of their own by default, so it only skips messages published with
+// PublisherConfig.SubjectKeyMetadata; LastPerSubjectRetention compacts the stream itself.
+// Messages are only skipped when the consumer is created, so it is meant for subscribers without DurableName.
+func AtLastPerSubject() StreamPosition {
+	return StreamPosition{LastPerSubject: true}
+}
+
+// IsZero reports whether the position is unset.
+func (p StreamPosition) IsZero() bool {
+	return p.Sequence == 0 && p.Time.IsZero() && !p.Last && !p.New && !p.LastPerSubject
+}
+
+func (p StreamPosition) startOption() nats.SubOpt {
+	switch {
+	case p.Sequence > 0:
+		return nats.StartSequence(p.Sequence)
+	case !p.Time.IsZero():
+		return nats.StartTime(p.Time)
+	case p.Last:
+		return nats.DeliverLast()
+	case p.New:
+		return nats.DeliverNew()
+	case p.LastPerSubject:
+		return nats.DeliverLastPerSubject()
+	default:
+		return nats.DeliverAll()
+	}
+}
+
+// passedBy reports whether a message with the given metadata lies beyond the position used as an inclusive end.
+// Last, New and LastPerSubject have no meaning as an end and are never passed.
+func (p StreamPosition) passedBy(meta *nats.MsgMetadata) bool {
+	switch {
+	case p.Sequence > 0:
+		return meta.Sequence.Stream > p.Sequence
+	case !p.Time.IsZero():
+		return meta.Timestamp.After(p.Time)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,64 @@
+package jetstream_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-jetstream/pkg/jetstream"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriber_AtLastPerSubject(t *testing.T) {
+	conn, js := serverConn(t)
+
+	pub, err := jetstream.NewPublisherWithNatsConn(conn, jetstream.PublisherPublishConfig{
+		Marshaler:          &jetstream.GobMarshaler{},
+		AutoProvision:      true,
+		SubjectKeyMetadata: "customer",
+	}, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	for _, update := range []struct{ customer, payload string }{
+		{"alice", "alice-1"},
+		{"bob", "bob-1"},
+		{"alice", "alice-2"},
+		{"bob", "bob-2"},
+		{"alice", "alice-3"},
+	} {
+		msg := message.NewMessage(watermill.NewUUID(), []byte(update.payload))
+		msg.Metadata.Set("customer", update.customer)
+		require.NoError(t, pub.Publish("customers", msg))
+	}
+
+	// every update is stored, the subscription skips the ones replaced by a later update of the same key
+	require.Equal(t, uint64(5), streamMsgs(t, js, "customers"))
+
+	sub := serverSubscriber(t, conn, jetstream.SubscriberSubscriptionConfig{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	messages, err := sub.Subscribe(jetstream.WithStartPosition(ctx, jetstream.AtLastPerSubject()), "customers")
+	require.NoError(t, err)
+
+	var payloads []string
+	for len(payloads) < 2 {
+		select {
+		case msg := <-messages:
+			payloads = append(payloads, string(msg.Payload))
+			msg.Ack()
+		case <-ctx.Done():
+			t.Fatalf("received %v before timing out", payloads)
+		}
+	}
+	require.ElementsMatch(t, []string{"alice-3", "bob-2"}, payloads)
+
+	select {
+	case msg := <-messages:
+		t.Fatalf("unexpected message %s", msg.Payload)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,55 @@
+package jetstream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamPosition_passedBy(t *testing.T) {
+	now := time.Now()
+
+	meta := &nats.MsgMetadata{
+		Sequence:  nats.SequencePair{Stream: 10},
+		Timestamp: now,
+	}
+
+	tests := []struct {
+		name     string
+		position StreamPosition
+		want     bool
+	}{
+		{name: "Zero", position: StreamPosition{}, want: false},
+		{name: "Sequence Before", position: AtSequence(9), want: true},
+		{name: "Sequence Equal", position: AtSequence(10), want: false},
+		{name: "Time Before", position: AtTime(now.Add(-time.Second)), want: true},
+		{name: "Time After", position: AtTime(now.Add(time.Second)), want: false},
+		{name: "Last Per Subject", position: AtLastPerSubject(), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, tt.position.passedBy(meta))
+		})
+	}
+}
+
+func TestStreamPosition_IsZero(t *testing.T) {
+	require.True(t, StreamPosition{}.IsZero())
+	require.False(t, AtSequence(1).IsZero())
+	require.False(t, AtTime(time.Now()).IsZero())
+	require.False(t, AtLast().IsZero())
+	require.False(t, AtNew().IsZero())
+	require.False(t, AtLastPerSubject().IsZero())
+}
+
+func TestStartPositionFromCtx(t *testing.T) {
+	_, ok := StartPositionFromCtx(context.Background())
+	require.False(t, ok)
+
+	pos, ok := StartPositionFromCtx(WithStartPosition(context.Background(), AtSequence(5)))
+	require.True(t, ok)
+	require.Equal(t, AtSequence(5), pos)
+}
@@ -0,0 +1,209 @@
+package jetstream
+
+import (
+	"context"
+	"reflect"
+	"sort"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// PriorityTopic is a topic consumed by a PrioritySubscriber.
+type PriorityTopic struct {
+	// Topic is the consumed topic.
+	Topic string
+
+	// Weight is the share of messages taken from the topic while several topics have messages ready.
+	// When no topic has a weight, topics are drained in the order they are passed (strict priority).
+	Weight int
+}
+
+// PrioritySubscriber consumes several topics into a single channel, preferring messages of higher priority topics,
+// so urgent messages are not stuck behind a bulk backlog on the same handler.
+//
+// A message is only taken from a topic when the consumer is ready to receive it, so no message is held back while
+// another topic is preferred.
+type PrioritySubscriber struct {
+	subscriber message.Subscriber
+	logger     watermill.LoggerAdapter
+}
+
+// NewPrioritySubscriber creates a new PrioritySubscriber consuming topics with subscriber.
+func NewPrioritySubscriber(subscriber message.Subscriber, logger watermill.LoggerAdapter) *PrioritySubscriber {
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	return &PrioritySubscriber{
+		subscriber: subscriber,
+		logger:     logger,
+	}
+}
+
+// Subscribe subscribes to all topics, the returned channel is closed once every topic subscription is closed.
+func (p *PrioritySubscriber) Subscribe(ctx context.Context, topics ...PriorityTopic) (<-chan *message.Message, error) {
+	if len(topics) == 0 {
+		return nil, errors.New("at least one topic is required")
+	}
+
+	for _, topic := range topics {
+		if topic.Weight < 0 {
+			return nil, errors.Errorf("weight of topic %s can not be negative", topic.Topic)
+		}
+	}
+
+	inputs := make([]<-chan *message.Message, len(topics))
+	for i, topic := range topics {
+		input, err := p.subscriber.Subscribe(ctx, topic.Topic)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot subscribe to %s", topic.Topic)
+		}
+		inputs[i] = input
+	}
+
+	output := make(chan *message.Message)
+
+	go func() {
+		defer close(output)
+		newPrioritySelector(topics, inputs).run(ctx, output, p.logger)
+	}()
+
+	return output, nil
+}
+
+// prioritySelector picks the topic the next message is taken from.
+type prioritySelector struct {
+	topics []PriorityTopic
+	inputs []<-chan *message.Message
+
+	weighted bool
+	// current are the smooth weighted round-robin counters of topics
+	current []int
+}
+
+func newPrioritySelector(topics []PriorityTopic, inputs []<-chan *message.Message) *prioritySelector {
+	weighted := false
+	for _, topic := range topics {
+		if topic.Weight > 0 {
+			weighted = true
+		}
+	}
+
+	return &prioritySelector{
+		topics:   topics,
+		inputs:   inputs,
+		weighted: weighted,
+		current:  make([]int, len(topics)),
+	}
+}
+
+// order returns the indexes of open topics, most preferred first.
+func (s *prioritySelector) order() []int {
+	order := make([]int, 0, len(s.inputs))
+	for i, input := range s.inputs {
+		if input != nil {
+			order = append(order, i)
+		}
+	}
+
+	if !s.weighted {
+		return order
+	}
+
+	for _, i := range order {
+		s.current[i] += s.topics[i].Weight
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		return s.current[order[a]] > s.current[order[b]]
+	})
+
+	return order
+}
+
+// taken records that a message was taken from topic i.
+func (s *prioritySelector) taken(i int) {
+	if !s.weighted {
+		return
+	}
+
+	for j, input := range s.inputs {
+		if input != nil {
+			s.current[i] -= s.topics[j].Weight
+		}
+	}
+}
+
+// next returns the next message and the index of its topic, blocking until a message is ready.
+// ok is false when all topics are closed or ctx is done.
+func (s *prioritySelector) next(ctx context.Context) (msg *message.Message, topic int, ok bool) {
+	for {
+		order := s.order()
+		if len(order) == 0 {
+			return nil, 0, false
+		}
+
+		closed := false
+		for _, i := range order {
+			select {
+			case msg, open := <-s.inputs[i]:
+				if !open {
+					s.inputs[i] = nil
+					closed = true
+					continue
+				}
+				s.taken(i)
+				return msg, i, true
+			default:
+			}
+		}
+		if closed {
+			continue
+		}
+
+		cases := make([]reflect.SelectCase, 0, len(order)+1)
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())})
+		for _, i := range order {
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(s.inputs[i])})
+		}
+
+		chosen, value, open := reflect.Select(cases)
+		if chosen == 0 {
+			return nil, 0, false
+		}
+
+		i := order[chosen-1]
+		if !open {
+			s.inputs[i] = nil
+			continue
+		}
+
+		s.taken(i)
+		return value.Interface().(*message.Message), i, true
+	}
+}
+
+func (s *prioritySelector) run(ctx context.Context, output chan<- *message.Message, logger watermill.LoggerAdapter) {
+	for {
+		msg, i, ok := s.next(ctx)
+		if !ok {
+			return
+		}
+
+		logFields := watermill.LogFields{
+			"message_uuid": msg.UUID,
+			"topic":        s.topics[i].Topic,
+		}
+
+		select {
+		case output <- msg:
+			logger.Trace("Message sent to consumer", logFields)
+		case <-ctx.Done():
+			logger.Trace("Context cancelled, message nacked", logFields)
+			msg.Nack()
+			return
+		}
+	}
+}
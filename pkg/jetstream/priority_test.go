@@ -0,0 +1,57 @@
+package jetstream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/require"
+)
+
+func bufferedTopic(uuids ...string) <-chan *message.Message {
+	ch := make(chan *message.Message, len(uuids))
+	for _, uuid := range uuids {
+		ch <- message.NewMessage(uuid, nil)
+	}
+	close(ch)
+	return ch
+}
+
+func drainSelector(t *testing.T, s *prioritySelector) []string {
+	var uuids []string
+	for {
+		msg, _, ok := s.next(context.Background())
+		if !ok {
+			return uuids
+		}
+		uuids = append(uuids, msg.UUID)
+	}
+}
+
+func TestPrioritySelector_Strict(t *testing.T) {
+	s := newPrioritySelector(
+		[]PriorityTopic{{Topic: "urgent"}, {Topic: "bulk"}},
+		[]<-chan *message.Message{bufferedTopic("u1", "u2"), bufferedTopic("b1", "b2")},
+	)
+
+	require.Equal(t, []string{"u1", "u2", "b1", "b2"}, drainSelector(t, s))
+}
+
+func TestPrioritySelector_Weighted(t *testing.T) {
+	s := newPrioritySelector(
+		[]PriorityTopic{{Topic: "urgent", Weight: 2}, {Topic: "bulk", Weight: 1}},
+		[]<-chan *message.Message{bufferedTopic("u1", "u2", "u3", "u4"), bufferedTopic("b1", "b2", "b3", "b4")},
+	)
+
+	require.Equal(t, []string{"u1", "b1", "u2", "u3", "b2", "u4", "b3", "b4"}, drainSelector(t, s))
+}
+
+func TestPrioritySelector_ContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	s := newPrioritySelector([]PriorityTopic{{Topic: "urgent"}}, []<-chan *message.Message{make(chan *message.Message)})
+
+	_, _, ok := s.next(ctx)
+	require.False(t, ok)
+}
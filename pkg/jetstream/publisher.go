@@ -1,12 +1,40 @@
 package jetstream
 
 import (
+	"context"
+	"sync"
+	"time"
+
 	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/nats-io/nats.go"
 	"github.com/pkg/errors"
 )
 
+// HeaderFunc computes headers for a message published to topic, without embedding them in the payload.
+// The headers are set on the marshaled message, replacing the marshaled headers with the same key.
+// It may return nil when there is no header to add.
+type HeaderFunc func(topic string, msg *message.Message) nats.Header
+
+// setHeaders sets the headers computed by headerFunc on natsMsg.
+func setHeaders(natsMsg *nats.Msg, headerFunc HeaderFunc, topic string, msg *message.Message) {
+	if headerFunc == nil {
+		return
+	}
+
+	header := headerFunc(topic, msg)
+	if len(header) == 0 {
+		return
+	}
+
+	if natsMsg.Header == nil {
+		natsMsg.Header = nats.Header{}
+	}
+	for key, values := range header {
+		natsMsg.Header[key] = values
+	}
+}
+
 // PublisherConfig is the configuration to create a publisher
 type PublisherConfig struct {
 	// URL is the NATS URL.
@@ -27,11 +55,101 @@ type PublisherConfig struct {
 	// AutoProvision bypasses client validation and provisioning of streams
 	AutoProvision bool
 
+	// StreamPreset customizes the configuration of provisioned streams, e.g. InterestRetention.
+	StreamPreset StreamPreset
+
 	// PublishOptions are custom publish option to be used on all publication
 	PublishOptions []nats.PubOpt
 
 	// TrackMsgId uses the Nats.MsgId option with the msg UUID to prevent duplication
 	TrackMsgId bool
+
+	// ExactlyOnce enables the publish side of exactly-once delivery: TrackMsgId is always used and
+	// provisioned streams get DuplicateWindow.  See the README for the constraints of exactly-once delivery.
+	ExactlyOnce bool
+
+	// DuplicateWindow is the window JetStream tracks Nats-Msg-Id values in for streams created by the publisher
+	// (defaults to 2 minutes when ExactlyOnce is set, otherwise the server default is used)
+	DuplicateWindow time.Duration
+
+	// Partitioning publishes messages to partition subjects picked from their partition key, see PartitionConfig.
+	Partitioning PartitionConfig
+
+	// SubjectKeyMetadata is the metadata key holding the subject key of a message.  Messages with a key are published
+	// to KeySubject(topic, key) instead of a subject of their own, so the last message of every key can be kept
+	// (see LastPerSubjectRetention) and read with AtLastPerSubject.  It can not be combined with Partitioning.
+	SubjectKeyMetadata string
+
+	// TTLMetadata is the metadata key holding the TTL of a message (e.g. "30s"), which is sent as the Nats-TTL header.
+	// Messages without it do not expire, TTLs are not sent when it is empty.  See MsgTTLHdr.
+	TTLMetadata string
+
+	// TopicSanitizer transforms topics before they are validated with ValidateTopic (e.g. SlashTopicSanitizer).
+	TopicSanitizer TopicSanitizer
+
+	// EscapeTopics escapes the characters of topics not allowed in NATS subjects with EscapeTopic, after
+	// TopicSanitizer.  Publishers and subscribers of a topic must agree on it.
+	EscapeTopics bool
+
+	// Transformers are applied to the messages passed to Publish before marshaling, see Transformers.
+	Transformers Transformers
+
+	// PublishInterceptors intercept the publish of every message, the first one being the outermost,
+	// see PublishInterceptor.
+	PublishInterceptors []PublishInterceptor
+
+	// HeaderFunc computes headers added to every published message (e.g. signing timestamps or routing hints),
+	// see HeaderFunc.
+	HeaderFunc HeaderFunc
+
+	// Name identifies the publisher in its logs, logged as publisher_name.
+	Name string
+
+	// LogFields are static fields added to every log of the publisher.
+	LogFields watermill.LogFields
+
+	// Latency reports the publish latency per topic and the round trip time to the server, see LatencyConfig.
+	Latency LatencyConfig
+
+	// Correlation generates correlation ids and copies them to NATS headers, see CorrelationConfig.
+	Correlation CorrelationConfig
+
+	// Audit publishes a record of every publish to an audit subject, see AuditConfig.
+	Audit AuditConfig
+
+	// Spool persists publishes to disk while the broker is unreachable and replays them later, see SpoolConfig.
+	Spool SpoolConfig
+
+	// InterestCheck warns when publishing to an interest stream without consumers, see InterestCheckConfig.
+	InterestCheck InterestCheckConfig
+
+	// PublishRetry retries publishes failing because the broker is unreachable or timing out, they are not
+	// retried when nil.  Retried messages carry their UUID as Nats-Msg-Id, so a message stored before a timeout
+	// is deduplicated within the duplicate window of the stream.  Spooled messages are spooled once retries
+	// are exhausted.
+	PublishRetry RetryPolicy
+
+	// UnavailableGracePeriod is how long publishes are retried while JetStream is unavailable (no responders,
+	// JetStream not enabled or temporarily unavailable), e.g. while the server restarts.  Publishing then fails
+	// with a JetStreamUnavailableError.  Publishes are not retried when zero.
+	UnavailableGracePeriod time.Duration
+
+	// Clock is the source of time of PublishRetry delays and UnavailableGracePeriod (defaults to RealClock),
+	// see Clock.
+	Clock Clock
+
+	// CloseTimeout bounds flushing pending publishes on close when the close context has no deadline
+	// (defaults to 30 seconds).
+	CloseTimeout time.Duration
+
+	// DrainOnClose makes closing also wait for the acks of pending asynchronous publishes and drain the connection
+	// instead of closing it, so no publish in flight is lost.
+	DrainOnClose bool
+
+	// TenantCredentials maps tenants to the credentials file they publish with.  Messages with TenantMetadataKey
+	// are published on a connection of their tenant, opened on first use with URL and NatsOptions, other messages
+	// use the default connection.
+	TenantCredentials map[string]string
 }
 
 // PublisherPublishConfig is the configuration subset needed for an individual publish call
@@ -45,6 +163,9 @@ type PublisherPublishConfig struct {
 	// AutoProvision bypasses client validation and provisioning of streams
 	AutoProvision bool
 
+	// StreamPreset customizes the configuration of provisioned streams, e.g. InterestRetention.
+	StreamPreset StreamPreset
+
 	// JetstreamOptions are custom Jetstream options for a connection.
 	JetstreamOptions []nats.JSOpt
 
@@ -53,38 +174,222 @@ type PublisherPublishConfig struct {
 
 	// TrackMsgId uses the Nats.MsgId option with the msg UUID to prevent duplication
 	TrackMsgId bool
+
+	// ExactlyOnce enables the publish side of exactly-once delivery: TrackMsgId is always used and
+	// provisioned streams get DuplicateWindow.  See the README for the constraints of exactly-once delivery.
+	ExactlyOnce bool
+
+	// DuplicateWindow is the window JetStream tracks Nats-Msg-Id values in for streams created by the publisher
+	// (defaults to 2 minutes when ExactlyOnce is set, otherwise the server default is used)
+	DuplicateWindow time.Duration
+
+	// Partitioning publishes messages to partition subjects picked from their partition key, see PartitionConfig.
+	Partitioning PartitionConfig
+
+	// SubjectKeyMetadata is the metadata key holding the subject key of a message.  Messages with a key are published
+	// to KeySubject(topic, key) instead of a subject of their own, so the last message of every key can be kept
+	// (see LastPerSubjectRetention) and read with AtLastPerSubject.  It can not be combined with Partitioning.
+	SubjectKeyMetadata string
+
+	// TTLMetadata is the metadata key holding the TTL of a message (e.g. "30s"), which is sent as the Nats-TTL header.
+	// Messages without it do not expire, TTLs are not sent when it is empty.  See MsgTTLHdr.
+	TTLMetadata string
+
+	// TopicSanitizer transforms topics before they are validated with ValidateTopic (e.g. SlashTopicSanitizer).
+	TopicSanitizer TopicSanitizer
+
+	// EscapeTopics escapes the characters of topics not allowed in NATS subjects with EscapeTopic, after
+	// TopicSanitizer.  Publishers and subscribers of a topic must agree on it.
+	EscapeTopics bool
+
+	// Transformers are applied to the messages passed to Publish before marshaling, see Transformers.
+	Transformers Transformers
+
+	// PublishInterceptors intercept the publish of every message, the first one being the outermost,
+	// see PublishInterceptor.
+	PublishInterceptors []PublishInterceptor
+
+	// HeaderFunc computes headers added to every published message (e.g. signing timestamps or routing hints),
+	// see HeaderFunc.
+	HeaderFunc HeaderFunc
+
+	// Name identifies the publisher in its logs, logged as publisher_name.
+	Name string
+
+	// LogFields are static fields added to every log of the publisher.
+	LogFields watermill.LogFields
+
+	// Latency reports the publish latency per topic and the round trip time to the server, see LatencyConfig.
+	Latency LatencyConfig
+
+	// Correlation generates correlation ids and copies them to NATS headers, see CorrelationConfig.
+	Correlation CorrelationConfig
+
+	// Audit publishes a record of every publish to an audit subject, see AuditConfig.
+	Audit AuditConfig
+
+	// Spool persists publishes to disk while the broker is unreachable and replays them later, see SpoolConfig.
+	Spool SpoolConfig
+
+	// InterestCheck warns when publishing to an interest stream without consumers, see InterestCheckConfig.
+	InterestCheck InterestCheckConfig
+
+	// PublishRetry retries publishes failing because the broker is unreachable or timing out, they are not
+	// retried when nil.  Retried messages carry their UUID as Nats-Msg-Id, so a message stored before a timeout
+	// is deduplicated within the duplicate window of the stream.  Spooled messages are spooled once retries
+	// are exhausted.
+	PublishRetry RetryPolicy
+
+	// UnavailableGracePeriod is how long publishes are retried while JetStream is unavailable (no responders,
+	// JetStream not enabled or temporarily unavailable), e.g. while the server restarts.  Publishing then fails
+	// with a JetStreamUnavailableError.  Publishes are not retried when zero.
+	UnavailableGracePeriod time.Duration
+
+	// Clock is the source of time of PublishRetry delays and UnavailableGracePeriod (defaults to RealClock),
+	// see Clock.
+	Clock Clock
+
+	// CloseTimeout bounds flushing pending publishes on close when the close context has no deadline
+	// (defaults to 30 seconds).
+	CloseTimeout time.Duration
+
+	// DrainOnClose makes closing also wait for the acks of pending asynchronous publishes and drain the connection
+	// instead of closing it, so no publish in flight is lost.
+	DrainOnClose bool
+
+	// OwnsConnection makes closing the publisher close the connection it was created with.  Connections passed
+	// to NewPublisherWithNatsConn are owned by the caller unless it is set, NewPublisher owns its connection.
+	OwnsConnection bool
 }
 
 func (c *PublisherConfig) setDefaults() {
 	if c.SubjectCalculator == nil {
 		c.SubjectCalculator = defaultSubjectCalculator
 	}
+
+	c.Partitioning.setDefaults()
+	c.Correlation.setDefaults()
+	c.Spool.setDefaults()
+
+	if c.Clock == nil {
+		c.Clock = RealClock{}
+	}
+	if c.CloseTimeout == 0 {
+		c.CloseTimeout = defaultFlushTimeout
+	}
+}
+
+func (c *PublisherPublishConfig) setDefaults() {
+	if c.SubjectCalculator == nil {
+		c.SubjectCalculator = defaultSubjectCalculator
+	}
+
+	c.Partitioning.setDefaults()
+	c.Correlation.setDefaults()
+	c.Spool.setDefaults()
+
+	if c.Clock == nil {
+		c.Clock = RealClock{}
+	}
+	if c.CloseTimeout == 0 {
+		c.CloseTimeout = defaultFlushTimeout
+	}
+
+	if c.ExactlyOnce {
+		c.TrackMsgId = true
+
+		if c.DuplicateWindow <= 0 {
+			c.DuplicateWindow = defaultDuplicateWindow
+		}
+	}
 }
 
 // Validate ensures configuration is valid before use
 func (c PublisherConfig) Validate() error {
+	return c.GetPublisherPublishConfig().Validate()
+}
+
+// Validate ensures configuration is valid before use
+func (c PublisherPublishConfig) Validate() error {
+	var errs ConfigErrors
+
 	if c.Marshaler == nil {
-		return errors.New("PublisherConfig.Marshaler is missing")
+		errs.add("PublisherConfig.Marshaler", "missing")
 	}
 
 	if c.SubjectCalculator == nil {
-		return errors.New("PublisherConfig.SubjectCalculator is missing")
+		errs.add("PublisherConfig.SubjectCalculator", "missing")
 	}
-	return nil
+
+	if c.DuplicateWindow < 0 {
+		errs.add("PublisherConfig.DuplicateWindow", "can not be negative")
+	}
+
+	errs.addErr("PublisherConfig.Partitioning", c.Partitioning.Validate())
+	if c.SubjectKeyMetadata != "" && c.Partitioning.enabled() {
+		errs.add("PublisherConfig.SubjectKeyMetadata", "can not be combined with Partitioning")
+	}
+	errs.addErr("PublisherConfig.Latency", c.Latency.Validate())
+	errs.addErr("PublisherConfig.Audit", c.Audit.Validate())
+	errs.addErr("PublisherConfig.Spool", c.Spool.Validate())
+	errs.addErr("PublisherConfig.InterestCheck", c.InterestCheck.Validate())
+	errs.addErr("PublisherConfig.PublishRetry", validateRetryPolicy(c.PublishRetry))
+
+	if c.CloseTimeout < 0 {
+		errs.add("PublisherConfig.CloseTimeout", "can not be negative")
+	}
+	if c.UnavailableGracePeriod < 0 {
+		errs.add("PublisherConfig.UnavailableGracePeriod", "can not be negative")
+	}
+
+	return errs.err()
 }
 
 // GetPublisherPublishConfig gets the configuration subset needed for individual publish calls once a connection has been established
 func (c PublisherConfig) GetPublisherPublishConfig() PublisherPublishConfig {
 	return PublisherPublishConfig{
-		Marshaler:         c.Marshaler,
-		SubjectCalculator: c.SubjectCalculator,
-		AutoProvision:     c.AutoProvision,
-		JetstreamOptions:  c.JetstreamOptions,
-		PublishOptions:    c.PublishOptions,
-		TrackMsgId:        c.TrackMsgId,
+		Marshaler:              c.Marshaler,
+		SubjectCalculator:      c.SubjectCalculator,
+		AutoProvision:          c.AutoProvision,
+		StreamPreset:           c.StreamPreset,
+		JetstreamOptions:       c.JetstreamOptions,
+		PublishOptions:         c.PublishOptions,
+		TrackMsgId:             c.TrackMsgId,
+		ExactlyOnce:            c.ExactlyOnce,
+		DuplicateWindow:        c.DuplicateWindow,
+		Partitioning:           c.Partitioning,
+		SubjectKeyMetadata:     c.SubjectKeyMetadata,
+		TTLMetadata:            c.TTLMetadata,
+		TopicSanitizer:         c.TopicSanitizer,
+		EscapeTopics:           c.EscapeTopics,
+		Transformers:           c.Transformers,
+		PublishInterceptors:    c.PublishInterceptors,
+		HeaderFunc:             c.HeaderFunc,
+		Name:                   c.Name,
+		LogFields:              c.LogFields,
+		Latency:                c.Latency,
+		Correlation:            c.Correlation,
+		Audit:                  c.Audit,
+		Spool:                  c.Spool,
+		InterestCheck:          c.InterestCheck,
+		PublishRetry:           c.PublishRetry,
+		UnavailableGracePeriod: c.UnavailableGracePeriod,
+		Clock:                  c.Clock,
+		CloseTimeout:           c.CloseTimeout,
+		DrainOnClose:           c.DrainOnClose,
 	}
 }
 
+// logFields returns the fields added to every log of the publisher.
+func (c PublisherPublishConfig) logFields() watermill.LogFields {
+	fields := c.LogFields.Add(nil)
+	if c.Name != "" {
+		fields["publisher_name"] = c.Name
+	}
+
+	return fields
+}
+
 // Publisher provides the jetstream implementation for watermill publish operations
 type Publisher struct {
 	conn             *nats.Conn
@@ -92,6 +397,22 @@ type Publisher struct {
 	logger           watermill.LoggerAdapter
 	js               nats.JetStream
 	topicInterpreter *topicInterpreter
+
+	// tenants is set when publishing with per-tenant connections
+	tenants *tenantPublishers
+
+	// stopProbe stops probing the round trip time, it is set when LatencyConfig.RTTInterval is set
+	stopProbe func()
+
+	// auditor is set when publishes are audited, see AuditConfig
+	auditor *auditor
+
+	// spool is set when publishes are spooled while the broker is unreachable, stopSpool stops replaying it
+	spool     *spool
+	stopSpool func()
+
+	// interest is set when publishing to interest streams without consumers is warned about, see InterestCheckConfig
+	interest *interestChecker
 }
 
 // NewPublisher creates a new Publisher.
@@ -107,14 +428,52 @@ func NewPublisher(config PublisherConfig, logger watermill.LoggerAdapter) (*Publ
 		return nil, errors.Wrap(err, "cannot connect to nats")
 	}
 
-	return NewPublisherWithNatsConn(conn, config.GetPublisherPublishConfig(), logger)
+	publishConfig := config.GetPublisherPublishConfig()
+	publishConfig.OwnsConnection = true
+
+	pub, err := NewPublisherWithNatsConn(conn, publishConfig, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(config.TenantCredentials) > 0 {
+		// messages were already transformed and topics sanitized by the publisher routing them to tenants,
+		// the round trip time is probed on the default connection only
+		tenantConfig := pub.config
+		tenantConfig.Transformers = Transformers{}
+		tenantConfig.TopicSanitizer = nil
+		tenantConfig.EscapeTopics = false
+		tenantConfig.Latency.RTTInterval = 0
+
+		pub.tenants = &tenantPublishers{
+			connector: tenantConnector{
+				url:         config.URL,
+				options:     config.NatsOptions,
+				credentials: config.TenantCredentials,
+			},
+			config:     tenantConfig,
+			logger:     logger, // tenant publishers add the log fields of config themselves
+			publishers: map[string]*Publisher{},
+		}
+	}
+
+	return pub, nil
 }
 
 // NewPublisherWithNatsConn creates a new Publisher with the provided nats connection.
 func NewPublisherWithNatsConn(conn *nats.Conn, config PublisherPublishConfig, logger watermill.LoggerAdapter) (*Publisher, error) {
+	config.setDefaults()
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
 	if logger == nil {
 		logger = watermill.NopLogger{}
 	}
+	if fields := config.logFields(); len(fields) > 0 {
+		logger = logger.With(fields)
+	}
 
 	js, err := conn.JetStream(config.JetstreamOptions...)
 
@@ -122,13 +481,50 @@ func NewPublisherWithNatsConn(conn *nats.Conn, config PublisherPublishConfig, lo
 		return nil, err
 	}
 
-	return &Publisher{
+	pub := &Publisher{
 		conn:             conn,
 		config:           config,
 		logger:           logger,
 		js:               js,
-		topicInterpreter: newTopicInterpreter(js, config.SubjectCalculator),
-	}, nil
+		topicInterpreter: newTopicInterpreter(js, config.SubjectCalculator, config.DuplicateWindow),
+	}
+	pub.topicInterpreter.streamPreset = config.StreamPreset
+
+	if config.InterestCheck.enabled() {
+		pub.interest = newInterestChecker(config.InterestCheck, pub.topicInterpreter, logger)
+	}
+
+	if config.Audit.enabled() {
+		pub.auditor = newAuditor(config.Audit, js, logger)
+	}
+
+	if config.Spool.enabled() {
+		spool, err := newSpool(config.Spool, js, logger)
+		if err != nil {
+			return nil, err
+		}
+		pub.spool = spool
+
+		closing := make(chan struct{})
+		var once sync.Once
+		pub.stopSpool = func() {
+			once.Do(func() { close(closing) })
+		}
+
+		go spool.run(conn.IsConnected, closing)
+	}
+
+	if config.Latency.probes() {
+		closing := make(chan struct{})
+		var once sync.Once
+		pub.stopProbe = func() {
+			once.Do(func() { close(closing) })
+		}
+
+		go config.Latency.probeRTT(conn.RTT, closing)
+	}
+
+	return pub, nil
 }
 
 // Publish publishes message to NATS.
@@ -136,46 +532,290 @@ func NewPublisherWithNatsConn(conn *nats.Conn, config PublisherPublishConfig, lo
 // Publish will not return until an ack has been received from JetStream.
 // When one of messages delivery fails - function is interrupted.
 func (p *Publisher) Publish(topic string, messages ...*message.Message) error {
+	return p.publishWithOptions(topic, messages)
+}
+
+// publishWithOptions is Publish passing opts to the publish of every message, e.g. the Nats-Msg-Id of Redrive.
+func (p *Publisher) publishWithOptions(topic string, messages []*message.Message, opts ...nats.PubOpt) error {
+	topic, err := sanitizeTopic(topic, p.config.TopicSanitizer, p.config.EscapeTopics, p.config.AutoProvision)
+	if err != nil {
+		return err
+	}
+
+	// transformers run before routing, so they can set the tenant of a message
+	for _, msg := range messages {
+		if err := p.config.Transformers.apply(topic, msg); err != nil {
+			return err
+		}
+	}
+
+	if p.tenants != nil {
+		return p.publishTenants(topic, messages, opts...)
+	}
+
+	return p.publish(topic, messages, opts...)
+}
+
+func (p *Publisher) publish(topic string, messages []*message.Message, opts ...nats.PubOpt) error {
 	if p.config.AutoProvision {
 		err := p.topicInterpreter.ensureStream(topic)
 		if err != nil {
 			return err
 		}
 	}
+	if p.interest != nil {
+		p.interest.check(topic)
+	}
 
 	for _, msg := range messages {
-		messageFields := watermill.LogFields{
-			"message_uuid": msg.UUID,
-			"topic_name":   topic,
+		if err := p.publishMessage(topic, msg, opts...); err != nil {
+			return err
 		}
+	}
+
+	return nil
+}
 
-		p.logger.Trace("Publishing message", messageFields)
+func (p *Publisher) publishMessage(topic string, msg *message.Message, opts ...nats.PubOpt) error {
+	correlationID := p.config.Correlation.ensure(msg)
 
-		natsMsg, err := p.config.Marshaler.Marshal(topic, msg)
+	messageFields := p.config.Correlation.logFields(watermill.LogFields{
+		"message_uuid": msg.UUID,
+		"topic_name":   topic,
+	}, correlationID)
+
+	p.logger.Trace("Publishing message", messageFields)
+
+	natsMsg, err := p.config.Marshaler.Marshal(topic, msg)
+	if err != nil {
+		return err
+	}
+	p.config.Correlation.setHeader(natsMsg, correlationID)
+	setHeaders(natsMsg, p.config.HeaderFunc, topic, msg)
+
+	if p.config.Partitioning.enabled() {
+		natsMsg.Subject = PartitionSubject(topic, p.config.Partitioning.partition(msg))
+	} else if p.config.SubjectKeyMetadata != "" {
+		if key := msg.Metadata.Get(p.config.SubjectKeyMetadata); key != "" {
+			natsMsg.Subject = KeySubject(topic, key)
+		}
+	}
+
+	if p.config.TTLMetadata != "" {
+		ttl, found, err := messageTTL(msg, p.config.TTLMetadata)
 		if err != nil {
 			return err
 		}
+		if found {
+			setMsgTTL(natsMsg, ttl)
+		}
+	}
 
-		publishOpts := p.config.PublishOptions
+	if len(p.config.PublishInterceptors) == 0 {
+		return p.sendMessage(topic, msg, natsMsg, messageFields, opts...)
+	}
 
-		if p.config.TrackMsgId {
-			publishOpts = append(publishOpts, nats.MsgId(msg.UUID))
-		}
+	return chainPublishInvoker(p.config.PublishInterceptors, func(_ context.Context, topic string, msg *message.Message, natsMsg *nats.Msg) error {
+		return p.sendMessage(topic, msg, natsMsg, messageFields, opts...)
+	})(msg.Context(), topic, msg, natsMsg)
+}
 
-		if _, err := p.js.PublishMsg(natsMsg, publishOpts...); err != nil {
-			return errors.Wrap(err, "sending message failed")
+// sendMessage publishes natsMsg, the marshaled msg, spooling it when the broker is unreachable and a spool is configured.
+func (p *Publisher) sendMessage(
+	topic string,
+	msg *message.Message,
+	natsMsg *nats.Msg,
+	messageFields watermill.LogFields,
+	opts ...nats.PubOpt,
+) error {
+	publishOpts := make([]nats.PubOpt, 0, len(p.config.PublishOptions)+len(opts)+1)
+	publishOpts = append(publishOpts, p.config.PublishOptions...)
+
+	// retried and spooled messages are deduplicated by their id when they were stored before the publish failed,
+	// an id passed in opts (e.g. by Redrive) takes precedence
+	if p.config.TrackMsgId || p.config.PublishRetry != nil || p.spool != nil {
+		publishOpts = append(publishOpts, nats.MsgId(msg.UUID))
+	}
+	publishOpts = append(publishOpts, opts...)
+
+	start := time.Now()
+	var ack *nats.PubAck
+	err := retryUnavailable(p.config.UnavailableGracePeriod, p.config.Clock, nil, p.logger, func() (string, string) {
+		return p.topicInterpreter.streamName(topic), natsMsg.Subject
+	}, func() error {
+		var err error
+		ack, err = p.publishWithRetry(topic, natsMsg, publishOpts, messageFields)
+		return err
+	})
+	if p.auditor != nil {
+		p.auditor.recordPublish(msg.UUID, topic, ack, start, err)
+	}
+
+	if err != nil && p.spool != nil && len(opts) == 0 && brokerUnreachable(err) {
+		return p.spoolMessage(natsMsg, msg.UUID, err, messageFields)
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "sending message failed")
+	}
+
+	return nil
+}
+
+// publishWithRetry publishes natsMsg, retrying according to PublishRetry while the broker is unreachable.
+func (p *Publisher) publishWithRetry(
+	topic string,
+	natsMsg *nats.Msg,
+	publishOpts []nats.PubOpt,
+	messageFields watermill.LogFields,
+) (*nats.PubAck, error) {
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		ack, err := p.js.PublishMsg(natsMsg, publishOpts...)
+		p.config.Latency.recordPublish(topic, start, err)
+
+		if err == nil || p.config.PublishRetry == nil || !brokerUnreachable(err) ||
+			retriesExhausted(p.config.PublishRetry, attempt) {
+			return ack, err
 		}
+
+		delay := p.config.PublishRetry.NextDelay(attempt)
+		p.logger.Debug("Broker unreachable, retrying publish", messageFields.Add(watermill.LogFields{
+			"err":     err,
+			"attempt": attempt,
+			"delay":   delay,
+		}))
+		wait, stop := after(p.config.Clock, delay)
+		<-wait
+		stop()
+	}
+}
+
+// spoolMessage spools natsMsg, which could not be published because of publishErr, see SpoolConfig.
+func (p *Publisher) spoolMessage(natsMsg *nats.Msg, uuid string, publishErr error, messageFields watermill.LogFields) error {
+	if natsMsg.Header == nil {
+		natsMsg.Header = nats.Header{}
 	}
+	natsMsg.Header.Set(nats.MsgIdHdr, uuid)
+
+	if err := p.spool.add(natsMsg); err != nil {
+		return errors.Wrapf(err, "sending message failed (%s), cannot spool it", publishErr)
+	}
+
+	p.logger.Debug("Broker unreachable, message spooled", messageFields.Add(watermill.LogFields{"err": publishErr}))
 
 	return nil
 }
 
-// Close closes the publisher and the underlying connection
+// Close closes the publisher and the underlying connection.  Pending publishes are flushed first,
+// an error is returned when they could not be flushed, see CloseWithContext.
 func (p *Publisher) Close() error {
+	_, err := p.CloseWithContext(context.Background())
+
+	return err
+}
+
+// CloseWithContext flushes pending publishes until ctx is done (or CloseTimeout elapsed when ctx has no deadline)
+// and closes the publisher and the underlying connection when the publisher owns it, see OwnsConnection.
+// With DrainOnClose the acks of pending asynchronous publishes are awaited and the connection is drained.
+// The report tells whether pending publishes were flushed, an owned connection is closed either way.  An error is
+// returned when pending publishes were not flushed, or the connection could not be drained in time.
+func (p *Publisher) CloseWithContext(ctx context.Context) (ShutdownReport, error) {
 	p.logger.Trace("Closing publisher", nil)
 	defer p.logger.Trace("Publisher closed", nil)
 
-	p.conn.Close()
+	if p.tenants != nil {
+		p.tenants.close()
+	}
+
+	if p.stopProbe != nil {
+		p.stopProbe()
+	}
+	if p.stopSpool != nil {
+		p.stopSpool()
+	}
+
+	var report ShutdownReport
+
+	if p.conn.IsClosed() {
+		return report, nil
+	}
+
+	flushCtx, cancel := flushContext(ctx, p.closeTimeout())
+	defer cancel()
+
+	flushErr := p.flush(flushCtx)
+	if flushErr != nil {
+		p.logger.Error("Cannot flush pending publishes", flushErr, nil)
+	} else {
+		report.Flushed = true
+	}
+
+	closeErr := p.closeConn(flushCtx)
+
+	if flushErr != nil {
+		return report, errors.Wrap(flushErr, "cannot flush pending publishes")
+	}
+	if closeErr != nil {
+		report.Flushed = false
+		return report, closeErr
+	}
+
+	return report, nil
+}
+
+func (p *Publisher) closeTimeout() time.Duration {
+	if p.config.CloseTimeout > 0 {
+		return p.config.CloseTimeout
+	}
+	return defaultFlushTimeout
+}
+
+// flush waits until pending publishes were received by the server, and with DrainOnClose until pending
+// asynchronous publishes were acked.
+func (p *Publisher) flush(ctx context.Context) error {
+	if p.config.DrainOnClose && p.js.PublishAsyncPending() > 0 {
+		select {
+		case <-p.js.PublishAsyncComplete():
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "%d asynchronous publishes not acked", p.js.PublishAsyncPending())
+		}
+	}
+
+	return p.conn.FlushWithContext(ctx)
+}
+
+// closeConn closes the connection when the publisher owns it, draining it with DrainOnClose until ctx is done.
+// It returns an error when the connection could not be drained, pending publishes may have been lost then.
+func (p *Publisher) closeConn(ctx context.Context) error {
+	if !p.config.OwnsConnection {
+		return nil
+	}
+
+	if !p.config.DrainOnClose {
+		p.conn.Close()
+		return nil
+	}
+
+	if err := p.conn.Drain(); err != nil {
+		p.logger.Error("Cannot drain connection", err, nil)
+		p.conn.Close()
+		return errors.Wrap(err, "cannot drain connection")
+	}
+
+	// draining completes asynchronously
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for !p.conn.IsClosed() {
+		select {
+		case <-ctx.Done():
+			p.logger.Error("Connection not drained in time", ctx.Err(), nil)
+			p.conn.Close()
+			return errors.Wrap(ctx.Err(), "connection not drained in time")
+		case <-ticker.C:
+		}
+	}
 
 	return nil
 }
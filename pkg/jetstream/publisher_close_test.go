@@ -0,0 +1,81 @@
+package jetstream_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-jetstream/pkg/jetstream"
+	jetstreamtests "github.com/ThreeDotsLabs/watermill-jetstream/pkg/jetstream/tests"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublisher_CloseConnectionOwnership(t *testing.T) {
+	server := jetstreamtests.RunServer(t)
+
+	tests := []struct {
+		name       string
+		config     jetstream.PublisherPublishConfig
+		wantClosed bool
+	}{
+		{name: "caller owned", wantClosed: false},
+		{name: "owned", config: jetstream.PublisherPublishConfig{OwnsConnection: true}, wantClosed: true},
+		{name: "drained", config: jetstream.PublisherPublishConfig{OwnsConnection: true, DrainOnClose: true}, wantClosed: true},
+		{name: "caller owned drained", config: jetstream.PublisherPublishConfig{DrainOnClose: true}, wantClosed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := nats.Connect(server.URL)
+			require.NoError(t, err)
+			defer conn.Close()
+
+			tt.config.Marshaler = &jetstream.GobMarshaler{}
+			pub, err := jetstream.NewPublisherWithNatsConn(conn, tt.config, watermill.NopLogger{})
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			report, err := pub.CloseWithContext(ctx)
+			require.NoError(t, err)
+			require.True(t, report.Flushed)
+			require.Equal(t, tt.wantClosed, conn.IsClosed())
+		})
+	}
+}
+
+func TestPublisher_CloseDrainTimeout(t *testing.T) {
+	server := jetstreamtests.RunServer(t)
+
+	conn, err := nats.Connect(server.URL)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// a subscription whose handler is still running keeps the connection from draining
+	release := make(chan struct{})
+	defer close(release)
+	received := make(chan struct{})
+	_, err = conn.Subscribe("blocking", func(*nats.Msg) {
+		close(received)
+		<-release
+	})
+	require.NoError(t, err)
+	require.NoError(t, conn.Publish("blocking", nil))
+	<-received
+
+	pub, err := jetstream.NewPublisherWithNatsConn(conn, jetstream.PublisherPublishConfig{
+		Marshaler:      &jetstream.GobMarshaler{},
+		OwnsConnection: true,
+		DrainOnClose:   true,
+		CloseTimeout:   100 * time.Millisecond,
+	}, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	err = pub.Close()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "connection not drained in time")
+	require.True(t, conn.IsClosed())
+}
@@ -2,7 +2,11 @@ package jetstream
 
 import (
 	"testing"
+	"time"
 
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
 	"github.com/stretchr/testify/require"
 )
 
@@ -32,3 +36,129 @@ func TestPublisherConfig_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestPublisherPublishConfig_Validate(t *testing.T) {
+	c := PublisherPublishConfig{
+		Marshaler:              &GobMarshaler{},
+		PublishRetry:           FixedRetryPolicy{Delay: -time.Second},
+		UnavailableGracePeriod: -time.Second,
+		DuplicateWindow:        -time.Second,
+		CloseTimeout:           -time.Second,
+		Partitioning:           PartitionConfig{Count: 2},
+		SubjectKeyMetadata:     "key",
+	}
+	c.setDefaults()
+
+	err := c.Validate()
+	var errs ConfigErrors
+	require.ErrorAs(t, err, &errs)
+
+	fields := make([]string, len(errs))
+	for i, fieldErr := range errs {
+		fields[i] = fieldErr.Field
+	}
+	require.ElementsMatch(t, []string{
+		"PublisherConfig.DuplicateWindow",
+		"PublisherConfig.PublishRetry",
+		"PublisherConfig.CloseTimeout",
+		"PublisherConfig.UnavailableGracePeriod",
+		"PublisherConfig.SubjectKeyMetadata",
+	}, fields)
+
+	// the connection is not used when the configuration is invalid
+	_, err = NewPublisherWithNatsConn(&nats.Conn{}, c, nil)
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs, 5)
+}
+
+func TestPublisherPublishConfig_ExactlyOnce(t *testing.T) {
+	c := PublisherPublishConfig{ExactlyOnce: true}
+	c.setDefaults()
+
+	require.True(t, c.TrackMsgId)
+	require.Equal(t, defaultDuplicateWindow, c.DuplicateWindow)
+
+	c = PublisherPublishConfig{ExactlyOnce: true, DuplicateWindow: time.Hour}
+	c.setDefaults()
+
+	require.Equal(t, time.Hour, c.DuplicateWindow)
+
+	c = PublisherPublishConfig{}
+	c.setDefaults()
+
+	require.False(t, c.TrackMsgId)
+	require.Zero(t, c.DuplicateWindow)
+	require.Equal(t, defaultFlushTimeout, c.CloseTimeout)
+}
+
+func TestPublisherPublishConfig_LogFields(t *testing.T) {
+	require.Empty(t, PublisherPublishConfig{}.logFields())
+
+	config := PublisherConfig{
+		Name:      "orders",
+		LogFields: watermill.LogFields{"component": "checkout"},
+	}.GetPublisherPublishConfig()
+
+	require.Equal(t, watermill.LogFields{
+		"publisher_name": "orders",
+		"component":      "checkout",
+	}, config.logFields())
+
+	// the configured fields are not modified
+	require.Equal(t, watermill.LogFields{"component": "checkout"}, config.LogFields)
+}
+
+func TestPublisher_HeaderFunc(t *testing.T) {
+	js := &faultyJetStream{}
+	p := &Publisher{
+		config: PublisherPublishConfig{
+			Marshaler: &NATSMarshaler{},
+			HeaderFunc: func(topic string, msg *message.Message) nats.Header {
+				if msg.Metadata.Get("skip") != "" {
+					return nil
+				}
+				return nats.Header{"Routing-Hint": []string{topic + "/" + msg.UUID}}
+			},
+		},
+		logger: watermill.NopLogger{},
+	}
+	p.decorateClient(clientDecorator{
+		jetStream: func(nats.JetStream) nats.JetStream { return js },
+	})
+
+	msg := message.NewMessage(watermill.NewUUID(), nil)
+	skipped := message.NewMessage(watermill.NewUUID(), nil)
+	skipped.Metadata.Set("skip", "true")
+	require.NoError(t, p.Publish("orders", msg, skipped))
+	require.Len(t, js.published, 2)
+
+	require.Equal(t, "orders/"+msg.UUID, js.published[0].Header.Get("Routing-Hint"))
+	require.Equal(t, msg.UUID, js.published[0].Header.Get(WatermillUUIDHdr))
+	require.Empty(t, js.published[1].Header.Get("Routing-Hint"))
+}
+
+// unackedJetStream has asynchronous publishes which are never acked.
+type unackedJetStream struct {
+	nats.JetStream
+}
+
+func (unackedJetStream) PublishAsyncPending() int {
+	return 1
+}
+
+func (unackedJetStream) PublishAsyncComplete() <-chan struct{} {
+	return make(chan struct{})
+}
+
+func TestPublisher_CloseFlushError(t *testing.T) {
+	p := &Publisher{
+		conn:   &nats.Conn{},
+		js:     unackedJetStream{},
+		config: PublisherPublishConfig{DrainOnClose: true, CloseTimeout: time.Millisecond},
+		logger: watermill.NopLogger{},
+	}
+
+	err := p.Close()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "1 asynchronous publishes not acked")
+}
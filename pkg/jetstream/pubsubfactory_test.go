@@ -1,14 +1,12 @@
 package jetstream_test
 
 import (
-	"os"
-	"strings"
 	"testing"
 	"time"
 
 	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill-jetstream/pkg/jetstream"
-	"github.com/ThreeDotsLabs/watermill-jetstream/pkg/jetstream/wmpb"
+	jetstreamtests "github.com/ThreeDotsLabs/watermill-jetstream/pkg/jetstream/tests"
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/ThreeDotsLabs/watermill/pubsub/tests"
 	"github.com/nats-io/nats.go"
@@ -16,113 +14,90 @@ import (
 )
 
 func getTestFeatures() tests.Features {
-	return tests.Features{
-		ConsumerGroups:                      true,
-		ExactlyOnceDelivery:                 false,
-		GuaranteedOrder:                     true,
-		GuaranteedOrderWithSingleSubscriber: true,
-		Persistent:                          true,
-		RequireSingleInstance:               false,
-		NewSubscriberReceivesOldMessages:    true,
-	}
+	return jetstreamtests.Features()
 }
 
-func newPubSub(t *testing.T, clientID string, queueName string, exactlyOnce bool) (message.Publisher, message.Subscriber) {
-	trace := os.Getenv("WATERMILL_TEST_NATS_TRACE")
-	debug := os.Getenv("WATERMILL_TEST_NATS_DEBUG")
-
-	format := os.Getenv("WATERMILL_TEST_NATS_FORMAT")
-
-	var marshaler jetstream.MarshalerUnmarshaler
-
-	switch strings.ToLower(format) {
-	case "nats":
-		marshaler = &jetstream.NATSMarshaler{}
-	case "proto":
-		marshaler = &wmpb.NATSMarshaler{}
-	case "json":
-		marshaler = &jetstream.JSONMarshaler{}
-	default:
-		marshaler = &jetstream.GobMarshaler{}
-	}
-
-	logger := watermill.NewStdLogger(strings.ToLower(debug) == "true", strings.ToLower(trace) == "true")
-
-	natsURL := os.Getenv("WATERMILL_TEST_NATS_URL")
-	if natsURL == "" {
-		natsURL = nats.DefaultURL
-	}
+func createPubSub(t *testing.T) (message.Publisher, message.Subscriber) {
+	return jetstreamtests.ConfigFromEnv().NewPubSub(t, "")
+}
 
-	options := []nats.Option{
-		nats.RetryOnFailedConnect(true),
-		nats.Timeout(30 * time.Second),
-		nats.ReconnectWait(1 * time.Second),
-	}
+func createPubSubWithConsumerGroup(t *testing.T, consumerGroup string) (message.Publisher, message.Subscriber) {
+	return jetstreamtests.ConfigFromEnv().NewPubSub(t, consumerGroup)
+}
 
-	subscriberCount := 1
+//nolint:deadcode,unused
+func createPubSubWithExactlyOnce(t *testing.T) (message.Publisher, message.Subscriber) {
+	config := jetstreamtests.ConfigFromEnv()
+	config.ExactlyOnce = true
+	return config.NewPubSub(t, "")
+}
 
-	if queueName != "" {
-		subscriberCount = 2
-	}
+//nolint:deadcode,unused
+func createPubSubWithConsumerGroupWithExactlyOnce(t *testing.T, consumerGroup string) (message.Publisher, message.Subscriber) {
+	config := jetstreamtests.ConfigFromEnv()
+	config.ExactlyOnce = true
+	return config.NewPubSub(t, consumerGroup)
+}
 
-	subscribeOptions := []nats.SubOpt{
-		nats.DeliverAll(),
-		nats.AckExplicit(),
-	}
+// serverConn connects to a disposable server, the connection is closed when the test finishes.
+func serverConn(t *testing.T) (*nats.Conn, nats.JetStreamContext) {
+	server := jetstreamtests.RunServer(t)
 
-	c, err := nats.Connect(natsURL, options...)
+	conn, err := nats.Connect(server.URL)
 	require.NoError(t, err)
+	t.Cleanup(conn.Close)
 
-	defer c.Close()
+	js, err := conn.JetStream()
+	require.NoError(t, err)
 
-	jetstreamOptions := make([]nats.JSOpt, 0)
+	return conn, js
+}
 
-	_, err = c.JetStream()
+// serverPublisher creates a publisher provisioning its topics on conn.
+func serverPublisher(t *testing.T, conn *nats.Conn) *jetstream.Publisher {
+	pub, err := jetstream.NewPublisherWithNatsConn(conn, jetstream.PublisherPublishConfig{
+		Marshaler:     &jetstream.GobMarshaler{},
+		AutoProvision: true,
+	}, watermill.NopLogger{})
 	require.NoError(t, err)
 
-	pub, err := jetstream.NewPublisher(jetstream.PublisherConfig{
-		URL:              natsURL,
-		Marshaler:        marshaler,
-		NatsOptions:      options,
-		JetstreamOptions: jetstreamOptions,
-		AutoProvision:    true,
-		TrackMsgId:       exactlyOnce,
-	}, logger)
-	require.NoError(t, err)
+	return pub
+}
+
+// serverSubscriber creates a subscriber on conn receiving every message of the topics it subscribes to,
+// closed when the test finishes.
+func serverSubscriber(t *testing.T, conn *nats.Conn, config jetstream.SubscriberSubscriptionConfig) *jetstream.Subscriber {
+	config.Unmarshaler = &jetstream.GobMarshaler{}
+	config.AutoProvision = true
+	config.SubscribeOptions = append([]nats.SubOpt{nats.DeliverAll(), nats.AckExplicit()}, config.SubscribeOptions...)
+	if config.CloseTimeout == 0 {
+		config.CloseTimeout = time.Second
+	}
 
-	sub, err := jetstream.NewSubscriber(jetstream.SubscriberConfig{
-		URL:              natsURL,
-		QueueGroup:       queueName,
-		DurableName:      queueName,
-		SubscribersCount: subscriberCount, //multiple only works if a queue group specified
-		AckWaitTimeout:   30 * time.Second,
-		Unmarshaler:      marshaler,
-		NatsOptions:      options,
-		SubscribeOptions: subscribeOptions,
-		JetstreamOptions: jetstreamOptions,
-		CloseTimeout:     30 * time.Second,
-		AutoProvision:    false, // tests use SubscribeInitialize
-		AckSync:          exactlyOnce,
-	}, logger)
+	sub, err := jetstream.NewSubscriberWithNatsConn(conn, config, watermill.NopLogger{})
 	require.NoError(t, err)
+	t.Cleanup(func() { _ = sub.Close() })
 
-	return pub, sub
+	return sub
 }
 
-func createPubSub(t *testing.T) (message.Publisher, message.Subscriber) {
-	return newPubSub(t, watermill.NewUUID(), "", false)
+func streamMsgs(t *testing.T, js nats.JetStreamContext, stream string) uint64 {
+	info, err := js.StreamInfo(stream)
+	require.NoError(t, err)
+	return info.State.Msgs
 }
 
-func createPubSubWithConsumerGroup(t *testing.T, consumerGroup string) (message.Publisher, message.Subscriber) {
-	return newPubSub(t, watermill.NewUUID(), consumerGroup, false)
-}
+// streamMessages returns the messages stored in stream, unmarshaled with GobMarshaler.
+func streamMessages(t *testing.T, js nats.JetStreamContext, stream string) []*message.Message {
+	var messages []*message.Message
+	for seq := uint64(1); seq <= streamMsgs(t, js, stream); seq++ {
+		raw, err := js.GetMsg(stream, seq)
+		require.NoError(t, err)
 
-//nolint:deadcode,unused
-func createPubSubWithExactlyOnce(t *testing.T) (message.Publisher, message.Subscriber) {
-	return newPubSub(t, watermill.NewUUID(), "", true)
-}
+		msg, err := (&jetstream.GobMarshaler{}).Unmarshal(&nats.Msg{Subject: raw.Subject, Header: raw.Header, Data: raw.Data})
+		require.NoError(t, err)
+		messages = append(messages, msg)
+	}
 
-//nolint:deadcode,unused
-func createPubSubWithConsumerGroupWithExactlyOnce(t *testing.T, consumerGroup string) (message.Publisher, message.Subscriber) {
-	return newPubSub(t, watermill.NewUUID(), consumerGroup, true)
+	return messages
 }
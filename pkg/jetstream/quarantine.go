@@ -0,0 +1,81 @@
+package jetstream
+
+import (
+	"fmt"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+const (
+	// QuarantineErrorHdr is the NATS header holding why a quarantined message could not be read.
+	QuarantineErrorHdr = "Watermill-Quarantine-Error"
+
+	// QuarantineSubjectHdr is the NATS header holding the subject a quarantined message was received on.
+	QuarantineSubjectHdr = "Watermill-Quarantine-Subject"
+)
+
+// QuarantineTopicCalculator is a function used to calculate the quarantine topic of the given topic.
+type QuarantineTopicCalculator func(topic string) string
+
+// QuarantineConfig preserves malformed messages for inspection.
+//
+// When enabled, a message which can not be unmarshaled or fails a transformer (e.g. a schema upgrade) is republished
+// as received to the quarantine topic of its topic, with the error in QuarantineErrorHdr, and the original is terminated.
+// Otherwise such messages are left unacked and redelivered until MaxDeliver is reached.
+type QuarantineConfig struct {
+	Enabled bool
+
+	// TopicCalculator calculates the quarantine topic of a topic (defaults to "{topic}_quarantine").
+	// Quarantine topics must not be covered by the subjects of their topic, or quarantined messages would be
+	// delivered to its consumers again, which is the case of a "{topic}.quarantine" subject with the default subjects.
+	TopicCalculator QuarantineTopicCalculator
+}
+
+func (c *QuarantineConfig) setDefaults() {
+	if c.TopicCalculator == nil {
+		c.TopicCalculator = defaultQuarantineTopicCalculator
+	}
+}
+
+func defaultQuarantineTopicCalculator(topic string) string {
+	return fmt.Sprintf("%s_quarantine", topic)
+}
+
+// quarantine republishes a message which could not be read to the quarantine topic of topic and terminates it.
+// The message is left unacked when it could not be republished, so it is quarantined on redelivery.
+func (s *Subscriber) quarantine(topic string, m *nats.Msg, readErr error, logFields watermill.LogFields) {
+	quarantineTopic := s.config.Quarantine.TopicCalculator(topic)
+	logFields = logFields.Add(watermill.LogFields{"quarantine_topic": quarantineTopic})
+
+	if err := s.republish(quarantineTopic, m, nats.Header{
+		QuarantineErrorHdr:   []string{readErr.Error()},
+		QuarantineSubjectHdr: []string{m.Subject},
+	}); err != nil {
+		s.logger.Error("Cannot quarantine message", err, logFields)
+		return
+	}
+
+	if err := s.acker.Term(m); err != nil {
+		s.logger.Error("Cannot terminate quarantined message", err, logFields)
+		return
+	}
+
+	s.logger.Info("Message quarantined", logFields.Add(watermill.LogFields{"reason": readErr.Error()}))
+}
+
+// readFailed handles a message of topic which could not be unmarshaled or transformed.
+func (s *Subscriber) readFailed(topic string, m *nats.Msg, err error, logFields watermill.LogFields) {
+	s.logger.Error("Cannot read message", err, logFields)
+
+	var undecodable *UndecodableMessageError
+	if errors.As(err, &undecodable) {
+		s.undecodable(topic, m, err, logFields)
+		return
+	}
+
+	if s.config.Quarantine.Enabled {
+		s.quarantine(topic, m, err, logFields)
+	}
+}
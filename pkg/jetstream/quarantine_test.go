@@ -0,0 +1,75 @@
+package jetstream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriber_Quarantine(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      QuarantineConfig
+		publishErr  error
+		calls       []string
+		quarantined string
+	}{
+		{name: "disabled"},
+		{name: "default topic", config: QuarantineConfig{Enabled: true}, calls: []string{"term"}, quarantined: "orders_quarantine"},
+		{
+			name: "custom topic",
+			config: QuarantineConfig{
+				Enabled:         true,
+				TopicCalculator: func(topic string) string { return "quarantine_" + topic },
+			},
+			calls:       []string{"term"},
+			quarantined: "quarantine_orders",
+		},
+		{name: "publish failure", config: QuarantineConfig{Enabled: true}, publishErr: nats.ErrTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acker := &settlingAcker{}
+			js := &faultyJetStream{publishErr: tt.publishErr}
+			s := faultySubscriber(SubscriberSubscriptionConfig{Quarantine: tt.config}, clientDecorator{
+				jetStream: func(nats.JetStream) nats.JetStream { return js },
+				acker:     func(msgAcker) msgAcker { return acker },
+			})
+
+			output := make(chan *message.Message, 1)
+			malformed := &nats.Msg{
+				Subject: "orders.1",
+				Header:  nats.Header{"Custom": []string{"kept"}},
+				Data:    []byte("not gob"),
+			}
+
+			s.processMessage(&subscriptionHandler{
+				ctx:       context.Background(),
+				topic:     "orders",
+				output:    output,
+				logFields: watermill.LogFields{},
+			}, malformed)
+
+			require.Empty(t, output)
+			require.Equal(t, tt.calls, acker.calls)
+
+			if tt.quarantined == "" {
+				require.Empty(t, js.published)
+				return
+			}
+
+			require.Len(t, js.published, 1)
+			quarantined := js.published[0]
+			require.Regexp(t, "^"+tt.quarantined+`\.`, quarantined.Subject)
+			require.Equal(t, malformed.Data, quarantined.Data)
+			require.Equal(t, "kept", quarantined.Header.Get("Custom"))
+			require.Equal(t, "orders.1", quarantined.Header.Get(QuarantineSubjectHdr))
+			require.Contains(t, quarantined.Header.Get(QuarantineErrorHdr), "cannot unmarshal message")
+		})
+	}
+}
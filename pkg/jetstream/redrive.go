@@ -0,0 +1,136 @@
+package jetstream
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// poisonedTopicKey mirrors middleware.PoisonedTopicKey, the metadata key the watermill poison queue middleware
+// records the original topic in.
+const poisonedTopicKey = "topic_poisoned"
+
+// RedriveFilter decides whether a dead lettered message should be redriven.
+type RedriveFilter func(msg *message.Message) bool
+
+// Redrive replays all messages currently stored for dlqTopic to targetTopic, so operators can recover
+// after a bug fix without writing ad-hoc scripts.
+//
+// When targetTopic is empty the original topic recorded by the watermill poison queue middleware
+// (topic_poisoned metadata), or by DispositionDeadLetter (DeadLetterTopicHdr header), is used.  Messages are republished with "{uuid}.redrive.{dlq sequence}" as
+// Nats-Msg-Id: redriving twice within the target stream's duplicate window does not produce duplicates, while
+// the id of the original publish (see TrackMsgId) does not deduplicate the redriven message away.
+// Messages go through Publish, so they are transformed and routed to their tenant like any other publish.
+// A nil filter redrives every message.  Messages are left in the DLQ stream.
+//
+// The publisher's Marshaler must also implement Unmarshaler.  Redrive returns the number of messages redriven.
+func (p *Publisher) Redrive(ctx context.Context, dlqTopic, targetTopic string, filter RedriveFilter) (int, error) {
+	unmarshaler, ok := p.config.Marshaler.(Unmarshaler)
+	if !ok {
+		return 0, errors.New("PublisherConfig.Marshaler must implement Unmarshaler to redrive messages")
+	}
+
+	dlqTopic, err := sanitizeTopic(dlqTopic, p.config.TopicSanitizer, p.config.EscapeTopics, p.config.AutoProvision)
+	if err != nil {
+		return 0, err
+	}
+
+	sub, err := p.js.SubscribeSync(
+		p.topicInterpreter.subjects(dlqTopic).Primary,
+		nats.OrderedConsumer(),
+		nats.DeliverAll(),
+	)
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot subscribe to dlq topic")
+	}
+	defer func() {
+		if err := sub.Unsubscribe(); err != nil {
+			p.logger.Error("Cannot unsubscribe from dlq topic", err, watermill.LogFields{"topic": dlqTopic})
+		}
+	}()
+
+	info, err := sub.ConsumerInfo()
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot get dlq consumer info")
+	}
+
+	redriven := 0
+	pending := orderedPending(info)
+
+	for pending > 0 {
+		m, err := sub.NextMsgWithContext(ctx)
+		if err != nil {
+			return redriven, errors.Wrap(err, "cannot read dlq message")
+		}
+
+		meta, err := m.Metadata()
+		if err != nil {
+			return redriven, errors.Wrap(err, "cannot read dlq message metadata")
+		}
+		pending = meta.NumPending
+
+		msg, err := unmarshaler.Unmarshal(m)
+		if err != nil {
+			return redriven, errors.Wrap(err, "cannot unmarshal dlq message")
+		}
+
+		if filter != nil && !filter(msg) {
+			continue
+		}
+
+		target, err := redriveTarget(targetTopic, m, msg, p.config.EscapeTopics)
+		if err != nil {
+			return redriven, err
+		}
+
+		msgID := nats.MsgId(redriveMsgID(msg.UUID, meta.Sequence.Stream))
+		if err := p.publishWithOptions(target, []*message.Message{msg}, msgID); err != nil {
+			return redriven, errors.Wrapf(err, "cannot redrive message %s", msg.UUID)
+		}
+
+		redriven++
+	}
+
+	p.logger.Info("Redrive finished", watermill.LogFields{
+		"dlq_topic":    dlqTopic,
+		"target_topic": targetTopic,
+		"redriven":     redriven,
+	})
+
+	return redriven, nil
+}
+
+// redriveMsgID returns the Nats-Msg-Id of a message redriven from the dlq stream sequence seq.
+func redriveMsgID(uuid string, seq uint64) string {
+	return fmt.Sprintf("%s.redrive.%d", uuid, seq)
+}
+
+// redriveTarget returns the topic a dlq message is redriven to.  DeadLetterTopicHdr holds the topic after
+// EscapeTopic when the subscriber escaped topics, it is unescaped as Publish escapes it again.
+func redriveTarget(targetTopic string, m *nats.Msg, msg *message.Message, escaped bool) (string, error) {
+	if targetTopic != "" {
+		return targetTopic, nil
+	}
+
+	if original := msg.Metadata.Get(poisonedTopicKey); original != "" {
+		return original, nil
+	}
+
+	if m.Header != nil {
+		if original := m.Header.Get(DeadLetterTopicHdr); original != "" {
+			if escaped {
+				return UnescapeTopic(original)
+			}
+			return original, nil
+		}
+	}
+
+	return "", errors.Errorf(
+		"no target topic provided and message %s has no %s metadata nor %s header",
+		msg.UUID, poisonedTopicKey, DeadLetterTopicHdr,
+	)
+}
@@ -0,0 +1,139 @@
+package jetstream_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-jetstream/pkg/jetstream"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublisher_RedriveTrackedMessage(t *testing.T) {
+	conn, js := serverConn(t)
+
+	pub, err := jetstream.NewPublisherWithNatsConn(conn, jetstream.PublisherPublishConfig{
+		Marshaler:     &jetstream.GobMarshaler{},
+		AutoProvision: true,
+		TrackMsgId:    true,
+	}, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	msg := message.NewMessage(watermill.NewUUID(), []byte("payload"))
+	require.NoError(t, pub.Publish("orders", msg))
+	require.NoError(t, pub.Publish("orders_dlq", msg))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// the id of the original publish does not deduplicate the redriven message away
+	redriven, err := pub.Redrive(ctx, "orders_dlq", "orders", nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, redriven)
+	require.Equal(t, uint64(2), streamMsgs(t, js, "orders"))
+
+	// redriving the same dlq message again is deduplicated
+	redriven, err = pub.Redrive(ctx, "orders_dlq", "orders", nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, redriven)
+	require.Equal(t, uint64(2), streamMsgs(t, js, "orders"))
+}
+
+func TestPublisher_RedriveDeadLetteredMessage(t *testing.T) {
+	conn, js := serverConn(t)
+	marshaler := &jetstream.GobMarshaler{}
+
+	pub, err := jetstream.NewPublisherWithNatsConn(conn, jetstream.PublisherPublishConfig{
+		Marshaler:     marshaler,
+		AutoProvision: true,
+	}, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	sub, err := jetstream.NewSubscriber(jetstream.SubscriberConfig{
+		URL:              conn.ConnectedUrl(),
+		Unmarshaler:      marshaler,
+		AutoProvision:    true,
+		SubscribeOptions: []nats.SubOpt{nats.DeliverAll(), nats.AckExplicit()},
+		CloseTimeout:     time.Second,
+		Disposition: jetstream.DispositionConfig{
+			Classifier: func(msg *message.Message, acked bool) jetstream.Decision {
+				return jetstream.Decision{Disposition: jetstream.DispositionDeadLetter, Reason: "poisoned"}
+			},
+		},
+	}, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	messages, err := sub.Subscribe(ctx, "orders")
+	require.NoError(t, err)
+
+	msg := message.NewMessage(watermill.NewUUID(), []byte("payload"))
+	require.NoError(t, pub.Publish("orders", msg))
+
+	select {
+	case received := <-messages:
+		received.Nack()
+	case <-ctx.Done():
+		t.Fatal("message not received")
+	}
+
+	require.Eventually(t, func() bool {
+		info, err := js.StreamInfo("orders_dlq")
+		return err == nil && info.State.Msgs == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, sub.Close())
+
+	// the dead lettered message is redriven to the topic it was received on
+	redriven, err := pub.Redrive(ctx, "orders_dlq", "", nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, redriven)
+	require.Equal(t, uint64(2), streamMsgs(t, js, "orders"))
+
+	raw, err := js.GetMsg("orders", 2)
+	require.NoError(t, err)
+	redrivenMsg, err := marshaler.Unmarshal(&nats.Msg{Subject: raw.Subject, Header: raw.Header, Data: raw.Data})
+	require.NoError(t, err)
+	require.Equal(t, msg.UUID, redrivenMsg.UUID)
+	require.Equal(t, msg.Payload, redrivenMsg.Payload)
+}
+
+func TestPublisher_RedriveThroughPublish(t *testing.T) {
+	conn, js := serverConn(t)
+
+	pub, err := jetstream.NewPublisherWithNatsConn(conn, jetstream.PublisherPublishConfig{
+		Marshaler:      &jetstream.GobMarshaler{},
+		AutoProvision:  true,
+		TopicSanitizer: func(topic string) string { return strings.TrimPrefix(topic, "/") },
+		Transformers: jetstream.Transformers{
+			Topics: map[string][]jetstream.MessageTransformer{
+				"orders": {func(topic string, msg *message.Message) error {
+					msg.Metadata.Set("schema", "v2")
+					return nil
+				}},
+			},
+		},
+	}, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	msg := message.NewMessage(watermill.NewUUID(), []byte("payload"))
+	require.NoError(t, pub.Publish("/orders_dlq", msg))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// topics are sanitized and the transformers of the target topic are applied
+	redriven, err := pub.Redrive(ctx, "/orders_dlq", "/orders", nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, redriven)
+
+	messages := streamMessages(t, js, "orders")
+	require.Len(t, messages, 1)
+	require.Equal(t, msg.UUID, messages[0].UUID)
+	require.Equal(t, "v2", messages[0].Metadata.Get("schema"))
+}
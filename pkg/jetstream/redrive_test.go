@@ -0,0 +1,50 @@
+package jetstream
+
+import (
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedriveTarget(t *testing.T) {
+	tests := []struct {
+		name            string
+		targetTopic     string
+		poisonedTopic   string
+		deadLetterTopic string
+		escaped         bool
+		want            string
+		wantErr         bool
+	}{
+		{name: "Explicit Target", targetTopic: "target", poisonedTopic: "original", want: "target"},
+		{name: "Poisoned Topic", poisonedTopic: "original", want: "original"},
+		{name: "Dead Letter Topic", deadLetterTopic: "original", want: "original"},
+		{name: "Escaped Dead Letter Topic", deadLetterTopic: "orders%2Aeu", escaped: true, want: "orders*eu"},
+		{name: "Poisoned Topic Before Dead Letter Topic", poisonedTopic: "poisoned", deadLetterTopic: "dead", want: "poisoned"},
+		{name: "Invalid - No Target", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := message.NewMessage("uuid", nil)
+			if tt.poisonedTopic != "" {
+				msg.Metadata.Set(poisonedTopicKey, tt.poisonedTopic)
+			}
+
+			m := nats.NewMsg("subject")
+			if tt.deadLetterTopic != "" {
+				m.Header.Set(DeadLetterTopicHdr, tt.deadLetterTopic)
+			}
+
+			got, err := redriveTarget(tt.targetTopic, m, msg, tt.escaped)
+
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
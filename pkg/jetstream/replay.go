@@ -0,0 +1,145 @@
+package jetstream
+
+import (
+	"context"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// Replay delivers the messages of topic between from and to (both inclusive) through a temporary ordered consumer,
+// closing the channel once to is reached, e.g. for rebuilding projections.
+// A zero to replays up to the last message stored when Replay is called.
+//
+// Messages are delivered one at a time, a nacked message is delivered again.
+// The replay does not affect any durable consumer state.
+func (s *Subscriber) Replay(ctx context.Context, topic string, from, to StreamPosition) (<-chan *message.Message, error) {
+	ctx = withTopic(ctx, topic)
+
+	logFields := subscriptionLogFields(ctx, watermill.LogFields{
+		"topic":  topic,
+		"replay": true,
+	})
+
+	sub, pending, err := s.orderedSubscription(topic, from)
+	if err != nil {
+		return nil, err
+	}
+
+	output := make(chan *message.Message)
+
+	s.outputsWg.Add(1)
+	go func() {
+		defer s.outputsWg.Done()
+		defer close(output)
+		defer func() {
+			if err := sub.Unsubscribe(); err != nil {
+				s.logger.Error("Cannot unsubscribe", err, logFields)
+			}
+		}()
+
+		s.logger.Debug("Starting replay", logFields)
+		defer s.logger.Debug("Replay finished", logFields)
+
+		for pending > 0 {
+			m, err := sub.NextMsgWithContext(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					s.logger.Error("Cannot read replayed message", err, logFields)
+				}
+				return
+			}
+
+			meta, err := m.Metadata()
+			if err != nil {
+				s.logger.Error("Cannot read replayed message metadata", err, logFields)
+				return
+			}
+			pending = meta.NumPending
+
+			if to.passedBy(meta) {
+				return
+			}
+
+			if !s.deliverUntilAcked(ctx, m, output, logFields, nil) {
+				return
+			}
+		}
+	}()
+
+	return output, nil
+}
+
+// orderedSubscription creates a temporary ordered consumer on topic starting at from,
+// returning the number of messages pending at creation time.
+func (s *Subscriber) orderedSubscription(topic string, from StreamPosition) (*nats.Subscription, uint64, error) {
+	sub, err := s.js.SubscribeSync(
+		s.topicInterpreter.subjects(topic).Primary,
+		nats.OrderedConsumer(),
+		from.startOption(),
+	)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "cannot create ordered consumer")
+	}
+
+	info, err := sub.ConsumerInfo()
+	if err != nil {
+		_ = sub.Unsubscribe()
+		return nil, 0, errors.Wrap(err, "cannot get ordered consumer info")
+	}
+
+	return sub, orderedPending(info), nil
+}
+
+// orderedPending returns the number of messages of an ordered consumer pending at creation time from its info,
+// counting the messages the server already delivered when the info was read.
+func orderedPending(info *nats.ConsumerInfo) uint64 {
+	return info.NumPending + info.Delivered.Consumer
+}
+
+// deliverUntilAcked sends the message to output until it is acked, returning false when delivery was interrupted.
+// annotate, when set, is applied to every delivered message.
+func (s *Subscriber) deliverUntilAcked(
+	ctx context.Context,
+	m *nats.Msg,
+	output chan *message.Message,
+	logFields watermill.LogFields,
+	annotate func(*message.Message),
+) bool {
+	for {
+		msg, err := s.config.Unmarshaler.Unmarshal(m)
+		if err != nil {
+			s.logger.Error("Cannot unmarshal message", err, logFields)
+			return true
+		}
+		msg.SetContext(WithNatsMsg(ctx, m))
+		if annotate != nil {
+			annotate(msg)
+		}
+
+		messageLogFields := logFields.Add(watermill.LogFields{"message_uuid": msg.UUID})
+
+		select {
+		case output <- msg:
+			s.logger.Trace("Message sent to consumer", messageLogFields)
+		case <-s.closing:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+
+		select {
+		case <-msg.Acked():
+			s.logger.Trace("Message Acked", messageLogFields)
+			return true
+		case <-msg.Nacked():
+			s.logger.Trace("Message Nacked, delivering again", messageLogFields)
+		case <-s.closing:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package jetstream_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-jetstream/pkg/jetstream"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriber_Replay(t *testing.T) {
+	conn, _ := serverConn(t)
+	pub := serverPublisher(t, conn)
+	sub := serverSubscriber(t, conn, jetstream.SubscriberSubscriptionConfig{})
+
+	var published []string
+	publish := func(n int) {
+		for i := 0; i < n; i++ {
+			msg := message.NewMessage(watermill.NewUUID(), []byte("payload"))
+			require.NoError(t, pub.Publish("orders", msg))
+			published = append(published, msg.UUID)
+		}
+	}
+
+	publish(3)
+	time.Sleep(100 * time.Millisecond)
+	between := time.Now()
+	time.Sleep(100 * time.Millisecond)
+	publish(3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	t.Run("Start Sequence", func(t *testing.T) {
+		messages, err := sub.Replay(ctx, "orders", jetstream.AtSequence(2), jetstream.AtSequence(4))
+		require.NoError(t, err)
+		require.Equal(t, published[1:4], replayed(t, messages, false))
+	})
+
+	t.Run("Start Time", func(t *testing.T) {
+		messages, err := sub.Replay(ctx, "orders", jetstream.AtTime(between), jetstream.StreamPosition{})
+		require.NoError(t, err)
+		require.Equal(t, published[3:], replayed(t, messages, false))
+	})
+
+	t.Run("Nacked Delivered Again", func(t *testing.T) {
+		messages, err := sub.Replay(ctx, "orders", jetstream.StreamPosition{}, jetstream.AtTime(between))
+		require.NoError(t, err)
+		require.Equal(t, published[:3], replayed(t, messages, true))
+	})
+}
+
+// replayed returns the UUIDs of the messages of a replay until its channel is closed, acking them.
+// With nackFirst, every message is nacked once and only counted when it is delivered again.
+func replayed(t *testing.T, messages <-chan *message.Message, nackFirst bool) []string {
+	var uuids []string
+	nacked := map[string]bool{}
+
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				return uuids
+			}
+			if nackFirst && !nacked[msg.UUID] {
+				nacked[msg.UUID] = true
+				msg.Nack()
+				continue
+			}
+			uuids = append(uuids, msg.UUID)
+			msg.Ack()
+		case <-time.After(10 * time.Second):
+			t.Fatal("replay did not finish")
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package jetstream
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+const (
+	// RepublishedStreamMetadataKey is the metadata key holding the stream a message republished with Republish
+	// was received from.
+	RepublishedStreamMetadataKey = "republished_stream"
+
+	// RepublishedSequenceMetadataKey is the metadata key holding the stream sequence a message republished with
+	// Republish was received with.
+	RepublishedSequenceMetadataKey = "republished_sequence"
+
+	// RepublishedSubjectMetadataKey is the metadata key holding the subject a message republished with Republish
+	// was received on.
+	RepublishedSubjectMetadataKey = "republished_subject"
+)
+
+// Republish publishes msg, received from a Subscriber, to targetTopic keeping its identity, for routing and
+// forwarding services: the UUID, payload and metadata (the headers set by the original publisher) are kept,
+// and the Nats-Msg-Id of the received message (its UUID when it has none) is sent again, so a message republished
+// twice within the duplicate window of the target stream is stored once.
+//
+// The stream, sequence and subject msg was received with are recorded as RepublishedStreamMetadataKey,
+// RepublishedSequenceMetadataKey and RepublishedSubjectMetadataKey, messages not received from JetStream are
+// republished without them.  msg itself is not modified.
+func (p *Publisher) Republish(ctx context.Context, msg *message.Message, targetTopic string) error {
+	topic, err := sanitizeTopic(targetTopic, p.config.TopicSanitizer, p.config.EscapeTopics, p.config.AutoProvision)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	republished := msg.Copy()
+	msgId := msg.UUID
+
+	if m, ok := NatsMsgFromCtx(msg.Context()); ok {
+		if id := m.Header.Get(nats.MsgIdHdr); id != "" {
+			msgId = id
+		}
+		republished.Metadata.Set(RepublishedSubjectMetadataKey, m.Subject)
+
+		if meta, err := m.Metadata(); err == nil {
+			republished.Metadata.Set(RepublishedStreamMetadataKey, meta.Stream)
+			republished.Metadata.Set(RepublishedSequenceMetadataKey, strconv.FormatUint(meta.Sequence.Stream, 10))
+		}
+	}
+
+	if p.config.AutoProvision {
+		if err := p.topicInterpreter.ensureStream(topic); err != nil {
+			return err
+		}
+	}
+
+	if err := p.publishMessage(topic, republished, nats.MsgId(msgId), nats.Context(ctx)); err != nil {
+		return errors.Wrapf(err, "cannot republish message %s", msg.UUID)
+	}
+
+	return nil
+}
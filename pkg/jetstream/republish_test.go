@@ -0,0 +1,47 @@
+package jetstream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublisher_Republish(t *testing.T) {
+	js := &faultyJetStream{}
+	p := &Publisher{
+		config: PublisherPublishConfig{Marshaler: &NATSMarshaler{}},
+		logger: watermill.NopLogger{},
+	}
+	p.decorateClient(clientDecorator{
+		jetStream: func(nats.JetStream) nats.JetStream { return js },
+	})
+
+	msg := message.NewMessage("uuid", []byte("payload"))
+	msg.Metadata.Set("origin", "billing")
+	msg.SetContext(WithNatsMsg(context.Background(), storedMsg(time.Now(), nats.Header{nats.MsgIdHdr: []string{"msg-id"}})))
+
+	require.NoError(t, p.Republish(context.Background(), msg, "forwarded"))
+	require.Len(t, js.published, 1)
+
+	republished, err := (&NATSMarshaler{}).Unmarshal(js.published[0])
+	require.NoError(t, err)
+	require.Equal(t, "uuid", republished.UUID)
+	require.Equal(t, []byte("payload"), []byte(republished.Payload))
+	require.Equal(t, "billing", republished.Metadata.Get("origin"))
+	require.Equal(t, "topic", republished.Metadata.Get(RepublishedStreamMetadataKey))
+	require.Equal(t, "10", republished.Metadata.Get(RepublishedSequenceMetadataKey))
+	require.Equal(t, "topic.uuid", republished.Metadata.Get(RepublishedSubjectMetadataKey))
+	require.Equal(t, "forwarded.uuid", js.published[0].Subject)
+
+	require.Empty(t, msg.Metadata.Get(RepublishedStreamMetadataKey), "original message is not modified")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Error(t, p.Republish(ctx, msg, "forwarded"))
+	require.Len(t, js.published, 1)
+}
@@ -0,0 +1,307 @@
+package jetstream
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	watermillSync "github.com/ThreeDotsLabs/watermill/pubsub/sync"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// ReplySubjectMetadataKey is the metadata key holding the NATS reply subject of a request received by a Replier.
+const ReplySubjectMetadataKey = "_watermill_reply_subject"
+
+// RequesterConfig is the configuration to create a requester
+type RequesterConfig struct {
+	// Marshaler is used to marshal requests and unmarshal replies.
+	Marshaler MarshalerUnmarshaler
+
+	// Timeout is how long a request waits for its reply when ctx has no deadline (defaults to 30 seconds).
+	Timeout time.Duration
+}
+
+func (c *RequesterConfig) setDefaults() {
+	if c.Timeout <= 0 {
+		c.Timeout = time.Second * 30
+	}
+}
+
+// Validate ensures configuration is valid before use
+func (c RequesterConfig) Validate() error {
+	if c.Marshaler == nil {
+		return errors.New("RequesterConfig.Marshaler is missing")
+	}
+
+	return nil
+}
+
+// Requester sends watermill messages as core NATS requests to a Replier and waits for their reply,
+// for RPC style calls next to the events kept on JetStream.
+type Requester struct {
+	conn   *nats.Conn
+	config RequesterConfig
+	logger watermill.LoggerAdapter
+}
+
+// NewRequester creates a new Requester with the provided nats connection.
+func NewRequester(conn *nats.Conn, config RequesterConfig, logger watermill.LoggerAdapter) (*Requester, error) {
+	config.setDefaults()
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	return &Requester{
+		conn:   conn,
+		config: config,
+		logger: logger,
+	}, nil
+}
+
+// Request sends msg to topic and returns the reply.
+func (r *Requester) Request(ctx context.Context, topic string, msg *message.Message) (*message.Message, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.config.Timeout)
+		defer cancel()
+	}
+
+	logFields := watermill.LogFields{
+		"message_uuid": msg.UUID,
+		"topic_name":   topic,
+	}
+
+	r.logger.Trace("Sending request", logFields)
+
+	natsMsg, err := r.config.Marshaler.Marshal(topic, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	replyMsg, err := r.conn.RequestMsgWithContext(ctx, natsMsg)
+	if err != nil {
+		return nil, errors.Wrap(err, "request failed")
+	}
+
+	reply, err := r.config.Marshaler.Unmarshal(replyMsg)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot unmarshal reply")
+	}
+
+	r.logger.Trace("Reply received", logFields.Add(watermill.LogFields{"reply_uuid": reply.UUID}))
+
+	return reply, nil
+}
+
+// ReplierConfig is the configuration to create a replier
+type ReplierConfig struct {
+	// Marshaler is used to unmarshal requests and marshal replies.
+	Marshaler MarshalerUnmarshaler
+
+	// QueueGroup spreads requests over all repliers sharing it, otherwise every replier receives every request.
+	QueueGroup string
+
+	// SubjectCalculator is a function used to transform a topic to the subscribed subject (defaults to "{topic}.*")
+	SubjectCalculator SubjectCalculator
+
+	// AckWaitTimeout is how long a request waits for Ack/Nack before the next one is handled (defaults to 30 seconds).
+	AckWaitTimeout time.Duration
+
+	// CloseTimeout determines how long replier will wait for Ack/Nack on close (defaults to 30 seconds).
+	CloseTimeout time.Duration
+
+	// Clock is the source of time of AckWaitTimeout (defaults to RealClock), see Clock.
+	Clock Clock
+}
+
+func (c *ReplierConfig) setDefaults() {
+	if c.SubjectCalculator == nil {
+		c.SubjectCalculator = defaultSubjectCalculator
+	}
+	if c.AckWaitTimeout <= 0 {
+		c.AckWaitTimeout = time.Second * 30
+	}
+	if c.CloseTimeout <= 0 {
+		c.CloseTimeout = time.Second * 30
+	}
+	if c.Clock == nil {
+		c.Clock = RealClock{}
+	}
+}
+
+// Validate ensures configuration is valid before use
+func (c ReplierConfig) Validate() error {
+	if c.Marshaler == nil {
+		return errors.New("ReplierConfig.Marshaler is missing")
+	}
+
+	return nil
+}
+
+// Replier receives the requests of a Requester over core NATS as watermill messages.
+//
+// The reply subject of a request is available from its context (ReplySubjectFromCtx) and metadata
+// (ReplySubjectMetadataKey), Reply publishes a response to it.  Requests are not persisted, a request
+// arriving while no replier is subscribed fails with no responders.
+type Replier struct {
+	conn   *nats.Conn
+	config ReplierConfig
+	logger watermill.LoggerAdapter
+
+	closedLock sync.Mutex
+	closed     bool
+	closing    chan struct{}
+	outputsWg  sync.WaitGroup
+}
+
+// NewReplier creates a new Replier with the provided nats connection.
+func NewReplier(conn *nats.Conn, config ReplierConfig, logger watermill.LoggerAdapter) (*Replier, error) {
+	config.setDefaults()
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	return &Replier{
+		conn:    conn,
+		config:  config,
+		logger:  logger,
+		closing: make(chan struct{}),
+	}, nil
+}
+
+// Subscribe subscribes to the requests sent to topic.
+func (r *Replier) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	logFields := watermill.LogFields{"topic": topic}
+
+	requests := make(chan *nats.Msg, 1)
+
+	sub, err := r.conn.ChanQueueSubscribe(r.config.SubjectCalculator(topic).Primary, r.config.QueueGroup, requests)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot subscribe")
+	}
+
+	output := make(chan *message.Message)
+
+	r.outputsWg.Add(1)
+	go func() {
+		defer r.outputsWg.Done()
+		defer close(output)
+		defer func() {
+			if err := sub.Unsubscribe(); err != nil {
+				r.logger.Error("Cannot unsubscribe", err, logFields)
+			}
+		}()
+
+		for {
+			select {
+			case m := <-requests:
+				r.processRequest(ctx, m, output, logFields)
+			case <-r.closing:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return output, nil
+}
+
+func (r *Replier) processRequest(ctx context.Context, m *nats.Msg, output chan *message.Message, logFields watermill.LogFields) {
+	msg, err := r.config.Marshaler.Unmarshal(m)
+	if err != nil {
+		r.logger.Error("Cannot unmarshal request", err, logFields)
+		return
+	}
+
+	if m.Reply != "" {
+		msg.Metadata.Set(ReplySubjectMetadataKey, m.Reply)
+	}
+
+	ctx, cancelCtx := context.WithCancel(withReplySubject(ctx, m.Reply))
+	msg.SetContext(ctx)
+	defer cancelCtx()
+
+	messageLogFields := logFields.Add(watermill.LogFields{"message_uuid": msg.UUID})
+
+	select {
+	case output <- msg:
+		r.logger.Trace("Request sent to consumer", messageLogFields)
+	case <-r.closing:
+		return
+	case <-ctx.Done():
+		return
+	}
+
+	ackTimeout, stopAckTimeout := after(r.config.Clock, r.config.AckWaitTimeout)
+	defer stopAckTimeout()
+
+	select {
+	case <-msg.Acked():
+		r.logger.Trace("Request Acked", messageLogFields)
+	case <-msg.Nacked():
+		r.logger.Trace("Request Nacked", messageLogFields)
+	case <-ackTimeout:
+		r.logger.Trace("Ack timeout", messageLogFields)
+	case <-r.closing:
+	case <-ctx.Done():
+	}
+}
+
+// Reply publishes response to the reply subject of request.
+func (r *Replier) Reply(request, response *message.Message) error {
+	reply, ok := ReplySubjectFromCtx(request.Context())
+	if !ok {
+		reply = request.Metadata.Get(ReplySubjectMetadataKey)
+	}
+	if reply == "" {
+		return errors.Errorf("message %s has no reply subject", request.UUID)
+	}
+
+	natsMsg, err := r.config.Marshaler.Marshal(reply, response)
+	if err != nil {
+		return err
+	}
+	natsMsg.Subject = reply
+
+	if err := r.conn.PublishMsg(natsMsg); err != nil {
+		return errors.Wrap(err, "cannot publish reply")
+	}
+
+	return nil
+}
+
+// Close stops all subscriptions.  It will attempt to wait for in-flight requests to complete.
+func (r *Replier) Close() error {
+	r.closedLock.Lock()
+	defer r.closedLock.Unlock()
+
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+
+	r.logger.Debug("Closing replier", nil)
+	defer r.logger.Info("Replier closed", nil)
+
+	close(r.closing)
+
+	if watermillSync.WaitGroupTimeout(&r.outputsWg, r.config.CloseTimeout) {
+		return errors.New("output wait group did not finish")
+	}
+
+	return nil
+}
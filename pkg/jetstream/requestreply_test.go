@@ -0,0 +1,31 @@
+package jetstream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplySubjectFromCtx(t *testing.T) {
+	_, ok := ReplySubjectFromCtx(withReplySubject(context.Background(), ""))
+	require.False(t, ok)
+
+	reply, ok := ReplySubjectFromCtx(withReplySubject(context.Background(), "_INBOX.abc"))
+	require.True(t, ok)
+	require.Equal(t, "_INBOX.abc", reply)
+}
+
+func TestReplier_ReplyWithoutReplySubject(t *testing.T) {
+	r, err := NewReplier(nil, ReplierConfig{Marshaler: &NATSMarshaler{}}, nil)
+	require.NoError(t, err)
+
+	err = r.Reply(message.NewMessage("request", nil), message.NewMessage("response", nil))
+	require.Error(t, err)
+}
+
+func TestRequesterConfig_Validate(t *testing.T) {
+	require.Error(t, RequesterConfig{}.Validate())
+	require.NoError(t, RequesterConfig{Marshaler: &NATSMarshaler{}}.Validate())
+}
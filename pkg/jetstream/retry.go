@@ -0,0 +1,251 @@
+package jetstream
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+const (
+	// RetryAttemptHdr is the NATS header holding the number of retry tiers a message went through.
+	RetryAttemptHdr = "Watermill-Retry-Attempt"
+
+	// RetrySubjectHdr is the NATS header holding the subject a retried message is routed back to.
+	RetrySubjectHdr = "Watermill-Retry-Subject"
+
+	// RetryAtHdr is the NATS header holding the time (RFC3339) a retried message is due to be routed back.
+	RetryAtHdr = "Watermill-Retry-At"
+)
+
+// RetryTopicCalculator is a function used to calculate the delay topic of a retry tier for the given topic.
+type RetryTopicCalculator func(topic string, delay time.Duration) string
+
+// RetryConfig configures tiered retries through delay streams.
+//
+// When enabled, a nacked message is republished into the delay topic of its next tier and acked,
+// instead of being nacked back to the consumer.  Subscriber.RouteRetries forwards messages from
+// the delay topics back to the main topic once their delay elapsed.  When all tiers are exhausted
+// the message is nacked as usual.
+//
+// Messages are republished in NATS wire format, so attempts are tracked in NATS headers (RetryAttemptHdr)
+// which are only visible as metadata when NATSMarshaler is used.
+type RetryConfig struct {
+	// Delays are the retry tiers, in order of use (e.g. 30s, 5m).
+	Delays []time.Duration
+
+	// TopicCalculator calculates the delay topic of a tier (defaults to "{topic}_retry_{delay in milliseconds}ms",
+	// e.g. "orders_retry_1500ms"), delay topics must be valid stream names when AutoProvision is enabled.
+	TopicCalculator RetryTopicCalculator
+}
+
+func (c *RetryConfig) setDefaults() {
+	if c.TopicCalculator == nil {
+		c.TopicCalculator = defaultRetryTopicCalculator
+	}
+}
+
+func (c RetryConfig) enabled() bool {
+	return len(c.Delays) > 0
+}
+
+// Validate ensures configuration is valid before use
+func (c RetryConfig) Validate() error {
+	for _, delay := range c.Delays {
+		if delay < time.Millisecond {
+			return errors.Errorf("RetryConfig.Delays must be at least a millisecond, got %s", delay)
+		}
+	}
+
+	return nil
+}
+
+// defaultRetryTopicCalculator names delay topics after whole milliseconds, a formatted duration (e.g. "1.5s")
+// would add a subject token and is not a valid stream name.
+func defaultRetryTopicCalculator(topic string, delay time.Duration) string {
+	return fmt.Sprintf("%s_retry_%dms", topic, delay.Milliseconds())
+}
+
+func retryAttempt(m *nats.Msg) int {
+	if m.Header == nil {
+		return 0
+	}
+
+	attempt, err := strconv.Atoi(m.Header.Get(RetryAttemptHdr))
+	if err != nil {
+		return 0
+	}
+
+	return attempt
+}
+
+// nextTier builds the message to publish into the next retry tier, returning false when all tiers are exhausted.
+// The subject of the message is left to the caller, it depends on the subject calculator of the tier topic.
+func (c RetryConfig) nextTier(topic string, m *nats.Msg, now time.Time) (string, *nats.Msg, bool) {
+	attempt := retryAttempt(m)
+	if attempt >= len(c.Delays) {
+		return "", nil, false
+	}
+
+	delay := c.Delays[attempt]
+	tierTopic := c.TopicCalculator(topic, delay)
+
+	header := copyHeader(m.Header)
+	header.Set(RetryAttemptHdr, strconv.Itoa(attempt+1))
+	header.Set(RetryAtHdr, now.Add(delay).Format(time.RFC3339Nano))
+	if header.Get(RetrySubjectHdr) == "" {
+		header.Set(RetrySubjectHdr, m.Subject)
+	}
+
+	return tierTopic, &nats.Msg{
+		Header: header,
+		Data:   m.Data,
+	}, true
+}
+
+// routeBack builds the message to publish back to the main topic.
+func routeBack(m *nats.Msg) *nats.Msg {
+	header := copyHeader(m.Header)
+
+	// a retried message would otherwise be dropped as a duplicate of the original
+	if id := header.Get(nats.MsgIdHdr); id != "" {
+		header.Set(nats.MsgIdHdr, fmt.Sprintf("%s.retry.%s", id, header.Get(RetryAttemptHdr)))
+	}
+
+	return &nats.Msg{
+		Subject: header.Get(RetrySubjectHdr),
+		Header:  header,
+		Data:    m.Data,
+	}
+}
+
+func retryDue(m *nats.Msg, now time.Time) time.Duration {
+	return dueIn(m, RetryAtHdr, now)
+}
+
+// dueIn returns how long it takes until the time (RFC3339) held by header hdr of m, 0 when it is missing.
+func dueIn(m *nats.Msg, hdr string, now time.Time) time.Duration {
+	at, err := time.Parse(time.RFC3339Nano, m.Header.Get(hdr))
+	if err != nil {
+		return 0
+	}
+
+	return at.Sub(now)
+}
+
+func copyHeader(hdr nats.Header) nats.Header {
+	header := make(nats.Header, len(hdr))
+	for k, v := range hdr {
+		header[k] = append([]string(nil), v...)
+	}
+	return header
+}
+
+// retry republishes a nacked message into its next retry tier and acks the original, returning false when
+// the message should be nacked instead.
+func (s *Subscriber) retry(topic string, m *nats.Msg, logFields watermill.LogFields) bool {
+	tierTopic, retryMsg, ok := s.config.Retry.nextTier(topic, m, s.now())
+	if !ok {
+		s.logger.Trace("Retry tiers exhausted", logFields)
+		return false
+	}
+
+	retryMsg.Subject = s.topicInterpreter.publishSubject(tierTopic, watermill.NewUUID())
+	logFields = logFields.Add(watermill.LogFields{"retry_topic": tierTopic})
+
+	if s.config.AutoProvision {
+		if err := s.topicInterpreter.ensureStream(tierTopic); err != nil {
+			s.logger.Error("Cannot provision retry topic", err, logFields)
+			return false
+		}
+	}
+
+	if _, err := s.js.PublishMsg(retryMsg); err != nil {
+		s.logger.Error("Cannot publish message to retry topic", err, logFields)
+		return false
+	}
+
+	if err := s.acker.Ack(m); err != nil {
+		s.logger.Error("Cannot send ack for retried message", err, logFields)
+	}
+
+	s.logger.Trace("Message sent to retry topic", logFields)
+
+	return true
+}
+
+// RouteRetries consumes the retry tier topics of topic and routes their messages back to the main topic
+// once their delay elapsed.  Messages which are not due yet are nacked with the remaining delay.
+// Routing stops when ctx is cancelled or the subscriber is closed.
+func (s *Subscriber) RouteRetries(ctx context.Context, topic string) error {
+	if !s.config.Retry.enabled() {
+		return errors.New("SubscriberConfig.Retry has no delays configured")
+	}
+
+	for _, delay := range s.config.Retry.Delays {
+		tierTopic := s.config.Retry.TopicCalculator(topic, delay)
+
+		logFields := watermill.LogFields{
+			"topic":       topic,
+			"retry_topic": tierTopic,
+		}
+
+		s.logger.Debug("Starting retry router", logFields)
+
+		sub, err := s.subscribe(tierTopic, func(m *nats.Msg) {
+			s.routeRetry(m, logFields)
+		})
+		if err != nil {
+			return errors.Wrap(err, "cannot subscribe to retry topic")
+		}
+
+		s.outputsWg.Add(1)
+		go func(sub *nats.Subscription, logFields watermill.LogFields) {
+			defer s.outputsWg.Done()
+			select {
+			case <-s.closing:
+			case <-ctx.Done():
+			}
+
+			if s.config.DurableName == "" {
+				if err := sub.Unsubscribe(); err != nil {
+					s.logger.Error("Cannot unsubscribe", err, logFields)
+				}
+			}
+		}(sub, logFields)
+	}
+
+	return nil
+}
+
+func (s *Subscriber) routeRetry(m *nats.Msg, logFields watermill.LogFields) {
+	if s.isClosed() {
+		return
+	}
+
+	if wait := retryDue(m, s.now()); wait > 0 {
+		if err := s.acker.NakWithDelay(m, wait); err != nil {
+			s.logger.Error("Cannot delay retried message", err, logFields)
+		}
+		return
+	}
+
+	if _, err := s.js.PublishMsg(routeBack(m)); err != nil {
+		s.logger.Error("Cannot route retried message back", err, logFields)
+		if err := s.acker.Nak(m); err != nil {
+			s.logger.Error("Cannot send nak", err, logFields)
+		}
+		return
+	}
+
+	if err := s.acker.Ack(m); err != nil {
+		s.logger.Error("Cannot send ack", err, logFields)
+		return
+	}
+
+	s.logger.Trace("Retried message routed back", logFields)
+}
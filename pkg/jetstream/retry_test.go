@@ -0,0 +1,91 @@
+package jetstream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryConfig_nextTier(t *testing.T) {
+	c := RetryConfig{Delays: []time.Duration{30 * time.Second, 5 * time.Minute}}
+	c.setDefaults()
+
+	now := time.Now()
+
+	original := &nats.Msg{
+		Subject: "topic.uuid",
+		Header:  nats.Header{nats.MsgIdHdr: []string{"uuid"}},
+		Data:    []byte("payload"),
+	}
+
+	tierTopic, first, ok := c.nextTier("topic", original, now)
+	require.True(t, ok)
+	require.Equal(t, "topic_retry_30000ms", tierTopic)
+	require.Equal(t, "1", first.Header.Get(RetryAttemptHdr))
+	require.Equal(t, "topic.uuid", first.Header.Get(RetrySubjectHdr))
+	require.Equal(t, 30*time.Second, retryDue(first, now))
+	require.Equal(t, original.Data, first.Data)
+	require.Empty(t, original.Header.Get(RetryAttemptHdr), "original header must not be modified")
+
+	first.Subject = "topic_retry_30000ms.other"
+
+	tierTopic, second, ok := c.nextTier("topic", first, now)
+	require.True(t, ok)
+	require.Equal(t, "topic_retry_300000ms", tierTopic)
+	require.Equal(t, "2", second.Header.Get(RetryAttemptHdr))
+	require.Equal(t, "topic.uuid", second.Header.Get(RetrySubjectHdr))
+
+	_, _, ok = c.nextTier("topic", second, now)
+	require.False(t, ok)
+}
+
+func TestSubscriber_RetrySubjectCalculator(t *testing.T) {
+	js := &faultyJetStream{}
+	s := faultySubscriber(SubscriberSubscriptionConfig{
+		Retry: RetryConfig{Delays: []time.Duration{time.Second}},
+		SubjectCalculator: func(topic string) *Subjects {
+			return &Subjects{Primary: "events." + topic + ".>"}
+		},
+	}, clientDecorator{
+		jetStream: func(nats.JetStream) nats.JetStream { return js },
+		acker:     func(msgAcker) msgAcker { return nopAcker{} },
+	})
+
+	original := &nats.Msg{Subject: "events.topic.uuid", Data: []byte("payload")}
+	require.True(t, s.retry("topic", original, watermill.LogFields{}))
+
+	// the retry tier is published to a subject of its stream as calculated for the tier topic
+	require.Len(t, js.published, 1)
+	require.Regexp(t, `^events\.topic_retry_1000ms\.[^.]+$`, js.published[0].Subject)
+	require.Equal(t, "events.topic.uuid", js.published[0].Header.Get(RetrySubjectHdr))
+}
+
+func TestRouteBack(t *testing.T) {
+	m := &nats.Msg{
+		Subject: "topic_retry_30000ms.other",
+		Header: nats.Header{
+			nats.MsgIdHdr:   []string{"uuid"},
+			RetryAttemptHdr: []string{"1"},
+			RetrySubjectHdr: []string{"topic.uuid"},
+		},
+		Data: []byte("payload"),
+	}
+
+	back := routeBack(m)
+
+	require.Equal(t, "topic.uuid", back.Subject)
+	require.Equal(t, "uuid.retry.1", back.Header.Get(nats.MsgIdHdr))
+	require.Equal(t, m.Data, back.Data)
+}
+
+func TestDefaultRetryTopicCalculator(t *testing.T) {
+	topic := defaultRetryTopicCalculator("orders", 1500*time.Millisecond)
+	require.Equal(t, "orders_retry_1500ms", topic)
+	require.NoError(t, ValidateTopic(topic, true))
+
+	require.Error(t, RetryConfig{Delays: []time.Duration{time.Second, time.Microsecond}}.Validate())
+	require.NoError(t, RetryConfig{Delays: []time.Duration{time.Second}}.Validate())
+}
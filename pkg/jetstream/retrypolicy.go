@@ -0,0 +1,140 @@
+package jetstream
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RetryPolicy decides how often a failing operation is attempted and how long to wait between attempts.
+// It is used by publish retries (PublisherConfig.PublishRetry), the redelivery delays of nacked messages
+// (SubscriberConfig.NakRetry) and the heartbeat watchdog recreating subscriptions (HeartbeatConfig.Retry).
+//
+// FixedRetryPolicy and ExponentialRetryPolicy are provided, policies must be safe for concurrent use.
+type RetryPolicy interface {
+	// NextDelay returns the delay before the attempt following the attempt-th failed one, attempt starting at 1.
+	NextDelay(attempt int) time.Duration
+
+	// MaxAttempts returns the number of attempts including the first one, unlimited when zero.
+	MaxAttempts() int
+}
+
+// retriesExhausted reports whether no attempt follows the attempt-th failed one according to policy.
+func retriesExhausted(policy RetryPolicy, attempt int) bool {
+	maxAttempts := policy.MaxAttempts()
+	return maxAttempts > 0 && attempt >= maxAttempts
+}
+
+// validateRetryPolicy validates policy when it can be validated, e.g. policies provided by this package.
+func validateRetryPolicy(policy RetryPolicy) error {
+	if v, ok := policy.(interface{ Validate() error }); ok {
+		return v.Validate()
+	}
+
+	return nil
+}
+
+// FixedRetryPolicy waits Delay between attempts.
+type FixedRetryPolicy struct {
+	Delay time.Duration
+
+	// Attempts is the number of attempts including the first one, unlimited when zero.
+	Attempts int
+}
+
+// NextDelay returns Delay.
+func (p FixedRetryPolicy) NextDelay(int) time.Duration {
+	return p.Delay
+}
+
+// MaxAttempts returns Attempts.
+func (p FixedRetryPolicy) MaxAttempts() int {
+	return p.Attempts
+}
+
+// Validate ensures configuration is valid before use
+func (p FixedRetryPolicy) Validate() error {
+	if p.Delay < 0 {
+		return errors.New("FixedRetryPolicy.Delay can not be negative")
+	}
+	if p.Attempts < 0 {
+		return errors.New("FixedRetryPolicy.Attempts can not be negative")
+	}
+
+	return nil
+}
+
+// ExponentialRetryPolicy waits InitialDelay after the first failed attempt, multiplying the delay by Multiplier
+// with every further attempt up to MaxDelay.  Jitter randomizes delays, so clients failing together do not
+// retry in lockstep.
+type ExponentialRetryPolicy struct {
+	InitialDelay time.Duration
+
+	// Multiplier multiplies the delay with every attempt (defaults to 2).
+	Multiplier float64
+
+	// MaxDelay caps the delay, it is not capped when zero.
+	MaxDelay time.Duration
+
+	// Jitter is the fraction of the delay which is randomized, between 0 (no jitter) and 1: a delay d is
+	// picked at random between d*(1-Jitter) and d.
+	Jitter float64
+
+	// Attempts is the number of attempts including the first one, unlimited when zero.
+	Attempts int
+}
+
+// NextDelay returns the delay before the attempt following the attempt-th failed one.
+func (p ExponentialRetryPolicy) NextDelay(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+
+	delay := float64(p.InitialDelay) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+
+	if p.Jitter > 0 {
+		delay -= delay * p.Jitter * rand.Float64()
+	}
+
+	if delay >= math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+
+	return time.Duration(delay)
+}
+
+// MaxAttempts returns Attempts.
+func (p ExponentialRetryPolicy) MaxAttempts() int {
+	return p.Attempts
+}
+
+// Validate ensures configuration is valid before use
+func (p ExponentialRetryPolicy) Validate() error {
+	if p.InitialDelay < 0 {
+		return errors.New("ExponentialRetryPolicy.InitialDelay can not be negative")
+	}
+	if p.Multiplier != 0 && p.Multiplier < 1 {
+		return errors.New("ExponentialRetryPolicy.Multiplier can not be lower than 1")
+	}
+	if p.MaxDelay < 0 {
+		return errors.New("ExponentialRetryPolicy.MaxDelay can not be negative")
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return errors.New("ExponentialRetryPolicy.Jitter must be between 0 and 1")
+	}
+	if p.Attempts < 0 {
+		return errors.New("ExponentialRetryPolicy.Attempts can not be negative")
+	}
+
+	return nil
+}
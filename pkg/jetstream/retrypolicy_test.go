@@ -0,0 +1,181 @@
+package jetstream
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFixedRetryPolicy(t *testing.T) {
+	p := FixedRetryPolicy{Delay: time.Second, Attempts: 3}
+	require.Equal(t, time.Second, p.NextDelay(1))
+	require.Equal(t, time.Second, p.NextDelay(10))
+
+	require.False(t, retriesExhausted(p, 2))
+	require.True(t, retriesExhausted(p, 3))
+	require.False(t, retriesExhausted(FixedRetryPolicy{}, 100))
+
+	require.NoError(t, validateRetryPolicy(p))
+	require.Error(t, validateRetryPolicy(FixedRetryPolicy{Delay: -1}))
+	require.Error(t, validateRetryPolicy(FixedRetryPolicy{Attempts: -1}))
+}
+
+func TestExponentialRetryPolicy(t *testing.T) {
+	p := ExponentialRetryPolicy{InitialDelay: time.Second, MaxDelay: 10 * time.Second}
+	require.Equal(t, time.Second, p.NextDelay(0))
+	require.Equal(t, time.Second, p.NextDelay(1))
+	require.Equal(t, 2*time.Second, p.NextDelay(2))
+	require.Equal(t, 8*time.Second, p.NextDelay(4))
+	require.Equal(t, 10*time.Second, p.NextDelay(5))
+	require.Equal(t, 10*time.Second, p.NextDelay(1000))
+
+	p = ExponentialRetryPolicy{InitialDelay: time.Second, Multiplier: 3}
+	require.Equal(t, 9*time.Second, p.NextDelay(3))
+	require.Equal(t, time.Duration(1<<63-1), p.NextDelay(1000))
+
+	p = ExponentialRetryPolicy{InitialDelay: time.Second, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		delay := p.NextDelay(2)
+		require.GreaterOrEqual(t, delay, time.Second)
+		require.LessOrEqual(t, delay, 2*time.Second)
+	}
+
+	require.NoError(t, validateRetryPolicy(ExponentialRetryPolicy{InitialDelay: time.Second, Jitter: 1, Attempts: 5}))
+	require.Error(t, validateRetryPolicy(ExponentialRetryPolicy{InitialDelay: -1}))
+	require.Error(t, validateRetryPolicy(ExponentialRetryPolicy{Multiplier: 0.5}))
+	require.Error(t, validateRetryPolicy(ExponentialRetryPolicy{MaxDelay: -1}))
+	require.Error(t, validateRetryPolicy(ExponentialRetryPolicy{Jitter: 1.5}))
+	require.Error(t, validateRetryPolicy(ExponentialRetryPolicy{Attempts: -1}))
+}
+
+// flakyJetStream fails the first publishes with err.
+type flakyJetStream struct {
+	faultyJetStream
+	err      error
+	failures int
+	attempts int
+}
+
+func (js *flakyJetStream) PublishMsg(m *nats.Msg, opts ...nats.PubOpt) (*nats.PubAck, error) {
+	js.attempts++
+	if js.attempts <= js.failures {
+		return nil, js.err
+	}
+	return js.faultyJetStream.PublishMsg(m, opts...)
+}
+
+func TestPublisher_PublishRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		publishErr   error
+		failures     int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{name: "recovered", publishErr: nats.ErrTimeout, failures: 2, wantAttempts: 3},
+		{name: "exhausted", publishErr: nats.ErrNoResponders, failures: 5, wantAttempts: 3, wantErr: true},
+		{name: "not retried", publishErr: errors.New("maximum payload exceeded"), failures: 1, wantAttempts: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			js := &flakyJetStream{err: tt.publishErr, failures: tt.failures}
+			p := &Publisher{
+				config: PublisherPublishConfig{
+					Marshaler:    &GobMarshaler{},
+					PublishRetry: FixedRetryPolicy{Delay: time.Millisecond, Attempts: 3},
+				},
+				logger: watermill.NopLogger{},
+			}
+			p.decorateClient(clientDecorator{
+				jetStream: func(nats.JetStream) nats.JetStream { return js },
+			})
+
+			err := p.Publish("orders", message.NewMessage(watermill.NewUUID(), nil))
+			if tt.wantErr {
+				require.Error(t, err)
+				require.Empty(t, js.published)
+			} else {
+				require.NoError(t, err)
+				require.Len(t, js.published, 1)
+			}
+			require.Equal(t, tt.wantAttempts, js.attempts)
+		})
+	}
+}
+
+func TestPublisher_PublishRetryClock(t *testing.T) {
+	js := &flakyJetStream{err: nats.ErrTimeout, failures: 1}
+	clock := NewManualClock(time.Now())
+	p := &Publisher{
+		config: PublisherPublishConfig{
+			Marshaler:    &GobMarshaler{},
+			PublishRetry: FixedRetryPolicy{Delay: time.Hour, Attempts: 3},
+			Clock:        clock,
+		},
+		logger: watermill.NopLogger{},
+	}
+	p.decorateClient(clientDecorator{
+		jetStream: func(nats.JetStream) nats.JetStream { return js },
+	})
+
+	published := make(chan error, 1)
+	go func() {
+		published <- p.Publish("orders", message.NewMessage(watermill.NewUUID(), nil))
+	}()
+
+	// the retry delay is measured on the clock of the publisher
+	require.Eventually(t, func() bool { return clock.Timers() == 1 }, time.Second, time.Millisecond)
+	clock.Advance(time.Hour)
+
+	require.NoError(t, <-published)
+	require.Equal(t, 2, js.attempts)
+}
+
+func TestPublisherConfig_ValidatePublishRetry(t *testing.T) {
+	config := PublisherConfig{PublishRetry: FixedRetryPolicy{Delay: -1}}
+	config.setDefaults()
+	require.Error(t, config.Validate())
+}
+
+func TestSubscriber_NakRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		delivered int
+		calls     []string
+		wantDelay time.Duration
+	}{
+		{name: "first delivery", delivered: 1, calls: []string{"nak_with_delay"}, wantDelay: time.Second},
+		{name: "third delivery", delivered: 3, calls: []string{"nak_with_delay"}, wantDelay: 4 * time.Second},
+		{name: "exhausted", delivered: 4, calls: []string{"term"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acker := &settlingAcker{}
+			s := faultySubscriber(SubscriberSubscriptionConfig{
+				NakRetry: ExponentialRetryPolicy{InitialDelay: time.Second, Attempts: 4},
+			}, clientDecorator{
+				acker: func(msgAcker) msgAcker { return acker },
+			})
+
+			m := &nats.Msg{
+				Subject: "orders.1",
+				Reply:   fmt.Sprintf("$JS.ACK.orders.consumer.%d.10.5.%d.0", tt.delivered, time.Now().UnixNano()),
+				Sub:     &nats.Subscription{},
+			}
+			msg := message.NewMessage(watermill.NewUUID(), nil)
+			s.settleMsg(context.Background(), "orders", msg, m, false, watermill.LogFields{})
+
+			require.Equal(t, tt.calls, acker.calls)
+			require.Equal(t, tt.wantDelay, acker.delay)
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package jetstream
+
+import (
+	"context"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ScheduledSubjectHdr is the NATS header holding the subject a scheduled message is delivered to.
+	ScheduledSubjectHdr = "Watermill-Scheduled-Subject"
+
+	// ScheduledAtHdr is the NATS header holding the time (RFC3339) a scheduled message is due to be delivered.
+	ScheduledAtHdr = "Watermill-Scheduled-At"
+
+	defaultSchedulerTopic = "watermill_scheduled"
+)
+
+// SchedulerConfig is the configuration to create a scheduler
+type SchedulerConfig struct {
+	// Topic is the topic scheduled messages are kept in until they are due (defaults to "watermill_scheduled").
+	Topic string
+}
+
+func (c *SchedulerConfig) setDefaults() {
+	if c.Topic == "" {
+		c.Topic = defaultSchedulerTopic
+	}
+}
+
+// Scheduler delivers messages to a topic at a requested time, e.g. for sagas publishing "wake me at T" commands.
+//
+// Schedule stores messages in the scheduler topic, Start consumes it and publishes messages to their topic once due,
+// naking them with the remaining delay until then.  Messages are only acked after they were published, so delivery
+// is at-least-once, the message UUID is used as Nats-Msg-Id so redeliveries within the duplicate window are dropped.
+type Scheduler struct {
+	publisher  *Publisher
+	subscriber *Subscriber
+	config     SchedulerConfig
+	logger     watermill.LoggerAdapter
+}
+
+// NewScheduler creates a new Scheduler.  publisher is used by Schedule and subscriber by Start, a process only
+// scheduling or only delivering messages can pass nil for the other one.
+func NewScheduler(publisher *Publisher, subscriber *Subscriber, config SchedulerConfig, logger watermill.LoggerAdapter) (*Scheduler, error) {
+	config.setDefaults()
+
+	if publisher == nil && subscriber == nil {
+		return nil, errors.New("scheduler requires a publisher or a subscriber")
+	}
+
+	if subscriber != nil && subscriber.config.DurableName == "" {
+		return nil, errors.New("scheduler requires a subscriber with SubscriberConfig.DurableName")
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	return &Scheduler{
+		publisher:  publisher,
+		subscriber: subscriber,
+		config:     config,
+		logger:     logger,
+	}, nil
+}
+
+// Schedule stores messages to be published to topic at at.
+func (s *Scheduler) Schedule(topic string, at time.Time, messages ...*message.Message) error {
+	if s.publisher == nil {
+		return errors.New("scheduler has no publisher")
+	}
+
+	if s.publisher.config.AutoProvision {
+		if err := s.publisher.topicInterpreter.ensureStream(s.config.Topic); err != nil {
+			return err
+		}
+	}
+
+	for _, msg := range messages {
+		scheduled, err := s.scheduledMsg(topic, at, msg)
+		if err != nil {
+			return err
+		}
+
+		if _, err := s.publisher.js.PublishMsg(scheduled, nats.MsgId(msg.UUID)); err != nil {
+			return errors.Wrap(err, "cannot schedule message")
+		}
+
+		s.logger.Trace("Message scheduled", watermill.LogFields{
+			"message_uuid": msg.UUID,
+			"topic":        topic,
+			"scheduled_at": at,
+		})
+	}
+
+	return nil
+}
+
+// scheduledMsg builds the message stored in the scheduler topic.
+func (s *Scheduler) scheduledMsg(topic string, at time.Time, msg *message.Message) (*nats.Msg, error) {
+	natsMsg, err := s.publisher.config.Marshaler.Marshal(topic, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	if natsMsg.Header == nil {
+		natsMsg.Header = make(nats.Header)
+	}
+	natsMsg.Header.Set(ScheduledSubjectHdr, natsMsg.Subject)
+	natsMsg.Header.Set(ScheduledAtHdr, at.UTC().Format(time.RFC3339Nano))
+	natsMsg.Subject = PublishSubject(s.config.Topic, msg.UUID)
+
+	return natsMsg, nil
+}
+
+// Start consumes the scheduler topic and delivers messages once they are due.
+// Delivery stops when ctx is cancelled or the subscriber is closed, the durable consumer is kept so Start can be
+// called again to resume it.
+func (s *Scheduler) Start(ctx context.Context) error {
+	if s.subscriber == nil {
+		return errors.New("scheduler has no subscriber")
+	}
+
+	logFields := watermill.LogFields{"scheduler_topic": s.config.Topic}
+
+	sub, err := s.subscriber.subscribe(s.config.Topic, func(m *nats.Msg) {
+		s.deliver(ctx, m, logFields)
+	})
+	if err != nil {
+		return errors.Wrap(err, "cannot subscribe to scheduler topic")
+	}
+
+	s.subscriber.outputsWg.Add(1)
+	go func() {
+		defer s.subscriber.outputsWg.Done()
+		select {
+		case <-s.subscriber.closing:
+			return
+		case <-ctx.Done():
+		}
+
+		// the durable consumer is kept, so messages not delivered yet are delivered once the scheduler is started again
+		if err := detachSubscription(sub); err != nil {
+			s.logger.Error("Cannot detach scheduler subscription", err, logFields)
+		}
+	}()
+
+	return nil
+}
+
+func (s *Scheduler) deliver(ctx context.Context, m *nats.Msg, logFields watermill.LogFields) {
+	if s.subscriber.isClosed() {
+		return
+	}
+
+	// messages received while the subscription is detached go back to the consumer right away,
+	// e.g. for another scheduler sharing it
+	if ctx.Err() != nil {
+		if err := s.subscriber.acker.Nak(m); err != nil {
+			s.logger.Error("Cannot send nak for message received after the scheduler stopped", err, logFields)
+		}
+		return
+	}
+
+	if wait := dueIn(m, ScheduledAtHdr, s.subscriber.now()); wait > 0 {
+		if err := s.subscriber.acker.NakWithDelay(m, wait); err != nil {
+			s.logger.Error("Cannot delay scheduled message", err, logFields)
+		}
+		return
+	}
+
+	header := copyHeader(m.Header)
+	subject := header.Get(ScheduledSubjectHdr)
+	header.Del(ScheduledSubjectHdr)
+	header.Del(ScheduledAtHdr)
+
+	due := &nats.Msg{
+		Subject: subject,
+		Header:  header,
+		Data:    m.Data,
+	}
+
+	if _, err := s.subscriber.js.PublishMsg(due); err != nil {
+		s.logger.Error("Cannot deliver scheduled message", err, logFields)
+		if err := s.subscriber.acker.Nak(m); err != nil {
+			s.logger.Error("Cannot send nak", err, logFields)
+		}
+		return
+	}
+
+	if err := s.subscriber.acker.Ack(m); err != nil {
+		s.logger.Error("Cannot send ack", err, logFields)
+		return
+	}
+
+	s.logger.Trace("Scheduled message delivered", logFields.Add(watermill.LogFields{"subject": subject}))
+}
@@ -0,0 +1,43 @@
+package jetstream_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-jetstream/pkg/jetstream"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduler_StopOnContextDone(t *testing.T) {
+	conn, js := serverConn(t)
+	pub := serverPublisher(t, conn)
+	sub := serverSubscriber(t, conn, jetstream.SubscriberSubscriptionConfig{DurableName: "scheduler"})
+	require.NoError(t, sub.SubscribeInitialize("orders"))
+
+	scheduler, err := jetstream.NewScheduler(pub, sub, jetstream.SchedulerConfig{}, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, scheduler.Start(ctx))
+	subscriptions := conn.NumSubscriptions()
+
+	require.NoError(t, scheduler.Schedule("orders", time.Now(), message.NewMessage(watermill.NewUUID(), nil)))
+	require.Eventually(t, func() bool { return streamMsgs(t, js, "orders") == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// the subscription stops when ctx is done, the durable consumer is kept
+	cancel()
+	require.Eventually(t, func() bool { return conn.NumSubscriptions() == subscriptions-1 }, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, scheduler.Schedule("orders", time.Now(), message.NewMessage(watermill.NewUUID(), nil)))
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, uint64(1), streamMsgs(t, js, "orders"))
+
+	// restarting resumes from the consumer
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, scheduler.Start(ctx))
+	require.Eventually(t, func() bool { return streamMsgs(t, js, "orders") == 2 }, 5*time.Second, 10*time.Millisecond)
+}
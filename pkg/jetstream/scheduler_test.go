@@ -0,0 +1,61 @@
+package jetstream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduler_ScheduledMsg(t *testing.T) {
+	config := SchedulerConfig{}
+	config.setDefaults()
+
+	s := &Scheduler{
+		publisher: &Publisher{config: PublisherPublishConfig{Marshaler: &NATSMarshaler{}}},
+		config:    config,
+	}
+
+	at := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	m, err := s.scheduledMsg("payments", at, message.NewMessage("uuid-1", []byte("charge")))
+	require.NoError(t, err)
+	require.Equal(t, "watermill_scheduled.uuid-1", m.Subject)
+	require.Equal(t, "payments.uuid-1", m.Header.Get(ScheduledSubjectHdr))
+	require.Equal(t, at, at.Add(dueIn(m, ScheduledAtHdr, at)))
+	require.Equal(t, time.Hour, dueIn(m, ScheduledAtHdr, at.Add(-time.Hour)))
+}
+
+func TestNewScheduler_Validation(t *testing.T) {
+	_, err := NewScheduler(nil, nil, SchedulerConfig{}, nil)
+	require.Error(t, err)
+
+	_, err = NewScheduler(nil, &Subscriber{}, SchedulerConfig{}, nil)
+	require.Error(t, err)
+
+	_, err = NewScheduler(&Publisher{}, nil, SchedulerConfig{}, nil)
+	require.NoError(t, err)
+}
+
+func TestScheduler_DeliverAfterStop(t *testing.T) {
+	acker := &recordingAcker{}
+	s := &Scheduler{
+		subscriber: faultySubscriber(SubscriberSubscriptionConfig{}, clientDecorator{
+			acker: func(msgAcker) msgAcker { return acker },
+		}),
+		logger: watermill.NopLogger{},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// messages received once the scheduler stopped are nacked instead of waiting for AckWait
+	s.deliver(ctx, &nats.Msg{Header: nats.Header{ScheduledAtHdr: []string{time.Now().Format(time.RFC3339Nano)}}}, watermill.LogFields{})
+	acks, naks, _ := acker.counts()
+	require.Equal(t, 0, acks)
+	require.Equal(t, 1, naks)
+}
@@ -0,0 +1,385 @@
+package jetstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// The NATS micro service protocol (https://github.com/nats-io/nats-architecture-and-design, ADR-32) is implemented
+// directly, as the micro package is not part of the nats.go version used here.
+const (
+	serviceAPIPrefix        = "$SRV"
+	serviceErrorHdr         = "Nats-Service-Error"
+	serviceErrorCodeHdr     = "Nats-Service-Error-Code"
+	defaultServiceQueue     = "q"
+	servicePingResponse     = "io.nats.micro.v1.ping_response"
+	serviceInfoResponse     = "io.nats.micro.v1.info_response"
+	serviceStatsResponse    = "io.nats.micro.v1.stats_response"
+	serviceHandlerErrorCode = 500
+)
+
+// ServiceConfig is the configuration to create a service
+type ServiceConfig struct {
+	// Name is the service name, used for discovery.
+	Name string
+
+	// Version is the semantic version of the service.
+	Version string
+
+	// Description is a human readable description of the service.
+	Description string
+
+	// Metadata is exposed through discovery.
+	Metadata map[string]string
+
+	// QueueGroup is the queue group of endpoints (defaults to "q"), so requests are spread over service instances.
+	QueueGroup string
+
+	// Marshaler is used to unmarshal requests and marshal responses (defaults to NATSMarshaler).
+	Marshaler MarshalerUnmarshaler
+}
+
+func (c *ServiceConfig) setDefaults() {
+	if c.QueueGroup == "" {
+		c.QueueGroup = defaultServiceQueue
+	}
+	if c.Marshaler == nil {
+		c.Marshaler = &NATSMarshaler{}
+	}
+	if c.Metadata == nil {
+		c.Metadata = map[string]string{}
+	}
+}
+
+// Validate ensures configuration is valid before use
+func (c ServiceConfig) Validate() error {
+	if c.Name == "" {
+		return errors.New("ServiceConfig.Name is missing")
+	}
+
+	if c.Version == "" {
+		return errors.New("ServiceConfig.Version is missing")
+	}
+
+	return nil
+}
+
+// Service exposes watermill handlers as NATS micro service endpoints, with discovery and stats,
+// so the same handler functions can consume events and serve requests.
+//
+// The first message produced by a handler is the response, a handler error is returned to the caller
+// through the Nats-Service-Error headers.
+type Service struct {
+	conn    *nats.Conn
+	config  ServiceConfig
+	logger  watermill.LoggerAdapter
+	id      string
+	started time.Time
+
+	mu        sync.Mutex
+	endpoints []*serviceEndpoint
+	subs      []*nats.Subscription
+}
+
+type serviceEndpoint struct {
+	name    string
+	subject string
+	handler message.HandlerFunc
+	sub     *nats.Subscription
+
+	mu    sync.Mutex
+	stats serviceEndpointStats
+}
+
+type serviceEndpointStats struct {
+	NumRequests           int           `json:"num_requests"`
+	NumErrors             int           `json:"num_errors"`
+	LastError             string        `json:"last_error"`
+	ProcessingTime        time.Duration `json:"processing_time"`
+	AverageProcessingTime time.Duration `json:"average_processing_time"`
+}
+
+type serviceIdentity struct {
+	Name     string            `json:"name"`
+	ID       string            `json:"id"`
+	Version  string            `json:"version"`
+	Metadata map[string]string `json:"metadata"`
+	Type     string            `json:"type"`
+}
+
+type serviceEndpointInfo struct {
+	Name       string            `json:"name"`
+	Subject    string            `json:"subject"`
+	QueueGroup string            `json:"queue_group"`
+	Metadata   map[string]string `json:"metadata"`
+}
+
+type serviceInfo struct {
+	serviceIdentity
+	Description string                `json:"description"`
+	Endpoints   []serviceEndpointInfo `json:"endpoints"`
+}
+
+type serviceEndpointStatsInfo struct {
+	Name       string `json:"name"`
+	Subject    string `json:"subject"`
+	QueueGroup string `json:"queue_group"`
+	serviceEndpointStats
+}
+
+type serviceStats struct {
+	serviceIdentity
+	Started   time.Time                  `json:"started"`
+	Endpoints []serviceEndpointStatsInfo `json:"endpoints"`
+}
+
+// NewService creates a new Service with the provided nats connection and starts answering discovery requests.
+func NewService(conn *nats.Conn, config ServiceConfig, logger watermill.LoggerAdapter) (*Service, error) {
+	config.setDefaults()
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	s := &Service{
+		conn:    conn,
+		config:  config,
+		logger:  logger,
+		id:      watermill.NewShortUUID(),
+		started: time.Now().UTC(),
+	}
+
+	verbs := map[string]func() interface{}{
+		"PING":  func() interface{} { return s.identity(servicePingResponse) },
+		"INFO":  func() interface{} { return s.info() },
+		"STATS": func() interface{} { return s.stats() },
+	}
+
+	for verb, response := range verbs {
+		response := response
+		for _, subject := range serviceDiscoverySubjects(verb, config.Name, s.id) {
+			sub, err := conn.Subscribe(subject, func(m *nats.Msg) {
+				s.respondJSON(m, response())
+			})
+			if err != nil {
+				_ = s.Stop()
+				return nil, errors.Wrapf(err, "cannot subscribe to %s", subject)
+			}
+			s.subs = append(s.subs, sub)
+		}
+	}
+
+	return s, nil
+}
+
+func serviceDiscoverySubjects(verb, name, id string) []string {
+	return []string{
+		fmt.Sprintf("%s.%s", serviceAPIPrefix, verb),
+		fmt.Sprintf("%s.%s.%s", serviceAPIPrefix, verb, name),
+		fmt.Sprintf("%s.%s.%s.%s", serviceAPIPrefix, verb, name, id),
+	}
+}
+
+// AddEndpoint serves handler on subject.
+func (s *Service) AddEndpoint(name, subject string, handler message.HandlerFunc) error {
+	e := &serviceEndpoint{
+		name:    name,
+		subject: subject,
+		handler: handler,
+	}
+
+	sub, err := s.conn.QueueSubscribe(subject, s.config.QueueGroup, func(m *nats.Msg) {
+		s.handleRequest(e, m)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "cannot subscribe endpoint %s", name)
+	}
+	e.sub = sub
+
+	s.mu.Lock()
+	s.endpoints = append(s.endpoints, e)
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *Service) handleRequest(e *serviceEndpoint, m *nats.Msg) {
+	logFields := watermill.LogFields{
+		"service":  s.config.Name,
+		"endpoint": e.name,
+	}
+
+	start := time.Now()
+	response, err := s.callHandler(e, m)
+	e.record(time.Since(start), err)
+
+	if err != nil {
+		s.logger.Error("Endpoint handler failed", err, logFields)
+		s.respondError(m, err)
+		return
+	}
+
+	if m.Reply == "" {
+		return
+	}
+
+	if response == nil {
+		response = &nats.Msg{}
+	}
+	response.Subject = m.Reply
+
+	if err := s.conn.PublishMsg(response); err != nil {
+		s.logger.Error("Cannot send response", err, logFields)
+	}
+}
+
+func (s *Service) callHandler(e *serviceEndpoint, m *nats.Msg) (*nats.Msg, error) {
+	msg, err := s.config.Marshaler.Unmarshal(m)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot unmarshal request")
+	}
+	if msg.UUID == "" {
+		msg.UUID = watermill.NewUUID()
+	}
+
+	produced, err := e.handler(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(produced) == 0 {
+		return nil, nil
+	}
+
+	return s.config.Marshaler.Marshal(m.Reply, produced[0])
+}
+
+func (s *Service) respondError(m *nats.Msg, err error) {
+	if m.Reply == "" {
+		return
+	}
+
+	response := nats.NewMsg(m.Reply)
+	response.Header.Set(serviceErrorHdr, err.Error())
+	response.Header.Set(serviceErrorCodeHdr, strconv.Itoa(serviceHandlerErrorCode))
+
+	if err := s.conn.PublishMsg(response); err != nil {
+		s.logger.Error("Cannot send error response", err, nil)
+	}
+}
+
+func (s *Service) respondJSON(m *nats.Msg, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		s.logger.Error("Cannot marshal discovery response", err, nil)
+		return
+	}
+
+	if err := m.Respond(data); err != nil {
+		s.logger.Error("Cannot send discovery response", err, nil)
+	}
+}
+
+func (e *serviceEndpoint) record(took time.Duration, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.stats.NumRequests++
+	e.stats.ProcessingTime += took
+	e.stats.AverageProcessingTime = e.stats.ProcessingTime / time.Duration(e.stats.NumRequests)
+
+	if err != nil {
+		e.stats.NumErrors++
+		e.stats.LastError = err.Error()
+	}
+}
+
+func (s *Service) identity(responseType string) serviceIdentity {
+	return serviceIdentity{
+		Name:     s.config.Name,
+		ID:       s.id,
+		Version:  s.config.Version,
+		Metadata: s.config.Metadata,
+		Type:     responseType,
+	}
+}
+
+func (s *Service) info() serviceInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	endpoints := make([]serviceEndpointInfo, 0, len(s.endpoints))
+	for _, e := range s.endpoints {
+		endpoints = append(endpoints, serviceEndpointInfo{
+			Name:       e.name,
+			Subject:    e.subject,
+			QueueGroup: s.config.QueueGroup,
+			Metadata:   map[string]string{},
+		})
+	}
+
+	return serviceInfo{
+		serviceIdentity: s.identity(serviceInfoResponse),
+		Description:     s.config.Description,
+		Endpoints:       endpoints,
+	}
+}
+
+func (s *Service) stats() serviceStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	endpoints := make([]serviceEndpointStatsInfo, 0, len(s.endpoints))
+	for _, e := range s.endpoints {
+		e.mu.Lock()
+		endpoints = append(endpoints, serviceEndpointStatsInfo{
+			Name:                 e.name,
+			Subject:              e.subject,
+			QueueGroup:           s.config.QueueGroup,
+			serviceEndpointStats: e.stats,
+		})
+		e.mu.Unlock()
+	}
+
+	return serviceStats{
+		serviceIdentity: s.identity(serviceStatsResponse),
+		Started:         s.started,
+		Endpoints:       endpoints,
+	}
+}
+
+// Stop stops serving endpoints and discovery requests, the nats connection is not closed.
+func (s *Service) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subs := s.subs
+	for _, e := range s.endpoints {
+		if e.sub != nil {
+			subs = append(subs, e.sub)
+		}
+	}
+
+	for _, sub := range subs {
+		if err := sub.Drain(); err != nil {
+			return errors.Wrap(err, "cannot drain subscription")
+		}
+	}
+
+	s.subs = nil
+	s.endpoints = nil
+
+	return nil
+}
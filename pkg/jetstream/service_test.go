@@ -0,0 +1,43 @@
+package jetstream
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceDiscoverySubjects(t *testing.T) {
+	require.Equal(t, []string{"$SRV.PING", "$SRV.PING.orders", "$SRV.PING.orders.abc"}, serviceDiscoverySubjects("PING", "orders", "abc"))
+}
+
+func TestService_Stats(t *testing.T) {
+	config := ServiceConfig{Name: "orders", Version: "1.0.0"}
+	config.setDefaults()
+	require.NoError(t, config.Validate())
+
+	s := &Service{config: config, id: "abc"}
+
+	e := &serviceEndpoint{name: "create", subject: "orders.create"}
+	e.record(2*time.Millisecond, nil)
+	e.record(4*time.Millisecond, errors.New("out of stock"))
+	s.endpoints = append(s.endpoints, e)
+
+	data, err := json.Marshal(s.stats())
+	require.NoError(t, err)
+
+	var stats map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &stats))
+	require.Equal(t, "orders", stats["name"])
+	require.Equal(t, "io.nats.micro.v1.stats_response", stats["type"])
+
+	endpoint := stats["endpoints"].([]interface{})[0].(map[string]interface{})
+	require.Equal(t, "create", endpoint["name"])
+	require.Equal(t, "q", endpoint["queue_group"])
+	require.EqualValues(t, 2, endpoint["num_requests"])
+	require.EqualValues(t, 1, endpoint["num_errors"])
+	require.Equal(t, "out of stock", endpoint["last_error"])
+	require.EqualValues(t, 3*time.Millisecond, endpoint["average_processing_time"])
+}
@@ -0,0 +1,232 @@
+package jetstream
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// defaultFlushTimeout bounds flushing on close when the close context has no deadline.
+const defaultFlushTimeout = 30 * time.Second
+
+// SubscriptionShutdown is the state of a subscription when closing finished.
+type SubscriptionShutdown struct {
+	Topic         string
+	SubscriberNum int
+
+	// Drained is true when the subscription stopped and no message was in flight anymore.
+	Drained bool
+
+	// InFlight is the number of messages still being processed.
+	InFlight int
+}
+
+// ShutdownReport describes what closing a Publisher or a Subscriber managed to finish.
+type ShutdownReport struct {
+	// Subscriptions are the subscriptions started by Subscribe and still running when closing started.
+	Subscriptions []SubscriptionShutdown
+
+	// InFlight is the number of messages still being processed by all subscriptions.
+	InFlight int
+
+	// Flushed is true when pending publishes and acks were confirmed flushed by the server.
+	Flushed bool
+}
+
+// Drained returns the number of drained subscriptions.
+func (r ShutdownReport) Drained() int {
+	drained := 0
+	for _, sub := range r.Subscriptions {
+		if sub.Drained {
+			drained++
+		}
+	}
+	return drained
+}
+
+// subscriptionState tracks a running subscription for the shutdown report.
+type subscriptionState struct {
+	topic         string
+	subscriberNum int
+	handler       *subscriptionHandler
+	stopped       uint32
+}
+
+func (s *subscriptionState) stop() {
+	atomic.StoreUint32(&s.stopped, 1)
+}
+
+func (s *subscriptionState) shutdown() SubscriptionShutdown {
+	inFlight := int(atomic.LoadInt64(&s.handler.inFlight))
+
+	return SubscriptionShutdown{
+		Topic:         s.topic,
+		SubscriberNum: s.subscriberNum,
+		Drained:       atomic.LoadUint32(&s.stopped) == 1 && inFlight == 0,
+		InFlight:      inFlight,
+	}
+}
+
+// subscriptionRegistry keeps the subscriptions of a Subscriber which are still running.
+type subscriptionRegistry struct {
+	lock          sync.Mutex
+	subscriptions map[*subscriptionState]struct{}
+}
+
+func (r *subscriptionRegistry) track(topic string, subscriberNum int, handler *subscriptionHandler) *subscriptionState {
+	state := &subscriptionState{
+		topic:         topic,
+		subscriberNum: subscriberNum,
+		handler:       handler,
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.subscriptions == nil {
+		r.subscriptions = make(map[*subscriptionState]struct{})
+	}
+	r.subscriptions[state] = struct{}{}
+
+	return state
+}
+
+func (r *subscriptionRegistry) untrack(states ...*subscriptionState) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, state := range states {
+		delete(r.subscriptions, state)
+	}
+}
+
+func (r *subscriptionRegistry) snapshot() []*subscriptionState {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	states := make([]*subscriptionState, 0, len(r.subscriptions))
+	for state := range r.subscriptions {
+		states = append(states, state)
+	}
+
+	return states
+}
+
+func newShutdownReport(states []*subscriptionState) ShutdownReport {
+	report := ShutdownReport{
+		Subscriptions: make([]SubscriptionShutdown, 0, len(states)),
+	}
+
+	for _, state := range states {
+		sub := state.shutdown()
+		report.Subscriptions = append(report.Subscriptions, sub)
+		report.InFlight += sub.InFlight
+	}
+
+	return report
+}
+
+// StopIntake stops the subscriber from taking new messages while keeping its subscriptions and connection,
+// so messages in flight can complete before Close, e.g. in the preStop hook of a Kubernetes pod.
+//
+// The subscriptions of Subscribe stop receiving messages, durable consumers are kept, so messages are delivered
+// to other subscribers sharing the consumer or the queue group.  Messages received before, but not taken yet,
+// are nacked with a delay of the AckWait of the consumer, so they are not redelivered to this subscriber
+// until MaxDeliver is exhausted.  SubscribeBatch stops fetching.  InFlight tells when the messages taken
+// before completed.  It can not be undone, Close must still be called.
+func (s *Subscriber) StopIntake() {
+	if !atomic.CompareAndSwapUint32(&s.intakeStopped, 0, 1) {
+		return
+	}
+
+	s.intakeLock.Lock()
+	if s.intakeStopping == nil {
+		s.intakeStopping = make(chan struct{})
+	}
+	close(s.intakeStopping)
+	s.intakeLock.Unlock()
+
+	if s.tenants != nil {
+		s.tenants.stopIntake()
+	}
+
+	s.logger.Info("Subscriber intake stopped", nil)
+}
+
+func (s *Subscriber) isIntakeStopped() bool {
+	return atomic.LoadUint32(&s.intakeStopped) == 1
+}
+
+// intakeStoppingChan returns a channel closed by StopIntake.
+func (s *Subscriber) intakeStoppingChan() <-chan struct{} {
+	s.intakeLock.Lock()
+	defer s.intakeLock.Unlock()
+
+	if s.intakeStopping == nil {
+		s.intakeStopping = make(chan struct{})
+	}
+
+	return s.intakeStopping
+}
+
+// detachSubscription removes sub from its connection without deleting the consumer the NATS client created
+// for it, as Unsubscribe and Drain do: an auto unsubscribe without limit is a plain unsubscribe.
+func detachSubscription(sub *nats.Subscription) error {
+	return sub.AutoUnsubscribe(0)
+}
+
+// nakIntakeStopped naks a message received after StopIntake with a delay of the AckWait of the consumer,
+// so it is not redelivered right away, possibly to this subscriber, until MaxDeliver is exhausted.
+func (s *Subscriber) nakIntakeStopped(m *nats.Msg, h *subscriptionHandler) {
+	delay := s.config.consumerAckWait(h.timeouts.AckWaitTimeout)
+	if err := s.acker.NakWithDelay(m, delay); err != nil {
+		s.logger.Error("Cannot send nak for message received after intake stopped", err, h.logFields)
+	}
+}
+
+// InFlight returns the number of messages of Subscribe being processed, sent to the consumer and not acked
+// or nacked yet.
+func (s *Subscriber) InFlight() int {
+	inFlight := 0
+	for _, state := range s.subscriptions.snapshot() {
+		inFlight += int(atomic.LoadInt64(&state.handler.inFlight))
+	}
+
+	return inFlight
+}
+
+// waitGroupContext waits for wg until ctx is done, returning false when ctx was done first.
+func waitGroupContext(ctx context.Context, wg *sync.WaitGroup) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// flushContext returns ctx bounded by timeout when it has no deadline, as flushing requires one.
+func flushContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+func shutdownError(report ShutdownReport) error {
+	return errors.Errorf(
+		"output wait group did not finish: %d of %d subscriptions drained, %d messages in flight",
+		report.Drained(), len(report.Subscriptions), report.InFlight,
+	)
+}
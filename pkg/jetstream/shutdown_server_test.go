@@ -0,0 +1,69 @@
+package jetstream_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-jetstream/pkg/jetstream"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriber_StopIntakeKeepsMaxDeliver(t *testing.T) {
+	conn, _ := serverConn(t)
+
+	pub, err := jetstream.NewPublisherWithNatsConn(conn, jetstream.PublisherPublishConfig{
+		Marshaler:     &jetstream.GobMarshaler{},
+		AutoProvision: true,
+	}, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	newSubscriber := func() *jetstream.Subscriber {
+		sub, err := jetstream.NewSubscriber(jetstream.SubscriberConfig{
+			URL:              conn.ConnectedUrl(),
+			Unmarshaler:      &jetstream.GobMarshaler{},
+			AutoProvision:    true,
+			Consumer:         jetstream.ConsumerConfig{Durable: "workers", DeliverGroup: "workers"},
+			SubscribeOptions: []nats.SubOpt{nats.DeliverAll(), nats.AckExplicit(), nats.MaxDeliver(3)},
+			AckWaitTimeout:   time.Second,
+			CloseTimeout:     time.Second,
+		}, watermill.NopLogger{})
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = sub.Close() })
+		return sub
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	stopping := newSubscriber()
+	_, err = stopping.Subscribe(ctx, "jobs")
+	require.NoError(t, err)
+
+	running := newSubscriber()
+	messages, err := running.Subscribe(ctx, "jobs")
+	require.NoError(t, err)
+
+	stopping.StopIntake()
+
+	const count = 20
+	for i := 0; i < count; i++ {
+		require.NoError(t, pub.Publish("jobs", message.NewMessage(watermill.NewUUID(), nil)))
+	}
+
+	// every message reaches the running subscriber, instead of being nacked back and forth by the stopping one
+	// until MaxDeliver drops it
+	received := map[string]bool{}
+	for len(received) < count {
+		select {
+		case msg := <-messages:
+			received[msg.UUID] = true
+			msg.Ack()
+		case <-ctx.Done():
+			t.Fatalf("received %d of %d messages", len(received), count)
+		}
+	}
+}
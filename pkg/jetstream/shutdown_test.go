@@ -0,0 +1,122 @@
+package jetstream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriber_CloseWithContextReport(t *testing.T) {
+	s := faultySubscriber(SubscriberSubscriptionConfig{}, clientDecorator{})
+
+	s.subscriptions.track("stuck", 0, &subscriptionHandler{inFlight: 2})
+	stopped := s.subscriptions.track("stopped", 1, &subscriptionHandler{})
+	stopped.stop()
+
+	// the stuck subscription keeps its output open
+	s.outputsWg.Add(1)
+	defer s.outputsWg.Done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	report, err := s.CloseWithContext(ctx)
+	require.EqualError(t, err, "output wait group did not finish: 1 of 2 subscriptions drained, 2 messages in flight")
+
+	require.Equal(t, 2, report.InFlight)
+	require.Equal(t, 1, report.Drained())
+	require.False(t, report.Flushed)
+	require.ElementsMatch(t, []SubscriptionShutdown{
+		{Topic: "stuck", SubscriberNum: 0, InFlight: 2},
+		{Topic: "stopped", SubscriberNum: 1, Drained: true},
+	}, report.Subscriptions)
+
+	report, err = s.CloseWithContext(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, report.Subscriptions)
+}
+
+func TestSubscriptionRegistry(t *testing.T) {
+	var r subscriptionRegistry
+	require.Empty(t, r.snapshot())
+
+	a := r.track("a", 0, &subscriptionHandler{})
+	b := r.track("a", 1, &subscriptionHandler{})
+	require.ElementsMatch(t, []*subscriptionState{a, b}, r.snapshot())
+
+	r.untrack(a, b)
+	require.Empty(t, r.snapshot())
+}
+
+func TestFlushContext(t *testing.T) {
+	ctx, cancel := flushContext(context.Background(), time.Minute)
+	defer cancel()
+
+	deadline, ok := ctx.Deadline()
+	require.True(t, ok)
+	require.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+
+	parent, parentCancel := context.WithTimeout(context.Background(), time.Second)
+	defer parentCancel()
+
+	ctx, cancel = flushContext(parent, time.Minute)
+	defer cancel()
+
+	parentDeadline, _ := parent.Deadline()
+	deadline, _ = ctx.Deadline()
+	require.Equal(t, parentDeadline, deadline)
+}
+
+func TestSubscriber_StopIntake(t *testing.T) {
+	acker := &settlingAcker{}
+	s := faultySubscriber(SubscriberSubscriptionConfig{AckWaitTimeout: time.Minute}, clientDecorator{
+		acker: func(msgAcker) msgAcker { return acker },
+	})
+
+	h := &subscriptionHandler{
+		ctx:       context.Background(),
+		topic:     "topic",
+		output:    make(chan *message.Message),
+		timeouts:  Timeouts{AckWaitTimeout: time.Minute},
+		logFields: watermill.LogFields{},
+	}
+	s.subscriptions.track("topic", 0, h)
+
+	m, err := (&GobMarshaler{}).Marshal("topic", message.NewMessage(watermill.NewUUID(), nil))
+	require.NoError(t, err)
+
+	processed := make(chan struct{})
+	go func() {
+		defer close(processed)
+		s.processMessage(h, m)
+	}()
+
+	taken := <-h.output
+	require.Equal(t, 1, s.InFlight())
+
+	s.StopIntake()
+	s.StopIntake()
+
+	// messages delivered after the intake stopped are nacked with a delay, so they are not redelivered
+	// right away until MaxDeliver is exhausted, the one taken before completes
+	s.processMessage(h, m)
+	require.Equal(t, []string{"nak_with_delay"}, acker.calls)
+	require.Equal(t, time.Minute, acker.delay)
+
+	select {
+	case <-s.intakeStoppingChan():
+	default:
+		t.Fatal("subscriptions not notified that the intake stopped")
+	}
+
+	taken.Ack()
+	<-processed
+
+	require.Equal(t, []string{"nak_with_delay", "ack"}, acker.calls)
+	require.Equal(t, 0, s.InFlight())
+	require.False(t, s.isClosed())
+}
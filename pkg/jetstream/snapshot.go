@@ -0,0 +1,263 @@
+package jetstream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultAPIPrefix         = "$JS.API"
+	defaultSnapshotChunkSize = 128 * 1024
+)
+
+// StreamBackupConfig is the configuration to create a StreamBackup
+type StreamBackupConfig struct {
+	// APIPrefix is the JetStream API prefix (defaults to "$JS.API"), it needs to be set when using a JetStream domain.
+	APIPrefix string
+
+	// ChunkSize is the size of snapshot chunks (defaults to 128KiB).
+	ChunkSize int
+
+	// SubjectCalculator is used to calculate the stream subjects when restoring into a different topic (defaults to "{topic}.*")
+	SubjectCalculator SubjectCalculator
+
+	// NoConsumers excludes consumer state from snapshots.
+	NoConsumers bool
+}
+
+func (c *StreamBackupConfig) setDefaults() {
+	if c.APIPrefix == "" {
+		c.APIPrefix = defaultAPIPrefix
+	}
+	if c.ChunkSize <= 0 {
+		c.ChunkSize = defaultSnapshotChunkSize
+	}
+	if c.SubjectCalculator == nil {
+		c.SubjectCalculator = defaultSubjectCalculator
+	}
+}
+
+// SnapshotInfo describes a stream snapshot, it needs to be stored alongside the snapshot data to restore it.
+type SnapshotInfo struct {
+	Config nats.StreamConfig `json:"config"`
+	State  nats.StreamState  `json:"state"`
+}
+
+type jsAPIError struct {
+	Code        int    `json:"code"`
+	Description string `json:"description"`
+}
+
+func (e *jsAPIError) err(action string) error {
+	return errors.Errorf("cannot %s: %s (%d)", action, e.Description, e.Code)
+}
+
+type snapshotRequest struct {
+	DeliverSubject string `json:"deliver_subject"`
+	NoConsumers    bool   `json:"no_consumers,omitempty"`
+	ChunkSize      int    `json:"chunk_size,omitempty"`
+}
+
+type snapshotResponse struct {
+	SnapshotInfo
+	Error *jsAPIError `json:"error,omitempty"`
+}
+
+type restoreResponse struct {
+	DeliverSubject string      `json:"deliver_subject"`
+	Error          *jsAPIError `json:"error,omitempty"`
+}
+
+type restoreFinishedResponse struct {
+	nats.StreamInfo
+	Error *jsAPIError `json:"error,omitempty"`
+}
+
+// StreamBackup backs up and restores the streams of topics through the JetStream snapshot API,
+// e.g. for copying production data into a staging environment.
+type StreamBackup struct {
+	conn   *nats.Conn
+	config StreamBackupConfig
+	logger watermill.LoggerAdapter
+}
+
+// NewStreamBackup creates a new StreamBackup with the provided nats connection.
+func NewStreamBackup(conn *nats.Conn, config StreamBackupConfig, logger watermill.LoggerAdapter) *StreamBackup {
+	config.setDefaults()
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	return &StreamBackup{
+		conn:   conn,
+		config: config,
+		logger: logger,
+	}
+}
+
+// Snapshot writes a snapshot of the stream of topic to w.
+func (b *StreamBackup) Snapshot(ctx context.Context, topic string, w io.Writer) (*SnapshotInfo, error) {
+	logFields := watermill.LogFields{"topic": topic}
+
+	inbox := nats.NewInbox()
+	sub, err := b.conn.SubscribeSync(inbox)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot subscribe to snapshot inbox")
+	}
+	defer func() {
+		if err := sub.Unsubscribe(); err != nil {
+			b.logger.Error("Cannot unsubscribe from snapshot inbox", err, logFields)
+		}
+	}()
+
+	req, err := json.Marshal(snapshotRequest{
+		DeliverSubject: inbox,
+		NoConsumers:    b.config.NoConsumers,
+		ChunkSize:      b.config.ChunkSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	respMsg, err := b.conn.RequestWithContext(ctx, b.apiSubject("STREAM.SNAPSHOT", topic), req)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot request snapshot")
+	}
+
+	var resp snapshotResponse
+	if err := json.Unmarshal(respMsg.Data, &resp); err != nil {
+		return nil, errors.Wrap(err, "cannot decode snapshot response")
+	}
+	if resp.Error != nil {
+		return nil, resp.Error.err("snapshot stream")
+	}
+
+	b.logger.Debug("Snapshot started", logFields)
+
+	for {
+		m, err := sub.NextMsgWithContext(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot receive snapshot chunk")
+		}
+
+		// an empty message marks the end of the snapshot
+		if len(m.Data) == 0 {
+			break
+		}
+
+		if _, err := w.Write(m.Data); err != nil {
+			return nil, errors.Wrap(err, "cannot write snapshot chunk")
+		}
+
+		// chunks are flow controlled by replying to them
+		if m.Reply != "" {
+			if err := m.Respond(nil); err != nil {
+				return nil, errors.Wrap(err, "cannot ack snapshot chunk")
+			}
+		}
+	}
+
+	b.logger.Info("Snapshot finished", logFields)
+
+	return &resp.SnapshotInfo, nil
+}
+
+// Restore restores a snapshot read from r into the stream of topic, which must not exist yet.
+// When topic differs from the snapshotted stream the subjects are recalculated for topic.
+func (b *StreamBackup) Restore(ctx context.Context, topic string, info *SnapshotInfo, r io.Reader) (*nats.StreamInfo, error) {
+	logFields := watermill.LogFields{"topic": topic}
+
+	restored := *info
+	if restored.Config.Name != topic {
+		restored.Config.Name = topic
+		restored.Config.Subjects = b.config.SubjectCalculator(topic).All()
+	}
+
+	req, err := json.Marshal(restored)
+	if err != nil {
+		return nil, err
+	}
+
+	respMsg, err := b.conn.RequestWithContext(ctx, b.apiSubject("STREAM.RESTORE", topic), req)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot request restore")
+	}
+
+	var resp restoreResponse
+	if err := json.Unmarshal(respMsg.Data, &resp); err != nil {
+		return nil, errors.Wrap(err, "cannot decode restore response")
+	}
+	if resp.Error != nil {
+		return nil, resp.Error.err("restore stream")
+	}
+
+	b.logger.Debug("Restore started", logFields)
+
+	chunk := make([]byte, b.config.ChunkSize)
+	for {
+		n, readErr := r.Read(chunk)
+		if n > 0 {
+			chunkResp, err := b.conn.RequestWithContext(ctx, resp.DeliverSubject, chunk[:n])
+			if err != nil {
+				return nil, errors.Wrap(err, "cannot send restore chunk")
+			}
+			if err := restoreChunkError(chunkResp); err != nil {
+				return nil, err
+			}
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return nil, errors.Wrap(readErr, "cannot read snapshot")
+		}
+	}
+
+	// an empty message marks the end of the restore, the reply holds the restored stream
+	finishedMsg, err := b.conn.RequestWithContext(ctx, resp.DeliverSubject, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot finish restore")
+	}
+
+	var finished restoreFinishedResponse
+	if err := json.Unmarshal(finishedMsg.Data, &finished); err != nil {
+		return nil, errors.Wrap(err, "cannot decode restore result")
+	}
+	if finished.Error != nil {
+		return nil, finished.Error.err("restore stream")
+	}
+
+	b.logger.Info("Restore finished", logFields)
+
+	return &finished.StreamInfo, nil
+}
+
+func restoreChunkError(m *nats.Msg) error {
+	if len(m.Data) == 0 {
+		return nil
+	}
+
+	var resp struct {
+		Error *jsAPIError `json:"error,omitempty"`
+	}
+	if err := json.Unmarshal(m.Data, &resp); err != nil {
+		return nil
+	}
+	if resp.Error != nil {
+		return resp.Error.err("restore chunk")
+	}
+
+	return nil
+}
+
+func (b *StreamBackup) apiSubject(op, stream string) string {
+	return fmt.Sprintf("%s.%s.%s", b.config.APIPrefix, op, stream)
+}
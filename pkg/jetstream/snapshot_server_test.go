@@ -0,0 +1,54 @@
+package jetstream_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-jetstream/pkg/jetstream"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamBackup_SnapshotRestore(t *testing.T) {
+	conn, js := serverConn(t)
+	pub := serverPublisher(t, conn)
+
+	var published []string
+	for i := 0; i < 5; i++ {
+		msg := message.NewMessage(watermill.NewUUID(), []byte("payload"))
+		require.NoError(t, pub.Publish("orders", msg))
+		published = append(published, msg.UUID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	backup := jetstream.NewStreamBackup(conn, jetstream.StreamBackupConfig{ChunkSize: 1024}, nil)
+
+	var snapshot bytes.Buffer
+	info, err := backup.Snapshot(ctx, "orders", &snapshot)
+	require.NoError(t, err)
+	require.Equal(t, "orders", info.Config.Name)
+	require.Equal(t, uint64(5), info.State.Msgs)
+	require.NotZero(t, snapshot.Len())
+
+	// the stream of a topic can not be restored over an existing one
+	_, err = backup.Restore(ctx, "orders", info, bytes.NewReader(snapshot.Bytes()))
+	require.Error(t, err)
+
+	require.NoError(t, js.DeleteStream("orders"))
+
+	restored, err := backup.Restore(ctx, "orders", info, &snapshot)
+	require.NoError(t, err)
+	require.Equal(t, "orders", restored.Config.Name)
+	require.Equal(t, uint64(5), restored.State.Msgs)
+
+	var uuids []string
+	for _, msg := range streamMessages(t, js, "orders") {
+		uuids = append(uuids, msg.UUID)
+	}
+	require.Equal(t, published, uuids)
+}
@@ -0,0 +1,22 @@
+package jetstream
+
+import (
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamBackup_apiSubject(t *testing.T) {
+	b := NewStreamBackup(nil, StreamBackupConfig{}, nil)
+	require.Equal(t, "$JS.API.STREAM.SNAPSHOT.topic", b.apiSubject("STREAM.SNAPSHOT", "topic"))
+
+	b = NewStreamBackup(nil, StreamBackupConfig{APIPrefix: "$JS.hub.API"}, nil)
+	require.Equal(t, "$JS.hub.API.STREAM.RESTORE.topic", b.apiSubject("STREAM.RESTORE", "topic"))
+}
+
+func TestRestoreChunkError(t *testing.T) {
+	require.NoError(t, restoreChunkError(&nats.Msg{}))
+	require.NoError(t, restoreChunkError(&nats.Msg{Data: []byte(`{}`)}))
+	require.Error(t, restoreChunkError(&nats.Msg{Data: []byte(`{"error":{"code":500,"description":"restore failed"}}`)}))
+}
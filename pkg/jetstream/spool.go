@@ -0,0 +1,288 @@
+package jetstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// ErrSpoolFull is returned by Publish when the broker is unreachable and the spool reached SpoolConfig.MaxBytes.
+var ErrSpoolFull = errors.New("spool is full")
+
+// spoolFileExt is the extension of spooled message files, named after their spool sequence.
+const spoolFileExt = ".msg"
+
+// SpoolConfig persists publishes to a local directory while the broker is unreachable and replays them once
+// the connection recovered, for deployments with unreliable links.  It is disabled unless Dir is set.
+//
+// Publishes failing because the connection is down, or timing out, are written to Dir and Publish succeeds.
+// Spooled messages are replayed in order every ReplayInterval while connected, with the message UUID as
+// Nats-Msg-Id, so messages stored by the broker before a timeout are deduplicated within the duplicate window
+// of the stream.  Messages published while the spool is replayed are not ordered after the spooled ones.
+// Publishes with expectations (e.g. of EventStore) are never spooled, they can not be checked on replay.
+type SpoolConfig struct {
+	// Dir is the directory spooled messages are stored in, it is created when missing.  Messages left by
+	// a previous run are replayed.  Publishers must not share a directory.
+	Dir string
+
+	// MaxBytes bounds the size of the spooled messages (defaults to 64MiB), once reached Publish fails with ErrSpoolFull.
+	MaxBytes int64
+
+	// ReplayInterval is the interval spooled messages are replayed at while connected (defaults to 5 seconds).
+	ReplayInterval time.Duration
+}
+
+func (c SpoolConfig) enabled() bool {
+	return c.Dir != ""
+}
+
+func (c *SpoolConfig) setDefaults() {
+	if c.MaxBytes == 0 {
+		c.MaxBytes = 64 << 20
+	}
+	if c.ReplayInterval == 0 {
+		c.ReplayInterval = 5 * time.Second
+	}
+}
+
+// Validate ensures configuration is valid before use
+func (c SpoolConfig) Validate() error {
+	if !c.enabled() {
+		return nil
+	}
+
+	if c.MaxBytes < 0 {
+		return errors.New("SpoolConfig.MaxBytes can not be negative")
+	}
+	if c.ReplayInterval < 0 {
+		return errors.New("SpoolConfig.ReplayInterval can not be negative")
+	}
+
+	return nil
+}
+
+// brokerUnreachable reports whether a publish failed because the broker could not be reached.
+func brokerUnreachable(err error) bool {
+	for _, unreachable := range []error{
+		nats.ErrTimeout,
+		nats.ErrNoResponders,
+		nats.ErrNoStreamResponse,
+		nats.ErrConnectionClosed,
+		nats.ErrConnectionReconnecting,
+		nats.ErrDisconnected,
+		nats.ErrNoServers,
+		nats.ErrStaleConnection,
+	} {
+		if errors.Is(err, unreachable) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// spooledMsg is a spooled NATS message as stored in its file.
+type spooledMsg struct {
+	Subject string      `json:"subject"`
+	Header  nats.Header `json:"header,omitempty"`
+	Data    []byte      `json:"data"`
+}
+
+// spool stores messages in a directory, one file per message, and replays them in order.
+type spool struct {
+	config SpoolConfig
+	js     nats.JetStream
+	logger watermill.LoggerAdapter
+
+	// lock serializes spooling and replaying, so files are replayed in the order they were spooled
+	lock sync.Mutex
+	seq  uint64
+	size int64
+}
+
+// newSpool opens the spool of config, picking up the messages left in its directory.
+func newSpool(config SpoolConfig, js nats.JetStream, logger watermill.LoggerAdapter) (*spool, error) {
+	if err := os.MkdirAll(config.Dir, 0o750); err != nil {
+		return nil, errors.Wrap(err, "cannot create spool directory")
+	}
+
+	s := &spool{
+		config: config,
+		js:     js,
+		logger: logger,
+	}
+
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		s.size += file.size
+		s.seq = file.seq
+	}
+
+	return s, nil
+}
+
+type spoolFile struct {
+	path string
+	seq  uint64
+	size int64
+}
+
+// files returns the spooled message files, in spool order.
+func (s *spool) files() ([]spoolFile, error) {
+	entries, err := os.ReadDir(s.config.Dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read spool directory")
+	}
+
+	files := make([]spoolFile, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, spoolFileExt) {
+			continue
+		}
+
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, spoolFileExt), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot read spooled message")
+		}
+
+		files = append(files, spoolFile{
+			path: filepath.Join(s.config.Dir, name),
+			seq:  seq,
+			size: info.Size(),
+		})
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].seq < files[j].seq })
+
+	return files, nil
+}
+
+// add spools m, failing with ErrSpoolFull when it does not fit.
+func (s *spool) add(m *nats.Msg) error {
+	data, err := json.Marshal(spooledMsg{Subject: m.Subject, Header: m.Header, Data: m.Data})
+	if err != nil {
+		return errors.Wrap(err, "cannot encode spooled message")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.size+int64(len(data)) > s.config.MaxBytes {
+		return ErrSpoolFull
+	}
+
+	seq := s.seq + 1
+	path := filepath.Join(s.config.Dir, fmt.Sprintf("%020d%s", seq, spoolFileExt))
+
+	// the file is renamed once written, so a crash never leaves a partial message to replay
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o640); err != nil {
+		return errors.Wrap(err, "cannot write spooled message")
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return errors.Wrap(err, "cannot write spooled message")
+	}
+
+	s.seq = seq
+	s.size += int64(len(data))
+
+	return nil
+}
+
+// pending returns the size of the spooled messages.
+func (s *spool) pending() int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.size
+}
+
+// replay publishes the spooled messages in order, stopping at the first failure.
+// It returns the number of messages processed.
+func (s *spool) replay() (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	files, err := s.files()
+	if err != nil {
+		return 0, err
+	}
+
+	for i, file := range files {
+		data, err := os.ReadFile(file.path)
+		if err != nil {
+			return i, errors.Wrap(err, "cannot read spooled message")
+		}
+
+		var spooled spooledMsg
+		if err := json.Unmarshal(data, &spooled); err != nil {
+			// a corrupted message would block the spool, it is set aside for inspection
+			s.logger.Error("Cannot decode spooled message, set aside", err, watermill.LogFields{"file": file.path})
+			if err := os.Rename(file.path, file.path+".corrupt"); err != nil {
+				return i, errors.Wrap(err, "cannot set corrupted spooled message aside")
+			}
+			s.size -= file.size
+			continue
+		}
+
+		if _, err := s.js.PublishMsg(&nats.Msg{
+			Subject: spooled.Subject,
+			Header:  spooled.Header,
+			Data:    spooled.Data,
+		}); err != nil {
+			return i, errors.Wrap(err, "cannot replay spooled message")
+		}
+
+		if err := os.Remove(file.path); err != nil {
+			return i, errors.Wrap(err, "cannot remove replayed message")
+		}
+		s.size -= file.size
+	}
+
+	return len(files), nil
+}
+
+// run replays the spooled messages every ReplayInterval while connected, until closing is closed.
+func (s *spool) run(connected func() bool, closing chan struct{}) {
+	ticker := time.NewTicker(s.config.ReplayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closing:
+			return
+		case <-ticker.C:
+		}
+
+		if s.pending() == 0 || !connected() {
+			continue
+		}
+
+		replayed, err := s.replay()
+		if replayed > 0 {
+			s.logger.Info("Spooled messages replayed", watermill.LogFields{"replayed": replayed})
+		}
+		if err != nil {
+			s.logger.Error("Cannot replay spooled messages", err, nil)
+		}
+	}
+}
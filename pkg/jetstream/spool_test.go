@@ -0,0 +1,116 @@
+package jetstream
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func spoolingPublisher(t *testing.T, js *faultyJetStream, config SpoolConfig) *Publisher {
+	config.setDefaults()
+
+	p := &Publisher{
+		config: PublisherPublishConfig{Marshaler: &NATSMarshaler{}},
+		logger: watermill.NopLogger{},
+	}
+	p.decorateClient(clientDecorator{
+		jetStream: func(nats.JetStream) nats.JetStream { return js },
+	})
+
+	spool, err := newSpool(config, js, p.logger)
+	require.NoError(t, err)
+	p.spool = spool
+
+	return p
+}
+
+func TestSpoolConfig_Validate(t *testing.T) {
+	require.NoError(t, SpoolConfig{}.Validate())
+	require.NoError(t, SpoolConfig{Dir: "spool"}.Validate())
+	require.Error(t, SpoolConfig{Dir: "spool", MaxBytes: -1}.Validate())
+	require.Error(t, SpoolConfig{Dir: "spool", ReplayInterval: -1}.Validate())
+}
+
+func TestPublisher_Spool(t *testing.T) {
+	dir := t.TempDir()
+	js := &faultyJetStream{publishErr: nats.ErrNoResponders}
+	p := spoolingPublisher(t, js, SpoolConfig{Dir: dir})
+
+	first := message.NewMessage(watermill.NewUUID(), []byte("first"))
+	second := message.NewMessage(watermill.NewUUID(), []byte("second"))
+	require.NoError(t, p.Publish("orders", first, second))
+	require.Empty(t, js.published)
+
+	// a new spool on the same directory replays the messages left by the previous one
+	js.publishErr = nil
+	spool, err := newSpool(SpoolConfig{Dir: dir}, js, watermill.NopLogger{})
+	require.NoError(t, err)
+	require.NotZero(t, spool.pending())
+
+	replayed, err := spool.replay()
+	require.NoError(t, err)
+	require.Equal(t, 2, replayed)
+	require.Zero(t, spool.pending())
+
+	require.Len(t, js.published, 2)
+	for i, msg := range []*message.Message{first, second} {
+		require.Equal(t, msg.UUID, js.published[i].Header.Get(nats.MsgIdHdr))
+		require.Equal(t, msg.Payload, message.Payload(js.published[i].Data))
+	}
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, files)
+}
+
+func TestPublisher_SpoolFull(t *testing.T) {
+	js := &faultyJetStream{publishErr: nats.ErrTimeout}
+	p := spoolingPublisher(t, js, SpoolConfig{Dir: t.TempDir(), MaxBytes: 10})
+
+	err := p.Publish("orders", message.NewMessage(watermill.NewUUID(), []byte("payload")))
+	require.True(t, errors.Is(err, ErrSpoolFull), "unexpected error: %v", err)
+}
+
+func TestPublisher_SpoolOnlyUnreachable(t *testing.T) {
+	js := &faultyJetStream{publishErr: nats.ErrStreamNotFound}
+	p := spoolingPublisher(t, js, SpoolConfig{Dir: t.TempDir()})
+
+	err := p.Publish("orders", message.NewMessage(watermill.NewUUID(), nil))
+	require.True(t, errors.Is(err, nats.ErrStreamNotFound), "unexpected error: %v", err)
+	require.Zero(t, p.spool.pending())
+}
+
+func TestSpool_ReplayStopsAtFailure(t *testing.T) {
+	dir := t.TempDir()
+	js := &faultyJetStream{}
+	spool, err := newSpool(SpoolConfig{Dir: dir, MaxBytes: 1 << 20}, js, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	require.NoError(t, spool.add(&nats.Msg{Subject: "orders.1", Data: []byte("first")}))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "00000000000000000002.msg"), []byte("corrupted"), 0o640))
+	spool.seq = 2
+	require.NoError(t, spool.add(&nats.Msg{Subject: "orders.3", Data: []byte("third")}))
+
+	js.publishErr = nats.ErrTimeout
+	replayed, err := spool.replay()
+	require.True(t, errors.Is(err, nats.ErrTimeout), "unexpected error: %v", err)
+	require.Zero(t, replayed)
+
+	// the corrupted message is set aside, the others are replayed in order
+	js.publishErr = nil
+	replayed, err = spool.replay()
+	require.NoError(t, err)
+	require.Equal(t, 3, replayed)
+	require.Len(t, js.published, 2)
+	require.Equal(t, "orders.1", js.published[0].Subject)
+	require.Equal(t, "orders.3", js.published[1].Subject)
+
+	_, err = os.Stat(filepath.Join(dir, "00000000000000000002.msg.corrupt"))
+	require.NoError(t, err)
+}
@@ -2,13 +2,16 @@ package jetstream
 
 import (
 	"context"
+	"fmt"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill/message"
-	watermillSync "github.com/ThreeDotsLabs/watermill/pubsub/sync"
 	"github.com/nats-io/nats.go"
+	natsjs "github.com/nats-io/nats.go/jetstream"
 	"github.com/pkg/errors"
 )
 
@@ -17,33 +20,37 @@ type SubscriberConfig struct {
 	// URL is the URL to the broker
 	URL string
 
-	// QueueGroup is the JetStream queue group.
+	// Consumer names the JetStream consumers of topics, see ConsumerConfig.
+	Consumer ConsumerConfig
+
+	// QueueGroup is the deliver group of the push consumer of a topic (calculated as "{QueueGroup}.{topic}",
+	// see QueueGroupCalculator).
+	//
+	// All subscriptions with the same queue group (regardless of the connection they originate from)
+	// share the consumer, each message is delivered to only one of them.
 	//
-	// All subscriptions with the same queue name (regardless of the connection they originate from)
-	// will form a queue group. Each message will be delivered to only one subscriber per queue group,
-	// using queuing semantics.
+	// It is recommended to set it with DurableName.  Without DurableName the consumer is ephemeral and deleted
+	// once the last member leaves the group, with DurableName it is kept and members re-joining resume at the
+	// first message the consumer did not get an ack for.
 	//
-	// It is recommended to set it with DurableName.
-	// For non durable queue subscribers, when the last member leaves the group,
-	// that group is removed. A durable queue group (DurableName) allows you to have all members leave
-	// but still maintain state. When a member re-joins, it starts at the last position in that group.
+	// When QueueGroup is empty the deliver group of durable consumers is still calculated from it (".{topic}" by
+	// default), so all subscriptions of a topic share its consumer.  Without DurableName every subscription gets
+	// an ephemeral consumer of its own then, as the NATS client names consumers of deliver groups after them.
 	//
-	// When QueueGroup is empty, subscribe without QueueGroup will be used.
+	// Deprecated: use Consumer.DeliverGroup.
 	QueueGroup string
 
-	// DurableName is the JetStream durable name.
+	// DurableName is the name of the durable consumer of a topic (calculated as "{DurableName}_{topic}",
+	// see DurableNameCalculator).
 	//
-	// Subscriptions may also specify a “durable name” which will survive client restarts.
-	// Durable subscriptions cause the server to track the last acknowledged message
-	// sequence number for a client and durable name. When the client restarts/resubscribes,
-	// and uses the same client ID and durable name, the server will resume delivery beginning
-	// with the earliest unacknowledged message for this durable subscription.
+	// The server keeps a durable consumer and its ack state when subscribers disconnect, so subscriptions
+	// with the same DurableName resume with the first message which was not acked.
 	//
-	// Doing this causes the JetStream server to track
-	// the last acknowledged message for that ClientID + DurableName.
+	// Deprecated: use Consumer.Durable.
 	DurableName string
 
 	// SubscribersCount determines how many concurrent subscribers should be started.
+	// It requires QueueGroup or DurableName, so the subscribers share a consumer instead of each receiving every message.
 	SubscribersCount int
 
 	// CloseTimeout determines how long subscriber will wait for Ack/Nack on close.
@@ -51,9 +58,23 @@ type SubscriberConfig struct {
 	CloseTimeout time.Duration
 
 	// How long subscriber should wait for Ack/Nack. When no Ack/Nack was received, message will be redelivered.
-	// It is mapped to stan.AckWait option.
+	// It is the AckWait of the consumer unless ConsumerAckWait is set.
 	AckWaitTimeout time.Duration
 
+	// ConsumerAckWait is the AckWait of the consumer, how long the server waits for an ack before redelivering
+	// a message (defaults to AckWaitTimeout).  It can be shorter than AckWaitTimeout, how long the subscriber waits
+	// for the handler, when InProgressInterval extends it while the handler runs.  It applies to every topic,
+	// TopicTimeouts only override AckWaitTimeout then.
+	ConsumerAckWait time.Duration
+
+	// InProgressInterval is the interval messages handled by the consumer are signaled in progress at, resetting
+	// the AckWait of the consumer.  It defaults to half ConsumerAckWait when ConsumerAckWait is shorter than
+	// AckWaitTimeout, messages are not signaled in progress otherwise.
+	InProgressInterval time.Duration
+
+	// TopicTimeouts overrides AckWaitTimeout and CloseTimeout for the topics it contains, see Timeouts.
+	TopicTimeouts map[string]Timeouts
+
 	// SubscribeTimeout determines how long subscriber will wait for a successful subscription
 	SubscribeTimeout time.Duration
 
@@ -65,6 +86,10 @@ type SubscriberConfig struct {
 	// JetstreamOptions are custom Jetstream options for a connection.
 	JetstreamOptions []nats.JSOpt
 
+	// ClientAPI is the API of the NATS client Subscribe consumes messages with (defaults to ClientAPILegacy),
+	// see ClientAPIJetStream.
+	ClientAPI ClientAPI
+
 	// Unmarshaler is an unmarshaler used to unmarshaling messages from NATS format to Watermill format.
 	Unmarshaler Unmarshaler
 
@@ -74,50 +99,251 @@ type SubscriberConfig struct {
 	// SubjectCalculator is a function used to transform a topic to an array of subjects on creation (defaults to "{topic}.*")
 	SubjectCalculator SubjectCalculator
 
+	// StreamNameCalculator calculates the name of the stream subscriptions of a topic bind to (defaults to the topic).
+	// When it is nil, subscriptions without DurableName bind to the stream matching their subject instead.
+	// Streams provisioned with AutoProvision get this name, so a stream shared by several topics must be created up front.
+	StreamNameCalculator StreamNameCalculator
+
+	// QueueGroupCalculator calculates the queue group of a topic from QueueGroup (defaults to "{QueueGroup}.{topic}").
+	// Partitions get their own group, suffixed with ".p{partition}".
+	QueueGroupCalculator QueueGroupCalculator
+
+	// DurableNameCalculator calculates the durable name of a topic from DurableName (defaults to "{DurableName}_{topic}"
+	// with dots of the topic replaced by underscores).  Partitions get their own consumer, suffixed with "_p{partition}".
+	// Changing it for existing consumers makes subscriptions create new consumers.
+	DurableNameCalculator DurableNameCalculator
+
 	// AutoProvision bypasses client validation and provisioning of streams
 	AutoProvision bool
 
+	// StreamPreset customizes the configuration of provisioned streams, e.g. InterestRetention.
+	StreamPreset StreamPreset
+
+	// RequireExistingStream makes subscribing bind to the stream of the topic (see StreamNameCalculator) and to
+	// existing durable consumers, failing with ErrStreamNotFound when the stream is missing, for environments where
+	// streams and consumers are only created through change control.  Streams and durable consumers are never
+	// created, so it can not be combined with AutoProvision.
+	RequireExistingStream bool
+
+	// VerifyCompatibility checks on subscribe that the existing stream of the topic captures its subject and that
+	// the existing durable consumer is a push consumer with explicit acks delivering it, failing with
+	// IncompatibleStreamError instead of subscribing to a consumer delivering nothing.  Consumers of work queue
+	// streams are checked not to overlap other consumers (see WorkQueueConflictError).  It costs a round trip
+	// to the server per stream and consumer.
+	VerifyCompatibility bool
+
 	// AckSync enables synchronous acknowledgement (needed for exactly once processing)
 	AckSync bool
+
+	// Retry configures tiered retries through delay streams for nacked messages
+	Retry RetryConfig
+
+	// SubscribeRetry retries provisioning and subscribing consumers failing with transient JetStream errors
+	// (e.g. timeouts or an unavailable cluster during a leader election), so subscribing survives broker
+	// failovers.  Subscribing fails at the first error when nil.
+	SubscribeRetry RetryPolicy
+
+	// UnavailableGracePeriod is how long provisioning and subscribing consumers is retried while JetStream is
+	// unavailable (no responders, JetStream not enabled or temporarily unavailable), e.g. while the server
+	// restarts.  Subscribing then fails with a JetStreamUnavailableError.  It is not retried when zero.
+	UnavailableGracePeriod time.Duration
+
+	// DeduplicationWindow skips messages delivered again while or shortly after they were processed, remembering
+	// recent message keys in memory, see DeduplicationWindowConfig.
+	DeduplicationWindow DeduplicationWindowConfig
+
+	// NakRetry delays the redelivery of nacked messages by the delay of their delivery attempt and terminates
+	// them once its attempts are exhausted.  Nacked messages are redelivered right away when nil.
+	// Retry tiers take precedence, and decisions set with SetDecision or by the Disposition are kept.
+	NakRetry RetryPolicy
+
+	// Disposition decides how messages handled through Subscribe are settled (ack, nak, term or dead letter).
+	Disposition DispositionConfig
+
+	// Quarantine preserves messages which can not be unmarshaled or transformed in a quarantine topic.
+	Quarantine QuarantineConfig
+
+	// Encoding declares the payload encodings and encryptions the subscriber decodes, messages with other ones
+	// are not delivered, see EncodingConfig.
+	Encoding EncodingConfig
+
+	// BackOff is the redelivery schedule of the consumer (e.g. 1s, 10s, 1m, 10m), used instead of redelivering every AckWait.
+	// It requires DurableName, as the consumer is created up front with this schedule.
+	BackOff []time.Duration
+
+	// MaxDeliver is the maximum number of delivery attempts of a message, it must exceed len(BackOff) when BackOff is set.
+	MaxDeliver int
+
+	// FinalAttemptThreshold flags messages delivered more than FinalAttemptThreshold times with
+	// FinalAttemptMetadataKey, so handlers can switch to compensating behavior on their last attempts.
+	// It must be lower than MaxDeliver when MaxDeliver is set, messages are not flagged when zero.
+	FinalAttemptThreshold int
+
+	// SampleFrequency is the percentage (1-100) of acks JetStream reports in ack sample advisories on
+	// AdvisoryConsumerSubject, e.g. to observe delivery latency, sampling is disabled when zero.
+	// It requires DurableName, as the consumer is created up front with this frequency.
+	SampleFrequency int
+
+	// ExactlyOnce enables the consume side of exactly-once delivery: AckSync is always used and
+	// provisioned streams get DuplicateWindow.  See the README for the constraints of exactly-once delivery.
+	ExactlyOnce bool
+
+	// DuplicateWindow is the window JetStream tracks Nats-Msg-Id values in for streams created by the subscriber
+	// (defaults to 2 minutes when ExactlyOnce is set, otherwise the server default is used)
+	DuplicateWindow time.Duration
+
+	// TenantCredentials maps tenants to the credentials file they subscribe with.  Subscriptions made with
+	// WithTenant use a connection of their tenant, opened on first use with URL and NatsOptions, other
+	// subscriptions use the default connection.
+	TenantCredentials map[string]string
+
+	// CheckpointStore records the stream sequence of every acked message per topic and subscriptions start after
+	// the saved checkpoint.  It can not be combined with DurableName, as the checkpoint replaces the consumer state.
+	// Messages may be acked out of order when SubscribersCount is greater than 1, so the checkpoint is only exact for a single subscriber.
+	CheckpointStore CheckpointStore
+
+	// Partitioning creates one consumer per assigned partition delivering one message at a time instead of
+	// SubscribersCount subscribers, see PartitionConfig.
+	Partitioning PartitionConfig
+
+	// Backpressure decides what happens to received messages while the consumer is slow (defaults to blocking),
+	// it can be overridden per subscription with WithBackpressure.
+	Backpressure BackpressureConfig
+
+	// DropExpired acks messages whose Nats-TTL elapsed without delivering them, for servers not expiring messages themselves.
+	DropExpired bool
+
+	// ReplyMetadataKey is the metadata key the NATS reply subject of received messages is stored in, so it
+	// outlives the message context (see NatsReplyFromCtx).  The reply subject is not stored when it is empty.
+	ReplyMetadataKey string
+
+	// StrictOrdering guarantees a single message of a topic is in flight at a time (MaxAckPending=1), across all
+	// instances sharing the DurableName, for workflows where global ordering is mandatory.  It requires a single
+	// subscriber and can not be combined with features delivering messages out of order (Partitioning, Retry,
+	// BackpressureNak and BackpressureBuffer).
+	StrictOrdering bool
+
+	// MaxInFlight limits the number of messages of a subscription handled concurrently (defaults to no limit),
+	// without changing how many messages the server pushes ahead, e.g. to cap parallelism of CPU-heavy handlers
+	// while SubscribersCount or Partitioning open many subscriptions.
+	MaxInFlight int
+
+	// AdaptiveConcurrency adjusts the messages handled concurrently and fetched at once from the handler latency
+	// and the ack pending level of the consumer, see AdaptiveConcurrencyConfig.
+	AdaptiveConcurrency AdaptiveConcurrencyConfig
+
+	// BatchAckMode decides how messages delivered by SubscribeBatch are acked (defaults to BatchAckPerMessage).
+	BatchAckMode BatchAckMode
+
+	// PullFetchers is the number of goroutines fetching batches concurrently in SubscribeBatch (defaults to 1),
+	// all of them delivering to the same channel, so a single subscription can keep several batches in flight.
+	PullFetchers int
+
+	// PullConsumer limits the fetch requests accepted by the pull consumers of SubscribeBatch and ClientAPIJetStream.
+	PullConsumer PullConsumerConfig
+
+	// Heartbeat enables idle heartbeats on push consumers, recreating subscriptions missing them, see HeartbeatConfig.
+	Heartbeat HeartbeatConfig
+
+	// PauseSchedule pauses consumption during daily windows, see PauseScheduleConfig.
+	PauseSchedule PauseScheduleConfig
+
+	// AckFloor reports the ack floors of the consumers of subscriptions as they advance, see AckFloorConfig.
+	AckFloor AckFloorConfig
+
+	// TopicSanitizer transforms topics before they are validated with ValidateTopic (e.g. SlashTopicSanitizer).
+	TopicSanitizer TopicSanitizer
+
+	// EscapeTopics escapes the characters of topics not allowed in NATS subjects with EscapeTopic, after
+	// TopicSanitizer.  Publishers and subscribers of a topic must agree on it.
+	EscapeTopics bool
+
+	// Transformers are applied to received messages after unmarshaling, see Transformers.
+	Transformers Transformers
+
+	// ConsumeInterceptors intercept every received message, the first one being the outermost, see ConsumeInterceptor.
+	ConsumeInterceptors []ConsumeInterceptor
+
+	// Correlation restores correlation ids from NATS headers and logs them, see CorrelationConfig.
+	Correlation CorrelationConfig
+
+	// Audit publishes a record of every ack, nak and term to an audit subject, see AuditConfig.
+	Audit AuditConfig
+
+	// ChannelDelivery delivers the messages of every subscription through a buffered channel drained by
+	// a pool of workers instead of a callback per message, see ChannelDeliveryConfig.
+	ChannelDelivery ChannelDeliveryConfig
+
+	// AckBatching sends acks in batches on an interval instead of one by one, see AckBatchingConfig.
+	// It can not be combined with AckSync (or ExactlyOnce).
+	AckBatching AckBatchingConfig
+
+	// ReleasePayloads returns the payload of every message delivered by Subscribe to a pool once it was acked
+	// or nacked, where GobMarshaler reuses it for the next messages, to reduce GC pressure at high rates.
+	// The consumer must not retain the payload (or slices of it) after acking or nacking the message.
+	// It requires GobMarshaler as Unmarshaler, as the payloads of other unmarshalers (e.g. NATSMarshaler)
+	// may share their memory with the NATS message.
+	ReleasePayloads bool
+
+	// Clock is the source of time of timeouts and retry delays (defaults to RealClock), see Clock.
+	Clock Clock
 }
 
-// SubscriberSubscriptionConfig is the configurationz
+// SubscriberSubscriptionConfig is the configuration subset needed for individual subscribe calls once a connection has been established
 type SubscriberSubscriptionConfig struct {
 	// Unmarshaler is an unmarshaler used to unmarshaling messages from NATS format to Watermill format.
 	Unmarshaler Unmarshaler
-	// QueueGroup is the JetStream queue group.
+	// Consumer names the JetStream consumers of topics, see ConsumerConfig.
+	Consumer ConsumerConfig
+
+	// QueueGroup is the deliver group of the push consumer of a topic (calculated as "{QueueGroup}.{topic}",
+	// see QueueGroupCalculator).
+	//
+	// All subscriptions with the same queue group (regardless of the connection they originate from)
+	// share the consumer, each message is delivered to only one of them.
 	//
-	// All subscriptions with the same queue name (regardless of the connection they originate from)
-	// will form a queue group. Each message will be delivered to only one subscriber per queue group,
-	// using queuing semantics.
+	// It is recommended to set it with DurableName.  Without DurableName the consumer is ephemeral and deleted
+	// once the last member leaves the group, with DurableName it is kept and members re-joining resume at the
+	// first message the consumer did not get an ack for.
 	//
-	// It is recommended to set it with DurableName.
-	// For non durable queue subscribers, when the last member leaves the group,
-	// that group is removed. A durable queue group (DurableName) allows you to have all members leave
-	// but still maintain state. When a member re-joins, it starts at the last position in that group.
+	// When QueueGroup is empty the deliver group of durable consumers is still calculated from it (".{topic}" by
+	// default), so all subscriptions of a topic share its consumer.  Without DurableName every subscription gets
+	// an ephemeral consumer of its own then, as the NATS client names consumers of deliver groups after them.
 	//
-	// When QueueGroup is empty, subscribe without QueueGroup will be used.
+	// Deprecated: use Consumer.DeliverGroup.
 	QueueGroup string
 
-	// DurableName is the JetStream durable name.
+	// DurableName is the name of the durable consumer of a topic (calculated as "{DurableName}_{topic}",
+	// see DurableNameCalculator).
 	//
-	// Subscriptions may also specify a “durable name” which will survive client restarts.
-	// Durable subscriptions cause the server to track the last acknowledged message
-	// sequence number for a client and durable name. When the client restarts/resubscribes,
-	// and uses the same client ID and durable name, the server will resume delivery beginning
-	// with the earliest unacknowledged message for this durable subscription.
+	// The server keeps a durable consumer and its ack state when subscribers disconnect, so subscriptions
+	// with the same DurableName resume with the first message which was not acked.
 	//
-	// Doing this causes the JetStream server to track
-	// the last acknowledged message for that ClientID + DurableName.
+	// Deprecated: use Consumer.Durable.
 	DurableName string
 
-	// SubscribersCount determines wow much concurrent subscribers should be started.
+	// SubscribersCount determines how many concurrent subscribers should be started.
+	// It requires QueueGroup or DurableName, so the subscribers share a consumer instead of each receiving every message.
 	SubscribersCount int
 
 	// How long subscriber should wait for Ack/Nack. When no Ack/Nack was received, message will be redelivered.
-	// It is mapped to stan.AckWait option.
+	// It is the AckWait of the consumer unless ConsumerAckWait is set.
 	AckWaitTimeout time.Duration
 
+	// ConsumerAckWait is the AckWait of the consumer, how long the server waits for an ack before redelivering
+	// a message (defaults to AckWaitTimeout).  It can be shorter than AckWaitTimeout, how long the subscriber waits
+	// for the handler, when InProgressInterval extends it while the handler runs.  It applies to every topic,
+	// TopicTimeouts only override AckWaitTimeout then.
+	ConsumerAckWait time.Duration
+
+	// InProgressInterval is the interval messages handled by the consumer are signaled in progress at, resetting
+	// the AckWait of the consumer.  It defaults to half ConsumerAckWait when ConsumerAckWait is shorter than
+	// AckWaitTimeout, messages are not signaled in progress otherwise.
+	InProgressInterval time.Duration
+
+	// TopicTimeouts overrides AckWaitTimeout and CloseTimeout for the topics it contains, see Timeouts.
+	TopicTimeouts map[string]Timeouts
+
 	// CloseTimeout determines how long subscriber will wait for Ack/Nack on close.
 	// When no Ack/Nack is received after CloseTimeout, subscriber will be closed.
 	CloseTimeout time.Duration
@@ -128,38 +354,271 @@ type SubscriberSubscriptionConfig struct {
 	// JetstreamOptions are custom Jetstream options for a connection.
 	JetstreamOptions []nats.JSOpt
 
+	// ClientAPI is the API of the NATS client Subscribe consumes messages with (defaults to ClientAPILegacy),
+	// see ClientAPIJetStream.
+	ClientAPI ClientAPI
+
 	// SubscribeOptions defines nats options to be used when subscribing
 	SubscribeOptions []nats.SubOpt
 
 	// SubjectCalculator is a function used to transform a topic to an array of subjects on creation (defaults to "{topic}.*")
 	SubjectCalculator SubjectCalculator
 
+	// StreamNameCalculator calculates the name of the stream subscriptions of a topic bind to (defaults to the topic).
+	// When it is nil, subscriptions without DurableName bind to the stream matching their subject instead.
+	// Streams provisioned with AutoProvision get this name, so a stream shared by several topics must be created up front.
+	StreamNameCalculator StreamNameCalculator
+
+	// QueueGroupCalculator calculates the queue group of a topic from QueueGroup (defaults to "{QueueGroup}.{topic}").
+	// Partitions get their own group, suffixed with ".p{partition}".
+	QueueGroupCalculator QueueGroupCalculator
+
+	// DurableNameCalculator calculates the durable name of a topic from DurableName (defaults to "{DurableName}_{topic}"
+	// with dots of the topic replaced by underscores).  Partitions get their own consumer, suffixed with "_p{partition}".
+	// Changing it for existing consumers makes subscriptions create new consumers.
+	DurableNameCalculator DurableNameCalculator
+
 	// AutoProvision bypasses client validation and provisioning of streams
 	AutoProvision bool
 
+	// StreamPreset customizes the configuration of provisioned streams, e.g. InterestRetention.
+	StreamPreset StreamPreset
+
+	// RequireExistingStream makes subscribing bind to the stream of the topic (see StreamNameCalculator) and to
+	// existing durable consumers, failing with ErrStreamNotFound when the stream is missing, for environments where
+	// streams and consumers are only created through change control.  Streams and durable consumers are never
+	// created, so it can not be combined with AutoProvision.
+	RequireExistingStream bool
+
+	// VerifyCompatibility checks on subscribe that the existing stream of the topic captures its subject and that
+	// the existing durable consumer is a push consumer with explicit acks delivering it, failing with
+	// IncompatibleStreamError instead of subscribing to a consumer delivering nothing.  Consumers of work queue
+	// streams are checked not to overlap other consumers (see WorkQueueConflictError).  It costs a round trip
+	// to the server per stream and consumer.
+	VerifyCompatibility bool
+
 	// AckSync enables synchronous acknowledgement (needed for exactly once processing)
 	AckSync bool
+
+	// Retry configures tiered retries through delay streams for nacked messages
+	Retry RetryConfig
+
+	// SubscribeRetry retries provisioning and subscribing consumers failing with transient JetStream errors
+	// (e.g. timeouts or an unavailable cluster during a leader election), so subscribing survives broker
+	// failovers.  Subscribing fails at the first error when nil.
+	SubscribeRetry RetryPolicy
+
+	// UnavailableGracePeriod is how long provisioning and subscribing consumers is retried while JetStream is
+	// unavailable (no responders, JetStream not enabled or temporarily unavailable), e.g. while the server
+	// restarts.  Subscribing then fails with a JetStreamUnavailableError.  It is not retried when zero.
+	UnavailableGracePeriod time.Duration
+
+	// DeduplicationWindow skips messages delivered again while or shortly after they were processed, remembering
+	// recent message keys in memory, see DeduplicationWindowConfig.
+	DeduplicationWindow DeduplicationWindowConfig
+
+	// NakRetry delays the redelivery of nacked messages by the delay of their delivery attempt and terminates
+	// them once its attempts are exhausted.  Nacked messages are redelivered right away when nil.
+	// Retry tiers take precedence, and decisions set with SetDecision or by the Disposition are kept.
+	NakRetry RetryPolicy
+
+	// Disposition decides how messages handled through Subscribe are settled (ack, nak, term or dead letter).
+	Disposition DispositionConfig
+
+	// Quarantine preserves messages which can not be unmarshaled or transformed in a quarantine topic.
+	Quarantine QuarantineConfig
+
+	// Encoding declares the payload encodings and encryptions the subscriber decodes, messages with other ones
+	// are not delivered, see EncodingConfig.
+	Encoding EncodingConfig
+
+	// BackOff is the redelivery schedule of the consumer (e.g. 1s, 10s, 1m, 10m), used instead of redelivering every AckWait.
+	// It requires DurableName, as the consumer is created up front with this schedule.
+	BackOff []time.Duration
+
+	// MaxDeliver is the maximum number of delivery attempts of a message, it must exceed len(BackOff) when BackOff is set.
+	MaxDeliver int
+
+	// FinalAttemptThreshold flags messages delivered more than FinalAttemptThreshold times with
+	// FinalAttemptMetadataKey, so handlers can switch to compensating behavior on their last attempts.
+	// It must be lower than MaxDeliver when MaxDeliver is set, messages are not flagged when zero.
+	FinalAttemptThreshold int
+
+	// SampleFrequency is the percentage (1-100) of acks JetStream reports in ack sample advisories on
+	// AdvisoryConsumerSubject, e.g. to observe delivery latency, sampling is disabled when zero.
+	// It requires DurableName, as the consumer is created up front with this frequency.
+	SampleFrequency int
+
+	// ExactlyOnce enables the consume side of exactly-once delivery: AckSync is always used and
+	// provisioned streams get DuplicateWindow.  See the README for the constraints of exactly-once delivery.
+	ExactlyOnce bool
+
+	// DuplicateWindow is the window JetStream tracks Nats-Msg-Id values in for streams created by the subscriber
+	// (defaults to 2 minutes when ExactlyOnce is set, otherwise the server default is used)
+	DuplicateWindow time.Duration
+
+	// CheckpointStore records the stream sequence of every acked message per topic and subscriptions start after
+	// the saved checkpoint.  It can not be combined with DurableName, as the checkpoint replaces the consumer state.
+	// Messages may be acked out of order when SubscribersCount is greater than 1, so the checkpoint is only exact for a single subscriber.
+	CheckpointStore CheckpointStore
+
+	// Partitioning creates one consumer per assigned partition delivering one message at a time instead of
+	// SubscribersCount subscribers, see PartitionConfig.
+	Partitioning PartitionConfig
+
+	// Backpressure decides what happens to received messages while the consumer is slow (defaults to blocking),
+	// it can be overridden per subscription with WithBackpressure.
+	Backpressure BackpressureConfig
+
+	// DropExpired acks messages whose Nats-TTL elapsed without delivering them, for servers not expiring messages themselves.
+	DropExpired bool
+
+	// ReplyMetadataKey is the metadata key the NATS reply subject of received messages is stored in, so it
+	// outlives the message context (see NatsReplyFromCtx).  The reply subject is not stored when it is empty.
+	ReplyMetadataKey string
+
+	// StrictOrdering guarantees a single message of a topic is in flight at a time (MaxAckPending=1), across all
+	// instances sharing the DurableName, for workflows where global ordering is mandatory.  It requires a single
+	// subscriber and can not be combined with features delivering messages out of order (Partitioning, Retry,
+	// BackpressureNak and BackpressureBuffer).
+	StrictOrdering bool
+
+	// MaxInFlight limits the number of messages of a subscription handled concurrently (defaults to no limit),
+	// without changing how many messages the server pushes ahead, e.g. to cap parallelism of CPU-heavy handlers
+	// while SubscribersCount or Partitioning open many subscriptions.
+	MaxInFlight int
+
+	// AdaptiveConcurrency adjusts the messages handled concurrently and fetched at once from the handler latency
+	// and the ack pending level of the consumer, see AdaptiveConcurrencyConfig.
+	AdaptiveConcurrency AdaptiveConcurrencyConfig
+
+	// BatchAckMode decides how messages delivered by SubscribeBatch are acked (defaults to BatchAckPerMessage).
+	BatchAckMode BatchAckMode
+
+	// PullFetchers is the number of goroutines fetching batches concurrently in SubscribeBatch (defaults to 1),
+	// all of them delivering to the same channel, so a single subscription can keep several batches in flight.
+	PullFetchers int
+
+	// PullConsumer limits the fetch requests accepted by the pull consumers of SubscribeBatch and ClientAPIJetStream.
+	PullConsumer PullConsumerConfig
+
+	// Heartbeat enables idle heartbeats on push consumers, recreating subscriptions missing them, see HeartbeatConfig.
+	Heartbeat HeartbeatConfig
+
+	// PauseSchedule pauses consumption during daily windows, see PauseScheduleConfig.
+	PauseSchedule PauseScheduleConfig
+
+	// AckFloor reports the ack floors of the consumers of subscriptions as they advance, see AckFloorConfig.
+	AckFloor AckFloorConfig
+
+	// TopicSanitizer transforms topics before they are validated with ValidateTopic (e.g. SlashTopicSanitizer).
+	TopicSanitizer TopicSanitizer
+
+	// EscapeTopics escapes the characters of topics not allowed in NATS subjects with EscapeTopic, after
+	// TopicSanitizer.  Publishers and subscribers of a topic must agree on it.
+	EscapeTopics bool
+
+	// Transformers are applied to received messages after unmarshaling, see Transformers.
+	Transformers Transformers
+
+	// ConsumeInterceptors intercept every received message, the first one being the outermost, see ConsumeInterceptor.
+	ConsumeInterceptors []ConsumeInterceptor
+
+	// Correlation restores correlation ids from NATS headers and logs them, see CorrelationConfig.
+	Correlation CorrelationConfig
+
+	// Audit publishes a record of every ack, nak and term to an audit subject, see AuditConfig.
+	Audit AuditConfig
+
+	// ChannelDelivery delivers the messages of every subscription through a buffered channel drained by
+	// a pool of workers instead of a callback per message, see ChannelDeliveryConfig.
+	ChannelDelivery ChannelDeliveryConfig
+
+	// AckBatching sends acks in batches on an interval instead of one by one, see AckBatchingConfig.
+	// It can not be combined with AckSync (or ExactlyOnce).
+	AckBatching AckBatchingConfig
+
+	// ReleasePayloads returns the payload of every message delivered by Subscribe to a pool once it was acked
+	// or nacked, where GobMarshaler reuses it for the next messages, to reduce GC pressure at high rates.
+	// The consumer must not retain the payload (or slices of it) after acking or nacking the message.
+	// It requires GobMarshaler as Unmarshaler, as the payloads of other unmarshalers (e.g. NATSMarshaler)
+	// may share their memory with the NATS message.
+	ReleasePayloads bool
+
+	// Clock is the source of time of timeouts and retry delays (defaults to RealClock), see Clock.
+	Clock Clock
 }
 
 // GetSubscriberSubscriptionConfig gets the configuration subset needed for individual subscribe calls once a connection has been established
 func (c *SubscriberConfig) GetSubscriberSubscriptionConfig() SubscriberSubscriptionConfig {
 	return SubscriberSubscriptionConfig{
-		Unmarshaler:       c.Unmarshaler,
-		QueueGroup:        c.QueueGroup,
-		DurableName:       c.DurableName,
-		SubscribersCount:  c.SubscribersCount,
-		AckWaitTimeout:    c.AckWaitTimeout,
-		CloseTimeout:      c.CloseTimeout,
-		SubscribeTimeout:  c.SubscribeTimeout,
-		SubscribeOptions:  c.SubscribeOptions,
-		SubjectCalculator: c.SubjectCalculator,
-		AutoProvision:     c.AutoProvision,
-		JetstreamOptions:  c.JetstreamOptions,
-		AckSync:           c.AckSync,
+		Unmarshaler:            c.Unmarshaler,
+		Consumer:               c.Consumer,
+		QueueGroup:             c.QueueGroup,
+		DurableName:            c.DurableName,
+		SubscribersCount:       c.SubscribersCount,
+		AckWaitTimeout:         c.AckWaitTimeout,
+		ConsumerAckWait:        c.ConsumerAckWait,
+		InProgressInterval:     c.InProgressInterval,
+		TopicTimeouts:          c.TopicTimeouts,
+		CloseTimeout:           c.CloseTimeout,
+		SubscribeTimeout:       c.SubscribeTimeout,
+		SubscribeOptions:       c.SubscribeOptions,
+		SubjectCalculator:      c.SubjectCalculator,
+		StreamNameCalculator:   c.StreamNameCalculator,
+		QueueGroupCalculator:   c.QueueGroupCalculator,
+		DurableNameCalculator:  c.DurableNameCalculator,
+		AutoProvision:          c.AutoProvision,
+		StreamPreset:           c.StreamPreset,
+		RequireExistingStream:  c.RequireExistingStream,
+		VerifyCompatibility:    c.VerifyCompatibility,
+		JetstreamOptions:       c.JetstreamOptions,
+		ClientAPI:              c.ClientAPI,
+		AckSync:                c.AckSync,
+		Retry:                  c.Retry,
+		NakRetry:               c.NakRetry,
+		SubscribeRetry:         c.SubscribeRetry,
+		UnavailableGracePeriod: c.UnavailableGracePeriod,
+		DeduplicationWindow:    c.DeduplicationWindow,
+		Disposition:            c.Disposition,
+		Quarantine:             c.Quarantine,
+		Encoding:               c.Encoding,
+		BackOff:                c.BackOff,
+		MaxDeliver:             c.MaxDeliver,
+		FinalAttemptThreshold:  c.FinalAttemptThreshold,
+		SampleFrequency:        c.SampleFrequency,
+		ExactlyOnce:            c.ExactlyOnce,
+		DuplicateWindow:        c.DuplicateWindow,
+		CheckpointStore:        c.CheckpointStore,
+		Partitioning:           c.Partitioning,
+		Backpressure:           c.Backpressure,
+		DropExpired:            c.DropExpired,
+		ReplyMetadataKey:       c.ReplyMetadataKey,
+		StrictOrdering:         c.StrictOrdering,
+		MaxInFlight:            c.MaxInFlight,
+		AdaptiveConcurrency:    c.AdaptiveConcurrency,
+		BatchAckMode:           c.BatchAckMode,
+		PullFetchers:           c.PullFetchers,
+		PullConsumer:           c.PullConsumer,
+		Heartbeat:              c.Heartbeat,
+		PauseSchedule:          c.PauseSchedule,
+		AckFloor:               c.AckFloor,
+		ReleasePayloads:        c.ReleasePayloads,
+		Clock:                  c.Clock,
+		ChannelDelivery:        c.ChannelDelivery,
+		AckBatching:            c.AckBatching,
+		TopicSanitizer:         c.TopicSanitizer,
+		EscapeTopics:           c.EscapeTopics,
+		Transformers:           c.Transformers,
+		ConsumeInterceptors:    c.ConsumeInterceptors,
+		Correlation:            c.Correlation,
+		Audit:                  c.Audit,
 	}
 }
 
 func (c *SubscriberSubscriptionConfig) setDefaults() {
+	c.Consumer.apply(&c.DurableName, &c.QueueGroup)
+
 	if c.SubscribersCount <= 0 {
 		c.SubscribersCount = 1
 	}
@@ -169,34 +628,195 @@ func (c *SubscriberSubscriptionConfig) setDefaults() {
 	if c.AckWaitTimeout <= 0 {
 		c.AckWaitTimeout = time.Second * 30
 	}
+	if c.InProgressInterval == 0 && c.ConsumerAckWait > 0 && c.ConsumerAckWait < c.AckWaitTimeout {
+		c.InProgressInterval = c.ConsumerAckWait / 2
+	}
 	if c.SubscribeTimeout <= 0 {
 		c.SubscribeTimeout = time.Second * 30
 	}
+	if c.PullFetchers <= 0 {
+		c.PullFetchers = 1
+	}
 
 	if c.SubjectCalculator == nil {
 		c.SubjectCalculator = defaultSubjectCalculator
 	}
+	if c.Clock == nil {
+		c.Clock = RealClock{}
+	}
+
+	c.Retry.setDefaults()
+	c.Disposition.setDefaults()
+	c.Quarantine.setDefaults()
+	c.Partitioning.setDefaults()
+	c.Backpressure.setDefaults()
+	c.ChannelDelivery.setDefaults()
+	c.AckBatching.setDefaults()
+	c.Correlation.setDefaults()
+	c.PauseSchedule.setDefaults()
+	c.AckFloor.setDefaults()
+	c.DeduplicationWindow.setDefaults()
+	c.AdaptiveConcurrency.setDefaults()
+	if c.AdaptiveConcurrency.Max == 0 {
+		c.AdaptiveConcurrency.Max = c.MaxInFlight
+	}
+
+	if c.ExactlyOnce {
+		c.AckSync = true
+
+		if c.DuplicateWindow <= 0 {
+			c.DuplicateWindow = defaultDuplicateWindow
+		}
+	}
 }
 
 // Validate ensures configuration is valid before use
 func (c *SubscriberSubscriptionConfig) Validate() error {
+	var errs ConfigErrors
+
 	if c.Unmarshaler == nil {
-		return errors.New("SubscriberConfig.Unmarshaler is missing")
+		errs.add("SubscriberConfig.Unmarshaler", "missing")
 	}
 
-	if c.QueueGroup == "" && c.SubscribersCount > 1 {
-		return errors.New(
-			"to set SubscriberConfig.SubscribersCount " +
-				"you need to also set SubscriberConfig.QueueGroup, " +
-				"in other case you will receive duplicated messages",
-		)
+	c.Consumer.validate(&errs, c.DurableName, c.QueueGroup)
+
+	// the subscriptions of a subscriber share a deliver group, so a durable consumer balances messages between them
+	// even without QueueGroup, while ephemeral subscriptions would each get their own consumer
+	if c.QueueGroup == "" && c.DurableName == "" && c.SubscribersCount > 1 {
+		errs.add("SubscriberConfig.QueueGroup", "QueueGroup or DurableName is required when SubscriberConfig.SubscribersCount "+
+			"is greater than 1, in other case you will receive duplicated messages")
 	}
 
 	if c.SubjectCalculator == nil {
-		return errors.New("SubscriberSubscriptionConfig.SubjectCalculator is required.")
+		errs.add("SubscriberConfig.SubjectCalculator", "missing")
 	}
 
-	return nil
+	if invalid := invalidNameChars(c.DurableName); invalid != "" {
+		errs.add("SubscriberConfig.DurableName", "contains invalid characters "+invalid)
+	}
+
+	if c.AckWaitTimeout < 0 {
+		errs.add("SubscriberConfig.AckWaitTimeout", "can not be negative")
+	}
+	if c.UnavailableGracePeriod < 0 {
+		errs.add("SubscriberConfig.UnavailableGracePeriod", "can not be negative")
+	}
+	if c.ConsumerAckWait < 0 {
+		errs.add("SubscriberConfig.ConsumerAckWait", "can not be negative")
+	}
+	if c.InProgressInterval < 0 {
+		errs.add("SubscriberConfig.InProgressInterval", "can not be negative")
+	}
+	if c.InProgressInterval > 0 && c.InProgressInterval >= c.consumerAckWait(c.AckWaitTimeout) {
+		errs.add("SubscriberConfig.InProgressInterval", "must be shorter than the AckWait of the consumer")
+	}
+	if c.CloseTimeout < 0 {
+		errs.add("SubscriberConfig.CloseTimeout", "can not be negative")
+	}
+	if c.SubscribeTimeout < 0 {
+		errs.add("SubscriberConfig.SubscribeTimeout", "can not be negative")
+	}
+
+	if len(c.BackOff) > 0 {
+		if c.DurableName == "" {
+			errs.add("SubscriberConfig.BackOff", "requires SubscriberConfig.DurableName")
+		}
+		if c.MaxDeliver <= len(c.BackOff) {
+			errs.add("SubscriberConfig.MaxDeliver", "must be greater than the number of SubscriberConfig.BackOff values")
+		}
+	}
+
+	if c.FinalAttemptThreshold < 0 {
+		errs.add("SubscriberConfig.FinalAttemptThreshold", "can not be negative")
+	}
+	if c.FinalAttemptThreshold > 0 && c.MaxDeliver > 0 && c.FinalAttemptThreshold >= c.MaxDeliver {
+		errs.add("SubscriberConfig.FinalAttemptThreshold", "must be lower than SubscriberConfig.MaxDeliver")
+	}
+
+	if c.SampleFrequency < 0 || c.SampleFrequency > 100 {
+		errs.add("SubscriberConfig.SampleFrequency", "must be between 0 and 100")
+	}
+	if c.SampleFrequency > 0 && c.DurableName == "" {
+		errs.add("SubscriberConfig.SampleFrequency", "requires SubscriberConfig.DurableName")
+	}
+
+	if c.RequireExistingStream && c.AutoProvision {
+		errs.add("SubscriberConfig.RequireExistingStream", "can not be combined with SubscriberConfig.AutoProvision")
+	}
+
+	if c.CheckpointStore != nil && c.DurableName != "" {
+		errs.add("SubscriberConfig.CheckpointStore", "can not be combined with SubscriberConfig.DurableName")
+	}
+
+	errs.addErr("SubscriberConfig.Partitioning", c.Partitioning.Validate())
+	errs.addErr("SubscriberConfig.Retry", c.Retry.Validate())
+	errs.addErr("SubscriberConfig.Backpressure", c.Backpressure.Validate())
+	errs.addErr("SubscriberConfig.Encoding", c.Encoding.Validate())
+	errs.addErr("SubscriberConfig.ChannelDelivery", c.ChannelDelivery.Validate())
+	errs.addErr("SubscriberConfig.AckBatching", c.AckBatching.Validate())
+	errs.addErr("SubscriberConfig.PullConsumer", c.PullConsumer.Validate())
+	errs.addErr("SubscriberConfig.Heartbeat", c.Heartbeat.Validate())
+	errs.addErr("SubscriberConfig.PauseSchedule", c.PauseSchedule.Validate())
+	errs.addErr("SubscriberConfig.AckFloor", c.AckFloor.Validate())
+	errs.addErr("SubscriberConfig.Audit", c.Audit.Validate())
+	errs.addErr("SubscriberConfig.NakRetry", validateRetryPolicy(c.NakRetry))
+	errs.addErr("SubscriberConfig.SubscribeRetry", validateRetryPolicy(c.SubscribeRetry))
+	errs.addErr("SubscriberConfig.DeduplicationWindow", c.DeduplicationWindow.Validate())
+	errs.addErr("SubscriberConfig.AdaptiveConcurrency", c.AdaptiveConcurrency.Validate())
+
+	topics := make([]string, 0, len(c.TopicTimeouts))
+	for topic := range c.TopicTimeouts {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	for _, topic := range topics {
+		errs.addErr(fmt.Sprintf("SubscriberConfig.TopicTimeouts[%s]", topic), c.TopicTimeouts[topic].Validate())
+	}
+
+	// heartbeats are not supported on queue subscriptions
+	if c.Heartbeat.enabled() {
+		if c.QueueGroup != "" {
+			errs.add("SubscriberConfig.Heartbeat", "can not be combined with SubscriberConfig.QueueGroup")
+		}
+		if c.SubscribersCount > 1 {
+			errs.add("SubscriberConfig.Heartbeat", "requires a single subscriber (SubscriberConfig.SubscribersCount)")
+		}
+	}
+
+	if c.AckBatching.enabled() && c.AckSync {
+		errs.add("SubscriberConfig.AckBatching", "can not be combined with SubscriberConfig.AckSync")
+	}
+
+	if c.ReleasePayloads && c.Unmarshaler != nil && !poolsPayloads(c.Unmarshaler) {
+		errs.add("SubscriberConfig.ReleasePayloads", "requires GobMarshaler as Unmarshaler")
+	}
+
+	if c.Partitioning.enabled() && c.CheckpointStore != nil {
+		errs.add("SubscriberConfig.CheckpointStore", "can not be combined with SubscriberConfig.Partitioning")
+	}
+
+	if c.MaxInFlight < 0 {
+		errs.add("SubscriberConfig.MaxInFlight", "can not be negative")
+	}
+
+	if c.StrictOrdering {
+		if c.SubscribersCount > 1 {
+			errs.add("SubscriberConfig.StrictOrdering", "requires a single subscriber (SubscriberConfig.SubscribersCount)")
+		}
+		if c.Partitioning.enabled() {
+			errs.add("SubscriberConfig.StrictOrdering", "can not be combined with SubscriberConfig.Partitioning")
+		}
+		if c.Retry.enabled() {
+			errs.add("SubscriberConfig.StrictOrdering", "can not be combined with SubscriberConfig.Retry")
+		}
+		if c.Backpressure.Policy != BackpressureBlock {
+			errs.add("SubscriberConfig.StrictOrdering", "requires the BackpressureBlock policy")
+		}
+	}
+
+	c.validateClientAPI(&errs)
+
+	return errs.err()
 }
 
 // Subscriber provides the jetstream implementation for watermill subscribe operations
@@ -206,14 +826,42 @@ type Subscriber struct {
 
 	config SubscriberSubscriptionConfig
 
-	subsLock sync.RWMutex
-
-	closed  bool
+	// closed is set atomically by the first Close, closing is closed at the same time,
+	// so the message path checks the closed state without taking a lock
+	closed  uint32
 	closing chan struct{}
 
+	// intakeStopped is set atomically by StopIntake, intakeStopping is closed at the same time
+	intakeStopped  uint32
+	intakeLock     sync.Mutex
+	intakeStopping chan struct{}
+
+	// pausedUntilNano is the time consumption resumes at (in Unix nanoseconds) while it is paused by
+	// PauseScheduleConfig, zero otherwise, it is accessed atomically
+	pausedUntilNano int64
+
 	outputsWg        sync.WaitGroup
 	js               nats.JetStream
+	acker            msgAcker
 	topicInterpreter *topicInterpreter
+
+	// ackBatcher is set when acks are batched, see AckBatchingConfig
+	ackBatcher *batchingAcker
+
+	// tenants is set when subscribing with per-tenant connections
+	tenants *tenantSubscribers
+
+	// subscriptions are the running subscriptions, reported by CloseWithContext
+	subscriptions subscriptionRegistry
+
+	// watchdog is set when subscriptions missing heartbeats are recreated, see HeartbeatConfig
+	watchdog *heartbeatWatchdog
+
+	// dedup is set when redelivered messages are skipped, see DeduplicationWindowConfig
+	dedup *dedupWindow
+
+	// jsAPI is set when Subscribe consumes with ClientAPIJetStream
+	jsAPI natsjs.JetStream
 }
 
 // NewSubscriber creates a new Subscriber.
@@ -222,7 +870,30 @@ func NewSubscriber(config SubscriberConfig, logger watermill.LoggerAdapter) (*Su
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot connect to NATS")
 	}
-	return NewSubscriberWithNatsConn(conn, config.GetSubscriberSubscriptionConfig(), logger)
+	sub, err := NewSubscriberWithNatsConn(conn, config.GetSubscriberSubscriptionConfig(), logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(config.TenantCredentials) > 0 {
+		// topics were already sanitized by the subscriber routing them to tenants
+		tenantConfig := sub.config
+		tenantConfig.TopicSanitizer = nil
+		tenantConfig.EscapeTopics = false
+
+		sub.tenants = &tenantSubscribers{
+			connector: tenantConnector{
+				url:         config.URL,
+				options:     config.NatsOptions,
+				credentials: config.TenantCredentials,
+			},
+			config:      tenantConfig,
+			logger:      sub.logger,
+			subscribers: map[string]*Subscriber{},
+		}
+	}
+
+	return sub, nil
 }
 
 // NewSubscriberWithNatsConn creates a new Subscriber with the provided nats connection.
@@ -243,166 +914,660 @@ func NewSubscriberWithNatsConn(conn *nats.Conn, config SubscriberSubscriptionCon
 		return nil, err
 	}
 
-	return &Subscriber{
+	s := &Subscriber{
 		conn:             conn,
 		logger:           logger,
 		config:           config,
 		closing:          make(chan struct{}),
 		js:               js,
-		topicInterpreter: newTopicInterpreter(js, config.SubjectCalculator),
-	}, nil
+		acker:            natsAcker{},
+		topicInterpreter: newSubscriberTopicInterpreter(js, config),
+	}
+
+	if config.ClientAPI == ClientAPIJetStream {
+		if s.jsAPI, err = natsjs.New(conn); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.AckBatching.enabled() {
+		s.ackBatcher = newBatchingAcker(s.acker, conn.Flush, config.AckBatching, config.Clock, logger)
+		s.acker = s.ackBatcher
+	}
+
+	if config.Audit.enabled() {
+		s.acker = auditAcker{msgAcker: s.acker, auditor: newAuditor(config.Audit, js, logger)}
+	}
+
+	if config.Heartbeat.enabled() {
+		s.watchdog = newHeartbeatWatchdog(config.Heartbeat, config.Clock, logger, s.closing)
+		s.watchdog.install(conn)
+	}
+
+	if config.DeduplicationWindow.enabled() {
+		s.dedup = newDedupWindow(config.DeduplicationWindow, config.Clock)
+	}
+
+	if config.PauseSchedule.enabled() {
+		go s.runPauseSchedule()
+	}
+
+	return s, nil
+}
+
+// newSubscriberTopicInterpreter creates the topic interpreter of a subscriber, with the calculators of config.
+func newSubscriberTopicInterpreter(js nats.JetStreamManager, config SubscriberSubscriptionConfig) *topicInterpreter {
+	b := newTopicInterpreter(js, config.SubjectCalculator, config.DuplicateWindow)
+	b.streamPreset = config.StreamPreset
+	if config.StreamNameCalculator != nil {
+		b.streamNameCalculator = config.StreamNameCalculator
+	}
+	if config.QueueGroupCalculator != nil {
+		b.queueGroupCalculator = config.QueueGroupCalculator
+	}
+	if config.DurableNameCalculator != nil {
+		b.durableNameCalculator = config.DurableNameCalculator
+	}
+
+	return b
 }
 
 // Subscribe subscribes messages from JetStream.
+//
+// The start position of the subscription can be overridden with WithStartPosition.
 func (s *Subscriber) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	output, _, err := s.SubscribeWithHandle(ctx, topic)
+	return output, err
+}
+
+// SubscribeWithHandle subscribes messages from JetStream like Subscribe, also returning a handle on the consumers
+// of the subscription, see SubscriptionHandle.
+func (s *Subscriber) SubscribeWithHandle(ctx context.Context, topic string) (<-chan *message.Message, *SubscriptionHandle, error) {
+	topic, err := sanitizeTopic(topic, s.config.TopicSanitizer, s.config.EscapeTopics, s.config.AutoProvision)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if tenant, ok := TenantFromCtx(ctx); ok && s.tenants != nil {
+		sub, err := s.tenants.get(tenant)
+		if err != nil {
+			return nil, nil, err
+		}
+		return sub.SubscribeWithHandle(ctx, topic)
+	}
+
+	ctx = withTopic(ctx, topic)
+
+	if s.jsAPI != nil {
+		return s.consumeWithHandle(ctx, topic)
+	}
+
 	output := make(chan *message.Message)
+	handle := &SubscriptionHandle{topic: topic, js: s.topicInterpreter.js}
+
+	var startOpts []nats.SubOpt
+	if pos, ok := StartPositionFromCtx(ctx); ok {
+		startOpts = append(startOpts, pos.startOption())
+	} else if s.config.CheckpointStore != nil {
+		opts, err := s.checkpointStartOptions(ctx, topic)
+		if err != nil {
+			return nil, nil, err
+		}
+		startOpts = opts
+	}
+
+	if ephemeral, ok := EphemeralConsumerFromCtx(ctx); ok {
+		if s.config.DurableName != "" {
+			return nil, nil, errors.New("ephemeral consumers can not be configured for a durable subscription")
+		}
+		if err := ephemeral.Validate(); err != nil {
+			return nil, nil, err
+		}
+		startOpts = append(startOpts, ephemeral.subOpts()...)
+	}
+
+	targets := s.subscriptionTargets(ctx, topic)
+
+	backpressure := s.backpressureConfig(ctx)
+	if err := backpressure.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	timeouts := s.subscriptionTimeouts(ctx, topic)
+	if err := timeouts.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	var inFlight concurrencyLimiter = newInFlightLimiter(s.config.MaxInFlight)
+	var adaptive *adaptiveLimit
+	if s.config.AdaptiveConcurrency.enabled() {
+		adaptive = newAdaptiveLimit(s.config.AdaptiveConcurrency, s.config.AdaptiveConcurrency.Max)
+		inFlight = adaptive
+	}
+
+	// the context of the messages of the subscription, cancelled once it stopped
+	handlerCtx, cancelHandlers := context.WithCancel(ctx)
 
 	s.outputsWg.Add(1)
 	outputWg := &sync.WaitGroup{}
+	states := make([]*subscriptionState, 0, len(targets))
 
-	for i := 0; i < s.config.SubscribersCount; i++ {
+	for i, target := range targets {
 		outputWg.Add(1)
 
-		subscriberLogFields := watermill.LogFields{
+		subscriberLogFields := subscriptionLogFields(ctx, watermill.LogFields{
 			"subscriber_num": i,
 			"topic":          topic,
+		})
+		if target.partition != nil {
+			subscriberLogFields["partition"] = *target.partition
 		}
 
 		s.logger.Debug("Starting subscriber", subscriberLogFields)
 
-		sub, err := s.subscribe(topic, func(msg *nats.Msg) {
-			s.processMessage(ctx, msg, output, subscriberLogFields)
-		})
+		handler := &subscriptionHandler{
+			ctx:          handlerCtx,
+			topic:        topic,
+			output:       output,
+			backpressure: backpressure,
+			timeouts:     timeouts,
+			logFields:    subscriberLogFields,
+		}
+		state := s.subscriptions.track(topic, i, handler)
+		states = append(states, state)
+
+		cb := func(msg *nats.Msg) {
+			if !inFlight.acquire(ctx, s.closing) {
+				return
+			}
+			defer inFlight.release()
+
+			if adaptive == nil {
+				s.processMessage(handler, msg)
+				return
+			}
+
+			start := s.now()
+			s.processMessage(handler, msg)
+			adaptive.observe(s.now().Sub(start))
+		}
+		if backpressure.Policy == BackpressureBuffer {
+			outputWg.Add(1)
+			cb = s.bufferedHandler(ctx, cb, backpressure.BufferSize, subscriberLogFields, outputWg.Done)
+		}
+
+		deliver := s.callbackDelivery(cb)
+		if s.config.ChannelDelivery.enabled() {
+			ch := make(chan *nats.Msg, s.config.ChannelDelivery.BufferSize)
+			outputWg.Add(s.config.ChannelDelivery.Workers)
+			s.startDeliveryWorkers(ctx, ch, cb, outputWg.Done)
+			deliver = s.channelDelivery(ch)
+		}
+
+		sub, err := s.subscribeTargetWith(topic, target, deliver, startOpts...)
 		if err != nil {
-			return nil, errors.Wrap(err, "cannot subscribe")
+			s.subscriptions.untrack(state)
+			cancelHandlers()
+			return nil, nil, errors.Wrap(err, "cannot subscribe")
 		}
 
+		var watched *watchedSubscription
+		if s.watchdog != nil {
+			target := target
+			watched = s.watchdog.watch(sub, topic, func() (*nats.Subscription, error) {
+				return s.subscribeTargetWith(topic, target, deliver, startOpts...)
+			}, subscriberLogFields)
+			handle.add(target.partition, watched.current)
+		} else {
+			current := sub
+			handle.add(target.partition, func() *nats.Subscription { return current })
+		}
+
+		// do not unsubscribe if it is a durable subscription
+		// if the lib created the subscription, it will delete it!!!!!!
+		// only delete if the durable name is not set or the consumer was bound
+		unsubscribe := s.config.DurableName == "" || s.bindsConsumer(target)
+
 		go func(subscriber *nats.Subscription, subscriberLogFields watermill.LogFields) {
 			defer outputWg.Done()
+			defer state.stop()
+
 			select {
 			case <-s.closing:
 				// unblock
 			case <-ctx.Done():
 				// unblock
+			case <-s.intakeStoppingChan():
+				if watched != nil {
+					subscriber = s.watchdog.unwatch(watched)
+					watched = nil
+				}
+
+				// messages are not pushed to this subscriber anymore, so they are delivered to the other
+				// subscribers of the consumer instead of being nacked back to it until MaxDeliver is exhausted
+				if unsubscribe {
+					if err := subscriber.Unsubscribe(); err != nil {
+						s.logger.Error("Cannot unsubscribe", err, subscriberLogFields)
+					}
+				} else if err := detachSubscription(subscriber); err != nil {
+					s.logger.Error("Cannot detach subscription", err, subscriberLogFields)
+				}
+
+				select {
+				case <-s.closing:
+				case <-ctx.Done():
+				}
+				return
 			}
 
-			// do not unsubscribe if it is a durable subscription
-			// if the lib created the subscription, it will delete it!!!!!!
-			// only delete if the durable name is not set
-			if s.config.DurableName == "" {
-				if err := sub.Unsubscribe(); err != nil {
+			if watched != nil {
+				subscriber = s.watchdog.unwatch(watched)
+			}
+
+			if unsubscribe {
+				if err := subscriber.Unsubscribe(); err != nil {
 					s.logger.Error("Cannot unsubscribe", err, subscriberLogFields)
 				}
 			}
 		}(sub, subscriberLogFields)
 	}
 
+	if s.config.AckFloor.enabled() {
+		outputWg.Add(1)
+		go func() {
+			defer outputWg.Done()
+			s.watchAckFloors(ctx, handle, subscriptionLogFields(ctx, watermill.LogFields{"topic": topic}))
+		}()
+	}
+
+	if adaptive != nil {
+		outputWg.Add(1)
+		go func() {
+			defer outputWg.Done()
+			s.adaptConcurrency(ctx, adaptive, func() ([]*nats.ConsumerInfo, error) {
+				return handle.ConsumerInfo(ctx)
+			}, subscriptionLogFields(ctx, watermill.LogFields{"topic": topic}))
+		}()
+	}
+
 	go func() {
 		defer s.outputsWg.Done()
 		outputWg.Wait()
+		cancelHandlers()
 		close(output)
+		s.subscriptions.untrack(states...)
 	}()
 
-	return output, nil
+	return output, handle, nil
 }
 
-// SubscribeInitialize offers a way to ensure the stream for a topic exists prior to subscribe
+// SubscribeFrom subscribes messages from JetStream starting at pos, see WithStartPosition.
+func (s *Subscriber) SubscribeFrom(ctx context.Context, topic string, pos StreamPosition) (<-chan *message.Message, error) {
+	return s.Subscribe(WithStartPosition(ctx, pos), topic)
+}
+
+// SubscribeInitialize offers a way to ensure the stream for a topic exists prior to subscribe.
+//
+// Durable consumers created up front by Subscribe (see bindsConsumer: BackOff, SampleFrequency, Heartbeat and
+// partitions, and the pull consumers of ClientAPIJetStream) are created as well, with the configured options,
+// so messages published before the first subscription are kept for them.  Both are only created when missing,
+// existing streams and consumers are left untouched and no message is received.  Other consumers are created by
+// the NATS client on subscribe, from SubscribeOptions which can not be expressed as a consumer configuration.
+// With RequireExistingStream nothing is created, ErrStreamNotFound is returned when the stream is missing.
 func (s *Subscriber) SubscribeInitialize(topic string) error {
-	err := s.topicInterpreter.ensureStream(topic)
+	if s.config.RequireExistingStream {
+		return s.topicInterpreter.requireStream(topic)
+	}
 
-	if err != nil {
+	if err := s.topicInterpreter.ensureStream(topic); err != nil {
 		return errors.Wrap(err, "cannot initialize subscribe")
 	}
 
+	if s.config.DurableName == "" {
+		return nil
+	}
+
+	if s.jsAPI != nil {
+		if _, _, err := s.pullConsumer(context.Background(), topic, s.config.TopicTimeouts[topic], StreamPosition{}); err != nil {
+			return errors.Wrap(err, "cannot initialize subscribe")
+		}
+		return nil
+	}
+
+	for _, target := range s.subscriptionTargets(context.Background(), topic) {
+		if !s.bindsConsumer(target) {
+			continue
+		}
+		if _, err := s.ensureTargetConsumer(topic, target); err != nil {
+			return errors.Wrap(err, "cannot initialize subscribe")
+		}
+	}
+
 	return nil
 }
 
-func (s *Subscriber) subscribe(topic string, cb nats.MsgHandler) (*nats.Subscription, error) {
+// subscriptionTarget describes one of the subscriptions created by Subscribe.
+type subscriptionTarget struct {
+	// subject is the subject subscribed to
+	subject string
+
+	// partition is the consumed partition, nil when partitioning is disabled
+	partition *int
+
+	// bound is set when the durable consumer is created up front and bound, see withBoundConsumer
+	bound bool
+}
+
+// subscriptionTargets returns the subscriptions to create for topic: one per assigned partition when
+// partitioning is enabled, otherwise SubscribersCount subscriptions to the primary subject.
+func (s *Subscriber) subscriptionTargets(ctx context.Context, topic string) []subscriptionTarget {
+	bound := boundConsumerFromCtx(ctx)
+
+	if s.config.Partitioning.enabled() {
+		partitions, ok := assignedPartitionsFromCtx(ctx)
+		if !ok {
+			partitions = s.config.Partitioning.assigned()
+		}
+		targets := make([]subscriptionTarget, 0, len(partitions))
+		for _, p := range partitions {
+			p := p
+			targets = append(targets, subscriptionTarget{subject: PartitionSubject(topic, p), partition: &p, bound: bound})
+		}
+		return targets
+	}
+
+	targets := make([]subscriptionTarget, s.config.SubscribersCount)
+	for i := range targets {
+		targets[i] = subscriptionTarget{subject: s.topicInterpreter.subjects(topic).Primary, bound: bound}
+	}
+
+	return targets
+}
+
+func (s *Subscriber) subscribe(topic string, cb nats.MsgHandler, extraOpts ...nats.SubOpt) (*nats.Subscription, error) {
+	return s.subscribeTarget(topic, subscriptionTarget{subject: s.topicInterpreter.subjects(topic).Primary}, cb, extraOpts...)
+}
+
+func (s *Subscriber) subscribeTarget(topic string, target subscriptionTarget, cb nats.MsgHandler, extraOpts ...nats.SubOpt) (*nats.Subscription, error) {
+	return s.subscribeTargetWith(topic, target, s.callbackDelivery(cb), extraOpts...)
+}
+
+// subscribeTargetWith subscribes target, retrying according to SubscribeRetry while it fails with transient errors
+// and for UnavailableGracePeriod while JetStream is unavailable.
+func (s *Subscriber) subscribeTargetWith(topic string, target subscriptionTarget, deliver subscribeFunc, extraOpts ...nats.SubOpt) (*nats.Subscription, error) {
+	var sub *nats.Subscription
+	err := retryUnavailable(s.config.UnavailableGracePeriod, s.config.Clock, s.closing, s.logger, func() (string, string) {
+		return s.topicInterpreter.streamName(topic), target.subject
+	}, func() error {
+		var err error
+		sub, err = s.retrySubscribe(topic, func() (*nats.Subscription, error) {
+			return s.subscribeTargetOnce(topic, target, deliver, extraOpts...)
+		})
+		return err
+	})
+
+	return sub, err
+}
+
+func (s *Subscriber) subscribeTargetOnce(topic string, target subscriptionTarget, deliver subscribeFunc, extraOpts ...nats.SubOpt) (*nats.Subscription, error) {
 	if s.config.AutoProvision {
-		err := s.SubscribeInitialize(topic)
-		if err != nil {
+		// the consumer of target is provisioned below, other consumers are not provisioned before they are subscribed
+		if err := s.topicInterpreter.ensureStream(topic); err != nil {
+			return nil, errors.Wrap(err, "cannot initialize subscribe")
+		}
+	}
+	if s.config.RequireExistingStream {
+		if err := s.topicInterpreter.requireStream(topic); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.config.VerifyCompatibility {
+		if err := s.verifyCompatibility(topic, target); err != nil {
 			return nil, err
 		}
 	}
 
-	primarySubject := s.config.SubjectCalculator(topic).Primary
+	queueGroup := s.targetQueueGroup(topic, target)
+
+	opts := make([]nats.SubOpt, 0, len(s.config.SubscribeOptions)+len(extraOpts)+2)
+	opts = append(opts, s.config.SubscribeOptions...)
+	opts = append(opts, extraOpts...)
 
-	opts := s.config.SubscribeOptions
+	if s.singleFlight(target) {
+		opts = append(opts, nats.MaxAckPending(1))
+	}
+
+	// bound consumers keep the AckWait they were created with
+	if s.config.ConsumerAckWait > 0 && (s.config.DurableName == "" || !s.config.RequireExistingStream && !s.bindsConsumer(target)) {
+		opts = append(opts, nats.AckWait(s.config.ConsumerAckWait))
+	}
 
 	if s.config.DurableName != "" {
-		opts = append(opts, nats.Durable(s.topicInterpreter.durableNameCalculator(s.config.DurableName, topic)))
+		if s.config.RequireExistingStream {
+			opts = append(opts, nats.Bind(s.topicInterpreter.streamName(topic), s.targetDurableName(topic, target)))
+		} else if s.bindsConsumer(target) {
+			durableName, err := s.ensureTargetConsumer(topic, target)
+			if err != nil {
+				return nil, errors.Wrap(s.explainWorkQueueError(topic, target, err), "cannot provision consumer")
+			}
+			opts = append(opts, nats.Bind(s.topicInterpreter.streamName(topic), durableName))
+		} else {
+			opts = append(opts, nats.Durable(s.targetDurableName(topic, target)))
+		}
+	} else if s.config.RequireExistingStream || s.config.StreamNameCalculator != nil {
+		opts = append(opts, nats.BindStream(s.topicInterpreter.streamName(topic)))
 	} else {
+		// the NATS client looks the stream up by subject
 		opts = append(opts, nats.BindStream(""))
 	}
 
-	return s.js.QueueSubscribe(
-		primarySubject,
-		s.topicInterpreter.queueGroupCalculator(s.config.QueueGroup, topic),
-		cb,
-		opts...,
-	)
+	// durable consumers are bound when heartbeats are enabled, they get heartbeats from their configuration
+	if s.config.Heartbeat.enabled() && s.config.DurableName == "" {
+		opts = append(opts, nats.IdleHeartbeat(s.config.Heartbeat.Interval))
+	}
+
+	sub, err := deliver(target.subject, queueGroup, opts...)
+	if err != nil {
+		return nil, s.explainWorkQueueError(topic, target, err)
+	}
+
+	return sub, nil
+}
+
+// targetQueueGroup returns the queue group target is subscribed with, empty when subscribing without one.
+func (s *Subscriber) targetQueueGroup(topic string, target subscriptionTarget) string {
+	// heartbeats are not supported on queue subscriptions
+	if s.config.Heartbeat.enabled() {
+		return ""
+	}
+
+	// the NATS client would name the consumer after the calculated group, e.g. ".{topic}" which is not a valid name
+	if s.config.QueueGroup == "" && s.config.DurableName == "" {
+		return ""
+	}
+
+	queueGroup := s.topicInterpreter.queueGroup(s.config.QueueGroup, topic)
+	if target.partition != nil {
+		queueGroup = fmt.Sprintf("%s.p%d", queueGroup, *target.partition)
+	}
+
+	return queueGroup
+}
+
+// targetDurableName returns the name of the durable consumer of target.
+func (s *Subscriber) targetDurableName(topic string, target subscriptionTarget) string {
+	durableName := s.topicInterpreter.durableName(s.config.DurableName, topic)
+	if target.partition != nil {
+		durableName = fmt.Sprintf("%s_p%d", durableName, *target.partition)
+	}
+
+	return durableName
+}
+
+// singleFlight reports whether a single message of target is in flight at a time,
+// a single message in flight per partition keeps messages with the same key in order.
+func (s *Subscriber) singleFlight(target subscriptionTarget) bool {
+	return target.partition != nil || s.config.StrictOrdering
+}
+
+// ensureTargetConsumer creates the durable consumer of target unless it already exists, returning its name.
+// BackOff and SampleFrequency cannot be expressed through nats.SubOpt and partition or leader consumers are handed
+// over between instances, so such consumers are created up front and bound.
+func (s *Subscriber) ensureTargetConsumer(topic string, target subscriptionTarget) (string, error) {
+	durableName := s.targetDurableName(topic, target)
+
+	cfg := s.consumerConfig(target.subject, durableName, s.targetQueueGroup(topic, target))
+	cfg.AckWait = s.config.consumerAckWait(s.config.TopicTimeouts[topic].ackWait(s.config.AckWaitTimeout))
+	if s.singleFlight(target) {
+		cfg.MaxAckPending = 1
+	}
+
+	return durableName, s.topicInterpreter.ensureConsumer(s.topicInterpreter.streamName(topic), cfg)
+}
+
+// bindsConsumer reports whether the durable consumer of target is created up front and bound,
+// such consumers are not deleted when the subscription is unsubscribed.
+func (s *Subscriber) bindsConsumer(target subscriptionTarget) bool {
+	return len(s.config.BackOff) > 0 || s.config.SampleFrequency > 0 || target.partition != nil || target.bound ||
+		s.config.Heartbeat.enabled()
+}
+
+// consumerConfig builds the configuration of a durable push consumer created up front by the subscriber.
+func (s *Subscriber) consumerConfig(subject, durableName, queueGroup string) *nats.ConsumerConfig {
+	cfg := &nats.ConsumerConfig{
+		Durable:        durableName,
+		DeliverSubject: nats.NewInbox(),
+		DeliverGroup:   queueGroup,
+		DeliverPolicy:  nats.DeliverAllPolicy,
+		AckPolicy:      nats.AckExplicitPolicy,
+		AckWait:        s.config.consumerAckWait(s.config.AckWaitTimeout),
+		MaxDeliver:     s.config.MaxDeliver,
+		BackOff:        s.config.BackOff,
+		FilterSubject:  subject,
+		Heartbeat:      s.config.Heartbeat.Interval,
+	}
+
+	if s.config.SampleFrequency > 0 {
+		cfg.SampleFrequency = fmt.Sprintf("%d%%", s.config.SampleFrequency)
+	}
+
+	return cfg
+}
+
+// subscriptionHandler is the state shared by the messages of a subscription, set up once by Subscribe
+// instead of being derived again for every message in the NATS callback.
+type subscriptionHandler struct {
+	ctx          context.Context
+	topic        string
+	output       chan *message.Message
+	backpressure BackpressureConfig
+	timeouts     Timeouts
+	logFields    watermill.LogFields
+
+	// inFlight is the number of messages being processed, updated atomically
+	inFlight int64
 }
 
-func (s *Subscriber) processMessage(
-	ctx context.Context,
-	m *nats.Msg,
-	output chan *message.Message,
-	logFields watermill.LogFields,
-) {
-	if s.isClosed() {
+func (s *Subscriber) processMessage(h *subscriptionHandler, m *nats.Msg) {
+	select {
+	case <-s.closing:
+		s.nakDiscarded(m, h.logFields)
+		return
+	default:
+	}
+
+	if s.isIntakeStopped() {
+		s.logger.Trace("Intake stopped, message discarded", h.logFields)
+		s.nakIntakeStopped(m, h)
 		return
 	}
 
-	s.logger.Trace("Received message", logFields)
+	if until, paused := s.PausedUntil(); paused {
+		s.logger.Trace("Subscriber paused, message discarded", h.logFields)
+		s.nakPaused(m, until, h.logFields)
+		return
+	}
 
-	msg, err := s.config.Unmarshaler.Unmarshal(m)
+	atomic.AddInt64(&h.inFlight, 1)
+	defer atomic.AddInt64(&h.inFlight, -1)
+
+	s.logger.Trace("Received message", h.logFields)
+
+	if s.config.DropExpired && msgExpired(m, s.now()) {
+		s.logger.Debug("Message expired, dropped", h.logFields)
+		if err := s.acker.Ack(m); err != nil {
+			s.logger.Error("Cannot send ack", err, h.logFields)
+		}
+		return
+	}
+
+	msg, err := s.readMessage(h.ctx, h.topic, m)
 	if err != nil {
-		s.logger.Error("Cannot unmarshal message", err, logFields)
+		s.readFailed(h.topic, m, err, h.logFields)
 		return
 	}
 
-	ctx, cancelCtx := context.WithCancel(ctx)
+	// the context of the subscription is cancelled once it stops, so messages do not need their own
+	ctx := WithNatsMsg(h.ctx, m)
 	msg.SetContext(ctx)
-	defer cancelCtx()
 
-	messageLogFields := logFields.Add(watermill.LogFields{"message_uuid": msg.UUID})
+	messageLogFields := s.config.Correlation.logFields(
+		h.logFields.Add(watermill.LogFields{"message_uuid": msg.UUID}),
+		s.config.Correlation.id(msg),
+	)
 	s.logger.Trace("Unmarshaled message", messageLogFields)
 
+	// acked tells the deduplication window whether the message is remembered as processed
+	acked := false
+	if s.dedup != nil {
+		key := s.config.DeduplicationWindow.KeyFunc(msg)
+		if s.skipDuplicate(m, key, messageLogFields) {
+			return
+		}
+		defer func() { s.dedup.end(key, acked) }()
+	}
+
+	deliverTimeout, stopDeliverTimeout := h.backpressure.deliverTimeout(s.config.Clock)
+	defer stopDeliverTimeout()
+
 	select {
+	case <-deliverTimeout:
+		s.logger.Debug("Consumer too slow, message nacked", messageLogFields)
+		if err := s.acker.Nak(m); err != nil {
+			s.logger.Error("Cannot send nak", err, messageLogFields)
+		}
+		return
 	case <-s.closing:
 		s.logger.Trace("Closing, message discarded", messageLogFields)
+		s.nakDiscarded(m, messageLogFields)
 		return
 	case <-ctx.Done():
 		s.logger.Trace("Context cancelled, message discarded", messageLogFields)
+		s.nakDiscarded(m, messageLogFields)
 		return
 	// if this is first can risk 'send on closed channel' errors
-	case output <- msg:
+	case h.output <- msg:
 		s.logger.Trace("Message sent to consumer", messageLogFields)
 	}
 
-	select {
-	case <-msg.Acked():
-		var err error
+	ackTimeout, stopAckTimeout := after(s.config.Clock, h.timeouts.ackWait(s.config.AckWaitTimeout))
+	defer stopAckTimeout()
 
-		if s.config.AckSync {
-			err = m.AckSync()
-		} else {
-			err = m.Ack()
-		}
+	stopInProgress := s.startInProgress([]*nats.Msg{m}, messageLogFields)
+	defer stopInProgress()
 
-		if err != nil {
-			s.logger.Error("Cannot send ack", err, messageLogFields)
-			return
-		}
-		s.logger.Trace("Message Acked", messageLogFields)
+	select {
+	case <-msg.Acked():
+		acked = true
+		stopInProgress()
+		s.settleMsg(ctx, h.topic, msg, m, true, messageLogFields)
+		s.releasePayload(msg)
 	case <-msg.Nacked():
-		if err := m.Nak(); err != nil {
-			s.logger.Error("Cannot send nak", err, messageLogFields)
-			return
-		}
-		s.logger.Trace("Message Nacked", messageLogFields)
-		return
-	case <-time.After(s.config.AckWaitTimeout):
+		stopInProgress()
+		s.settleMsg(ctx, h.topic, msg, m, false, messageLogFields)
+		s.releasePayload(msg)
+	case <-ackTimeout:
 		s.logger.Trace("Ack timeout", messageLogFields)
 		return
 	case <-s.closing:
@@ -414,35 +1579,149 @@ func (s *Subscriber) processMessage(
 	}
 }
 
-// Close closes the publisher and the underlying connection.  It will attempt to wait for in-flight messages to complete.
+// releasePayload returns the payload of msg to the pool when SubscriberConfig.ReleasePayloads is set.
+// It is only called once the consumer acked or nacked msg, a message dropped on timeout may still be in use.
+func (s *Subscriber) releasePayload(msg *message.Message) {
+	if !s.config.ReleasePayloads {
+		return
+	}
+
+	payload := msg.Payload
+	msg.Payload = nil
+	releasePayload(payload)
+}
+
+// ackMsg acks m once its watermill message was acked.
+func (s *Subscriber) ackMsg(ctx context.Context, topic string, m *nats.Msg, logFields watermill.LogFields) {
+	var err error
+
+	if s.config.AckSync {
+		err = s.acker.AckSync(m)
+	} else {
+		err = s.acker.Ack(m)
+	}
+
+	if err != nil {
+		s.logger.Error("Cannot send ack", err, logFields)
+		return
+	}
+	s.logger.Trace("Message Acked", logFields)
+
+	if s.config.CheckpointStore != nil {
+		s.saveCheckpoint(ctx, topic, m, logFields)
+	}
+}
+
+// nakDiscarded naks m when it is discarded before it reached the consumer (closing, intake stopped or context cancelled),
+// so it is redelivered right away instead of after AckWaitTimeout.
+func (s *Subscriber) nakDiscarded(m *nats.Msg, logFields watermill.LogFields) {
+	if err := s.acker.Nak(m); err != nil {
+		s.logger.Error("Cannot send nak for discarded message", err, logFields)
+	}
+}
+
+// nakMsg naks m, or schedules its retry, once its watermill message was nacked.
+func (s *Subscriber) nakMsg(topic string, m *nats.Msg, logFields watermill.LogFields) {
+	if s.config.Retry.enabled() && s.retry(topic, m, logFields) {
+		return
+	}
+	if s.config.NakRetry != nil {
+		s.nakWithRetryPolicy(m, logFields)
+		return
+	}
+	if err := s.acker.Nak(m); err != nil {
+		s.logger.Error("Cannot send nak", err, logFields)
+		return
+	}
+	s.logger.Trace("Message Nacked", logFields)
+}
+
+// nakWithRetryPolicy naks m with the delay NakRetry gives its delivery attempt, or terminates it once
+// the attempts are exhausted.
+func (s *Subscriber) nakWithRetryPolicy(m *nats.Msg, logFields watermill.LogFields) {
+	attempt := 1
+	if meta, err := m.Metadata(); err == nil && meta.NumDelivered > 0 {
+		attempt = int(meta.NumDelivered)
+	}
+	logFields = logFields.Add(watermill.LogFields{"attempt": attempt})
+
+	if retriesExhausted(s.config.NakRetry, attempt) {
+		if err := s.acker.Term(m); err != nil {
+			s.logger.Error("Cannot terminate message", err, logFields)
+			return
+		}
+		s.logger.Info("Retries exhausted, message terminated", logFields)
+		return
+	}
+
+	if err := s.acker.NakWithDelay(m, s.config.NakRetry.NextDelay(attempt)); err != nil {
+		s.logger.Error("Cannot send nak", err, logFields)
+		return
+	}
+	s.logger.Trace("Message Nacked", logFields)
+}
+
+// Close closes the subscriber and the underlying connection.  It waits up to CloseTimeout (the longest one of the
+// running subscriptions, see Timeouts) for in-flight messages to complete, see CloseWithContext.
 func (s *Subscriber) Close() error {
-	s.subsLock.Lock()
-	defer s.subsLock.Unlock()
+	ctx, cancel := timeoutContext(context.Background(), s.config.Clock, s.closeTimeout())
+	defer cancel()
 
-	if s.closed {
-		return nil
+	_, err := s.CloseWithContext(ctx)
+	return err
+}
+
+// CloseWithContext closes the subscriber, waiting until ctx is done for subscriptions to finish.
+// The report tells which subscriptions drained, how many messages were still in flight and whether
+// pending acks were flushed.  Calls after the first one return an empty report.
+func (s *Subscriber) CloseWithContext(ctx context.Context) (ShutdownReport, error) {
+	if !atomic.CompareAndSwapUint32(&s.closed, 0, 1) {
+		return ShutdownReport{}, nil
 	}
-	s.closed = true
 
 	s.logger.Debug("Closing subscriber", nil)
 	defer s.logger.Info("Subscriber closed", nil)
 
+	// subscriptions untrack themselves once stopped, so they are captured before closing
+	subscriptions := s.subscriptions.snapshot()
+
 	close(s.closing)
 
-	if watermillSync.WaitGroupTimeout(&s.outputsWg, s.config.CloseTimeout) {
-		return errors.New("output wait group did not finish")
+	if s.tenants != nil {
+		if err := s.tenants.close(); err != nil {
+			s.logger.Error("Cannot close tenant subscribers", err, nil)
+		}
+	}
+
+	outputsFinished := waitGroupContext(ctx, &s.outputsWg)
+
+	// acks of messages handled before closing are sent even when other messages are still in flight
+	if s.ackBatcher != nil {
+		s.ackBatcher.close()
+	}
+
+	report := newShutdownReport(subscriptions)
+
+	if !outputsFinished {
+		return report, shutdownError(report)
+	}
+
+	flushCtx, cancel := flushContext(ctx, s.config.CloseTimeout)
+	defer cancel()
+
+	if err := s.conn.FlushWithContext(flushCtx); err != nil {
+		s.logger.Error("Cannot flush pending acks", err, nil)
+	} else {
+		report.Flushed = true
 	}
 
 	if err := s.conn.Drain(); err != nil {
-		return errors.Wrap(err, "cannot close conn")
+		return report, errors.Wrap(err, "cannot close conn")
 	}
 
-	return nil
+	return report, nil
 }
 
 func (s *Subscriber) isClosed() bool {
-	s.subsLock.RLock()
-	defer s.subsLock.RUnlock()
-
-	return s.closed
+	return atomic.LoadUint32(&s.closed) == 1
 }
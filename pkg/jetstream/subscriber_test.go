@@ -1,8 +1,15 @@
 package jetstream
 
 import (
+	"context"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
 	"github.com/stretchr/testify/require"
 )
 
@@ -13,13 +20,23 @@ func TestSubscriberSubscriptionConfig_Validate(t *testing.T) {
 		queueGroup        string
 		subscribersCount  int
 		SubjectCalculator func(string) *Subjects
+		durableName       string
+		backOff           []time.Duration
+		maxDeliver        int
+		strictOrdering    bool
 		wantErr           bool
 	}{
 		{name: "OK - 1 Subscriber", unmarshaler: &GobMarshaler{}, subscribersCount: 1, wantErr: false, SubjectCalculator: defaultSubjectCalculator},
 		{name: "OK - Multi Subscriber + Queue Group", unmarshaler: &GobMarshaler{}, subscribersCount: 3, queueGroup: "not empty", wantErr: false, SubjectCalculator: defaultSubjectCalculator},
 		{name: "Invalid - Multi Subscriber no QueueGroup", unmarshaler: &GobMarshaler{}, subscribersCount: 3, wantErr: true, SubjectCalculator: defaultSubjectCalculator},
+		{name: "OK - Multi Subscriber + DurableName", unmarshaler: &GobMarshaler{}, subscribersCount: 3, durableName: "durable", wantErr: false, SubjectCalculator: defaultSubjectCalculator},
 		{name: "Invalid - No Unmarshaler", unmarshaler: nil, subscribersCount: 3, queueGroup: "not empty", wantErr: true, SubjectCalculator: defaultSubjectCalculator},
 		{name: "Invalid - No Subject Calculator", unmarshaler: &GobMarshaler{}, subscribersCount: 3, queueGroup: "not empty", wantErr: true, SubjectCalculator: nil},
+		{name: "OK - BackOff", unmarshaler: &GobMarshaler{}, subscribersCount: 1, durableName: "durable", backOff: []time.Duration{time.Second, time.Minute}, maxDeliver: 3, wantErr: false, SubjectCalculator: defaultSubjectCalculator},
+		{name: "Invalid - BackOff no DurableName", unmarshaler: &GobMarshaler{}, subscribersCount: 1, backOff: []time.Duration{time.Second, time.Minute}, maxDeliver: 3, wantErr: true, SubjectCalculator: defaultSubjectCalculator},
+		{name: "Invalid - BackOff MaxDeliver too low", unmarshaler: &GobMarshaler{}, subscribersCount: 1, durableName: "durable", backOff: []time.Duration{time.Second, time.Minute}, maxDeliver: 2, wantErr: true, SubjectCalculator: defaultSubjectCalculator},
+		{name: "OK - StrictOrdering", unmarshaler: &GobMarshaler{}, subscribersCount: 1, durableName: "durable", strictOrdering: true, wantErr: false, SubjectCalculator: defaultSubjectCalculator},
+		{name: "Invalid - StrictOrdering Multi Subscriber", unmarshaler: &GobMarshaler{}, subscribersCount: 3, queueGroup: "not empty", strictOrdering: true, wantErr: true, SubjectCalculator: defaultSubjectCalculator},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -28,6 +45,10 @@ func TestSubscriberSubscriptionConfig_Validate(t *testing.T) {
 				QueueGroup:        tt.queueGroup,
 				SubscribersCount:  tt.subscribersCount,
 				SubjectCalculator: tt.SubjectCalculator,
+				DurableName:       tt.durableName,
+				BackOff:           tt.backOff,
+				MaxDeliver:        tt.maxDeliver,
+				StrictOrdering:    tt.strictOrdering,
 			}
 
 			if tt.wantErr {
@@ -38,3 +59,367 @@ func TestSubscriberSubscriptionConfig_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestSubscriberSubscriptionConfig_ExactlyOnce(t *testing.T) {
+	c := SubscriberSubscriptionConfig{ExactlyOnce: true}
+	c.setDefaults()
+
+	require.True(t, c.AckSync)
+	require.Equal(t, defaultDuplicateWindow, c.DuplicateWindow)
+
+	c = SubscriberSubscriptionConfig{}
+	c.setDefaults()
+
+	require.False(t, c.AckSync)
+	require.Zero(t, c.DuplicateWindow)
+}
+
+func TestSubscriber_CloseState(t *testing.T) {
+	clock := NewManualClock(time.Now())
+	s := faultySubscriber(SubscriberSubscriptionConfig{CloseTimeout: time.Minute, Clock: clock}, clientDecorator{})
+	require.False(t, s.isClosed())
+
+	// an in-flight output keeps the first Close waiting
+	s.outputsWg.Add(1)
+	defer s.outputsWg.Done()
+
+	closeErr := make(chan error)
+	go func() {
+		closeErr <- s.Close()
+	}()
+
+	// the closed state is visible without waiting for Close, and later calls return immediately
+	require.Eventually(t, s.isClosed, time.Second, time.Millisecond)
+	require.NoError(t, s.Close())
+
+	require.Eventually(t, func() bool { return clock.Timers() == 1 }, time.Second, time.Millisecond)
+	clock.Advance(time.Minute)
+	require.Error(t, <-closeErr)
+}
+
+func TestSubscriptionLogFields(t *testing.T) {
+	fields := watermill.LogFields{"topic": "orders", "subscriber_num": 0}
+
+	ctx := context.Background()
+	require.Equal(t, fields, subscriptionLogFields(ctx, fields))
+
+	_, ok := SubscriptionNameFromCtx(ctx)
+	require.False(t, ok)
+
+	ctx = WithSubscriptionName(ctx, "projections")
+	ctx = WithSubscriptionLogFields(ctx, watermill.LogFields{"component": "billing", "topic": "ignored"})
+	ctx = WithSubscriptionLogFields(ctx, watermill.LogFields{"team": "payments"})
+
+	name, ok := SubscriptionNameFromCtx(ctx)
+	require.True(t, ok)
+	require.Equal(t, "projections", name)
+
+	// fields of the subscriber take precedence over custom ones
+	require.Equal(t, watermill.LogFields{
+		"topic":             "orders",
+		"subscriber_num":    0,
+		"subscription_name": "projections",
+		"component":         "billing",
+		"team":              "payments",
+	}, subscriptionLogFields(ctx, fields))
+}
+
+func TestSubscriber_NatsMsgAccess(t *testing.T) {
+	s := faultySubscriber(SubscriberSubscriptionConfig{ReplyMetadataKey: "nats_reply"}, clientDecorator{
+		acker: func(msgAcker) msgAcker { return nopAcker{} },
+	})
+
+	m, err := (&GobMarshaler{}).Marshal("topic", message.NewMessage(watermill.NewUUID(), nil))
+	require.NoError(t, err)
+	stored := storedMsg(time.Now(), nil)
+	m.Reply, m.Sub = stored.Reply, stored.Sub
+
+	output := make(chan *message.Message, 1)
+	go s.processMessage(&subscriptionHandler{
+		ctx:       context.Background(),
+		topic:     "topic",
+		output:    output,
+		logFields: watermill.LogFields{},
+	}, m)
+
+	msg := <-output
+	defer msg.Ack()
+
+	raw, ok := NatsMsgFromCtx(msg.Context())
+	require.True(t, ok)
+	require.Same(t, m, raw)
+
+	reply, ok := NatsReplyFromCtx(msg.Context())
+	require.True(t, ok)
+	require.Equal(t, m.Reply, reply)
+	require.Equal(t, m.Reply, msg.Metadata.Get("nats_reply"))
+
+	_, ok = NatsReplyFromCtx(context.Background())
+	require.False(t, ok)
+	_, ok = NatsReplyFromCtx(WithNatsMsg(context.Background(), &nats.Msg{}))
+	require.False(t, ok)
+}
+
+func TestSubscriber_SampleFrequency(t *testing.T) {
+	c := SubscriberSubscriptionConfig{
+		Unmarshaler:     &GobMarshaler{},
+		SampleFrequency: 101,
+	}
+	c.setDefaults()
+	require.EqualError(t, c.Validate(), "SubscriberConfig.SampleFrequency: must be between 0 and 100; "+
+		"SubscriberConfig.SampleFrequency: requires SubscriberConfig.DurableName")
+
+	c.SampleFrequency = 50
+	c.DurableName = "durable"
+	require.NoError(t, c.Validate())
+
+	s := faultySubscriber(c, clientDecorator{})
+	require.True(t, s.bindsConsumer(subscriptionTarget{subject: "topic"}))
+	require.Equal(t, "50%", s.consumerConfig("topic", "durable_topic", "").SampleFrequency)
+
+	s = faultySubscriber(SubscriberSubscriptionConfig{DurableName: "durable"}, clientDecorator{})
+	require.False(t, s.bindsConsumer(subscriptionTarget{subject: "topic"}))
+	require.Empty(t, s.consumerConfig("topic", "durable_topic", "").SampleFrequency)
+}
+
+// provisioningJetStream records the streams and consumers created, reporting the ones already created as existing.
+type provisioningJetStream struct {
+	nats.JetStreamContext
+	streams   map[string]*nats.StreamConfig
+	consumers map[string]*nats.ConsumerConfig
+	adds      int
+}
+
+func (js *provisioningJetStream) StreamInfo(stream string, opts ...nats.JSOpt) (*nats.StreamInfo, error) {
+	if cfg, ok := js.streams[stream]; ok {
+		return &nats.StreamInfo{Config: *cfg}, nil
+	}
+	return nil, nats.ErrStreamNotFound
+}
+
+func (js *provisioningJetStream) AddStream(cfg *nats.StreamConfig, opts ...nats.JSOpt) (*nats.StreamInfo, error) {
+	js.adds++
+	js.streams[cfg.Name] = cfg
+	return &nats.StreamInfo{Config: *cfg}, nil
+}
+
+func (js *provisioningJetStream) ConsumerInfo(stream, name string, opts ...nats.JSOpt) (*nats.ConsumerInfo, error) {
+	if cfg, ok := js.consumers[name]; ok {
+		return &nats.ConsumerInfo{Stream: stream, Name: name, Config: *cfg}, nil
+	}
+	return nil, nats.ErrConsumerNotFound
+}
+
+func (js *provisioningJetStream) AddConsumer(stream string, cfg *nats.ConsumerConfig, opts ...nats.JSOpt) (*nats.ConsumerInfo, error) {
+	js.adds++
+	js.consumers[cfg.Durable] = cfg
+	return &nats.ConsumerInfo{Stream: stream, Name: cfg.Durable, Config: *cfg}, nil
+}
+
+func TestSubscriber_SubscribeInitialize(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    SubscriberSubscriptionConfig
+		consumers []string
+	}{
+		{
+			name:   "consumer created on subscribe",
+			config: SubscriberSubscriptionConfig{DurableName: "durable"},
+		},
+		{
+			name:      "consumer created up front",
+			config:    SubscriberSubscriptionConfig{DurableName: "durable", BackOff: []time.Duration{time.Second}, MaxDeliver: 2},
+			consumers: []string{"durable_topic"},
+		},
+		{
+			name: "partition consumers",
+			config: SubscriberSubscriptionConfig{
+				DurableName:  "durable",
+				Partitioning: PartitionConfig{Count: 2},
+			},
+			consumers: []string{"durable_topic_p0", "durable_topic_p1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			js := &provisioningJetStream{
+				streams:   map[string]*nats.StreamConfig{},
+				consumers: map[string]*nats.ConsumerConfig{},
+			}
+
+			s := faultySubscriber(tt.config, clientDecorator{})
+			s.topicInterpreter = newTopicInterpreter(js, s.config.SubjectCalculator, 0)
+
+			require.NoError(t, s.SubscribeInitialize("topic"))
+			require.Contains(t, js.streams, "topic")
+
+			consumers := make([]string, 0, len(js.consumers))
+			for name, cfg := range js.consumers {
+				consumers = append(consumers, name)
+				require.Equal(t, tt.config.BackOff, cfg.BackOff)
+			}
+			require.ElementsMatch(t, tt.consumers, consumers)
+
+			// initializing again leaves the stream and consumers untouched
+			adds := js.adds
+			require.NoError(t, s.SubscribeInitialize("topic"))
+			require.Equal(t, adds, js.adds)
+		})
+	}
+}
+
+func TestSubscriber_NakDiscarded(t *testing.T) {
+	m, err := (&GobMarshaler{}).Marshal("topic", message.NewMessage(watermill.NewUUID(), nil))
+	require.NoError(t, err)
+
+	t.Run("context cancelled", func(t *testing.T) {
+		acker := &droppingAcker{}
+		s := faultySubscriber(SubscriberSubscriptionConfig{}, clientDecorator{
+			acker: func(msgAcker) msgAcker { return acker },
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		s.processMessage(&subscriptionHandler{
+			ctx:       ctx,
+			topic:     "topic",
+			output:    make(chan *message.Message),
+			logFields: watermill.LogFields{},
+		}, m)
+		require.Equal(t, 1, acker.naks)
+	})
+
+	t.Run("closing", func(t *testing.T) {
+		acker := &droppingAcker{}
+		s := faultySubscriber(SubscriberSubscriptionConfig{}, clientDecorator{
+			acker: func(msgAcker) msgAcker { return acker },
+		})
+		close(s.closing)
+
+		s.processMessage(&subscriptionHandler{
+			ctx:       context.Background(),
+			topic:     "topic",
+			output:    make(chan *message.Message),
+			logFields: watermill.LogFields{},
+		}, m)
+		require.Equal(t, 1, acker.naks)
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		acker := &droppingAcker{}
+		s := faultySubscriber(SubscriberSubscriptionConfig{}, clientDecorator{
+			acker: func(msgAcker) msgAcker { return acker },
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		delivered := s.processBatch(ctx, "topic", []*nats.Msg{m, m}, time.Minute, make(chan []*message.Message), watermill.LogFields{})
+		require.False(t, delivered)
+		require.Equal(t, 2, acker.naks)
+	})
+}
+
+func TestSubscriber_RequireExistingStream(t *testing.T) {
+	c := SubscriberSubscriptionConfig{
+		Unmarshaler:           &GobMarshaler{},
+		RequireExistingStream: true,
+		AutoProvision:         true,
+	}
+	c.setDefaults()
+	require.EqualError(t, c.Validate(), "SubscriberConfig.RequireExistingStream: can not be combined with SubscriberConfig.AutoProvision")
+
+	js := &provisioningJetStream{
+		streams:   map[string]*nats.StreamConfig{},
+		consumers: map[string]*nats.ConsumerConfig{},
+	}
+
+	s := faultySubscriber(SubscriberSubscriptionConfig{
+		DurableName:           "durable",
+		BackOff:               []time.Duration{time.Second},
+		MaxDeliver:            2,
+		RequireExistingStream: true,
+	}, clientDecorator{})
+	s.topicInterpreter = newTopicInterpreter(js, s.config.SubjectCalculator, 0)
+
+	subscribed := 0
+	deliver := func(subject, queueGroup string, opts ...nats.SubOpt) (*nats.Subscription, error) {
+		subscribed++
+		return &nats.Subscription{}, nil
+	}
+
+	err := s.SubscribeInitialize("topic")
+	require.True(t, errors.Is(err, ErrStreamNotFound), "unexpected error: %v", err)
+
+	_, err = s.subscribeTargetWith("topic", subscriptionTarget{subject: "topic.*"}, deliver)
+	require.True(t, errors.Is(err, ErrStreamNotFound), "unexpected error: %v", err)
+	require.Zero(t, subscribed)
+
+	// existing streams are bound, the consumer is not created even though BackOff requires creating it up front
+	js.streams["topic"] = &nats.StreamConfig{Name: "topic"}
+	require.NoError(t, s.SubscribeInitialize("topic"))
+
+	_, err = s.subscribeTargetWith("topic", subscriptionTarget{subject: "topic.*"}, deliver)
+	require.NoError(t, err)
+	require.Equal(t, 1, subscribed)
+	require.Zero(t, js.adds)
+}
+
+func TestSubscriber_StreamNameCalculator(t *testing.T) {
+	js := &provisioningJetStream{
+		streams:   map[string]*nats.StreamConfig{},
+		consumers: map[string]*nats.ConsumerConfig{},
+	}
+
+	s := faultySubscriber(SubscriberSubscriptionConfig{
+		DurableName:          "durable",
+		BackOff:              []time.Duration{time.Second},
+		MaxDeliver:           2,
+		AutoProvision:        true,
+		StreamNameCalculator: func(topic string) string { return "EVENTS" },
+	}, clientDecorator{})
+	s.topicInterpreter = newTopicInterpreter(js, s.config.SubjectCalculator, 0)
+	s.topicInterpreter.streamNameCalculator = s.config.StreamNameCalculator
+
+	_, err := s.subscribeTargetWith("orders", subscriptionTarget{subject: "orders.*"}, func(subject, queueGroup string, opts ...nats.SubOpt) (*nats.Subscription, error) {
+		return &nats.Subscription{}, nil
+	})
+	require.NoError(t, err)
+
+	require.Contains(t, js.streams, "EVENTS")
+	require.Equal(t, []string{"orders.*"}, js.streams["EVENTS"].Subjects)
+	require.Contains(t, js.consumers, "durable_orders")
+}
+
+func TestSubscriber_NameCalculators(t *testing.T) {
+	config := SubscriberSubscriptionConfig{
+		QueueGroup:  "group",
+		DurableName: "durable",
+		QueueGroupCalculator: func(queueGroup, topic string) string {
+			return queueGroup + "-" + topic
+		},
+		DurableNameCalculator: func(durableName, topic string) string {
+			return durableName + "-" + strings.Replace(topic, ".", "-", -1)
+		},
+	}
+	s := faultySubscriber(config, clientDecorator{})
+	s.topicInterpreter = newSubscriberTopicInterpreter(nil, s.config)
+
+	partition := 1
+	require.Equal(t, "group-orders.eu", s.targetQueueGroup("orders.eu", subscriptionTarget{}))
+	require.Equal(t, "group-orders.eu.p1", s.targetQueueGroup("orders.eu", subscriptionTarget{partition: &partition}))
+	require.Equal(t, "durable-orders-eu", s.targetDurableName("orders.eu", subscriptionTarget{}))
+	require.Equal(t, "durable-orders-eu_p1", s.targetDurableName("orders.eu", subscriptionTarget{partition: &partition}))
+
+	// the defaults are kept when no calculator is set
+	s.topicInterpreter = newSubscriberTopicInterpreter(nil, SubscriberSubscriptionConfig{})
+	require.Equal(t, "group.orders", s.targetQueueGroup("orders", subscriptionTarget{}))
+	require.Equal(t, "durable_orders_eu", s.targetDurableName("orders.eu", subscriptionTarget{}))
+
+	// ephemeral consumers of subscriptions without QueueGroup are not shared
+	s.config.QueueGroup = ""
+	s.config.DurableName = ""
+	require.Empty(t, s.targetQueueGroup("orders", subscriptionTarget{}))
+}
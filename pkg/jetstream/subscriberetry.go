@@ -0,0 +1,64 @@
+package jetstream
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// transientAPIErrors are fragments of the JetStream API errors returned while the cluster recovers,
+// e.g. during a leader election, the pinned client reports API errors as plain text.
+var transientAPIErrors = []string{
+	"temporarily unavailable",
+	"cluster is not current",
+	"no suitable peers",
+	"stream is offline",
+}
+
+// transientSubscribeError reports whether subscribing failed with an error which may go away on retry.
+func transientSubscribeError(err error) bool {
+	if brokerUnreachable(err) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, fragment := range transientAPIErrors {
+		if strings.Contains(msg, fragment) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// retrySubscribe calls subscribe, retrying according to SubscribeRetry while it fails with transient errors
+// and the subscriber is not closed.
+func (s *Subscriber) retrySubscribe(topic string, subscribe func() (*nats.Subscription, error)) (*nats.Subscription, error) {
+	for attempt := 1; ; attempt++ {
+		sub, err := subscribe()
+		if err == nil || s.config.SubscribeRetry == nil || !transientSubscribeError(err) ||
+			retriesExhausted(s.config.SubscribeRetry, attempt) {
+			return sub, err
+		}
+
+		delay := s.config.SubscribeRetry.NextDelay(attempt)
+		s.logger.Info("Cannot subscribe, retrying", watermill.LogFields{
+			"topic":   topic,
+			"err":     err,
+			"attempt": attempt,
+			"delay":   delay,
+		})
+
+		wait, stop := after(s.config.Clock, delay)
+		select {
+		case <-wait:
+			stop()
+		case <-s.closing:
+			stop()
+			return nil, errors.Wrap(err, "subscriber closed while retrying")
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package jetstream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// flakySubscribeJetStream fails the first subscribes with err.
+type flakySubscribeJetStream struct {
+	faultyJetStream
+	err      error
+	failures int
+	attempts int
+}
+
+func (js *flakySubscribeJetStream) QueueSubscribe(subj, queue string, cb nats.MsgHandler, opts ...nats.SubOpt) (*nats.Subscription, error) {
+	js.attempts++
+	if js.attempts <= js.failures {
+		return nil, js.err
+	}
+	return js.faultyJetStream.QueueSubscribe(subj, queue, cb, opts...)
+}
+
+func TestTransientSubscribeError(t *testing.T) {
+	require.True(t, transientSubscribeError(nats.ErrTimeout))
+	require.True(t, transientSubscribeError(errors.Wrap(context.DeadlineExceeded, "cannot subscribe")))
+	require.True(t, transientSubscribeError(errors.New("nats: JetStream system temporarily unavailable")))
+	require.True(t, transientSubscribeError(errors.New("nats: no suitable peers for placement")))
+	require.False(t, transientSubscribeError(nats.ErrStreamNotFound))
+	require.False(t, transientSubscribeError(errors.New("nats: consumer subject filters cannot overlap")))
+}
+
+func TestSubscriber_SubscribeRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		failures     int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{name: "recovered", err: nats.ErrTimeout, failures: 2, wantAttempts: 3},
+		{name: "exhausted", err: errors.New("nats: JetStream system temporarily unavailable"), failures: 5, wantAttempts: 3, wantErr: true},
+		{name: "not transient", err: nats.ErrStreamNotFound, failures: 1, wantAttempts: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			js := &flakySubscribeJetStream{err: tt.err, failures: tt.failures}
+			s := faultySubscriber(SubscriberSubscriptionConfig{
+				SubscribeRetry: ExponentialRetryPolicy{InitialDelay: time.Millisecond, Attempts: 3},
+			}, clientDecorator{
+				jetStream: func(nats.JetStream) nats.JetStream { return js },
+			})
+
+			_, err := s.subscribe("topic", func(*nats.Msg) {})
+			if tt.wantErr {
+				require.True(t, errors.Is(err, tt.err), "unexpected error: %v", err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tt.wantAttempts, js.attempts)
+		})
+	}
+}
+
+func TestSubscriber_SubscribeRetryClosed(t *testing.T) {
+	js := &flakySubscribeJetStream{err: nats.ErrTimeout, failures: 1}
+	s := faultySubscriber(SubscriberSubscriptionConfig{
+		SubscribeRetry: FixedRetryPolicy{Delay: time.Hour},
+	}, clientDecorator{
+		jetStream: func(nats.JetStream) nats.JetStream { return js },
+	})
+	close(s.closing)
+
+	_, err := s.subscribe("topic", func(*nats.Msg) {})
+	require.True(t, errors.Is(err, nats.ErrTimeout), "unexpected error: %v", err)
+	require.Equal(t, 1, js.attempts)
+}
@@ -0,0 +1,175 @@
+package jetstream
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// TenantMetadataKey is the metadata key holding the tenant a message is published for, see PublisherConfig.TenantCredentials.
+const TenantMetadataKey = "tenant"
+
+// tenantConnector connects to NATS with the credentials of a tenant.
+type tenantConnector struct {
+	url         string
+	options     []nats.Option
+	credentials map[string]string
+}
+
+func (c tenantConnector) connect(tenant string) (*nats.Conn, error) {
+	creds, ok := c.credentials[tenant]
+	if !ok {
+		return nil, errors.Errorf("unknown tenant %s", tenant)
+	}
+
+	opts := make([]nats.Option, 0, len(c.options)+1)
+	opts = append(opts, c.options...)
+	opts = append(opts, nats.UserCredentials(creds))
+
+	conn, err := nats.Connect(c.url, opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot connect to nats for tenant %s", tenant)
+	}
+
+	return conn, nil
+}
+
+// tenantPublishers lazily creates a publisher on its own connection per tenant.
+type tenantPublishers struct {
+	connector tenantConnector
+	config    PublisherPublishConfig
+	logger    watermill.LoggerAdapter
+
+	mu         sync.Mutex
+	publishers map[string]*Publisher
+}
+
+func (t *tenantPublishers) get(tenant string) (*Publisher, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if pub, ok := t.publishers[tenant]; ok {
+		return pub, nil
+	}
+
+	conn, err := t.connector.connect(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	config := t.config
+	if config.Spool.enabled() {
+		config.Spool.Dir = filepath.Join(config.Spool.Dir, tenant)
+	}
+
+	pub, err := NewPublisherWithNatsConn(conn, config, t.logger)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	t.publishers[tenant] = pub
+	return pub, nil
+}
+
+func (t *tenantPublishers) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, pub := range t.publishers {
+		_ = pub.Close()
+	}
+}
+
+// publishTenants publishes every message with the publisher of its tenant,
+// messages without a tenant are published with the default connection.
+func (p *Publisher) publishTenants(topic string, messages []*message.Message, opts ...nats.PubOpt) error {
+	for _, msg := range messages {
+		tenant := msg.Metadata.Get(TenantMetadataKey)
+		if tenant == "" {
+			if err := p.publish(topic, []*message.Message{msg}, opts...); err != nil {
+				return err
+			}
+			continue
+		}
+
+		pub, err := p.tenants.get(tenant)
+		if err != nil {
+			return err
+		}
+
+		if err := pub.publishWithOptions(topic, []*message.Message{msg}, opts...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// tenantSubscribers lazily creates a subscriber on its own connection per tenant.
+type tenantSubscribers struct {
+	connector tenantConnector
+	config    SubscriberSubscriptionConfig
+	logger    watermill.LoggerAdapter
+
+	mu          sync.Mutex
+	subscribers map[string]*Subscriber
+
+	// intakeStopped makes subscribers created after StopIntake stop their intake too
+	intakeStopped bool
+}
+
+func (t *tenantSubscribers) get(tenant string) (*Subscriber, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if sub, ok := t.subscribers[tenant]; ok {
+		return sub, nil
+	}
+
+	conn, err := t.connector.connect(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	sub, err := NewSubscriberWithNatsConn(conn, t.config, t.logger)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if t.intakeStopped {
+		sub.StopIntake()
+	}
+
+	t.subscribers[tenant] = sub
+	return sub, nil
+}
+
+func (t *tenantSubscribers) stopIntake() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.intakeStopped = true
+	for _, sub := range t.subscribers {
+		sub.StopIntake()
+	}
+}
+
+func (t *tenantSubscribers) close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var closeErr error
+	for tenant, sub := range t.subscribers {
+		if err := sub.Close(); err != nil {
+			closeErr = errors.Wrapf(err, "cannot close subscriber of tenant %s", tenant)
+		}
+	}
+
+	return closeErr
+}
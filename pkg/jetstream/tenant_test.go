@@ -0,0 +1,38 @@
+package jetstream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublisher_PublishUnknownTenant(t *testing.T) {
+	p := &Publisher{
+		logger: watermill.NopLogger{},
+		tenants: &tenantPublishers{
+			connector:  tenantConnector{credentials: map[string]string{"acme": "acme.creds"}},
+			publishers: map[string]*Publisher{},
+		},
+	}
+
+	msg := message.NewMessage(watermill.NewUUID(), nil)
+	msg.Metadata.Set(TenantMetadataKey, "globex")
+
+	err := p.Publish("topic", msg)
+	require.EqualError(t, err, "unknown tenant globex")
+}
+
+func TestTenantFromCtx(t *testing.T) {
+	_, ok := TenantFromCtx(context.Background())
+	require.False(t, ok)
+
+	_, ok = TenantFromCtx(WithTenant(context.Background(), ""))
+	require.False(t, ok)
+
+	tenant, ok := TenantFromCtx(WithTenant(context.Background(), "acme"))
+	require.True(t, ok)
+	require.Equal(t, "acme", tenant)
+}
@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill-jetstream/pkg/jetstream"
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+const serverStartTimeout = 10 * time.Second
+
+// Server is a disposable nats-server with JetStream enabled, stopped when the test finishes.
+type Server struct {
+	// URL is the NATS URL of the server.
+	URL string
+}
+
+// RunServer starts a disposable nats-server with JetStream for t, embedded in the test process on a random port
+// and storing its streams in a temporary directory, so no nats-server binary or container is needed.
+func RunServer(t testing.TB) *Server {
+	t.Helper()
+
+	s, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      server.RANDOM_PORT,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatalf("cannot create nats-server: %s", err)
+	}
+
+	go s.Start()
+	t.Cleanup(s.Shutdown)
+
+	if !s.ReadyForConnections(serverStartTimeout) {
+		t.Fatal("nats-server did not start")
+	}
+
+	return &Server{URL: s.ClientURL()}
+}
+
+// Config returns the configuration of pub/subs connecting to the server.
+func (s *Server) Config() Config {
+	return Config{URL: s.URL}
+}
+
+// NewPubSub creates a publisher and a subscriber connected to the server, closed when the test finishes.
+// The subscriber consumes with consumerGroup as queue group and durable name when set.
+func (s *Server) NewPubSub(t *testing.T, consumerGroup string) (*jetstream.Publisher, *jetstream.Subscriber) {
+	pub, sub := s.Config().newPubSub(t, consumerGroup)
+
+	t.Cleanup(func() {
+		_ = sub.Close()
+		_ = pub.Close()
+	})
+
+	return pub, sub
+}
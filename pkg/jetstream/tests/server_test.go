@@ -0,0 +1,36 @@
+package tests_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-jetstream/pkg/jetstream/tests"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunServer(t *testing.T) {
+	server := tests.RunServer(t)
+
+	pub, sub := server.NewPubSub(t, "")
+	require.NoError(t, sub.SubscribeInitialize("topic"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	messages, err := sub.Subscribe(ctx, "topic")
+	require.NoError(t, err)
+
+	msg := message.NewMessage(watermill.NewUUID(), []byte("payload"))
+	require.NoError(t, pub.Publish("topic", msg))
+
+	select {
+	case received := <-messages:
+		require.Equal(t, msg.UUID, received.UUID)
+		received.Ack()
+	case <-ctx.Done():
+		t.Fatal("no message received")
+	}
+}
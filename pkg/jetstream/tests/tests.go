@@ -0,0 +1,188 @@
+// Package tests runs the watermill Pub/Sub acceptance tests against a JetStream server,
+// for contributors and for downstream users verifying the behaviour of their setup.
+package tests
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-jetstream/pkg/jetstream"
+	"github.com/ThreeDotsLabs/watermill-jetstream/pkg/jetstream/wmpb"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/pubsub/tests"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+// Config is the configuration of the pub/subs created for the acceptance tests
+type Config struct {
+	// URL is the NATS URL of the JetStream server (defaults to nats.DefaultURL).
+	URL string
+
+	// NatsOptions are custom options for connections (defaults to retrying the connection for 30 seconds).
+	NatsOptions []nats.Option
+
+	// Marshaler is the marshaler used by the pub/subs (defaults to GobMarshaler).
+	Marshaler jetstream.MarshalerUnmarshaler
+
+	// Logger is the logger of the pub/subs (defaults to NopLogger).
+	Logger watermill.LoggerAdapter
+
+	// ExactlyOnce enables exactly-once delivery on the pub/subs.
+	ExactlyOnce bool
+}
+
+func (c *Config) setDefaults() {
+	if c.URL == "" {
+		c.URL = nats.DefaultURL
+	}
+	if c.NatsOptions == nil {
+		c.NatsOptions = []nats.Option{
+			nats.RetryOnFailedConnect(true),
+			nats.Timeout(30 * time.Second),
+			nats.ReconnectWait(1 * time.Second),
+		}
+	}
+	if c.Marshaler == nil {
+		c.Marshaler = &jetstream.GobMarshaler{}
+	}
+	if c.Logger == nil {
+		c.Logger = watermill.NopLogger{}
+	}
+}
+
+// ConfigFromEnv returns the configuration described by the environment:
+//
+//	WATERMILL_TEST_NATS_URL      NATS URL
+//	WATERMILL_TEST_NATS_FORMAT   marshaler: gob (default), nats, proto or json
+//	WATERMILL_TEST_NATS_DEBUG    "true" enables debug logs
+//	WATERMILL_TEST_NATS_TRACE    "true" enables trace logs
+func ConfigFromEnv() Config {
+	var marshaler jetstream.MarshalerUnmarshaler
+
+	switch strings.ToLower(os.Getenv("WATERMILL_TEST_NATS_FORMAT")) {
+	case "nats":
+		marshaler = &jetstream.NATSMarshaler{}
+	case "proto":
+		marshaler = &wmpb.NATSMarshaler{}
+	case "json":
+		marshaler = &jetstream.JSONMarshaler{}
+	default:
+		marshaler = &jetstream.GobMarshaler{}
+	}
+
+	debug := strings.ToLower(os.Getenv("WATERMILL_TEST_NATS_DEBUG")) == "true"
+	trace := strings.ToLower(os.Getenv("WATERMILL_TEST_NATS_TRACE")) == "true"
+
+	return Config{
+		URL:       os.Getenv("WATERMILL_TEST_NATS_URL"),
+		Marshaler: marshaler,
+		Logger:    watermill.NewStdLogger(debug, trace),
+	}
+}
+
+// Features returns the features of the Pub/Sub verified by the acceptance tests.
+func Features() tests.Features {
+	return tests.Features{
+		ConsumerGroups:                      true,
+		ExactlyOnceDelivery:                 false,
+		GuaranteedOrder:                     true,
+		GuaranteedOrderWithSingleSubscriber: true,
+		Persistent:                          true,
+		RequireSingleInstance:               false,
+		NewSubscriberReceivesOldMessages:    true,
+	}
+}
+
+// ExactlyOnceFeatures returns the features of the Pub/Sub verified by the acceptance tests with ExactlyOnce.
+func ExactlyOnceFeatures() tests.Features {
+	return tests.Features{
+		ExactlyOnceDelivery:                 true,
+		GuaranteedOrder:                     true,
+		GuaranteedOrderWithSingleSubscriber: true,
+		Persistent:                          true,
+		RequireSingleInstance:               true,
+		NewSubscriberReceivesOldMessages:    false,
+	}
+}
+
+// TestPubSub runs the watermill Pub/Sub acceptance tests with features against the server described by config.
+func TestPubSub(t *testing.T, config Config, features tests.Features) {
+	tests.TestPubSub(t, features, config.PubSubConstructor(), config.ConsumerGroupPubSubConstructor())
+}
+
+// TestPubSubStressTest runs the watermill Pub/Sub acceptance tests repeatedly, see TestPubSub.
+func TestPubSubStressTest(t *testing.T, config Config, features tests.Features) {
+	tests.TestPubSubStressTest(t, features, config.PubSubConstructor(), config.ConsumerGroupPubSubConstructor())
+}
+
+// PubSubConstructor returns the constructor of pub/subs without consumer group for the acceptance tests.
+func (c Config) PubSubConstructor() tests.PubSubConstructor {
+	return func(t *testing.T) (message.Publisher, message.Subscriber) {
+		return c.NewPubSub(t, "")
+	}
+}
+
+// ConsumerGroupPubSubConstructor returns the constructor of pub/subs with a consumer group for the acceptance tests.
+func (c Config) ConsumerGroupPubSubConstructor() tests.ConsumerGroupPubSubConstructor {
+	return func(t *testing.T, consumerGroup string) (message.Publisher, message.Subscriber) {
+		return c.NewPubSub(t, consumerGroup)
+	}
+}
+
+// NewPubSub creates a publisher and a subscriber, consuming with consumerGroup as queue group and durable name when set.
+func (c Config) NewPubSub(t *testing.T, consumerGroup string) (message.Publisher, message.Subscriber) {
+	return c.newPubSub(t, consumerGroup)
+}
+
+func (c Config) newPubSub(t *testing.T, consumerGroup string) (*jetstream.Publisher, *jetstream.Subscriber) {
+	c.setDefaults()
+
+	subscriberCount := 1
+
+	if consumerGroup != "" {
+		subscriberCount = 2
+	}
+
+	subscribeOptions := []nats.SubOpt{
+		nats.DeliverAll(),
+		nats.AckExplicit(),
+	}
+
+	conn, err := nats.Connect(c.URL, c.NatsOptions...)
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	_, err = conn.JetStream()
+	require.NoError(t, err)
+
+	pub, err := jetstream.NewPublisher(jetstream.PublisherConfig{
+		URL:           c.URL,
+		Marshaler:     c.Marshaler,
+		NatsOptions:   c.NatsOptions,
+		AutoProvision: true,
+		ExactlyOnce:   c.ExactlyOnce,
+	}, c.Logger)
+	require.NoError(t, err)
+
+	sub, err := jetstream.NewSubscriber(jetstream.SubscriberConfig{
+		URL:              c.URL,
+		QueueGroup:       consumerGroup,
+		DurableName:      consumerGroup,
+		SubscribersCount: subscriberCount, //multiple only works if a queue group specified
+		AckWaitTimeout:   30 * time.Second,
+		Unmarshaler:      c.Marshaler,
+		NatsOptions:      c.NatsOptions,
+		SubscribeOptions: subscribeOptions,
+		CloseTimeout:     30 * time.Second,
+		AutoProvision:    false, // tests use SubscribeInitialize
+		ExactlyOnce:      c.ExactlyOnce,
+	}, c.Logger)
+	require.NoError(t, err)
+
+	return pub, sub
+}
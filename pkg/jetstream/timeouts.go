@@ -0,0 +1,97 @@
+package jetstream
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Timeouts overrides the AckWaitTimeout and CloseTimeout of the subscriber for a topic (SubscriberConfig.TopicTimeouts)
+// or a subscription (WithTimeouts), so slow topics do not force their timeouts on every other topic.
+// Zero values keep the timeouts of the subscriber.
+//
+// AckWaitTimeout applies to the messages of Subscribe and SubscribeBatch, consumers created up front by the
+// subscriber get the AckWaitTimeout of their topic unless SubscriberConfig.ConsumerAckWait is set.  Close waits
+// for the longest CloseTimeout of the running subscriptions of Subscribe.
+type Timeouts struct {
+	AckWaitTimeout time.Duration
+	CloseTimeout   time.Duration
+}
+
+// Validate ensures configuration is valid before use
+func (t Timeouts) Validate() error {
+	if t.AckWaitTimeout < 0 {
+		return errors.New("Timeouts.AckWaitTimeout can not be negative")
+	}
+	if t.CloseTimeout < 0 {
+		return errors.New("Timeouts.CloseTimeout can not be negative")
+	}
+
+	return nil
+}
+
+// override returns t with the timeouts set in o.
+func (t Timeouts) override(o Timeouts) Timeouts {
+	if o.AckWaitTimeout > 0 {
+		t.AckWaitTimeout = o.AckWaitTimeout
+	}
+	if o.CloseTimeout > 0 {
+		t.CloseTimeout = o.CloseTimeout
+	}
+
+	return t
+}
+
+// ackWait returns the overridden AckWaitTimeout, defaultTimeout when it is not overridden.
+func (t Timeouts) ackWait(defaultTimeout time.Duration) time.Duration {
+	if t.AckWaitTimeout > 0 {
+		return t.AckWaitTimeout
+	}
+	return defaultTimeout
+}
+
+// closeTimeout returns the overridden CloseTimeout, defaultTimeout when it is not overridden.
+func (t Timeouts) closeTimeout(defaultTimeout time.Duration) time.Duration {
+	if t.CloseTimeout > 0 {
+		return t.CloseTimeout
+	}
+	return defaultTimeout
+}
+
+// subscriptionTimeouts returns the timeouts overridden for a subscription to topic: the timeouts of the topic,
+// overridden by the ones set with WithTimeouts.
+func (s *Subscriber) subscriptionTimeouts(ctx context.Context, topic string) Timeouts {
+	timeouts := s.config.TopicTimeouts[topic]
+	if o, ok := TimeoutsFromCtx(ctx); ok {
+		timeouts = timeouts.override(o)
+	}
+
+	return timeouts
+}
+
+// closeTimeout returns how long Close waits: the longest CloseTimeout of the running subscriptions,
+// CloseTimeout when none is running.
+func (s *Subscriber) closeTimeout() time.Duration {
+	states := s.subscriptions.snapshot()
+	if len(states) == 0 {
+		return s.config.CloseTimeout
+	}
+
+	var timeout time.Duration
+	for _, state := range states {
+		if d := state.handler.timeouts.closeTimeout(s.config.CloseTimeout); d > timeout {
+			timeout = d
+		}
+	}
+
+	return timeout
+}
+
+// consumerAckWait returns ConsumerAckWait, ackWait when it is not set.
+func (c SubscriberSubscriptionConfig) consumerAckWait(ackWait time.Duration) time.Duration {
+	if c.ConsumerAckWait > 0 {
+		return c.ConsumerAckWait
+	}
+	return ackWait
+}
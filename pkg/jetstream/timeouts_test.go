@@ -0,0 +1,64 @@
+package jetstream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriber_SubscriptionTimeouts(t *testing.T) {
+	s := faultySubscriber(SubscriberSubscriptionConfig{
+		AckWaitTimeout: time.Second,
+		CloseTimeout:   time.Second,
+		TopicTimeouts: map[string]Timeouts{
+			"reports": {AckWaitTimeout: time.Hour, CloseTimeout: time.Minute},
+		},
+	}, clientDecorator{})
+
+	timeouts := s.subscriptionTimeouts(context.Background(), "orders")
+	require.Equal(t, time.Second, timeouts.ackWait(s.config.AckWaitTimeout))
+	require.Equal(t, time.Second, timeouts.closeTimeout(s.config.CloseTimeout))
+
+	timeouts = s.subscriptionTimeouts(context.Background(), "reports")
+	require.Equal(t, time.Hour, timeouts.ackWait(s.config.AckWaitTimeout))
+	require.Equal(t, time.Minute, timeouts.closeTimeout(s.config.CloseTimeout))
+
+	// the subscription overrides the timeouts it sets, keeping the other ones of its topic
+	ctx := WithTimeouts(context.Background(), Timeouts{AckWaitTimeout: 2 * time.Hour})
+	timeouts = s.subscriptionTimeouts(ctx, "reports")
+	require.Equal(t, 2*time.Hour, timeouts.ackWait(s.config.AckWaitTimeout))
+	require.Equal(t, time.Minute, timeouts.closeTimeout(s.config.CloseTimeout))
+}
+
+func TestSubscriber_CloseTimeout(t *testing.T) {
+	s := faultySubscriber(SubscriberSubscriptionConfig{
+		CloseTimeout: time.Minute,
+		TopicTimeouts: map[string]Timeouts{
+			"orders": {CloseTimeout: time.Second},
+		},
+	}, clientDecorator{})
+	require.Equal(t, time.Minute, s.closeTimeout())
+
+	orders := s.subscriptions.track("orders", 0, &subscriptionHandler{timeouts: s.subscriptionTimeouts(context.Background(), "orders")})
+	require.Equal(t, time.Second, s.closeTimeout())
+
+	reports := s.subscriptions.track("reports", 0, &subscriptionHandler{timeouts: Timeouts{CloseTimeout: time.Hour}})
+	require.Equal(t, time.Hour, s.closeTimeout())
+
+	s.subscriptions.untrack(orders, reports)
+	require.Equal(t, time.Minute, s.closeTimeout())
+}
+
+func TestSubscriberSubscriptionConfig_ValidateTopicTimeouts(t *testing.T) {
+	c := SubscriberSubscriptionConfig{
+		Unmarshaler: &GobMarshaler{},
+		TopicTimeouts: map[string]Timeouts{
+			"orders":  {AckWaitTimeout: -time.Second},
+			"reports": {CloseTimeout: time.Minute},
+		},
+	}
+	c.setDefaults()
+	require.EqualError(t, c.Validate(), "SubscriberConfig.TopicTimeouts[orders]: Timeouts.AckWaitTimeout can not be negative")
+}
@@ -0,0 +1,32 @@
+package jetstream
+
+import (
+	"sync"
+	"time"
+)
+
+// timerPool reuses the timers bounding the delivery and ack of every message,
+// time.After would keep a timer alive for the whole AckWaitTimeout after the message was acked.
+var timerPool sync.Pool
+
+// acquireTimer returns a timer firing after d, it needs to be returned with releaseTimer.
+func acquireTimer(d time.Duration) *time.Timer {
+	if t, ok := timerPool.Get().(*time.Timer); ok {
+		t.Reset(d)
+		return t
+	}
+
+	return time.NewTimer(d)
+}
+
+// releaseTimer stops t and returns it to the pool.
+func releaseTimer(t *time.Timer) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+
+	timerPool.Put(t)
+}
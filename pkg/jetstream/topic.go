@@ -1,10 +1,16 @@
 package jetstream
 
 import (
+	"container/list"
 	"fmt"
+	"net/url"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
 
 	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
 )
 
 // SubjectCalculator is a function used to calculate nats subject(s) for the given topic.
@@ -16,6 +22,134 @@ type DurableNameCalculator func(durableName, topic string) string
 // QueueGroupCalculator is a function used to calculate nats queue group for the given topic.
 type QueueGroupCalculator func(queueGroup, topic string) string
 
+// StreamNameCalculator is a function used to calculate the name of the stream holding the given topic.
+type StreamNameCalculator func(topic string) string
+
+// StreamPreset customizes the configuration of the streams provisioned for topics (with AutoProvision or
+// SubscribeInitialize), e.g. InterestRetention.  Existing streams are left untouched.
+type StreamPreset func(cfg *nats.StreamConfig)
+
+// InterestRetention provisions streams with interest based retention: messages are removed once acked by every
+// consumer of the stream, and are dropped right away when the stream has no consumer.  Publishers can warn about
+// the latter with InterestCheckConfig.
+func InterestRetention(cfg *nats.StreamConfig) {
+	cfg.Retention = nats.InterestPolicy
+}
+
+// LastPerSubjectRetention provisions streams keeping only the last message of every subject, i.e. compacted topics.
+// Messages need to be published to a subject per key for it to be useful, see PublisherConfig.SubjectKeyMetadata.
+func LastPerSubjectRetention(cfg *nats.StreamConfig) {
+	cfg.MaxMsgsPerSubject = 1
+}
+
+// TopicSanitizer is a function used to transform a watermill topic before it is validated and used,
+// e.g. SlashTopicSanitizer for topics written as paths.
+type TopicSanitizer func(topic string) string
+
+// SlashTopicSanitizer replaces "/" in topics with the NATS subject token separator ".".
+func SlashTopicSanitizer(topic string) string {
+	return strings.Replace(topic, "/", ".", -1)
+}
+
+// topicEscape is the escape character of EscapeTopic.
+const topicEscape = '%'
+
+// EscapeTopic escapes the characters of topic which are not allowed in NATS subjects (whitespace, control
+// characters and the wildcards "*" and ">") as %XX, with XX the hex of their UTF-8 bytes, so topic names from
+// upstream systems can be used as subjects.  "%" is escaped as well, so the escaping is reversible with
+// UnescapeTopic.  "." is kept, it still separates subject tokens.
+func EscapeTopic(topic string) string {
+	if strings.IndexFunc(topic, escapedInTopic) < 0 {
+		return topic
+	}
+
+	var b strings.Builder
+	for _, r := range topic {
+		if !escapedInTopic(r) {
+			b.WriteRune(r)
+			continue
+		}
+		for _, c := range []byte(string(r)) {
+			fmt.Fprintf(&b, "%c%02X", topicEscape, c)
+		}
+	}
+
+	return b.String()
+}
+
+// UnescapeTopic reverses EscapeTopic.
+func UnescapeTopic(escaped string) (string, error) {
+	topic, err := url.PathUnescape(escaped)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot unescape topic %q", escaped)
+	}
+
+	return topic, nil
+}
+
+func escapedInTopic(r rune) bool {
+	return r == topicEscape || r == '*' || r == '>' || unicode.IsSpace(r) || unicode.IsControl(r)
+}
+
+// InvalidTopicError is returned when a topic can not be used as a NATS subject (or stream name when provisioning).
+type InvalidTopicError struct {
+	Topic  string
+	Reason string
+}
+
+func (e *InvalidTopicError) Error() string {
+	return fmt.Sprintf("invalid topic %q: %s", e.Topic, e.Reason)
+}
+
+// ValidateTopic checks that topic can be used as a prefix of NATS subjects: it must not be empty, contain whitespace
+// or wildcards, or have empty tokens.  Topics of provisioned streams are also stream names, which can not contain ".".
+func ValidateTopic(topic string, provisioned bool) error {
+	if topic == "" {
+		return &InvalidTopicError{Topic: topic, Reason: "topic is empty"}
+	}
+
+	for _, r := range topic {
+		switch {
+		case unicode.IsSpace(r):
+			return &InvalidTopicError{Topic: topic, Reason: "whitespace is not allowed"}
+		case r == '*' || r == '>':
+			return &InvalidTopicError{Topic: topic, Reason: fmt.Sprintf("wildcard %q is not allowed", r)}
+		case r == '/' || r == '\\':
+			if provisioned {
+				return &InvalidTopicError{Topic: topic, Reason: fmt.Sprintf("%q is not allowed in stream names", r)}
+			}
+		}
+	}
+
+	for _, token := range strings.Split(topic, ".") {
+		if token == "" {
+			return &InvalidTopicError{Topic: topic, Reason: "empty subject tokens are not allowed"}
+		}
+	}
+
+	if provisioned && strings.Contains(topic, ".") {
+		return &InvalidTopicError{Topic: topic, Reason: `"." is not allowed in stream names`}
+	}
+
+	return nil
+}
+
+// sanitizeTopic applies sanitizer to topic, escapes it with EscapeTopic when escape is set and validates the result.
+func sanitizeTopic(topic string, sanitizer TopicSanitizer, escape bool, provisioned bool) (string, error) {
+	if sanitizer != nil {
+		topic = sanitizer(topic)
+	}
+	if escape {
+		topic = EscapeTopic(topic)
+	}
+
+	if err := ValidateTopic(topic, provisioned); err != nil {
+		return "", err
+	}
+
+	return topic, nil
+}
+
 // Subjects contains nats subject detail (primary + all additional) for a given watermill topic.
 type Subjects struct {
 	Primary    string
@@ -32,8 +166,100 @@ type topicInterpreter struct {
 	subjectCalculator     SubjectCalculator
 	durableNameCalculator DurableNameCalculator
 	queueGroupCalculator  QueueGroupCalculator
+	streamNameCalculator  StreamNameCalculator
+	streamPreset          StreamPreset
+	duplicateWindow       time.Duration
+
+	// calculators are expected to be deterministic, so their results are computed once per topic,
+	// for the topicCacheSize most recently used topics
+	subjectsCache     *lruCache // topic -> *Subjects
+	durableNamesCache *lruCache // nameKey -> string
+	queueGroupsCache  *lruCache // nameKey -> string
+	streamNamesCache  *lruCache // topic -> string
+}
+
+// topicCacheSize is the number of topics the calculated subjects and names are cached for, so subscribers
+// and publishers of many dynamic topics (e.g. per tenant or entity) do not grow their memory with every topic.
+const topicCacheSize = 1024
+
+// lruCache is a cache of at most size entries, forgetting the least recently used entry past it.
+type lruCache struct {
+	size int
+
+	lock    sync.Mutex
+	entries map[interface{}]*list.Element
+	order   *list.List // front is the most recently used
+}
+
+type lruEntry struct {
+	key   interface{}
+	value interface{}
+}
+
+func newLRUCache(size int) *lruCache {
+	return &lruCache{
+		size:    size,
+		entries: map[interface{}]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// get returns the value cached for key, calculating and caching it when it is not cached.
+func (c *lruCache) get(key interface{}, calculate func() interface{}) interface{} {
+	if value, ok := c.load(key); ok {
+		return value
+	}
+
+	// calculated outside of the lock, calculators are user code
+	value := calculate()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.order.MoveToFront(element)
+		return element.Value.(*lruEntry).value
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+
+	return value
+}
+
+func (c *lruCache) load(key interface{}) (interface{}, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+
+	return element.Value.(*lruEntry).value, true
+}
+
+func (c *lruCache) len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.order.Len()
+}
+
+// nameKey is the cache key of a durable name or queue group calculated for a topic.
+type nameKey struct {
+	name  string
+	topic string
 }
 
+// defaultDuplicateWindow matches the JetStream server default duplicate window.
+const defaultDuplicateWindow = 2 * time.Minute
+
 func defaultSubjectCalculator(topic string) *Subjects {
 	return &Subjects{
 		Primary: fmt.Sprintf("%s.*", topic),
@@ -49,7 +275,11 @@ func defaultQueueGroupCalculator(queueGroup, topic string) string {
 	return fmt.Sprintf("%s.%s", queueGroup, topic)
 }
 
-func newTopicInterpreter(js nats.JetStreamManager, formatter SubjectCalculator) *topicInterpreter {
+func defaultStreamNameCalculator(topic string) string {
+	return topic
+}
+
+func newTopicInterpreter(js nats.JetStreamManager, formatter SubjectCalculator, duplicateWindow time.Duration) *topicInterpreter {
 	if formatter == nil {
 		formatter = defaultSubjectCalculator
 	}
@@ -59,18 +289,72 @@ func newTopicInterpreter(js nats.JetStreamManager, formatter SubjectCalculator)
 		subjectCalculator:     formatter,
 		durableNameCalculator: defaultDurableNameCalculator,
 		queueGroupCalculator:  defaultQueueGroupCalculator,
+		streamNameCalculator:  defaultStreamNameCalculator,
+		duplicateWindow:       duplicateWindow,
+		subjectsCache:         newLRUCache(topicCacheSize),
+		durableNamesCache:     newLRUCache(topicCacheSize),
+		queueGroupsCache:      newLRUCache(topicCacheSize),
+		streamNamesCache:      newLRUCache(topicCacheSize),
+	}
+}
+
+// subjects returns the subjects of topic calculated by the subject calculator.
+func (b *topicInterpreter) subjects(topic string) *Subjects {
+	return b.subjectsCache.get(topic, func() interface{} {
+		return b.subjectCalculator(topic)
+	}).(*Subjects)
+}
+
+// publishSubject returns the subject a message with the given uuid is published to on topic: the primary subject
+// calculated by the subject calculator with its wildcards replaced by uuid, "{topic}.{uuid}" by default.
+func (b *topicInterpreter) publishSubject(topic, uuid string) string {
+	tokens := strings.Split(b.subjects(topic).Primary, ".")
+	for i, token := range tokens {
+		if token == "*" || token == ">" {
+			tokens[i] = uuid
+		}
 	}
+
+	return strings.Join(tokens, ".")
+}
+
+// durableName returns the durable name of topic calculated by the durable name calculator.
+func (b *topicInterpreter) durableName(durableName, topic string) string {
+	return b.durableNamesCache.get(nameKey{name: durableName, topic: topic}, func() interface{} {
+		return b.durableNameCalculator(durableName, topic)
+	}).(string)
+}
+
+// queueGroup returns the queue group of topic calculated by the queue group calculator.
+func (b *topicInterpreter) queueGroup(queueGroup, topic string) string {
+	return b.queueGroupsCache.get(nameKey{name: queueGroup, topic: topic}, func() interface{} {
+		return b.queueGroupCalculator(queueGroup, topic)
+	}).(string)
+}
+
+// streamName returns the name of the stream of topic calculated by the stream name calculator.
+func (b *topicInterpreter) streamName(topic string) string {
+	return b.streamNamesCache.get(topic, func() interface{} {
+		return b.streamNameCalculator(topic)
+	}).(string)
 }
 
 func (b *topicInterpreter) ensureStream(topic string) error {
-	_, err := b.js.StreamInfo(topic)
+	stream := b.streamName(topic)
+	_, err := b.js.StreamInfo(stream)
 
 	if err != nil {
-		_, err = b.js.AddStream(&nats.StreamConfig{
-			Name:        topic,
+		cfg := &nats.StreamConfig{
+			Name:        stream,
 			Description: "",
-			Subjects:    b.subjectCalculator(topic).All(),
-		})
+			Subjects:    b.subjects(topic).All(),
+			Duplicates:  b.duplicateWindow,
+		}
+		if b.streamPreset != nil {
+			b.streamPreset(cfg)
+		}
+
+		_, err = b.js.AddStream(cfg)
 
 		if err != nil {
 			return err
@@ -80,6 +364,42 @@ func (b *topicInterpreter) ensureStream(topic string) error {
 	return err
 }
 
+// ErrStreamNotFound is returned when subscribing with RequireExistingStream to a topic without stream,
+// it is nats.ErrStreamNotFound.
+var ErrStreamNotFound = nats.ErrStreamNotFound
+
+// requireStream returns ErrStreamNotFound when the stream of topic does not exist.
+func (b *topicInterpreter) requireStream(topic string) error {
+	stream := b.streamName(topic)
+	if _, err := b.js.StreamInfo(stream); err != nil {
+		return errors.Wrapf(err, "cannot bind stream %s", stream)
+	}
+
+	return nil
+}
+
+// ensureConsumer creates the durable consumer on stream unless it already exists.
+func (b *topicInterpreter) ensureConsumer(stream string, cfg *nats.ConsumerConfig) error {
+	_, err := b.js.ConsumerInfo(stream, cfg.Durable)
+	if err == nil {
+		return nil
+	}
+
+	if !errors.Is(err, nats.ErrConsumerNotFound) {
+		return err
+	}
+
+	_, err = b.js.AddConsumer(stream, cfg)
+
+	return err
+}
+
 func PublishSubject(topic string, uuid string) string {
-	return fmt.Sprintf("%s.%s", topic, uuid)
+	return topic + "." + uuid
+}
+
+// KeySubject returns the subject messages of topic with the given subject key are published to, see
+// PublisherConfig.SubjectKeyMetadata.  The key is escaped with EscapeTopic, "." included, so it is a single token.
+func KeySubject(topic string, key string) string {
+	return topic + "." + strings.Replace(EscapeTopic(key), ".", "%2E", -1)
 }
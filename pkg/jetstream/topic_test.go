@@ -0,0 +1,175 @@
+package jetstream
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopicInterpreter_CachesCalculations(t *testing.T) {
+	calls := map[string]int{}
+
+	b := newTopicInterpreter(nil, func(topic string) *Subjects {
+		calls["subjects"]++
+		return defaultSubjectCalculator(topic)
+	}, 0)
+	b.durableNameCalculator = func(durableName, topic string) string {
+		calls["durable"]++
+		return defaultDurableNameCalculator(durableName, topic)
+	}
+	b.queueGroupCalculator = func(queueGroup, topic string) string {
+		calls["queue"]++
+		return defaultQueueGroupCalculator(queueGroup, topic)
+	}
+
+	for i := 0; i < 3; i++ {
+		require.Equal(t, "orders.*", b.subjects("orders").Primary)
+		require.Equal(t, "durable_orders_eu", b.durableName("durable", "orders.eu"))
+		require.Equal(t, "group.orders", b.queueGroup("group", "orders"))
+	}
+
+	require.Equal(t, map[string]int{"subjects": 1, "durable": 1, "queue": 1}, calls)
+
+	// every topic and name is calculated on its own
+	require.Equal(t, "payments.*", b.subjects("payments").Primary)
+	require.Equal(t, "other_orders_eu", b.durableName("other", "orders.eu"))
+	require.Equal(t, map[string]int{"subjects": 2, "durable": 2, "queue": 1}, calls)
+}
+
+func TestPublishSubject(t *testing.T) {
+	require.Equal(t, "orders.1234", PublishSubject("orders", "1234"))
+}
+
+func TestTopicInterpreter_PublishSubject(t *testing.T) {
+	b := newTopicInterpreter(nil, nil, 0)
+	require.Equal(t, "orders.1234", b.publishSubject("orders", "1234"))
+
+	b = newTopicInterpreter(nil, func(topic string) *Subjects {
+		return &Subjects{Primary: "events." + topic + ".>"}
+	}, 0)
+	require.Equal(t, "events.orders.1234", b.publishSubject("orders", "1234"))
+}
+
+func TestKeySubject(t *testing.T) {
+	require.Equal(t, "orders.customer-1", KeySubject("orders", "customer-1"))
+	require.Equal(t, "orders.eu%2Ecustomer%201", KeySubject("orders", "eu.customer 1"))
+}
+
+func TestValidateTopic(t *testing.T) {
+	tests := []struct {
+		topic       string
+		provisioned bool
+		valid       bool
+	}{
+		{topic: "orders", provisioned: true, valid: true},
+		{topic: "orders.eu", valid: true},
+		{topic: "orders.eu", provisioned: true, valid: false},
+		{topic: "orders/eu", valid: true},
+		{topic: "orders/eu", provisioned: true, valid: false},
+		{topic: "", valid: false},
+		{topic: "orders eu", valid: false},
+		{topic: "orders.*", valid: false},
+		{topic: "orders.>", valid: false},
+		{topic: "orders..eu", valid: false},
+		{topic: ".orders", valid: false},
+	}
+
+	for _, tt := range tests {
+		err := ValidateTopic(tt.topic, tt.provisioned)
+		if tt.valid {
+			require.NoError(t, err, "topic %q", tt.topic)
+			continue
+		}
+
+		var topicErr *InvalidTopicError
+		require.True(t, errors.As(err, &topicErr), "topic %q", tt.topic)
+		require.Equal(t, tt.topic, topicErr.Topic)
+	}
+}
+
+func TestSanitizeTopic(t *testing.T) {
+	topic, err := sanitizeTopic("orders/eu", SlashTopicSanitizer, false, false)
+	require.NoError(t, err)
+	require.Equal(t, "orders.eu", topic)
+
+	_, err = sanitizeTopic("orders/eu", SlashTopicSanitizer, false, true)
+	require.Error(t, err)
+}
+
+func TestPublisher_InvalidTopic(t *testing.T) {
+	p := &Publisher{config: PublisherPublishConfig{Marshaler: &GobMarshaler{}}}
+
+	err := p.Publish("orders.*")
+
+	var topicErr *InvalidTopicError
+	require.True(t, errors.As(err, &topicErr))
+}
+
+func TestTopicInterpreter_StreamName(t *testing.T) {
+	b := newTopicInterpreter(nil, nil, 0)
+	require.Equal(t, "orders", b.streamName("orders"))
+
+	b.streamNameCalculator = func(topic string) string { return "EVENTS" }
+	require.Equal(t, "EVENTS", b.streamName("payments"))
+}
+
+func TestEscapeTopic(t *testing.T) {
+	tests := []struct {
+		topic   string
+		escaped string
+	}{
+		{topic: "orders.eu", escaped: "orders.eu"},
+		{topic: "orders eu", escaped: "orders%20eu"},
+		{topic: "orders.*", escaped: "orders.%2A"},
+		{topic: "orders.>", escaped: "orders.%3E"},
+		{topic: "100%", escaped: "100%25"},
+		{topic: "tab\tnewline\n", escaped: "tab%09newline%0A"},
+		{topic: "caf\u00e9 \u00e0", escaped: "caf\u00e9%20\u00e0"},
+		{topic: "no\u00a0break", escaped: "no%C2%A0break"},
+	}
+
+	for _, tt := range tests {
+		escaped := EscapeTopic(tt.topic)
+		require.Equal(t, tt.escaped, escaped)
+		require.NoError(t, ValidateTopic(escaped, false), "topic %q", tt.topic)
+
+		topic, err := UnescapeTopic(escaped)
+		require.NoError(t, err)
+		require.Equal(t, tt.topic, topic)
+	}
+
+	_, err := UnescapeTopic("orders%zz")
+	require.Error(t, err)
+}
+
+func TestSanitizeTopic_Escape(t *testing.T) {
+	topic, err := sanitizeTopic("orders/eu west", SlashTopicSanitizer, true, false)
+	require.NoError(t, err)
+	require.Equal(t, "orders.eu%20west", topic)
+
+	_, err = sanitizeTopic("orders eu", nil, false, false)
+	require.Error(t, err)
+}
+
+func TestTopicInterpreter_BoundsCaches(t *testing.T) {
+	calls := 0
+	b := newTopicInterpreter(nil, func(topic string) *Subjects {
+		calls++
+		return defaultSubjectCalculator(topic)
+	}, 0)
+
+	for i := 0; i < topicCacheSize+10; i++ {
+		b.subjects(fmt.Sprintf("topic_%d", i))
+	}
+	require.Equal(t, topicCacheSize, b.subjectsCache.len())
+
+	// the most recently used topics are still cached, the least recently used ones are calculated again
+	b.subjects(fmt.Sprintf("topic_%d", topicCacheSize+9))
+	require.Equal(t, topicCacheSize+10, calls)
+
+	b.subjects("topic_0")
+	require.Equal(t, topicCacheSize+11, calls)
+	require.Equal(t, topicCacheSize, b.subjectsCache.len())
+}
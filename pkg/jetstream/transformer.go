@@ -0,0 +1,72 @@
+package jetstream
+
+import (
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// MessageTransformer modifies a message in place, e.g. to add the tenant to its metadata or to upgrade its payload
+// to the current schema.  An error stops the message: publishing fails, a received message is not delivered.
+type MessageTransformer func(topic string, msg *message.Message) error
+
+// Transformers are the message transformers of a publisher or subscriber.
+//
+// The publisher applies them to the messages passed to Publish before marshaling, modifying them in place.
+// The subscriber applies them after unmarshaling, before messages are sent to the consumer by Subscribe and SubscribeBatch.
+// A received message failing a transformer is not acked, so it is redelivered after AckWaitTimeout,
+// unless it is quarantined (see QuarantineConfig).
+type Transformers struct {
+	// All are applied to the messages of every topic, before the transformers of their topic.
+	All []MessageTransformer
+
+	// Topics are applied to the messages of their topic, in order.
+	Topics map[string][]MessageTransformer
+}
+
+// apply applies the transformers of topic to msg, stopping at the first error.
+func (t Transformers) apply(topic string, msg *message.Message) error {
+	for _, transform := range t.All {
+		if err := transform(topic, msg); err != nil {
+			return errors.Wrap(err, "cannot transform message")
+		}
+	}
+
+	for _, transform := range t.Topics[topic] {
+		if err := transform(topic, msg); err != nil {
+			return errors.Wrap(err, "cannot transform message")
+		}
+	}
+
+	return nil
+}
+
+// unmarshal unmarshals a message received on topic and applies the transformers of the subscriber.
+// The reply subject, the correlation id and the final attempt flag are stored in the metadata before, so transformers
+// can use them.
+func (s *Subscriber) unmarshal(topic string, m *nats.Msg) (*message.Message, error) {
+	if err := s.config.Encoding.check(m); err != nil {
+		return nil, err
+	}
+
+	msg, err := s.config.Unmarshaler.Unmarshal(m)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot unmarshal message")
+	}
+
+	if s.config.ReplyMetadataKey != "" && m.Reply != "" {
+		msg.Metadata.Set(s.config.ReplyMetadataKey, m.Reply)
+	}
+
+	s.config.Correlation.restore(msg, m)
+
+	if s.finalAttempt(m) {
+		msg.Metadata.Set(FinalAttemptMetadataKey, "true")
+	}
+
+	if err := s.config.Transformers.apply(topic, msg); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,118 @@
+package jetstream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func setMetadata(key, value string) MessageTransformer {
+	return func(topic string, msg *message.Message) error {
+		msg.Metadata.Set(key, msg.Metadata.Get(key)+value)
+		return nil
+	}
+}
+
+func TestTransformers_Apply(t *testing.T) {
+	transformers := Transformers{
+		All: []MessageTransformer{setMetadata("order", "all")},
+		Topics: map[string][]MessageTransformer{
+			"orders": {setMetadata("order", ",orders1"), setMetadata("order", ",orders2")},
+		},
+	}
+
+	msg := message.NewMessage(watermill.NewUUID(), nil)
+	require.NoError(t, transformers.apply("orders", msg))
+	require.Equal(t, "all,orders1,orders2", msg.Metadata.Get("order"))
+
+	msg = message.NewMessage(watermill.NewUUID(), nil)
+	require.NoError(t, transformers.apply("payments", msg))
+	require.Equal(t, "all", msg.Metadata.Get("order"))
+
+	require.NoError(t, Transformers{}.apply("orders", msg))
+
+	failing := Transformers{
+		All: []MessageTransformer{func(string, *message.Message) error { return errors.New("unknown schema") }},
+		Topics: map[string][]MessageTransformer{
+			"orders": {setMetadata("order", "never")},
+		},
+	}
+
+	msg = message.NewMessage(watermill.NewUUID(), nil)
+	require.EqualError(t, failing.apply("orders", msg), "cannot transform message: unknown schema")
+	require.Empty(t, msg.Metadata.Get("order"))
+}
+
+func TestPublisher_Transformers(t *testing.T) {
+	js := &faultyJetStream{}
+	p := &Publisher{
+		config: PublisherPublishConfig{
+			Marshaler: &GobMarshaler{},
+			Transformers: Transformers{
+				Topics: map[string][]MessageTransformer{"orders": {setMetadata("tenant", "acme")}},
+			},
+		},
+		logger: watermill.NopLogger{},
+	}
+	p.decorateClient(clientDecorator{
+		jetStream: func(nats.JetStream) nats.JetStream { return js },
+	})
+
+	require.NoError(t, p.Publish("orders", message.NewMessage(watermill.NewUUID(), nil)))
+	require.Len(t, js.published, 1)
+
+	published, err := (&GobMarshaler{}).Unmarshal(js.published[0])
+	require.NoError(t, err)
+	require.Equal(t, "acme", published.Metadata.Get("tenant"))
+}
+
+func TestSubscriber_Transformers(t *testing.T) {
+	s := faultySubscriber(SubscriberSubscriptionConfig{
+		AckWaitTimeout: 50 * time.Millisecond,
+		Transformers: Transformers{
+			Topics: map[string][]MessageTransformer{
+				"orders": {func(topic string, msg *message.Message) error {
+					if msg.Metadata.Get("schema") != "v2" {
+						return errors.New("unknown schema")
+					}
+					msg.Metadata.Set("schema", "v3")
+					return nil
+				}},
+			},
+		},
+	}, clientDecorator{
+		acker: func(msgAcker) msgAcker { return nopAcker{} },
+	})
+
+	output := make(chan *message.Message, 1)
+	handler := &subscriptionHandler{
+		ctx:       context.Background(),
+		topic:     "orders",
+		output:    output,
+		logFields: watermill.LogFields{},
+	}
+
+	upgraded := message.NewMessage(watermill.NewUUID(), nil)
+	upgraded.Metadata.Set("schema", "v2")
+	m, err := (&GobMarshaler{}).Marshal("orders", upgraded)
+	require.NoError(t, err)
+
+	go s.processMessage(handler, m)
+
+	msg := <-output
+	require.Equal(t, "v3", msg.Metadata.Get("schema"))
+	msg.Ack()
+
+	// a message failing a transformer is not delivered
+	m, err = (&GobMarshaler{}).Marshal("orders", message.NewMessage(watermill.NewUUID(), nil))
+	require.NoError(t, err)
+
+	s.processMessage(handler, m)
+	require.Empty(t, output)
+}
@@ -0,0 +1,81 @@
+package jetstream
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// MsgTTLHdr is the NATS header holding the TTL of a message.
+//
+// Servers supporting per-message TTLs (nats-server 2.11+ with AllowMsgTTL enabled on the stream) remove the message
+// once it expired.  Other servers store the header as is, SubscriberConfig.DropExpired drops such messages client side.
+const MsgTTLHdr = "Nats-TTL"
+
+// messageTTL returns the TTL stored under key in the metadata of msg, found is false when it has no TTL.
+func messageTTL(msg *message.Message, key string) (ttl time.Duration, found bool, err error) {
+	value := msg.Metadata.Get(key)
+	if value == "" {
+		return 0, false, nil
+	}
+
+	ttl, err = parseTTL(value)
+	if err != nil {
+		return 0, false, errors.Wrapf(err, "invalid ttl of message %s", msg.UUID)
+	}
+
+	return ttl, true, nil
+}
+
+// parseTTL parses a TTL given as a duration (e.g. "30s") or as a number of seconds, like the server does.
+func parseTTL(value string) (time.Duration, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	ttl, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+
+	if ttl < time.Second {
+		return 0, errors.Errorf("ttl %s is shorter than a second", ttl)
+	}
+
+	return ttl, nil
+}
+
+func setMsgTTL(m *nats.Msg, ttl time.Duration) {
+	if m.Header == nil {
+		m.Header = make(nats.Header)
+	}
+
+	m.Header.Set(MsgTTLHdr, strconv.FormatInt(int64(ttl/time.Second), 10))
+}
+
+// msgExpired reports whether m carries a TTL which elapsed since it was stored.
+func msgExpired(m *nats.Msg, now time.Time) bool {
+	if m.Header == nil {
+		return false
+	}
+
+	value := m.Header.Get(MsgTTLHdr)
+	if value == "" {
+		return false
+	}
+
+	ttl, err := parseTTL(value)
+	if err != nil {
+		return false
+	}
+
+	meta, err := m.Metadata()
+	if err != nil {
+		return false
+	}
+
+	return now.After(meta.Timestamp.Add(ttl))
+}
@@ -0,0 +1,66 @@
+package jetstream
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+// storedMsg returns a message bound to a subscription as if it was delivered by JetStream, stored at stored.
+func storedMsg(stored time.Time, hdr nats.Header) *nats.Msg {
+	return &nats.Msg{
+		Subject: "topic.uuid",
+		Reply:   fmt.Sprintf("$JS.ACK.topic.consumer.1.10.5.%d.0", stored.UnixNano()),
+		Header:  hdr,
+		Sub:     &nats.Subscription{},
+	}
+}
+
+func TestMessageTTL(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		wantTTL   time.Duration
+		wantFound bool
+		wantErr   bool
+	}{
+		{name: "missing"},
+		{name: "duration", value: "1m30s", wantTTL: 90 * time.Second, wantFound: true},
+		{name: "seconds", value: "45", wantTTL: 45 * time.Second, wantFound: true},
+		{name: "too short", value: "500ms", wantErr: true},
+		{name: "invalid", value: "soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := message.NewMessage("uuid", nil)
+			if tt.value != "" {
+				msg.Metadata.Set("ttl", tt.value)
+			}
+
+			ttl, found, err := messageTTL(msg, "ttl")
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantFound, found)
+			require.Equal(t, tt.wantTTL, ttl)
+		})
+	}
+}
+
+func TestMsgExpired(t *testing.T) {
+	now := time.Now()
+
+	withTTL := nats.Header{}
+	setMsgTTL(&nats.Msg{Header: withTTL}, time.Minute)
+	require.Equal(t, "60", withTTL.Get(MsgTTLHdr))
+
+	require.False(t, msgExpired(storedMsg(now.Add(-2*time.Minute), nil), now))
+	require.False(t, msgExpired(storedMsg(now.Add(-30*time.Second), withTTL), now))
+	require.True(t, msgExpired(storedMsg(now.Add(-2*time.Minute), withTTL), now))
+}
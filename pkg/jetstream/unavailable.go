@@ -0,0 +1,99 @@
+package jetstream
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// unavailableRetry paces the attempts made while JetStream is unavailable, within the grace period.
+var unavailableRetry = ExponentialRetryPolicy{InitialDelay: 100 * time.Millisecond, MaxDelay: 2 * time.Second}
+
+// JetStreamUnavailableError is returned once JetStream stayed unavailable for the whole grace period
+// (PublisherConfig.UnavailableGracePeriod, SubscriberConfig.UnavailableGracePeriod), with the stream and
+// subject of the failed operation.  The last error of JetStream can be inspected with errors.Is.
+type JetStreamUnavailableError struct {
+	Stream  string
+	Subject string
+
+	// Elapsed is how long the operation was retried.
+	Elapsed time.Duration
+
+	Err error
+}
+
+func (e *JetStreamUnavailableError) Error() string {
+	return fmt.Sprintf("jetstream unavailable for stream %s (subject %s) for %s: %s", e.Stream, e.Subject, e.Elapsed, e.Err)
+}
+
+func (e *JetStreamUnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// jetStreamUnavailable reports whether err tells that JetStream did not answer: nothing listens on the API or
+// stream subject (no responders, e.g. while JetStream restarts or the stream is not created yet), JetStream is
+// not enabled, or the cluster is temporarily unavailable.
+func jetStreamUnavailable(err error) bool {
+	if errors.Is(err, nats.ErrNoResponders) || errors.Is(err, nats.ErrJetStreamNotEnabled) {
+		return true
+	}
+
+	// the pinned client reports API errors as plain text
+	return strings.Contains(strings.ToLower(err.Error()), "temporarily unavailable")
+}
+
+// retryUnavailable calls op, retrying it while JetStream is unavailable until grace elapsed on clock or closing
+// is closed, when it fails with a JetStreamUnavailableError about the stream and subject returned by target.
+// op is called once when grace is zero.
+func retryUnavailable(
+	grace time.Duration,
+	clock Clock,
+	closing <-chan struct{},
+	logger watermill.LoggerAdapter,
+	target func() (stream, subject string),
+	op func() error,
+) error {
+	start := clockNow(clock)
+	var stream, subject string
+
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || grace <= 0 || !jetStreamUnavailable(err) {
+			return err
+		}
+		if attempt == 1 {
+			stream, subject = target()
+		}
+
+		elapsed := clockNow(clock).Sub(start)
+		unavailableErr := &JetStreamUnavailableError{Stream: stream, Subject: subject, Elapsed: elapsed, Err: err}
+		if elapsed >= grace {
+			return unavailableErr
+		}
+
+		delay := unavailableRetry.NextDelay(attempt)
+		if remaining := grace - elapsed; delay > remaining {
+			delay = remaining
+		}
+
+		logger.Debug("JetStream unavailable, retrying", watermill.LogFields{
+			"stream":  stream,
+			"subject": subject,
+			"err":     err,
+			"delay":   delay,
+		})
+
+		wait, stop := after(clock, delay)
+		select {
+		case <-wait:
+			stop()
+		case <-closing:
+			stop()
+			return unavailableErr
+		}
+	}
+}
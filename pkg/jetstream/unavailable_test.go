@@ -0,0 +1,101 @@
+package jetstream
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJetStreamUnavailable(t *testing.T) {
+	require.True(t, jetStreamUnavailable(nats.ErrNoResponders))
+	require.True(t, jetStreamUnavailable(errors.Wrap(nats.ErrJetStreamNotEnabled, "cannot subscribe")))
+	require.True(t, jetStreamUnavailable(errors.New("nats: JetStream system temporarily unavailable")))
+	require.False(t, jetStreamUnavailable(nats.ErrTimeout))
+	require.False(t, jetStreamUnavailable(nats.ErrStreamNotFound))
+}
+
+func TestPublisher_UnavailableGracePeriod(t *testing.T) {
+	tests := []struct {
+		name        string
+		failures    int
+		wantErr     bool
+		wantRetried bool
+	}{
+		{name: "recovered", failures: 2, wantRetried: true},
+		{name: "grace period elapsed", failures: 1000, wantErr: true, wantRetried: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			js := &flakyJetStream{err: nats.ErrNoResponders, failures: tt.failures}
+			p := &Publisher{
+				config: PublisherPublishConfig{
+					Marshaler:              &GobMarshaler{},
+					UnavailableGracePeriod: 300 * time.Millisecond,
+				},
+				logger:           watermill.NopLogger{},
+				topicInterpreter: newTopicInterpreter(nil, defaultSubjectCalculator, 0),
+			}
+			p.decorateClient(clientDecorator{
+				jetStream: func(nats.JetStream) nats.JetStream { return js },
+			})
+
+			err := p.Publish("orders", message.NewMessage(watermill.NewUUID(), nil))
+			require.Greater(t, js.attempts, 1)
+
+			if !tt.wantErr {
+				require.NoError(t, err)
+				require.Len(t, js.published, 1)
+				return
+			}
+
+			var unavailableErr *JetStreamUnavailableError
+			require.True(t, errors.As(err, &unavailableErr), "unexpected error: %v", err)
+			require.Equal(t, "orders", unavailableErr.Stream)
+			require.True(t, strings.HasPrefix(unavailableErr.Subject, "orders."), unavailableErr.Subject)
+			require.GreaterOrEqual(t, unavailableErr.Elapsed, 300*time.Millisecond)
+			require.True(t, errors.Is(err, nats.ErrNoResponders))
+		})
+	}
+}
+
+func TestPublisher_UnavailableWithoutGracePeriod(t *testing.T) {
+	js := &flakyJetStream{err: nats.ErrNoResponders, failures: 1}
+	p := &Publisher{
+		config: PublisherPublishConfig{Marshaler: &GobMarshaler{}},
+		logger: watermill.NopLogger{},
+	}
+	p.decorateClient(clientDecorator{
+		jetStream: func(nats.JetStream) nats.JetStream { return js },
+	})
+
+	err := p.Publish("orders", message.NewMessage(watermill.NewUUID(), nil))
+	require.True(t, errors.Is(err, nats.ErrNoResponders), "unexpected error: %v", err)
+
+	var unavailableErr *JetStreamUnavailableError
+	require.False(t, errors.As(err, &unavailableErr))
+	require.Equal(t, 1, js.attempts)
+}
+
+func TestSubscriber_UnavailableGracePeriod(t *testing.T) {
+	js := &flakySubscribeJetStream{err: nats.ErrJetStreamNotEnabled, failures: 1000}
+	s := faultySubscriber(SubscriberSubscriptionConfig{
+		UnavailableGracePeriod: 200 * time.Millisecond,
+	}, clientDecorator{
+		jetStream: func(nats.JetStream) nats.JetStream { return js },
+	})
+
+	_, err := s.subscribe("orders", func(*nats.Msg) {})
+
+	var unavailableErr *JetStreamUnavailableError
+	require.True(t, errors.As(err, &unavailableErr), "unexpected error: %v", err)
+	require.Equal(t, "orders", unavailableErr.Stream)
+	require.Equal(t, "orders.*", unavailableErr.Subject)
+	require.Greater(t, js.attempts, 1)
+}
@@ -0,0 +1,247 @@
+package jetstream
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// StreamUsage is the usage of a stream against its limits.
+type StreamUsage struct {
+	Stream string
+
+	Bytes    uint64
+	MaxBytes int64
+
+	Msgs    uint64
+	MaxMsgs int64
+
+	// BytesRatio and MsgsRatio are the fractions of MaxBytes and MaxMsgs used, zero when the stream has no such limit.
+	BytesRatio float64
+	MsgsRatio  float64
+}
+
+// Ratio returns the highest of BytesRatio and MsgsRatio.
+func (u StreamUsage) Ratio() float64 {
+	if u.BytesRatio > u.MsgsRatio {
+		return u.BytesRatio
+	}
+	return u.MsgsRatio
+}
+
+func newStreamUsage(info *nats.StreamInfo) StreamUsage {
+	usage := StreamUsage{
+		Stream:   info.Config.Name,
+		Bytes:    info.State.Bytes,
+		MaxBytes: info.Config.MaxBytes,
+		Msgs:     info.State.Msgs,
+		MaxMsgs:  info.Config.MaxMsgs,
+	}
+	if usage.MaxBytes > 0 {
+		usage.BytesRatio = float64(usage.Bytes) / float64(usage.MaxBytes)
+	}
+	if usage.MaxMsgs > 0 {
+		usage.MsgsRatio = float64(usage.Msgs) / float64(usage.MaxMsgs)
+	}
+
+	return usage
+}
+
+// StreamUsageMonitorConfig is the configuration to create a stream usage monitor
+type StreamUsageMonitorConfig struct {
+	// Streams are the names of the watched streams (the topic, unless streams are named with a
+	// StreamNameCalculator), every stream of the account is watched when empty.
+	Streams []string
+
+	// Threshold is the fraction of MaxBytes or MaxMsgs from which a stream is reported (defaults to 0.8).
+	Threshold float64
+
+	// Interval is how often the usage of the streams is checked (defaults to 1 minute).
+	Interval time.Duration
+
+	// OnThreshold is called when the usage of a stream reaches Threshold, after it was logged.  It is called again
+	// once the usage went back below Threshold (e.g. after the retention limit discarded messages) and reached it again.
+	OnThreshold func(usage StreamUsage)
+
+	// JetstreamOptions are custom Jetstream options for a connection.
+	JetstreamOptions []nats.JSOpt
+}
+
+func (c *StreamUsageMonitorConfig) setDefaults() {
+	if c.Threshold == 0 {
+		c.Threshold = 0.8
+	}
+	if c.Interval <= 0 {
+		c.Interval = time.Minute
+	}
+}
+
+// Validate ensures configuration is valid before use
+func (c StreamUsageMonitorConfig) Validate() error {
+	if c.Threshold <= 0 || c.Threshold > 1 {
+		return errors.New("StreamUsageMonitorConfig.Threshold must be between 0 and 1")
+	}
+
+	return nil
+}
+
+// StreamUsageMonitor watches the bytes and messages of streams against their MaxBytes and MaxMsgs limits,
+// and warns when they reach the Threshold, so streams approaching their retention limits are noticed before
+// old messages are discarded (or new ones rejected with DiscardNew).  Streams without limits are not reported.
+type StreamUsageMonitor struct {
+	js     nats.JetStreamManager
+	config StreamUsageMonitorConfig
+	logger watermill.LoggerAdapter
+
+	// reported are the streams above Threshold at the last check
+	lock     sync.Mutex
+	reported map[string]bool
+
+	closing   chan struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// NewStreamUsageMonitor creates a new StreamUsageMonitor with the provided nats connection and starts checking
+// the usage of the streams every Interval.  The connection is not closed when the monitor is closed.
+func NewStreamUsageMonitor(conn *nats.Conn, config StreamUsageMonitorConfig, logger watermill.LoggerAdapter) (*StreamUsageMonitor, error) {
+	js, err := conn.JetStream(config.JetstreamOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	return newStreamUsageMonitor(js, config, logger)
+}
+
+func newStreamUsageMonitor(js nats.JetStreamManager, config StreamUsageMonitorConfig, logger watermill.LoggerAdapter) (*StreamUsageMonitor, error) {
+	config.setDefaults()
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	m := &StreamUsageMonitor{
+		js:       js,
+		config:   config,
+		logger:   logger,
+		reported: make(map[string]bool),
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go m.run()
+
+	return m, nil
+}
+
+func (m *StreamUsageMonitor) run() {
+	defer close(m.done)
+
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := m.Check(); err != nil {
+			m.logger.Error("Cannot check stream usage", err, nil)
+		}
+
+		select {
+		case <-m.closing:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check checks the usage of the streams right away, reporting the streams which reached Threshold,
+// and returns the usage of every stream with limits, sorted by stream name.
+func (m *StreamUsageMonitor) Check() ([]StreamUsage, error) {
+	infos, err := m.streamInfos()
+	if err != nil {
+		return nil, err
+	}
+
+	usages := make([]StreamUsage, 0, len(infos))
+	for _, info := range infos {
+		usage := newStreamUsage(info)
+		if usage.MaxBytes <= 0 && usage.MaxMsgs <= 0 {
+			continue
+		}
+
+		usages = append(usages, usage)
+		m.report(usage)
+	}
+
+	sort.Slice(usages, func(i, j int) bool { return usages[i].Stream < usages[j].Stream })
+
+	return usages, nil
+}
+
+func (m *StreamUsageMonitor) streamInfos() ([]*nats.StreamInfo, error) {
+	if len(m.config.Streams) == 0 {
+		var infos []*nats.StreamInfo
+		for info := range m.js.StreamsInfo() {
+			infos = append(infos, info)
+		}
+		return infos, nil
+	}
+
+	infos := make([]*nats.StreamInfo, 0, len(m.config.Streams))
+	for _, stream := range m.config.Streams {
+		info, err := m.js.StreamInfo(stream)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot get info of stream %s", stream)
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+// report warns about usage when its stream reached Threshold since the last check.
+func (m *StreamUsageMonitor) report(usage StreamUsage) {
+	above := usage.Ratio() >= m.config.Threshold
+
+	m.lock.Lock()
+	wasAbove := m.reported[usage.Stream]
+	m.reported[usage.Stream] = above
+	m.lock.Unlock()
+
+	logFields := watermill.LogFields{
+		"stream":      usage.Stream,
+		"bytes":       usage.Bytes,
+		"max_bytes":   usage.MaxBytes,
+		"msgs":        usage.Msgs,
+		"max_msgs":    usage.MaxMsgs,
+		"bytes_ratio": usage.BytesRatio,
+		"msgs_ratio":  usage.MsgsRatio,
+	}
+
+	switch {
+	case above && !wasAbove:
+		m.logger.Info("Stream usage reached threshold, messages will be discarded at the limit", logFields)
+		if m.config.OnThreshold != nil {
+			m.config.OnThreshold(usage)
+		}
+	case !above && wasAbove:
+		m.logger.Info("Stream usage back below threshold", logFields)
+	}
+}
+
+// Close stops checking the usage of the streams.
+func (m *StreamUsageMonitor) Close() error {
+	m.closeOnce.Do(func() {
+		close(m.closing)
+	})
+	<-m.done
+
+	return nil
+}
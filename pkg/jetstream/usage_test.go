@@ -0,0 +1,130 @@
+package jetstream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+type usageJetStream struct {
+	nats.JetStreamContext
+	streams map[string]*nats.StreamInfo
+}
+
+func (js *usageJetStream) StreamInfo(stream string, opts ...nats.JSOpt) (*nats.StreamInfo, error) {
+	info, ok := js.streams[stream]
+	if !ok {
+		return nil, nats.ErrStreamNotFound
+	}
+	return info, nil
+}
+
+func (js *usageJetStream) StreamsInfo(opts ...nats.JSOpt) <-chan *nats.StreamInfo {
+	infos := make(chan *nats.StreamInfo, len(js.streams))
+	for _, info := range js.streams {
+		infos <- info
+	}
+	close(infos)
+	return infos
+}
+
+func usageStream(name string, bytes uint64, maxBytes int64, msgs uint64, maxMsgs int64) *nats.StreamInfo {
+	return &nats.StreamInfo{
+		Config: nats.StreamConfig{Name: name, MaxBytes: maxBytes, MaxMsgs: maxMsgs},
+		State:  nats.StreamState{Bytes: bytes, Msgs: msgs},
+	}
+}
+
+func TestStreamUsageMonitor(t *testing.T) {
+	js := &usageJetStream{streams: map[string]*nats.StreamInfo{
+		"orders":    usageStream("orders", 850, 1000, 10, -1),
+		"payments":  usageStream("payments", 100, 1000, 90, 100),
+		"unlimited": usageStream("unlimited", 1<<30, -1, 1000, -1),
+	}}
+	logger := watermill.NewCaptureLogger()
+
+	var reported []StreamUsage
+	monitor, err := newStreamUsageMonitor(js, StreamUsageMonitorConfig{
+		Interval:    time.Hour,
+		OnThreshold: func(usage StreamUsage) { reported = append(reported, usage) },
+	}, logger)
+	require.NoError(t, err)
+	require.NoError(t, monitor.Close())
+
+	usages, err := monitor.Check()
+	require.NoError(t, err)
+	require.Len(t, usages, 2)
+	require.Equal(t, "orders", usages[0].Stream)
+	require.InDelta(t, 0.85, usages[0].BytesRatio, 0.001)
+	require.Zero(t, usages[0].MsgsRatio)
+	require.InDelta(t, 0.9, usages[1].Ratio(), 0.001)
+
+	require.Len(t, reported, 2)
+	require.True(t, logger.Has(watermill.CapturedMessage{
+		Level: watermill.InfoLogLevel,
+		Fields: watermill.LogFields{
+			"stream":      "orders",
+			"bytes":       uint64(850),
+			"max_bytes":   int64(1000),
+			"msgs":        uint64(10),
+			"max_msgs":    int64(-1),
+			"bytes_ratio": 0.85,
+			"msgs_ratio":  float64(0),
+		},
+		Msg: "Stream usage reached threshold, messages will be discarded at the limit",
+	}))
+
+	// streams staying above the threshold are reported once
+	_, err = monitor.Check()
+	require.NoError(t, err)
+	require.Len(t, reported, 2)
+
+	js.streams["orders"] = usageStream("orders", 100, 1000, 10, -1)
+	_, err = monitor.Check()
+	require.NoError(t, err)
+	require.Len(t, reported, 2)
+
+	js.streams["orders"] = usageStream("orders", 900, 1000, 10, -1)
+	_, err = monitor.Check()
+	require.NoError(t, err)
+	require.Len(t, reported, 3)
+	require.Equal(t, "orders", reported[2].Stream)
+}
+
+func TestStreamUsageMonitor_streams(t *testing.T) {
+	js := &usageJetStream{streams: map[string]*nats.StreamInfo{
+		"orders":   usageStream("orders", 850, 1000, 0, -1),
+		"payments": usageStream("payments", 950, 1000, 0, -1),
+	}}
+
+	monitor, err := newStreamUsageMonitor(js, StreamUsageMonitorConfig{
+		Streams:   []string{"orders"},
+		Threshold: 0.9,
+		Interval:  time.Hour,
+	}, nil)
+	require.NoError(t, err)
+	require.NoError(t, monitor.Close())
+
+	usages, err := monitor.Check()
+	require.NoError(t, err)
+	require.Len(t, usages, 1)
+	require.Equal(t, "orders", usages[0].Stream)
+
+	monitor.config.Streams = []string{"missing"}
+	_, err = monitor.Check()
+	require.ErrorIs(t, err, nats.ErrStreamNotFound)
+}
+
+func TestStreamUsageMonitorConfig_Validate(t *testing.T) {
+	config := StreamUsageMonitorConfig{}
+	config.setDefaults()
+	require.NoError(t, config.Validate())
+	require.Equal(t, 0.8, config.Threshold)
+	require.Equal(t, time.Minute, config.Interval)
+
+	config.Threshold = 1.5
+	require.Error(t, config.Validate())
+}
@@ -0,0 +1,86 @@
+package jetstream
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// FieldError is a problem with a configuration field.
+type FieldError struct {
+	// Field is the configuration field, e.g. "SubscriberConfig.DurableName".
+	Field string
+
+	// Problem describes what is wrong with the field.
+	Problem string
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Problem
+}
+
+// ConfigErrors are all the problems found when validating a configuration.
+type ConfigErrors []FieldError
+
+func (e ConfigErrors) Error() string {
+	problems := make([]string, len(e))
+	for i, fieldErr := range e {
+		problems[i] = fieldErr.Error()
+	}
+
+	return strings.Join(problems, "; ")
+}
+
+// add records a problem with field.
+func (e *ConfigErrors) add(field, problem string) {
+	*e = append(*e, FieldError{Field: field, Problem: problem})
+}
+
+// addErr records the error of validating field, flattening the problems of nested configurations.
+func (e *ConfigErrors) addErr(field string, err error) {
+	if err == nil {
+		return
+	}
+
+	var nested ConfigErrors
+	if errors.As(err, &nested) {
+		for _, fieldErr := range nested {
+			e.add(field+"."+fieldErr.Field, fieldErr.Problem)
+		}
+		return
+	}
+
+	e.add(field, err.Error())
+}
+
+// err returns the recorded problems, nil when there is none.
+func (e ConfigErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+
+	return e
+}
+
+// invalidNameRune reports whether r is not allowed in durable names: subject token separators, wildcards and whitespace.
+func invalidNameRune(r rune) bool {
+	switch r {
+	case '.', '*', '>', ' ', '\t', '\n', '\r':
+		return true
+	default:
+		return false
+	}
+}
+
+// invalidNameChars returns the characters of name which are not allowed in durable names, quoted.
+func invalidNameChars(name string) string {
+	var invalid []string
+	for _, r := range name {
+		if invalidNameRune(r) {
+			invalid = append(invalid, strconv.QuoteRune(r))
+		}
+	}
+
+	return strings.Join(invalid, ", ")
+}
@@ -0,0 +1,63 @@
+package jetstream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriberSubscriptionConfig_Validate_AllProblems(t *testing.T) {
+	c := SubscriberSubscriptionConfig{
+		DurableName:    "orders.v2",
+		MaxInFlight:    -1,
+		AckWaitTimeout: -time.Second,
+		Partitioning:   PartitionConfig{Count: -1},
+	}
+
+	err := c.Validate()
+	require.Error(t, err)
+
+	var errs ConfigErrors
+	require.True(t, errors.As(err, &errs))
+
+	var fields []string
+	for _, fieldErr := range errs {
+		fields = append(fields, fieldErr.Field)
+	}
+	require.Equal(t, []string{
+		"SubscriberConfig.Unmarshaler",
+		"SubscriberConfig.SubjectCalculator",
+		"SubscriberConfig.DurableName",
+		"SubscriberConfig.AckWaitTimeout",
+		"SubscriberConfig.Partitioning",
+		"SubscriberConfig.MaxInFlight",
+	}, fields)
+
+	require.Contains(t, err.Error(), `SubscriberConfig.DurableName: contains invalid characters '.'`)
+}
+
+func TestPublisherConfig_Validate_AllProblems(t *testing.T) {
+	err := PublisherConfig{DuplicateWindow: -time.Second}.Validate()
+
+	var errs ConfigErrors
+	require.True(t, errors.As(err, &errs))
+	require.Len(t, errs, 3)
+	require.Equal(t, "PublisherConfig.Marshaler: missing; PublisherConfig.SubjectCalculator: missing; "+
+		"PublisherConfig.DuplicateWindow: can not be negative", err.Error())
+}
+
+func TestConfigErrors_AddErr(t *testing.T) {
+	var errs ConfigErrors
+	errs.addErr("Outer", nil)
+	require.NoError(t, errs.err())
+
+	errs.addErr("Outer", ConfigErrors{{Field: "Inner", Problem: "missing"}})
+	errs.addErr("Other", errors.New("invalid"))
+
+	require.Equal(t, ConfigErrors{
+		{Field: "Outer.Inner", Problem: "missing"},
+		{Field: "Other", Problem: "invalid"},
+	}, errs)
+}
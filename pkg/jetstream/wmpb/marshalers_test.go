@@ -25,6 +25,7 @@ var marshalerCases = []marshalerCase{
 	{"gob", &jetstream.GobMarshaler{}},
 	{"json", &jetstream.JSONMarshaler{}},
 	{"proto", &wmpb.NATSMarshaler{}},
+	{"proto-zero-copy", &wmpb.NATSMarshaler{ZeroCopy: true}},
 	{"nats", &jetstream.NATSMarshaler{}},
 }
 
@@ -172,3 +173,37 @@ func sampleMessage(plSize int) *message.Message {
 
 	return msg
 }
+
+func TestNATSMarshaler_ZeroCopy(t *testing.T) {
+	msg := sampleMessage(100)
+	marshaler := &wmpb.NATSMarshaler{ZeroCopy: true}
+
+	natsMsg, err := marshaler.Marshal("topic", msg)
+	require.NoError(t, err)
+
+	unmarshaledMsg, err := marshaler.Unmarshal(natsMsg)
+	require.NoError(t, err)
+	require.True(t, msg.Equals(unmarshaledMsg))
+
+	// the payload shares its memory with the NATS message data
+	payloadEnd := &unmarshaledMsg.Payload[len(unmarshaledMsg.Payload)-1]
+	dataEnd := &natsMsg.Data[len(natsMsg.Data)-1]
+	assert.Same(t, dataEnd, payloadEnd)
+}
+
+func TestNATSMarshaler_ZeroCopy_Invalid(t *testing.T) {
+	natsMsg := nats.NewMsg("topic")
+	natsMsg.Data = []byte{0x1a, 0x10, 0x01}
+
+	_, err := (&wmpb.NATSMarshaler{ZeroCopy: true}).Unmarshal(natsMsg)
+	require.Error(t, err)
+}
+
+func TestNATSMarshaler_ZeroCopy_ReleasePayloads(t *testing.T) {
+	// released payloads would be reused while the NATS message data is still in use
+	config := jetstream.SubscriberSubscriptionConfig{
+		Unmarshaler:     &wmpb.NATSMarshaler{ZeroCopy: true},
+		ReleasePayloads: true,
+	}
+	require.ErrorContains(t, config.Validate(), "SubscriberConfig.ReleasePayloads")
+}
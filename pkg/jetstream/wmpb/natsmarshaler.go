@@ -4,10 +4,20 @@ import (
 	"github.com/ThreeDotsLabs/watermill-jetstream/pkg/jetstream"
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/proto"
 )
 
-type NATSMarshaler struct{}
+type NATSMarshaler struct {
+	// ZeroCopy makes Unmarshal use a slice of the NATS message data as payload instead of copying it,
+	// for latency-critical consumers.  The payload then shares its memory with the NATS message:
+	// it must not be modified, as features republishing the NATS message (e.g. retry tiers) would send
+	// the modified data, and retaining it keeps the whole NATS message data alive.  The payload is not owned by
+	// the consumer either, so it can not be released with SubscriberConfig.ReleasePayloads, which Validate rejects
+	// for every unmarshaler but jetstream.GobMarshaler.
+	ZeroCopy bool
+}
 
 func (*NATSMarshaler) Marshal(topic string, msg *message.Message) (*nats.Msg, error) {
 	pbMsg := &Message{
@@ -28,7 +38,11 @@ func (*NATSMarshaler) Marshal(topic string, msg *message.Message) (*nats.Msg, er
 	return natsMsg, nil
 }
 
-func (*NATSMarshaler) Unmarshal(msg *nats.Msg) (*message.Message, error) {
+func (m *NATSMarshaler) Unmarshal(msg *nats.Msg) (*message.Message, error) {
+	if m.ZeroCopy {
+		return unmarshalZeroCopy(msg.Data)
+	}
+
 	pbMsg := &Message{}
 
 	err := proto.Unmarshal(msg.Data, pbMsg)
@@ -42,3 +56,99 @@ func (*NATSMarshaler) Unmarshal(msg *nats.Msg) (*message.Message, error) {
 
 	return wmMsg, nil
 }
+
+// Message field numbers, see message.proto.
+const (
+	uuidField     protowire.Number = 1
+	metadataField protowire.Number = 2
+	payloadField  protowire.Number = 3
+
+	metadataKeyField   protowire.Number = 1
+	metadataValueField protowire.Number = 2
+)
+
+// unmarshalZeroCopy decodes a Message from its wire format, with the payload aliasing data.
+func unmarshalZeroCopy(data []byte) (*message.Message, error) {
+	var (
+		uuid    string
+		payload []byte
+	)
+	metadata := make(message.Metadata)
+
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, errors.Wrap(protowire.ParseError(n), "cannot decode message")
+		}
+		data = data[n:]
+
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return nil, errors.Wrap(protowire.ParseError(n), "cannot decode message")
+			}
+			data = data[n:]
+			continue
+		}
+
+		value, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return nil, errors.Wrap(protowire.ParseError(n), "cannot decode message")
+		}
+		data = data[n:]
+
+		switch num {
+		case uuidField:
+			uuid = string(value)
+		case metadataField:
+			key, val, err := unmarshalMetadataEntry(value)
+			if err != nil {
+				return nil, err
+			}
+			metadata[key] = val
+		case payloadField:
+			payload = value
+		}
+	}
+
+	msg := message.NewMessage(uuid, payload)
+	msg.Metadata = metadata
+
+	return msg, nil
+}
+
+func unmarshalMetadataEntry(data []byte) (string, string, error) {
+	var key, value string
+
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return "", "", errors.Wrap(protowire.ParseError(n), "cannot decode metadata")
+		}
+		data = data[n:]
+
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return "", "", errors.Wrap(protowire.ParseError(n), "cannot decode metadata")
+			}
+			data = data[n:]
+			continue
+		}
+
+		v, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return "", "", errors.Wrap(protowire.ParseError(n), "cannot decode metadata")
+		}
+		data = data[n:]
+
+		switch num {
+		case metadataKeyField:
+			key = string(v)
+		case metadataValueField:
+			value = string(v)
+		}
+	}
+
+	return key, value, nil
+}
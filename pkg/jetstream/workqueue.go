@@ -0,0 +1,130 @@
+package jetstream
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// WorkQueueConflictError is returned when subscribing to a topic whose stream has WorkQueue retention would
+// create a consumer overlapping another consumer of the stream: work queue streams deliver every message to
+// a single consumer, so their consumers must filter distinct subjects.  Subscribers sharing the messages of
+// a work queue should share a durable consumer (DurableName and QueueGroup) instead.
+type WorkQueueConflictError struct {
+	Stream string
+
+	// FilterSubject is the subject of the consumer being created.
+	FilterSubject string
+
+	// Consumer is the existing consumer it overlaps, and ConsumerFilter the subject it filters (">" when unfiltered).
+	Consumer       string
+	ConsumerFilter string
+
+	// Err is the error returned by the server, nil when the conflict was found before creating the consumer.
+	Err error
+}
+
+func (e *WorkQueueConflictError) Error() string {
+	msg := fmt.Sprintf(
+		"work queue stream %s: consumer of %s overlaps consumer %s of %s, "+
+			"work queue consumers must filter distinct subjects (share a DurableName with a QueueGroup instead)",
+		e.Stream, e.FilterSubject, e.Consumer, e.ConsumerFilter,
+	)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+
+	return msg
+}
+
+func (e *WorkQueueConflictError) Unwrap() error {
+	return e.Err
+}
+
+// isWorkQueueError reports whether err is the server rejecting a consumer of a work queue stream, e.g.
+// "filtered consumer not unique on workqueue stream".
+func isWorkQueueError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "workqueue stream")
+}
+
+// explainWorkQueueError returns a WorkQueueConflictError wrapping err when err is the server rejecting the
+// consumer of target because of an overlapping consumer, err otherwise.
+func (s *Subscriber) explainWorkQueueError(topic string, target subscriptionTarget, err error) error {
+	if !isWorkQueueError(err) {
+		return err
+	}
+
+	conflict, lookupErr := s.workQueueConflict(topic, target)
+	if lookupErr != nil || conflict == nil {
+		return err
+	}
+	conflict.Err = err
+
+	return conflict
+}
+
+// workQueueConflict returns the conflict of the consumer of target with the existing consumers of the stream
+// of topic, nil when the stream is missing, is not a work queue or has no overlapping consumer.
+func (s *Subscriber) workQueueConflict(topic string, target subscriptionTarget) (*WorkQueueConflictError, error) {
+	js := s.topicInterpreter.js
+	stream := s.topicInterpreter.streamName(topic)
+
+	info, err := js.StreamInfo(stream)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot get info of stream %s", stream)
+	}
+	if info.Config.Retention != nats.WorkQueuePolicy {
+		return nil, nil
+	}
+
+	// the durable consumer of the subscription is shared by its subscribers
+	durableName := ""
+	if s.config.DurableName != "" {
+		durableName = s.targetDurableName(topic, target)
+	}
+
+	var conflict *WorkQueueConflictError
+	for consumer := range js.ConsumersInfo(stream) {
+		if conflict != nil || consumer.Name == durableName {
+			// the channel is drained so the listing completes
+			continue
+		}
+
+		filter := consumer.Config.FilterSubject
+		if filter == "" {
+			filter = ">"
+		}
+		if subjectsOverlap(filter, target.subject) {
+			conflict = &WorkQueueConflictError{
+				Stream:         stream,
+				FilterSubject:  target.subject,
+				Consumer:       consumer.Name,
+				ConsumerFilter: filter,
+			}
+		}
+	}
+
+	return conflict, nil
+}
+
+// subjectsOverlap reports whether a subject can be matched by both a and b.
+func subjectsOverlap(a, b string) bool {
+	aTokens := strings.Split(a, ".")
+	bTokens := strings.Split(b, ".")
+
+	for i := 0; i < len(aTokens) && i < len(bTokens); i++ {
+		if aTokens[i] == ">" || bTokens[i] == ">" {
+			return true
+		}
+		if aTokens[i] != "*" && bTokens[i] != "*" && aTokens[i] != bTokens[i] {
+			return false
+		}
+	}
+
+	return len(aTokens) == len(bTokens)
+}
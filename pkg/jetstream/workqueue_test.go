@@ -0,0 +1,102 @@
+package jetstream
+
+import (
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// listingJetStream lists the consumers provisioned in provisioningJetStream.
+type listingJetStream struct {
+	*provisioningJetStream
+}
+
+func (js listingJetStream) ConsumersInfo(stream string, opts ...nats.JSOpt) <-chan *nats.ConsumerInfo {
+	infos := make(chan *nats.ConsumerInfo, len(js.consumers))
+	for name, cfg := range js.consumers {
+		infos <- &nats.ConsumerInfo{Stream: stream, Name: name, Config: *cfg}
+	}
+	close(infos)
+	return infos
+}
+
+func TestSubjectsOverlap(t *testing.T) {
+	tests := []struct {
+		a, b    string
+		overlap bool
+	}{
+		{a: "topic.*", b: "topic.*", overlap: true},
+		{a: ">", b: "topic.*", overlap: true},
+		{a: "topic.>", b: "topic.p1.*", overlap: true},
+		{a: "topic.*", b: "topic.uuid", overlap: true},
+		{a: "topic.p0.*", b: "topic.p1.*", overlap: false},
+		{a: "topic.*", b: "topic.p1.*", overlap: false},
+		{a: "other.*", b: "topic.*", overlap: false},
+	}
+
+	for _, tt := range tests {
+		require.Equal(t, tt.overlap, subjectsOverlap(tt.a, tt.b), "%s and %s", tt.a, tt.b)
+		require.Equal(t, tt.overlap, subjectsOverlap(tt.b, tt.a), "%s and %s", tt.b, tt.a)
+	}
+}
+
+func TestSubscriber_WorkQueueConflict(t *testing.T) {
+	newJetStream := func(retention nats.RetentionPolicy) listingJetStream {
+		return listingJetStream{&provisioningJetStream{
+			streams: map[string]*nats.StreamConfig{
+				"topic": {Name: "topic", Subjects: []string{"topic.>"}, Retention: retention},
+			},
+			consumers: map[string]*nats.ConsumerConfig{
+				"other":     {Durable: "other", FilterSubject: "topic.*"},
+				"partition": {Durable: "partition", FilterSubject: "topic.p1.*"},
+			},
+		}}
+	}
+	serverErr := errors.New("nats: filtered consumer not unique on workqueue stream")
+
+	s := faultySubscriber(SubscriberSubscriptionConfig{DurableName: "durable"}, clientDecorator{})
+	s.topicInterpreter = newSubscriberTopicInterpreter(newJetStream(nats.WorkQueuePolicy), s.config)
+
+	err := s.explainWorkQueueError("topic", subscriptionTarget{subject: "topic.*"}, serverErr)
+	var conflict *WorkQueueConflictError
+	require.True(t, errors.As(err, &conflict), "unexpected error: %v", err)
+	require.Equal(t, "other", conflict.Consumer)
+	require.Equal(t, "topic.*", conflict.ConsumerFilter)
+	require.True(t, errors.Is(err, serverErr), "unexpected error: %v", err)
+
+	conflict, err = s.workQueueConflict("topic", subscriptionTarget{subject: "topic.p0.*"})
+	require.NoError(t, err)
+	require.Nil(t, conflict)
+
+	// other errors are returned as is
+	otherErr := errors.New("nats: timeout")
+	require.Equal(t, otherErr, s.explainWorkQueueError("topic", subscriptionTarget{subject: "topic.*"}, otherErr))
+
+	// consumers of streams with other retentions may overlap
+	s.topicInterpreter = newSubscriberTopicInterpreter(newJetStream(nats.LimitsPolicy), s.config)
+	conflict, err = s.workQueueConflict("topic", subscriptionTarget{subject: "topic.*"})
+	require.NoError(t, err)
+	require.Nil(t, conflict)
+}
+
+func TestSubscriber_VerifyCompatibility_WorkQueue(t *testing.T) {
+	js := listingJetStream{&provisioningJetStream{
+		streams: map[string]*nats.StreamConfig{
+			"topic": {Name: "topic", Subjects: []string{"topic.*"}, Retention: nats.WorkQueuePolicy},
+		},
+		consumers: map[string]*nats.ConsumerConfig{
+			"other": {Durable: "other"},
+		},
+	}}
+
+	s := faultySubscriber(SubscriberSubscriptionConfig{VerifyCompatibility: true}, clientDecorator{})
+	s.topicInterpreter = newSubscriberTopicInterpreter(js, s.config)
+
+	err := s.verifyCompatibility("topic", subscriptionTarget{subject: "topic.*"})
+	var conflict *WorkQueueConflictError
+	require.True(t, errors.As(err, &conflict), "unexpected error: %v", err)
+	require.Equal(t, ">", conflict.ConsumerFilter)
+	require.Nil(t, conflict.Err)
+}